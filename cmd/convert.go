@@ -6,11 +6,16 @@ Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
+	"github.com/yifan-gu/blueNote/pkg/bluenote"
 	"github.com/yifan-gu/blueNote/pkg/config"
-	"github.com/yifan-gu/blueNote/pkg/exporter"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/option"
 	"github.com/yifan-gu/blueNote/pkg/parser"
 	"github.com/yifan-gu/blueNote/pkg/util"
 )
@@ -18,61 +23,114 @@ import (
 var convertConfig config.ConvertConfig
 
 var convertCmd = &cobra.Command{
-	Use:   "convert",
+	Use:   "convert [input...]",
 	Short: "Convert reading notes and clippings",
-	Run:   runConvert,
+	Long: `Convert reading notes and clippings.
+
+Each input can be a file, a directory, a glob pattern (e.g. "notes/*.html")
+or a zip archive. Use "-" or omit the inputs to read from the stdin.
+The results of all the inputs are merged before exporting.
+
+The old form "convert INPUT OUTPUT_DIR", a file then a directory, still writes
+to the directory but is deprecated, use --output-dir instead. Set --output-dir
+to read such a directory as an input.`,
+	Run: runConvert,
 }
 
 func runConvert(cmd *cobra.Command, args []string) {
-	if len(args) > 2 {
-		cmd.Help()
-		os.Exit(1)
-	}
+	ctx := context.Background()
 
 	if convertConfig.ListParsers {
-		printParsersAndExit()
+		printNamesAndExit(registry.Parsers.List())
 	}
 
 	if convertConfig.ListExporters {
-		printExportersAndExit()
+		printNamesAndExit(registry.Exporters.List())
+	}
+
+	if convertConfig.ListTransforms {
+		printNamesAndExit(registry.Transforms.List())
 	}
 
-	if len(args) != 0 {
-		convertConfig.InputPath = args[0]
-	} else {
-		if convertConfig.Parser != "json" {
+	if isLegacyOutputDir(cmd, args) {
+		util.Warn(fmt.Sprintf("Writing the output to %q, the output directory as the last argument is deprecated, please use --output-dir", args[1]))
+		convertConfig.OutputDir, args = args[1], args[:1]
+	}
+
+	convertConfig.InputPaths = args
+	if len(convertConfig.InputPaths) == 0 {
+		if util.IsTerminal(os.Stdin) {
 			cmd.Help()
 			os.Exit(1)
 		}
+		convertConfig.InputPaths = []string{parser.StdinInput}
 	}
 
-	convertConfig.OutputDir = "./"
-	if len(args) == 2 {
-		convertConfig.OutputDir = args[1]
+	// Build the transforms before reading the inputs so a typo in a spec fails fast.
+	chain, err := registry.Transforms.NewChain(convertConfig.Transforms)
+	if err != nil {
+		util.StackTraceErrorAndExit(err)
 	}
 
-	books, err := parser.GetParser(convertConfig.Parser).Parse(convertConfig.InputPath)
+	var books []*model.Book
+	var parsed, skipped int
+	err = parser.WalkSources(convertConfig.InputPaths, func(src *parser.Source) error {
+		bks, err := registry.Parse(ctx, src, convertConfig.Parser, nil)
+		if errors.Is(err, parser.ErrUndetected) && src.Expanded() {
+			// The directories, globs and archives can have other files, skip the ones that are not notes.
+			util.Warn(fmt.Sprintf("Skipped %v", err))
+			skipped++
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		parsed++
+		books = append(books, bks...)
+		return nil
+	})
 	if err != nil {
 		util.StackTraceErrorAndExit(err)
 	}
+	if parsed == 0 && skipped > 0 {
+		util.Fatal(fmt.Sprintf("No input could be parsed, %d skipped, please specify the parser with --parser", skipped))
+	}
+	books = model.MergeBooks(books)
+
+	if books, err = chain.Apply(books); err != nil {
+		util.StackTraceErrorAndExit(err)
+	}
 
-	exp := exporter.GetExporter(convertConfig.Exporter)
-	if err := exp.Export(&convertConfig, books); err != nil {
+	opts := &bluenote.ConvertOptions{OutputDir: convertConfig.OutputDir}
+	if err := registry.Export(ctx, books, convertConfig.Exporter, opts); err != nil {
 		util.StackTraceErrorAndExit(err)
 	}
 }
 
+// isLegacyOutputDir returns whether the args are in the old form of "convert INPUT OUTPUT_DIR",
+// i.e. a file then a directory without --output-dir.
+func isLegacyOutputDir(cmd *cobra.Command, args []string) bool {
+	if len(args) != 2 || cmd.Flags().Changed("output-dir") {
+		return false
+	}
+	if info, err := os.Stat(args[0]); err != nil || info.IsDir() {
+		return false
+	}
+	info, err := os.Stat(args[1])
+	return err == nil && info.IsDir()
+}
+
 func init() {
 	rootCmd.AddCommand(convertCmd)
 
 	convertCmd.PersistentFlags().BoolVar(&convertConfig.ListParsers, "list-parsers", false, "list the supported parsers")
 	convertCmd.PersistentFlags().BoolVar(&convertConfig.ListExporters, "list-exporters", false, "list the supported exporters")
-	convertCmd.PersistentFlags().StringVarP(&convertConfig.Parser, "parser", "i", config.DefaultParser, "the parser to use")
+	convertCmd.PersistentFlags().BoolVar(&convertConfig.ListTransforms, "list-transforms", false, "list the supported transforms")
+	convertCmd.PersistentFlags().StringVarP(&convertConfig.Parser, "parser", "i", config.DefaultParser, fmt.Sprintf("the parser to use, %q detects the parser from the input", parser.AutoParser))
 	convertCmd.PersistentFlags().StringVarP(&convertConfig.Exporter, "exporter", "o", config.DefaultExporter, "the exporter to use")
+	convertCmd.PersistentFlags().StringArrayVar(&convertConfig.Transforms, "transform", nil, "the transform to apply between parsing and exporting in the form of \"name[:key=value,...]\", can be repeated and applied in order")
+	convertCmd.PersistentFlags().StringVar(&convertConfig.OutputDir, "output-dir", "./", "the directory to write the output files to, used by exporters that create files")
 
-	registerParsers()
-	parser.LoadConfigs(convertCmd)
-
-	registerExporters()
-	exporter.LoadConfigs(convertCmd)
+	option.BindFlags(convertCmd.PersistentFlags(), registry.Parsers.Options())
+	option.BindFlags(convertCmd.PersistentFlags(), registry.Exporters.Options())
 }
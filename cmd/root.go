@@ -6,7 +6,11 @@ Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
 package cmd
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/yifan-gu/blueNote/pkg/config"
 	"github.com/yifan-gu/blueNote/pkg/util"
 )
@@ -14,6 +18,68 @@ import (
 var rootCmd = &cobra.Command{
 	Use:   "blueNote",
 	Short: "note organizer",
+	Long: `note organizer
+
+Flags can also be set in the config file (default "` + config.DefaultConfigFile + `")
+or with the environment variables (e.g. ` + config.EnvName("mongodb.host") + ` for --mongodb.host),
+the command line flags take precedence over the environment variables, which take
+precedence over the config file. A value can be read from a file with the "-file"
+suffixed key, e.g. ` + config.EnvName("mongodb.password-file") + `.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		unknown, err := loadConfigs(cmd)
+		if err != nil {
+			util.StackTraceErrorAndExit(err)
+		}
+		if err := setupLogger(); err != nil {
+			util.StackTraceErrorAndExit(err)
+		}
+		for _, key := range unknown {
+			util.Warn(fmt.Sprintf("Unknown key %q in the config file, it doesn't match any flag", key))
+		}
+	},
+}
+
+func setupLogger() error {
+	if err := util.SetLogFormat(config.GlobalCfg.LogFormat); err != nil {
+		return err
+	}
+	if config.GlobalCfg.Quiet {
+		config.GlobalCfg.LogLevel = "quiet"
+	}
+	return util.SetLogLevel(config.GlobalCfg.LogLevel)
+}
+
+// loadConfigs sets the flags of the command that are not given on the command line
+// from the environment variables and the config file, and returns the unknown keys of the config file.
+func loadConfigs(cmd *cobra.Command) ([]string, error) {
+	flags := cmd.Flags()
+	for _, name := range []string{"config", "profile"} {
+		if val, ok := os.LookupEnv(config.EnvName(name)); ok && !flags.Changed(name) {
+			if err := flags.Set(name, val); err != nil {
+				return nil, err
+			}
+		}
+	}
+	values, err := config.LoadFile(config.GlobalCfg.ConfigFile, config.GlobalCfg.Profile, flags.Changed("config"))
+	if err != nil {
+		return nil, err
+	}
+	// The config file is shared by the commands, so a key is only unknown if no command has the flag.
+	names := make(map[string]bool)
+	collectFlagNames(cmd.Root(), names)
+	return values.Unknown(func(name string) bool { return names[name] }), config.ApplyFlags(flags, values)
+}
+
+// collectFlagNames collects the names of the flags of the command and its subcommands.
+func collectFlagNames(cmd *cobra.Command, names map[string]bool) {
+	for _, fs := range []*pflag.FlagSet{cmd.Flags(), cmd.PersistentFlags()} {
+		fs.VisitAll(func(f *pflag.Flag) {
+			names[f.Name] = true
+		})
+	}
+	for _, sub := range cmd.Commands() {
+		collectFlagNames(sub, names)
+	}
 }
 
 func Execute() {
@@ -23,6 +89,11 @@ func Execute() {
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&config.GlobalCfg.ConfigFile, "config", config.DefaultConfigFile, "the config file to load the flags from")
+	rootCmd.PersistentFlags().StringVar(&config.GlobalCfg.LogLevel, "log-level", "info", "the log level, one of quiet, info and debug, logs are written to the stderr")
+	rootCmd.PersistentFlags().StringVar(&config.GlobalCfg.LogFormat, "log-format", util.LogFormatText, "the log format, one of text and json")
+	rootCmd.PersistentFlags().BoolVarP(&config.GlobalCfg.Quiet, "quiet", "q", false, "only log the warnings and the errors, same as --log-level=quiet")
+	rootCmd.PersistentFlags().StringVar(&config.GlobalCfg.Profile, "profile", "", "the profile in the config file to use, e.g. \"work\" for the [profiles.work] table")
 	convertCmd.PersistentFlags().BoolVarP(&config.GlobalCfg.PromptYesToAll, "yes-to-all", "y", false, "set yes to all prompt confirmation")
 	convertCmd.PersistentFlags().BoolVarP(&config.GlobalCfg.PromptNoToAll, "no-to-all", "n", false, "set no to all prompt confirmation")
 }
@@ -7,12 +7,16 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 	"github.com/yifan-gu/blueNote/pkg/config"
+	"github.com/yifan-gu/blueNote/pkg/event"
+	"github.com/yifan-gu/blueNote/pkg/search"
 	"github.com/yifan-gu/blueNote/pkg/server"
-	"github.com/yifan-gu/blueNote/pkg/storage"
 	"github.com/yifan-gu/blueNote/pkg/util"
 )
 
@@ -25,22 +29,65 @@ var serverCmd = &cobra.Command{
 }
 
 func runServer(cmd *cobra.Command, args []string) {
-	ctx := context.Background()
 	if len(args) != 0 {
 		cmd.Help()
 		os.Exit(1)
 	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	store := storage.GetStorages(storageConfig.Storage)
+	bus := event.NewBus()
+	base := getStorage(storageConfig.Storage)
+	source, isSource := base.(event.Source)
+	if serverConfig.ChangeStream && !isSource {
+		util.Fatal(fmt.Sprintf("Storage %q doesn't support the change streams", base.Name()))
+	}
+	if !serverConfig.ChangeStream {
+		base = event.NewPublishingStorage(base, bus)
+	}
+	store := search.NewIndexedStorage(base, bus)
 	if err := store.Connect(ctx); err != nil {
 		util.StackTraceErrorAndExit(err)
 	}
-	defer store.Close(ctx)
+	if serverConfig.ChangeStream {
+		go func() {
+			if err := source.Watch(ctx, bus); err != nil {
+				util.Error("Stopped watching the change stream:", err)
+			}
+		}()
+	}
 
-	server.NewServer(&serverConfig, store).Run()
+	s, err := server.NewServer(&serverConfig, store, registry, bus)
+	if err == nil {
+		err = s.Run(ctx)
+	}
+	// Close the storage before exiting, the in-flight requests are finished by now.
+	if closeErr := store.Close(context.Background()); closeErr != nil {
+		util.Error("Failed to close the storage:", closeErr)
+	}
+	if err != nil {
+		util.StackTraceErrorAndExit(err)
+	}
 }
 
 func init() {
 	rootCmd.AddCommand(serverCmd)
-	serverCmd.PersistentFlags().StringVar(&serverConfig.ListenAddr, "server.addr", "localhost:11212", "The port to listen for the server.")
+	flags := serverCmd.PersistentFlags()
+	flags.StringVar(&serverConfig.ListenAddr, "server.addr", "localhost:11212", "The port to listen for the server.")
+	flags.StringVar(&serverConfig.TLSCertFile, "server.tls-cert", "", "the TLS certificate file, serves https together with --server.tls-key")
+	flags.StringVar(&serverConfig.TLSKeyFile, "server.tls-key", "", "the TLS private key file")
+	flags.DurationVar(&serverConfig.ReadTimeout, "server.read-timeout", config.DefaultServerReadTimeout, "the timeout of reading a request, including the body")
+	flags.DurationVar(&serverConfig.WriteTimeout, "server.write-timeout", config.DefaultServerWriteTimeout, "the timeout of writing a response")
+	flags.DurationVar(&serverConfig.IdleTimeout, "server.idle-timeout", config.DefaultServerIdleTimeout, "the timeout of an idle keep-alive connection")
+	flags.DurationVar(&serverConfig.ShutdownTimeout, "server.shutdown-timeout", config.DefaultServerShutdownTimeout, "the time to wait for the in-flight requests when shutting down")
+	flags.Int64Var(&serverConfig.MaxBodySize, "server.max-body-size", config.DefaultServerMaxBodySize, "the maximum size in bytes of a request body, except the import")
+	flags.Int64Var(&serverConfig.MaxUploadSize, "server.max-upload-size", config.DefaultServerMaxUploadSize, "the maximum size in bytes of an import request")
+	flags.BoolVar(&serverConfig.GraphiQL, "server.graphiql", true, "serve the GraphiQL page at /graphql for the browsers")
+	flags.StringVar(&serverConfig.PersistedQueriesFile, "server.persisted-queries", "", "a json file of the queries that can be sent by their sha256 hashes, either an object keyed by the hashes or an array")
+	flags.BoolVar(&serverConfig.PersistedQueriesOnly, "server.persisted-queries-only", false, "only allow the persisted queries")
+	flags.BoolVar(&serverConfig.ChangeStream, "server.change-stream", false, "feed the subscriptions from the change stream of the storage (MongoDB replica sets only), which includes the changes made by other processes")
+	flags.StringArrayVar(&serverConfig.CORSOrigins, "server.cors-origin", nil, "an origin that can call the server from browsers, \"*\" allows any origin, can be repeated")
+	flags.DurationVar(&serverConfig.TrashRetention, "server.trash-retention", config.DefaultServerTrashRetention, "how long the deleted marks are kept in the trash before they are purged, 0 keeps them forever")
+	flags.StringArrayVar(&serverConfig.AuthTokens, "auth.token", nil, "a static API token in the form of \"user[:read|write]=token\", sent as \"Authorization: Bearer <token>\", can be repeated")
+	flags.StringArrayVar(&serverConfig.AuthBasicUsers, "auth.basic-user", nil, "a HTTP basic auth user in the form of \"user[:read|write]=password\", can be repeated")
 }
@@ -0,0 +1,121 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/yifan-gu/blueNote/pkg/config"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+	"github.com/yifan-gu/blueNote/pkg/util"
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Print the statistics of the marks in the storage",
+	Long: `Print the number of the marks and the average length of the highlights, in total and by the groups, e.g.
+
+  blueNote stats --group-by book --limit 10
+  blueNote stats --group-by createdAt --interval week --output json`,
+	Run: runStats,
+}
+
+var (
+	statsStorage  string
+	statsFilter   string
+	statsGroupBy  string
+	statsInterval string
+	statsLimit    int
+	statsOutput   string
+)
+
+func runStats(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	if len(args) != 0 {
+		cmd.Help()
+		os.Exit(1)
+	}
+
+	opts := &storage.AggregateOptions{Interval: statsInterval, Limit: statsLimit}
+	if statsGroupBy != "" {
+		groupBy, err := storage.ParseGroupBy(statsGroupBy)
+		if err != nil {
+			util.Fatal(err)
+		}
+		opts.GroupBy = groupBy
+	}
+	if statsOutput != "table" && statsOutput != "json" {
+		util.Fatal(fmt.Sprintf("Unrecognized output %q, expecting table or json", statsOutput))
+	}
+
+	store := getStorage(statsStorage)
+	if err := store.Connect(ctx); err != nil {
+		util.StackTraceErrorAndExit(err)
+	}
+	defer store.Close(ctx)
+
+	stats, err := storage.GetStats(ctx, store, statsFilter, opts)
+	if err != nil {
+		util.StackTraceErrorAndExit(err)
+	}
+	if statsOutput == "json" {
+		b, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			util.Fatal(err)
+		}
+		util.Output(string(b))
+		return
+	}
+	printStatsTable(stats, opts.GroupBy)
+}
+
+// printStatsTable prints the groups as a table, followed by the total.
+func printStatsTable(stats *storage.Stats, groupBy string) {
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	withBook := groupBy == storage.GroupByBook || groupBy == storage.GroupByChapter
+	if groupBy != storage.GroupByNone {
+		switch {
+		case groupBy == storage.GroupByBook:
+			fmt.Fprintln(w, "TITLE\tAUTHOR\tCOUNT\tAVG LENGTH")
+		case withBook:
+			fmt.Fprintln(w, "CHAPTER\tTITLE\tAUTHOR\tCOUNT\tAVG LENGTH")
+		default:
+			fmt.Fprintf(w, "%s\tCOUNT\tAVG LENGTH\n", groupBy)
+		}
+		for _, g := range stats.Groups {
+			switch {
+			case groupBy == storage.GroupByBook:
+				fmt.Fprintf(w, "%s\t%s\t%d\t%.1f\n", g.Title, g.Author, g.Count, g.AverageLength)
+			case withBook:
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%.1f\n", g.Key, g.Title, g.Author, g.Count, g.AverageLength)
+			default:
+				fmt.Fprintf(w, "%s\t%d\t%.1f\n", g.Key, g.Count, g.AverageLength)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "TOTAL\t%d\t%.1f\n", stats.Count, stats.AverageLength)
+	w.Flush()
+	util.Output(strings.TrimSuffix(sb.String(), "\n"))
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+	flags := statsCmd.PersistentFlags()
+	flags.StringVar(&statsStorage, "storage", config.DefaultStorage, "the storage to use")
+	flags.StringVar(&statsFilter, "filter", "{}", "the filters of the marks to count, expecting a json format (e.g. \"{\"author\":\"Maugham\"}\")")
+	flags.StringVar(&statsGroupBy, "group-by", "", "group the marks by one of book, author, tag, type, chapter and createdAt")
+	flags.StringVar(&statsInterval, "interval", storage.IntervalMonth, "the size of the buckets of createdAt, one of year, month, week and day")
+	flags.IntVar(&statsLimit, "limit", 0, "set the maximum number of groups to print, set 0 or negative to print all")
+	flags.StringVar(&statsOutput, "output", "table", "the output format, one of table and json")
+}
@@ -6,12 +6,12 @@ Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
 package cmd
 
 import (
-	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/yifan-gu/blueNote/pkg/config"
-	"github.com/yifan-gu/blueNote/pkg/storage"
+	"github.com/yifan-gu/blueNote/pkg/option"
 )
 
 var storageConfig config.StorageConfig
@@ -29,12 +29,11 @@ func runStorage(cmd *cobra.Command, args []string) {
 	}
 
 	if storageConfig.ListStorages {
-		printStoragesAndExit()
+		printNamesAndExit(registry.Storages.List())
 	}
 
 	if len(args) < 1 {
 		cmd.Help()
-		fmt.Println(len(args))
 		os.Exit(1)
 	}
 }
@@ -44,10 +43,14 @@ func init() {
 
 	storageCmd.PersistentFlags().BoolVar(&storageConfig.ListStorages, "list-storages", false, "list the supported storages")
 	storageCmd.PersistentFlags().StringVar(&storageConfig.Storage, "storage", config.DefaultStorage, "the storage to use")
+	storageCmd.PersistentFlags().BoolVarP(&config.GlobalCfg.PromptYesToAll, "yes-to-all", "y", false, "set yes to all prompt confirmation")
 	storageCmd.PersistentFlags().StringVar(&storageConfig.Filter, "filter", "", "the filters for the storage CRUD operation, expecting a json format (e.g. \"{\"_id\":\"<id>\"}\")")
 
-	registerStorages()
-
-	storage.LoadConfigs(storageCmd)
-	storage.LoadConfigs(serverCmd)
+	// The storage options are shared by the storage and the server commands.
+	storageFlags := pflag.NewFlagSet("storage", pflag.ExitOnError)
+	option.BindFlags(storageFlags, registry.Storages.Options())
+	storageCmd.PersistentFlags().AddFlagSet(storageFlags)
+	serverCmd.PersistentFlags().AddFlagSet(storageFlags)
+	statsCmd.PersistentFlags().AddFlagSet(storageFlags)
+	tagsCmd.PersistentFlags().AddFlagSet(storageFlags)
 }
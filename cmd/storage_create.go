@@ -0,0 +1,97 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/util"
+)
+
+var storageCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "create marks in the storage from the json on stdin, a mark or a list of marks",
+	Run:   runStorageCreate,
+}
+
+var storageCreateNewIDs bool
+
+// readMarks reads a mark or a list of marks in json from stdin, e.g. the output of "storage get",
+// all of them are validated before any is created, it exits on the failures. The marks with ids
+// are rejected as they would conflict with the existing ones, unless the ids are cleared by newIDs.
+func readMarks(newIDs bool) []*model.Mark {
+	b, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		util.StackTraceErrorAndExit(err)
+	}
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		util.Fatal("No marks are given on stdin")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	var marks []*model.Mark
+	if b[0] == '[' {
+		err = dec.Decode(&marks)
+	} else {
+		mark := &model.Mark{}
+		err = dec.Decode(mark)
+		marks = append(marks, mark)
+	}
+	if err != nil {
+		util.Fatal(fmt.Sprintf("Invalid json of the marks: %v", err))
+	}
+
+	var invalid bool
+	for i, mark := range marks {
+		if err := model.ValidateMark(mark); err != nil {
+			util.Error(fmt.Sprintf("Invalid mark #%d: %v", i, err))
+			invalid = true
+		}
+		switch {
+		case mark.ID == "":
+		case newIDs:
+			mark.ID = ""
+		default:
+			util.Error(fmt.Sprintf("Mark #%d has the id %q, use --new-ids to create it as a new mark", i, mark.ID))
+			invalid = true
+		}
+	}
+	if invalid {
+		os.Exit(1)
+	}
+	return marks
+}
+
+func runStorageCreate(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	marks := readMarks(storageCreateNewIDs)
+	store := connectStorage(ctx, cmd, args)
+	defer store.Close(ctx)
+
+	for _, mark := range marks {
+		id, err := store.CreateMark(ctx, mark)
+		if err != nil {
+			util.StackTraceErrorAndExit(err)
+		}
+		util.Output(id)
+	}
+	util.Log("Total created:", len(marks))
+}
+
+func init() {
+	storageCmd.AddCommand(storageCreateCmd)
+
+	storageCreateCmd.Flags().BoolVar(&storageCreateNewIDs, "new-ids", false, "clear the ids of the marks, e.g. from \"storage get\", so they are created as new marks")
+}
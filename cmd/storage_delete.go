@@ -11,13 +11,12 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
-	"github.com/yifan-gu/blueNote/pkg/storage"
 	"github.com/yifan-gu/blueNote/pkg/util"
 )
 
 var storageDelCmd = &cobra.Command{
 	Use:   "delete",
-	Short: "delete marks from the storage",
+	Short: "move marks to the trash of the storage",
 	Run:   runStorageDelete,
 }
 
@@ -28,7 +27,7 @@ func runStorageDelete(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	store := storage.GetStorages(storageConfig.Storage)
+	store := getStorage(storageConfig.Storage)
 	if err := store.Connect(ctx); err != nil {
 		util.StackTraceErrorAndExit(err)
 	}
@@ -38,11 +37,29 @@ func runStorageDelete(cmd *cobra.Command, args []string) {
 		util.Fatal("Missing parameters for --filter")
 	}
 
-	cnt, err := store.DeleteMarks(ctx, storageConfig.Filter)
+	cnt, err := store.CountMarks(ctx, storageConfig.Filter)
 	if err != nil {
 		util.StackTraceErrorAndExit(err)
 	}
-	fmt.Println("Total deleted:", cnt)
+	if cnt > 0 && !confirm(fmt.Sprintf("%d marks match the filter, move them to the trash?", cnt)) {
+		return
+	}
+	if cnt, err = store.DeleteMarks(ctx, storageConfig.Filter); err != nil {
+		util.StackTraceErrorAndExit(err)
+	}
+	util.Log("Total deleted:", cnt)
+}
+
+// confirm prompts for the confirmation, it exits on the failures of reading the response.
+func confirm(prompt string) bool {
+	ok, err := util.PromptExportOverrideConfirmation(prompt)
+	if err != nil {
+		util.StackTraceErrorAndExit(err)
+	}
+	if !ok {
+		util.Log("Canceled")
+	}
+	return ok
 }
 
 func init() {
@@ -8,7 +8,6 @@ package cmd
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -22,7 +21,11 @@ var storageGetCmd = &cobra.Command{
 	Run:   runStorageGet,
 }
 
-var storageGetLimit int
+var (
+	storageGetLimit int
+	storageGetSkip  int
+	storageGetSort  []string
+)
 
 func runStorageGet(cmd *cobra.Command, args []string) {
 	ctx := context.Background()
@@ -31,7 +34,7 @@ func runStorageGet(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	store := storage.GetStorages(storageConfig.Storage)
+	store := getStorage(storageConfig.Storage)
 	if err := store.Connect(ctx); err != nil {
 		util.StackTraceErrorAndExit(err)
 	}
@@ -41,7 +44,16 @@ func runStorageGet(cmd *cobra.Command, args []string) {
 		util.Fatal("Missing parameters for --filter")
 	}
 
-	marks, err := store.GetMarks(ctx, storageConfig.Filter, storageGetLimit)
+	opts := &storage.QueryOptions{Limit: storageGetLimit, Skip: storageGetSkip}
+	for _, spec := range storageGetSort {
+		sort, err := storage.ParseSort(spec)
+		if err != nil {
+			util.StackTraceErrorAndExit(err)
+		}
+		opts.Sort = append(opts.Sort, sort)
+	}
+
+	marks, err := store.GetMarks(ctx, storageConfig.Filter, opts)
 	if err != nil {
 		util.StackTraceErrorAndExit(err)
 	}
@@ -49,10 +61,12 @@ func runStorageGet(cmd *cobra.Command, args []string) {
 	if err != nil {
 		util.Fatal(err)
 	}
-	fmt.Println(string(b))
+	util.Output(string(b))
 }
 
 func init() {
 	storageCmd.AddCommand(storageGetCmd)
 	storageGetCmd.PersistentFlags().IntVar(&storageGetLimit, "limit", 0, "set the maximum number of marks to return, set 0 or negative to return all")
+	storageGetCmd.PersistentFlags().IntVar(&storageGetSkip, "skip", 0, "set the number of marks to skip")
+	storageGetCmd.PersistentFlags().StringSliceVar(&storageGetSort, "sort", nil, "sort the marks by the fields in order, one of createdAt, lastModifiedAt, title, location, prefix with \"-\" for the descending order (e.g. \"-createdAt\")")
 }
@@ -0,0 +1,134 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+	"github.com/yifan-gu/blueNote/pkg/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var storageTrashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "list the deleted marks in the trash of the storage",
+	Run:   runStorageTrash,
+}
+
+var storageRestoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "restore the marks from the trash of the storage",
+	Run:   runStorageRestore,
+}
+
+var storagePurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "permanently delete the marks in the trash of the storage",
+	Run:   runStoragePurge,
+}
+
+var (
+	storageTrashLimit     int
+	storageTrashSkip      int
+	storagePurgeOlderThan time.Duration
+)
+
+// connectStorage connects the storage of the storage command, it exits on the failures.
+func connectStorage(ctx context.Context, cmd *cobra.Command, args []string) storage.Storage {
+	if len(args) != 0 {
+		cmd.Help()
+		os.Exit(1)
+	}
+	store := getStorage(storageConfig.Storage)
+	if err := store.Connect(ctx); err != nil {
+		util.StackTraceErrorAndExit(err)
+	}
+	return store
+}
+
+// trashFilter parses the filter of the marks in the trash, an empty filter matches all of them.
+func trashFilter() bson.M {
+	filter := bson.M{}
+	if storageConfig.Filter == "" {
+		return filter
+	}
+	if err := json.Unmarshal([]byte(storageConfig.Filter), &filter); err != nil {
+		util.Fatal(fmt.Sprintf("Invalid --filter %q: %v", storageConfig.Filter, err))
+	}
+	return filter
+}
+
+func runStorageTrash(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	store := connectStorage(ctx, cmd, args)
+	defer store.Close(ctx)
+
+	marks, err := store.GetDeletedMarks(ctx, trashFilter(), &storage.QueryOptions{Limit: storageTrashLimit, Skip: storageTrashSkip})
+	if err != nil {
+		util.StackTraceErrorAndExit(err)
+	}
+	b, err := json.MarshalIndent(marks, "", "  ")
+	if err != nil {
+		util.Fatal(err)
+	}
+	util.Output(string(b))
+}
+
+func runStorageRestore(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	if storageConfig.Filter == "" {
+		util.Fatal("Missing parameters for --filter")
+	}
+	store := connectStorage(ctx, cmd, args)
+	defer store.Close(ctx)
+
+	ids, err := store.RestoreMarks(ctx, trashFilter())
+	if err != nil {
+		util.StackTraceErrorAndExit(err)
+	}
+	for _, id := range ids {
+		util.Output(id)
+	}
+	util.Log("Total restored:", len(ids))
+}
+
+func runStoragePurge(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	store := connectStorage(ctx, cmd, args)
+	defer store.Close(ctx)
+
+	filter := trashFilter()
+	if storagePurgeOlderThan > 0 {
+		for key, val := range storage.DeletedBefore(util.NowUnixMilli() - storagePurgeOlderThan.Milliseconds()) {
+			filter[key] = val
+		}
+	}
+	marks, err := store.GetDeletedMarks(ctx, filter, nil)
+	if err != nil {
+		util.StackTraceErrorAndExit(err)
+	}
+	if len(marks) > 0 && !confirm(fmt.Sprintf("%d marks in the trash match the filter, delete them permanently?", len(marks))) {
+		return
+	}
+	cnt, err := store.PurgeMarks(ctx, filter)
+	if err != nil {
+		util.StackTraceErrorAndExit(err)
+	}
+	util.Log("Total purged:", cnt)
+}
+
+func init() {
+	storageCmd.AddCommand(storageTrashCmd, storageRestoreCmd, storagePurgeCmd)
+	storageTrashCmd.Flags().IntVar(&storageTrashLimit, "limit", 0, "set the maximum number of marks to return, set 0 or negative to return all")
+	storageTrashCmd.Flags().IntVar(&storageTrashSkip, "skip", 0, "set the number of marks to skip")
+	storagePurgeCmd.Flags().DurationVar(&storagePurgeOlderThan, "older-than", 0, "only purge the marks that have been in the trash for longer than the duration (e.g. \"720h\")")
+}
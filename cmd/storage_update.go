@@ -0,0 +1,144 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/tag"
+	"github.com/yifan-gu/blueNote/pkg/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var storageUpdateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "update the marks in the storage",
+	Run:   runStorageUpdate,
+}
+
+var (
+	storageUpdateSet        []string
+	storageUpdateClear      []string
+	storageUpdateAddTags    []string
+	storageUpdateRemoveTags []string
+)
+
+// updatePatch constructs the patch of the --set and --clear flags.
+func updatePatch() *model.MarkPatch {
+	patch := &model.MarkPatch{Mark: &model.Mark{}}
+	for _, kv := range storageUpdateSet {
+		tuples := strings.SplitN(kv, "=", 2)
+		if len(tuples) != 2 {
+			util.Fatal(fmt.Sprintf("Invalid --set %q, expecting \"field=value\"", kv))
+		}
+		if err := patch.SetString(tuples[0], tuples[1]); err != nil {
+			util.Fatal(fmt.Sprintf("Invalid --set %q: %v", kv, err))
+		}
+	}
+	for _, field := range storageUpdateClear {
+		if patch.Has(field) {
+			util.Fatal(fmt.Sprintf("Field %q can't be both set and cleared", field))
+		}
+		patch.Clear(field)
+	}
+	if err := patch.Validate(); err != nil {
+		util.Fatal(err)
+	}
+	return patch
+}
+
+// normalizeTags normalizes the tags of the flag, it exits on the empty ones.
+func normalizeTags(flag string, tags []string) []string {
+	var ret []string
+	for _, t := range tags {
+		normalized := tag.Normalize(t)
+		if normalized == "" {
+			util.Fatal(fmt.Sprintf("Invalid --%s %q", flag, t))
+		}
+		ret = append(ret, normalized)
+	}
+	return ret
+}
+
+// withTags returns a copy of the patch that also sets the tags.
+func withTags(patch *model.MarkPatch, tags []string) *model.MarkPatch {
+	mark := *patch.Mark
+	mark.Tags = tags
+	ret := &model.MarkPatch{Mark: &mark, Fields: append([]string{}, patch.Fields...)}
+	ret.Set("tags")
+	return ret
+}
+
+func runStorageUpdate(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	if storageConfig.Filter == "" {
+		util.Fatal("Missing parameters for --filter")
+	}
+	patch := updatePatch()
+	added := normalizeTags("add-tag", storageUpdateAddTags)
+	removed := normalizeTags("remove-tag", storageUpdateRemoveTags)
+	editTags := len(added) > 0 || len(removed) > 0
+	if len(patch.Fields) == 0 && !editTags {
+		util.Fatal("Nothing to update, expecting --set, --clear, --add-tag or --remove-tag")
+	}
+	if editTags && patch.Has("tags") {
+		util.Fatal("The tags can't be set or cleared together with --add-tag or --remove-tag")
+	}
+
+	store := connectStorage(ctx, cmd, args)
+	defer store.Close(ctx)
+
+	cnt, err := store.CountMarks(ctx, storageConfig.Filter)
+	if err != nil {
+		util.StackTraceErrorAndExit(err)
+	}
+	if cnt > 0 && !confirm(fmt.Sprintf("%d marks match the filter, update them?", cnt)) {
+		return
+	}
+
+	var ids []string
+	if !editTags {
+		if ids, err = store.UpdateMarks(ctx, storageConfig.Filter, patch); err != nil {
+			util.StackTraceErrorAndExit(err)
+		}
+	} else {
+		// The tags are different for each mark, so the marks are updated one by one.
+		marks, err := store.GetMarks(ctx, storageConfig.Filter, nil)
+		if err != nil {
+			util.StackTraceErrorAndExit(err)
+		}
+		for _, mark := range marks {
+			markPatch := patch
+			if tags := tag.Remove(util.MergeStrings(mark.Tags, added), removed); !util.StringSlicesEqual(tags, mark.Tags) {
+				markPatch = withTags(patch, tags)
+			}
+			if len(markPatch.Fields) == 0 {
+				continue
+			}
+			updated, err := store.UpdateMarks(ctx, bson.M{"_id": mark.ID}, markPatch)
+			if err != nil {
+				util.StackTraceErrorAndExit(err)
+			}
+			ids = append(ids, updated...)
+		}
+	}
+	for _, id := range ids {
+		util.Output(id)
+	}
+	util.Log("Total updated:", len(ids))
+}
+
+func init() {
+	storageCmd.AddCommand(storageUpdateCmd)
+	storageUpdateCmd.Flags().StringArrayVar(&storageUpdateSet, "set", nil, fmt.Sprintf("set a field in the form of \"field=value\", an empty value clears the field, the field is one of %s, can be repeated", strings.Join(model.MarkFields, ", ")))
+	storageUpdateCmd.Flags().StringSliceVar(&storageUpdateClear, "clear", nil, "the fields to clear (e.g. \"note,location.page\")")
+	storageUpdateCmd.Flags().StringSliceVar(&storageUpdateAddTags, "add-tag", nil, "the tags to add to the marks, can be repeated")
+	storageUpdateCmd.Flags().StringSliceVar(&storageUpdateRemoveTags, "remove-tag", nil, "the tags to remove from the marks together with their descendants, can be repeated")
+}
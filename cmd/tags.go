@@ -0,0 +1,220 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/yifan-gu/blueNote/pkg/config"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+	"github.com/yifan-gu/blueNote/pkg/tag"
+	"github.com/yifan-gu/blueNote/pkg/transform"
+	"github.com/yifan-gu/blueNote/pkg/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var tagsCmd = &cobra.Command{
+	Use:   "tags",
+	Short: "Manage the tags of the marks in the storage",
+	Long: `Manage the tags of the marks in the storage, the tags are hierarchical with the levels
+separated by "/", e.g. "philosophy/stoicism" is under "philosophy", and the operations on a tag
+apply to its descendants too.`,
+}
+
+var tagsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the tags with the numbers of their marks",
+	Run:   runTagsList,
+}
+
+var tagsRenameCmd = &cobra.Command{
+	Use:   "rename <from> <to>",
+	Short: "Rename a tag and its descendants on all the marks",
+	Args:  cobra.ExactArgs(2),
+	Run:   runTagsRename,
+}
+
+var tagsMergeCmd = &cobra.Command{
+	Use:   "merge <tag>... --into <to>",
+	Short: "Merge the tags and their descendants into one tag on all the marks",
+	Args:  cobra.MinimumNArgs(1),
+	Run:   runTagsMerge,
+}
+
+var tagsDeleteCmd = &cobra.Command{
+	Use:   "delete <tag>...",
+	Short: "Delete the tags and their descendants from all the marks",
+	Args:  cobra.MinimumNArgs(1),
+	Run:   runTagsDelete,
+}
+
+var tagsApplyRulesCmd = &cobra.Command{
+	Use:   "apply-rules --rules <file>",
+	Short: "Apply the auto-tagging rules to the marks in the storage",
+	Long: `Apply the auto-tagging rules to the marks in the storage that match the filter, the rules
+are the same as the ones of the auto-tag transform, see the README for the format of the rules file.`,
+	Run: runTagsApplyRules,
+}
+
+var (
+	tagsStorage string
+	tagsFilter  string
+	tagsUnder   string
+	tagsOutput  string
+	tagsInto    string
+	tagsDryRun  bool
+	tagsRules   string
+)
+
+func connectTagsStorage(ctx context.Context) storage.Storage {
+	store := getStorage(tagsStorage)
+	if err := store.Connect(ctx); err != nil {
+		util.StackTraceErrorAndExit(err)
+	}
+	return store
+}
+
+func runTagsList(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	if len(args) != 0 {
+		cmd.Help()
+		os.Exit(1)
+	}
+	if tagsOutput != "table" && tagsOutput != "json" {
+		util.Fatal(fmt.Sprintf("Unrecognized output %q, expecting table or json", tagsOutput))
+	}
+	filter := bson.M{}
+	if err := json.Unmarshal([]byte(tagsFilter), &filter); err != nil {
+		util.Fatal(fmt.Sprintf("Invalid --filter %q: %v", tagsFilter, err))
+	}
+
+	store := connectTagsStorage(ctx)
+	defer store.Close(ctx)
+
+	counts, err := tag.List(ctx, store, filter, tagsUnder)
+	if err != nil {
+		util.StackTraceErrorAndExit(err)
+	}
+	if tagsOutput == "json" {
+		if counts == nil {
+			counts = []*tag.Count{}
+		}
+		b, err := json.MarshalIndent(counts, "", "  ")
+		if err != nil {
+			util.Fatal(err)
+		}
+		util.Output(string(b))
+		return
+	}
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TAG\tCOUNT\tTOTAL")
+	for _, c := range counts {
+		// Indent the descendants under their ancestors.
+		depth := strings.Count(c.Name, tag.Separator)
+		fmt.Fprintf(w, "%s%s\t%d\t%d\n", strings.Repeat("  ", depth), c.Name, c.Count, c.Total)
+	}
+	w.Flush()
+	util.Output(strings.TrimSuffix(sb.String(), "\n"))
+}
+
+func runTagsRename(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	store := connectTagsStorage(ctx)
+	defer store.Close(ctx)
+	marks, err := tag.Rename(ctx, store, args[0], args[1], tagsDryRun)
+	printChangedMarks(marks, err)
+}
+
+func runTagsMerge(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	if tagsInto == "" {
+		util.Fatal("Missing parameters for --into")
+	}
+	store := connectTagsStorage(ctx)
+	defer store.Close(ctx)
+	marks, err := tag.Merge(ctx, store, args, tagsInto, tagsDryRun)
+	printChangedMarks(marks, err)
+}
+
+func runTagsDelete(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	store := connectTagsStorage(ctx)
+	defer store.Close(ctx)
+	marks, err := tag.Delete(ctx, store, args, tagsDryRun)
+	printChangedMarks(marks, err)
+}
+
+func runTagsApplyRules(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	if len(args) != 0 {
+		cmd.Help()
+		os.Exit(1)
+	}
+	if tagsRules == "" {
+		util.Fatal("Missing parameters for --rules")
+	}
+	rules, err := transform.LoadRules(tagsRules)
+	if err != nil {
+		util.StackTraceErrorAndExit(err)
+	}
+	filter := bson.M{}
+	if err := json.Unmarshal([]byte(tagsFilter), &filter); err != nil {
+		util.Fatal(fmt.Sprintf("Invalid --filter %q: %v", tagsFilter, err))
+	}
+
+	store := connectTagsStorage(ctx)
+	defer store.Close(ctx)
+
+	changes, err := rules.ApplyToStorage(ctx, store, filter, tagsDryRun)
+	if err != nil {
+		util.StackTraceErrorAndExit(err)
+	}
+	for _, change := range changes {
+		util.Output(fmt.Sprintf("%s\t%s\trules %v\tadded %v", change.Mark.ID, change.Mark.Title, change.Rules, change.AddedTags))
+	}
+	printTotal(len(changes))
+}
+
+// printChangedMarks prints the marks changed by a tag operation with their new tags.
+func printChangedMarks(marks []*model.Mark, err error) {
+	if err != nil {
+		util.StackTraceErrorAndExit(err)
+	}
+	for _, mark := range marks {
+		util.Output(fmt.Sprintf("%s\t%s\t%v", mark.ID, mark.Title, mark.Tags))
+	}
+	printTotal(len(marks))
+}
+
+func printTotal(n int) {
+	if tagsDryRun {
+		util.Log("Total to update (dry run):", n)
+		return
+	}
+	util.Log("Total updated:", n)
+}
+
+func init() {
+	rootCmd.AddCommand(tagsCmd)
+	tagsCmd.AddCommand(tagsListCmd, tagsRenameCmd, tagsMergeCmd, tagsDeleteCmd, tagsApplyRulesCmd)
+
+	tagsCmd.PersistentFlags().StringVar(&tagsStorage, "storage", config.DefaultStorage, "the storage to use")
+	tagsCmd.PersistentFlags().BoolVar(&tagsDryRun, "dry-run", false, "print the marks to update without updating them")
+	tagsListCmd.Flags().StringVar(&tagsFilter, "filter", "{}", "the filters of the marks to count the tags of, expecting a json format (e.g. \"{\"author\":\"Maugham\"}\")")
+	tagsListCmd.Flags().StringVar(&tagsUnder, "under", "", "only list the tag and its descendants")
+	tagsListCmd.Flags().StringVar(&tagsOutput, "output", "table", "the output format, one of table and json")
+	tagsMergeCmd.Flags().StringVar(&tagsInto, "into", "", "the tag to merge into")
+	tagsApplyRulesCmd.Flags().StringVar(&tagsRules, "rules", "", "the path of the rules file")
+	tagsApplyRulesCmd.Flags().StringVar(&tagsFilter, "filter", "{}", "the filters of the marks to apply the rules to, expecting a json format (e.g. \"{\"author\":\"Maugham\"}\")")
+}
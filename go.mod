@@ -3,11 +3,13 @@ module github.com/yifan-gu/blueNote
 go 1.17
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/google/uuid v1.1.2
 	github.com/graphql-go/graphql v0.8.0
 	github.com/mattn/go-sqlite3 v1.14.11
 	github.com/pkg/errors v0.9.1
 	github.com/spf13/cobra v1.3.0
+	github.com/spf13/pflag v1.0.5
 	github.com/stretchr/testify v1.7.0
 	go.mongodb.org/mongo-driver v1.10.1
 	golang.org/x/net v0.0.0-20211112202133-69e39bad7dc2
@@ -20,7 +22,6 @@ require (
 	github.com/klauspost/compress v1.13.6 // indirect
 	github.com/montanaflynn/stats v0.0.0-20171201202039-1bf9dbcd8cbe // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
 	github.com/xdg-go/scram v1.1.1 // indirect
 	github.com/xdg-go/stringprep v1.0.3 // indirect
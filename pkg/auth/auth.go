@@ -0,0 +1,146 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+// Package auth authenticates the requests to the server and carries the users in the contexts.
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Scope is what a user is allowed to do.
+type Scope string
+
+const (
+	// ScopeRead allows reading the marks.
+	ScopeRead Scope = "read"
+	// ScopeWrite allows reading, creating, updating and deleting the marks.
+	ScopeWrite Scope = "write"
+)
+
+// ParseScope parses a scope name, which is case-insensitive.
+func ParseScope(name string) (Scope, error) {
+	switch scope := Scope(strings.ToLower(name)); scope {
+	case ScopeRead, ScopeWrite:
+		return scope, nil
+	default:
+		return "", errors.New(fmt.Sprintf("unrecognized scope %q, expecting %q or %q", name, ScopeRead, ScopeWrite))
+	}
+}
+
+// User is an authenticated user, the ID is the owner of the marks created by the user.
+type User struct {
+	ID    string
+	Scope Scope
+}
+
+// Allows returns whether the user has the scope, the write scope includes the read scope.
+func (u *User) Allows(scope Scope) bool {
+	return u.Scope == ScopeWrite || u.Scope == scope
+}
+
+// ErrNoCredentials is returned by an Authenticator if the request has no credentials for it.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authenticator authenticates the requests.
+type Authenticator interface {
+	// Authenticate returns the user of the request, or ErrNoCredentials if the request
+	// doesn't carry the credentials of the authenticator.
+	Authenticate(r *http.Request) (*User, error)
+	// Challenge is the value of the WWW-Authenticate header of the unauthorized responses.
+	Challenge() string
+}
+
+// Chain tries the authenticators in order until one of them finds the credentials.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(r *http.Request) (*User, error) {
+	for _, a := range c {
+		user, err := a.Authenticate(r)
+		if err == ErrNoCredentials {
+			continue
+		}
+		return user, err
+	}
+	return nil, ErrNoCredentials
+}
+
+func (c Chain) Challenge() string {
+	var challenges []string
+	for _, a := range c {
+		challenges = append(challenges, a.Challenge())
+	}
+	return strings.Join(challenges, ", ")
+}
+
+// parseSpec parses a credential in the form of "user[:scope]=secret", the scope defaults to write.
+func parseSpec(spec string) (*User, string, error) {
+	kv := strings.SplitN(spec, "=", 2)
+	if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+		return nil, "", errors.New(fmt.Sprintf("invalid credential %q, expecting \"user[:scope]=secret\"", redact(spec)))
+	}
+	user := &User{ID: kv[0], Scope: ScopeWrite}
+	if i := strings.LastIndex(kv[0], ":"); i >= 0 {
+		scope, err := ParseScope(kv[0][i+1:])
+		if err != nil {
+			return nil, "", errors.Wrap(err, fmt.Sprintf("invalid credential of user %q", kv[0][:i]))
+		}
+		user.ID, user.Scope = kv[0][:i], scope
+	}
+	if user.ID == "" {
+		return nil, "", errors.New(fmt.Sprintf("invalid credential %q, the user is empty", redact(spec)))
+	}
+	return user, kv[1], nil
+}
+
+// redact hides the secret of a credential in the error messages.
+func redact(spec string) string {
+	if i := strings.Index(spec, "="); i >= 0 {
+		return spec[:i+1] + "***"
+	}
+	return spec
+}
+
+// New creates the authenticator of the static tokens and the basic auth users, both in the form of
+// "user[:scope]=secret". It returns nil if neither is given, which disables the authentication.
+func New(tokens, basicUsers []string) (Authenticator, error) {
+	var chain Chain
+	if len(tokens) > 0 {
+		a, err := NewTokenAuthenticator(tokens)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, a)
+	}
+	if len(basicUsers) > 0 {
+		a, err := NewBasicAuthenticator(basicUsers)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, a)
+	}
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	return chain, nil
+}
+
+type contextKey struct{}
+
+// WithUser returns a copy of the context that carries the user.
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// UserFromContext returns the user carried by the context, or nil.
+func UserFromContext(ctx context.Context) *User {
+	user, _ := ctx.Value(contextKey{}).(*User)
+	return user
+}
@@ -0,0 +1,84 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		tokens  []string
+		users   []string
+		nilAuth bool
+		err     bool
+	}{
+		{nilAuth: true},
+		{tokens: []string{"alice=t1", "bob:read=t2"}},
+		{users: []string{"alice:WRITE=p=w"}},
+		{tokens: []string{"alice"}, err: true},
+		{tokens: []string{"=t1"}, err: true},
+		{tokens: []string{":read=t1"}, err: true},
+		{tokens: []string{"alice:admin=t1"}, err: true},
+		{tokens: []string{"alice=t1", "bob=t1"}, err: true},
+		{users: []string{"alice=p1", "alice:read=p2"}, err: true},
+	}
+	for i, tt := range tests {
+		a, err := New(tt.tokens, tt.users)
+		if tt.err {
+			assert.Error(t, err, "case #%d", i)
+			continue
+		}
+		assert.NoError(t, err, "case #%d", i)
+		assert.Equal(t, tt.nilAuth, a == nil, "case #%d", i)
+	}
+
+	// The secrets are not leaked in the errors.
+	_, err := New([]string{"alice:admin=secret"}, nil)
+	assert.NotContains(t, err.Error(), "secret")
+}
+
+func TestAuthenticate(t *testing.T) {
+	a, err := New([]string{"alice=t1", "bob:read=t2"}, []string{"carol:read=p=w"})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		setup func(r *http.Request)
+		user  *User
+		err   error
+	}{
+		{setup: func(r *http.Request) {}, err: ErrNoCredentials},
+		{setup: func(r *http.Request) { r.Header.Set("Authorization", "Bearer t1") }, user: &User{ID: "alice", Scope: ScopeWrite}},
+		{setup: func(r *http.Request) { r.Header.Set("Authorization", "bearer t2") }, user: &User{ID: "bob", Scope: ScopeRead}},
+		{setup: func(r *http.Request) { r.Header.Set("Authorization", "Bearer t3") }},
+		{setup: func(r *http.Request) { r.SetBasicAuth("carol", "p=w") }, user: &User{ID: "carol", Scope: ScopeRead}},
+		{setup: func(r *http.Request) { r.SetBasicAuth("carol", "p") }},
+		{setup: func(r *http.Request) { r.SetBasicAuth("dave", "p=w") }},
+	}
+	for i, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		tt.setup(r)
+		user, err := a.Authenticate(r)
+		assert.Equal(t, tt.user, user, "case #%d", i)
+		switch {
+		case tt.err != nil:
+			assert.Equal(t, tt.err, err, "case #%d", i)
+		case tt.user == nil:
+			assert.Error(t, err, "case #%d", i)
+			assert.NotEqual(t, ErrNoCredentials, err, "case #%d", i)
+		default:
+			assert.NoError(t, err, "case #%d", i)
+		}
+	}
+	assert.Equal(t, `Bearer realm="blueNote", Basic realm="blueNote"`, a.Challenge())
+
+	assert.True(t, (&User{Scope: ScopeWrite}).Allows(ScopeRead))
+	assert.False(t, (&User{Scope: ScopeRead}).Allows(ScopeWrite))
+}
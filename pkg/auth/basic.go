@@ -0,0 +1,62 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+type basicUser struct {
+	user     *User
+	password [sha256.Size]byte
+}
+
+// BasicAuthenticator authenticates the requests with HTTP basic auth.
+type BasicAuthenticator struct {
+	users map[string]*basicUser
+}
+
+// NewBasicAuthenticator creates the authenticator of the users in the form of "user[:scope]=password".
+func NewBasicAuthenticator(specs []string) (*BasicAuthenticator, error) {
+	a := &BasicAuthenticator{users: make(map[string]*basicUser)}
+	for _, spec := range specs {
+		user, password, err := parseSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := a.users[user.ID]; ok {
+			return nil, errors.New("duplicated basic auth user " + user.ID)
+		}
+		a.users[user.ID] = &basicUser{user: user, password: sha256.Sum256([]byte(password))}
+	}
+	return a, nil
+}
+
+func (a *BasicAuthenticator) Authenticate(r *http.Request) (*User, error) {
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	hashed := sha256.Sum256([]byte(password))
+	u, found := a.users[name]
+	if !found {
+		// Compare anyway so the unknown users take the same time.
+		subtle.ConstantTimeCompare(hashed[:], hashed[:])
+		return nil, errors.New("invalid user or password")
+	}
+	if subtle.ConstantTimeCompare(hashed[:], u.password[:]) != 1 {
+		return nil, errors.New("invalid user or password")
+	}
+	return u.user, nil
+}
+
+func (a *BasicAuthenticator) Challenge() string {
+	return `Basic realm="blueNote"`
+}
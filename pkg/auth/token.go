@@ -0,0 +1,58 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// TokenAuthenticator authenticates the requests with static API tokens in the
+// "Authorization: Bearer <token>" header.
+type TokenAuthenticator struct {
+	// users are keyed by the sha256 of the tokens, so the lookups take the same time.
+	users map[[sha256.Size]byte]*User
+}
+
+// NewTokenAuthenticator creates the authenticator of the tokens in the form of "user[:scope]=token".
+func NewTokenAuthenticator(specs []string) (*TokenAuthenticator, error) {
+	a := &TokenAuthenticator{users: make(map[[sha256.Size]byte]*User)}
+	for _, spec := range specs {
+		user, token, err := parseSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		key := sha256.Sum256([]byte(token))
+		if _, ok := a.users[key]; ok {
+			return nil, errors.New("duplicated token of user " + user.ID)
+		}
+		a.users[key] = user
+	}
+	return a, nil
+}
+
+func (a *TokenAuthenticator) Authenticate(r *http.Request) (*User, error) {
+	header := r.Header.Get("Authorization")
+	const prefix = "bearer "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return nil, ErrNoCredentials
+	}
+	key := sha256.Sum256([]byte(strings.TrimSpace(header[len(prefix):])))
+	for k, user := range a.users {
+		if subtle.ConstantTimeCompare(k[:], key[:]) == 1 {
+			return user, nil
+		}
+	}
+	return nil, errors.New("invalid token")
+}
+
+func (a *TokenAuthenticator) Challenge() string {
+	return `Bearer realm="blueNote"`
+}
@@ -0,0 +1,140 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package bluenote
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/yifan-gu/blueNote/pkg/config"
+	"github.com/yifan-gu/blueNote/pkg/exporter"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/parser"
+	"github.com/yifan-gu/blueNote/pkg/util"
+)
+
+// ConvertOptions are the options of the conversion pipeline.
+type ConvertOptions struct {
+	// Transforms are the specs of the transforms applied in order between parsing and exporting,
+	// e.g. "drop-bookmarks" or "override:author=foo".
+	Transforms []string
+	// OutputDir is the directory for the exporters that write files.
+	OutputDir string
+	// Output is where the exporters write to, it defaults to the stdout and the files under OutputDir.
+	Output exporter.Output
+	// ParserOptions and ExporterOptions are the option values keyed by the option names,
+	// e.g. "json.pretty": "true". If they are set, new instances of the parser and the exporter
+	// are created with the options, the registered ones are left untouched.
+	ParserOptions   map[string]string
+	ExporterOptions map[string]string
+}
+
+// Parse parses the source with the parser, parser.AutoParser detects the parser from the source.
+func (r *Registry) Parse(ctx context.Context, src *parser.Source, parserName string, opts *ConvertOptions) ([]*model.Book, error) {
+	books, _, err := r.parse(ctx, src, parserName, opts)
+	return books, err
+}
+
+// parse parses the source and returns the name of the parser that is used.
+func (r *Registry) parse(ctx context.Context, src *parser.Source, parserName string, opts *ConvertOptions) ([]*model.Book, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", errors.Wrap(err, fmt.Sprintf("failed to parse %q", src.Name()))
+	}
+	if opts == nil {
+		opts = &ConvertOptions{}
+	}
+	if parserName == parser.AutoParser {
+		candidate, err := r.Parsers.Detect(src)
+		if err != nil {
+			return nil, "", err
+		}
+		util.LogFields(fmt.Sprintf("Detected parser %q for %q", candidate.Parser.Name(), src.Name()), util.Fields{"confidence": fmt.Sprintf("%.2f", candidate.Confidence)})
+		parserName = candidate.Parser.Name()
+	}
+	var p parser.Parser
+	var err error
+	if len(opts.ParserOptions) > 0 {
+		p, err = r.Parsers.New(parserName, opts.ParserOptions)
+	} else {
+		p, err = r.Parsers.Get(parserName)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	books, err := p.Parse(src)
+	if err != nil {
+		return nil, "", errors.Wrap(err, fmt.Sprintf("failed to parse %q", src.Name()))
+	}
+	return books, parserName, nil
+}
+
+// Transform applies the transforms to the books in order.
+func (r *Registry) Transform(ctx context.Context, books []*model.Book, specs []string) ([]*model.Book, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to transform the books")
+	}
+	chain, err := r.Transforms.NewChain(specs)
+	if err != nil {
+		return nil, err
+	}
+	return chain.Apply(books)
+}
+
+// Export exports the books with the exporter.
+func (r *Registry) Export(ctx context.Context, books []*model.Book, exporterName string, opts *ConvertOptions) error {
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to export the books with %q", exporterName))
+	}
+	if opts == nil {
+		opts = &ConvertOptions{}
+	}
+	var exp exporter.Exporter
+	var err error
+	if len(opts.ExporterOptions) > 0 {
+		exp, err = r.Exporters.New(exporterName, opts.ExporterOptions)
+	} else {
+		exp, err = r.Exporters.Get(exporterName)
+	}
+	if err != nil {
+		return err
+	}
+	out := opts.Output
+	if out == nil {
+		out = exporter.NewDirOutput(opts.OutputDir, os.Stdout)
+	}
+	return exp.Export(&config.ConvertConfig{OutputDir: opts.OutputDir}, out, books)
+}
+
+// Convert runs the source through the parser, the transforms and the exporter.
+func (r *Registry) Convert(ctx context.Context, src *parser.Source, parserName, exporterName string, opts *ConvertOptions) error {
+	if opts == nil {
+		opts = &ConvertOptions{}
+	}
+	// Build the transforms first so an invalid spec fails before the source is read.
+	chain, err := r.Transforms.NewChain(opts.Transforms)
+	if err != nil {
+		return err
+	}
+	books, err := r.Parse(ctx, src, parserName, opts)
+	if err != nil {
+		return err
+	}
+	if books, err = chain.Apply(books); err != nil {
+		return err
+	}
+	return r.Export(ctx, books, exporterName, opts)
+}
+
+// Convert runs the source through the parser, the transforms and the exporter of the default registry.
+func Convert(ctx context.Context, src *parser.Source, parserName, exporterName string, opts *ConvertOptions) error {
+	r, err := NewDefaultRegistry()
+	if err != nil {
+		return err
+	}
+	return r.Convert(ctx, src, parserName, exporterName, opts)
+}
@@ -0,0 +1,168 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package bluenote
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/parser"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+	"github.com/yifan-gu/blueNote/pkg/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ImportOptions are the options of importing the books into a storage.
+type ImportOptions struct {
+	// Dedupe skips the marks that already exist in the storage, including the ones in the trash,
+	// or appear earlier in the books.
+	Dedupe bool
+	// DryRun counts the marks that would be created without creating them.
+	DryRun bool
+}
+
+// ImportSummary is the summary of an import job.
+type ImportSummary struct {
+	ID         string   `json:"id"`
+	Source     string   `json:"source,omitempty"`
+	Parser     string   `json:"parser,omitempty"`
+	Books      int      `json:"books"`
+	Marks      int      `json:"marks"`
+	Created    int      `json:"created"`
+	Duplicates int      `json:"duplicates"`
+	IDs        []string `json:"ids"`
+	DryRun     bool     `json:"dryRun"`
+	StartedAt  int64    `json:"startedAt"`
+	FinishedAt int64    `json:"finishedAt"`
+}
+
+// markKey identifies the duplicated marks by their contents.
+func markKey(mark *model.Mark) string {
+	var page, location int
+	if mark.Location != nil {
+		if mark.Location.Page != nil {
+			page = *mark.Location.Page
+		}
+		if mark.Location.Location != nil {
+			location = *mark.Location.Location
+		}
+	}
+	return fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%s\x00%d\x00%d", mark.Type, mark.Title, mark.Author, mark.Data, mark.UserNote, page, location)
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprint(util.NowUnixMilli())
+	}
+	return hex.EncodeToString(b)
+}
+
+// ErrInvalidSource is wrapped by the errors of parsing and transforming the source of an import.
+var ErrInvalidSource = errors.New("invalid import source")
+
+// Import creates the marks of the books in the storage. On a failure, the summary of the marks
+// created so far is returned together with the error.
+func Import(ctx context.Context, store storage.Storage, books []*model.Book, opts *ImportOptions) (*ImportSummary, error) {
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+	summary := &ImportSummary{ID: newJobID(), Books: len(books), IDs: []string{}, DryRun: opts.DryRun, StartedAt: util.NowUnixMilli()}
+	err := importBooks(ctx, store, books, opts, summary)
+	summary.FinishedAt = util.NowUnixMilli()
+	if err != nil {
+		return summary, err
+	}
+	util.LogFields("Imported the marks", util.Fields{"job": summary.ID, "books": summary.Books, "marks": summary.Marks, "created": summary.Created, "duplicates": summary.Duplicates, "dryRun": summary.DryRun})
+	return summary, nil
+}
+
+// importBooks creates the marks of the books and counts them in the summary.
+func importBooks(ctx context.Context, store storage.Storage, books []*model.Book, opts *ImportOptions, summary *ImportSummary) error {
+	seen := make(map[string]bool)
+	for _, bk := range books {
+		if opts.Dedupe {
+			filter := bson.M{"title": bk.Title, "author": bk.Author}
+			existing, err := store.GetMarks(ctx, filter, nil)
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("failed to get the existing marks of %q", bk.Title))
+			}
+			// The trashed marks count as existing, so an import doesn't bring back the deleted ones.
+			deleted, err := store.GetDeletedMarks(ctx, filter, nil)
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("failed to get the deleted marks of %q", bk.Title))
+			}
+			for _, mark := range append(existing, deleted...) {
+				seen[markKey(mark)] = true
+			}
+		}
+
+		for _, mark := range bk.Marks {
+			if err := ctx.Err(); err != nil {
+				return errors.Wrap(err, "the import is interrupted")
+			}
+			if mark.Title == "" {
+				mark.Title = bk.Title
+			}
+			if mark.Author == "" {
+				mark.Author = bk.Author
+			}
+			summary.Marks++
+
+			key := markKey(mark)
+			if opts.Dedupe && seen[key] {
+				summary.Duplicates++
+				continue
+			}
+			seen[key] = true
+
+			if opts.DryRun {
+				if err := model.ValidateMark(mark); err != nil {
+					return err
+				}
+				summary.Created++
+				continue
+			}
+			id, err := store.CreateMark(ctx, mark)
+			if err != nil {
+				return err
+			}
+			summary.Created++
+			summary.IDs = append(summary.IDs, id)
+		}
+	}
+	return nil
+}
+
+// ImportSource parses the source, applies the transforms of the convert options and imports the books into the storage.
+// The errors of parsing and transforming the source wrap ErrInvalidSource, and the summary of the marks created so far
+// is returned with the errors of the storage.
+func (r *Registry) ImportSource(ctx context.Context, store storage.Storage, src *parser.Source, parserName string, convertOpts *ConvertOptions, opts *ImportOptions) (*ImportSummary, error) {
+	if convertOpts == nil {
+		convertOpts = &ConvertOptions{}
+	}
+	chain, err := r.Transforms.NewChain(convertOpts.Transforms)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidSource, err.Error())
+	}
+	books, parserName, err := r.parse(ctx, src, parserName, convertOpts)
+	if err == nil {
+		books, err = chain.Apply(books)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, errors.Wrap(ErrInvalidSource, err.Error())
+	}
+	summary, err := Import(ctx, store, model.MergeBooks(books), opts)
+	summary.Source, summary.Parser = src.Name(), parserName
+	return summary, err
+}
@@ -0,0 +1,26 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package bluenote
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/model"
+)
+
+func TestImportInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	books := []*model.Book{{Title: "T", Author: "A", Marks: []*model.Mark{{Type: model.MarkTypeHighlight, Data: "1"}}}}
+	summary, err := Import(ctx, nil, books, &ImportOptions{DryRun: true})
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, "the import is interrupted: context canceled", err.Error())
+	assert.Equal(t, 1, summary.Books)
+	assert.NotZero(t, summary.FinishedAt)
+}
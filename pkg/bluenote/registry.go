@@ -0,0 +1,106 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+// Package bluenote exposes the parse, transform and export pipeline as a Go library.
+package bluenote
+
+import (
+	"github.com/yifan-gu/blueNote/pkg/exporter"
+	jsonexporter "github.com/yifan-gu/blueNote/pkg/exporter/json"
+	"github.com/yifan-gu/blueNote/pkg/exporter/markdown"
+	mongodbexporter "github.com/yifan-gu/blueNote/pkg/exporter/mongodb"
+	"github.com/yifan-gu/blueNote/pkg/exporter/orgroam"
+	"github.com/yifan-gu/blueNote/pkg/option"
+	"github.com/yifan-gu/blueNote/pkg/parser"
+	jsonparser "github.com/yifan-gu/blueNote/pkg/parser/json"
+	"github.com/yifan-gu/blueNote/pkg/parser/kindlehtml"
+	"github.com/yifan-gu/blueNote/pkg/parser/kindlemyclippings"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+	mongodbstorage "github.com/yifan-gu/blueNote/pkg/storage/mongodb"
+	"github.com/yifan-gu/blueNote/pkg/transform"
+)
+
+// Registry holds the parsers, exporters, storages and transforms that can be looked up by their names.
+type Registry struct {
+	Parsers    *parser.Registry
+	Exporters  *exporter.Registry
+	Storages   *storage.Registry
+	Transforms *transform.Registry
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		Parsers:    parser.NewRegistry(),
+		Exporters:  exporter.NewRegistry(),
+		Storages:   storage.NewRegistry(),
+		Transforms: transform.NewRegistry(),
+	}
+}
+
+// NewDefaultRegistry creates a registry with all the built-in parsers, exporters, storages and transforms.
+func NewDefaultRegistry() (*Registry, error) {
+	r := NewRegistry()
+	for _, p := range []parser.Parser{
+		&kindlehtml.KindleHTMLParser{},
+		&jsonparser.JSONParser{},
+		&kindlemyclippings.KindleMyClippingsParser{},
+	} {
+		if err := r.Parsers.Register(p); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range []exporter.Exporter{
+		&orgroam.OrgRoamExporter{},
+		&jsonexporter.JSONExporter{},
+		&markdown.MarkdownExporter{},
+		&mongodbexporter.MongoDBExporter{},
+	} {
+		if err := r.Exporters.Register(e); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.Storages.Register(&mongodbstorage.MongoDBStorage{}); err != nil {
+		return nil, err
+	}
+	for name, factory := range map[string]transform.Factory{
+		"override":         transform.NewOverride,
+		"filter":           transform.NewFilter,
+		"drop-bookmarks":   transform.NewDropBookmarks,
+		"strip-whitespace": transform.NewStripWhitespace,
+		"rename-authors":   transform.NewRenameAuthors,
+		"split-sections":   transform.NewSplitSections,
+		"merge-books":      transform.NewMergeBooks,
+		"auto-tag":         transform.NewAutoTag,
+	} {
+		if err := r.Transforms.Register(name, factory); err != nil {
+			return nil, err
+		}
+	}
+	option.Reset(r.Parsers.Options())
+	option.Reset(r.Exporters.Options())
+	option.Reset(r.Storages.Options())
+	return r, nil
+}
+
+// Parser returns the parser by its name.
+func (r *Registry) Parser(name string) (parser.Parser, error) {
+	return r.Parsers.Get(name)
+}
+
+// Exporter returns the exporter by its name.
+func (r *Registry) Exporter(name string) (exporter.Exporter, error) {
+	return r.Exporters.Get(name)
+}
+
+// Storage returns the storage by its name.
+func (r *Registry) Storage(name string) (storage.Storage, error) {
+	return r.Storages.Get(name)
+}
+
+// NewTransform creates a transform from a spec in the form of "name[:key=value,...]".
+func (r *Registry) NewTransform(spec string) (transform.Transform, error) {
+	return r.Transforms.New(spec)
+}
@@ -0,0 +1,110 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package bluenote
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/parser"
+	jsonparser "github.com/yifan-gu/blueNote/pkg/parser/json"
+)
+
+func TestRegistryLookup(t *testing.T) {
+	r, err := NewDefaultRegistry()
+	assert.NoError(t, err)
+
+	_, err = r.Parser("kindle-html")
+	assert.NoError(t, err)
+	_, err = r.Exporter("json")
+	assert.NoError(t, err)
+	_, err = r.Storage("mongodb")
+	assert.NoError(t, err)
+
+	_, err = r.Parser("unknown")
+	assert.Error(t, err)
+	_, err = r.Exporter("unknown")
+	assert.Error(t, err)
+	_, err = r.Storage("unknown")
+	assert.Error(t, err)
+	_, err = r.NewTransform("unknown")
+	assert.Error(t, err)
+}
+
+func TestRegistryConvertErrors(t *testing.T) {
+	r, err := NewDefaultRegistry()
+	assert.NoError(t, err)
+
+	src := parser.NewSource("input", strings.NewReader("not a known format"))
+	assert.Error(t, r.Convert(context.Background(), src, parser.AutoParser, "json", nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = r.Transform(ctx, []*model.Book{{Title: "a"}}, nil)
+	assert.Error(t, err)
+
+	books, err := r.Transform(context.Background(), []*model.Book{{Title: "a"}}, []string{"override:title=b"})
+	assert.NoError(t, err)
+	assert.Equal(t, "b", books[0].Title)
+}
+
+type readCounter struct {
+	reads int
+}
+
+func (r *readCounter) Read(p []byte) (int, error) {
+	r.reads++
+	return 0, io.EOF
+}
+
+func TestRegistryInvalidTransformBeforeParse(t *testing.T) {
+	r, err := NewDefaultRegistry()
+	assert.NoError(t, err)
+
+	in := &readCounter{}
+	src := parser.NewSource("books.json", in)
+	assert.Error(t, r.Convert(context.Background(), src, "json", "json", &ConvertOptions{Transforms: []string{"unknown"}}))
+	_, err = r.ImportSource(context.Background(), nil, src, "json", &ConvertOptions{Transforms: []string{"override:unknown=1"}}, nil)
+	assert.True(t, errors.Is(err, ErrInvalidSource))
+	assert.Equal(t, 0, in.reads)
+}
+
+func TestRegistryNewWithOptions(t *testing.T) {
+	r, err := NewDefaultRegistry()
+	assert.NoError(t, err)
+
+	src := parser.NewSource("books.json", strings.NewReader(`[{"title":"a","author":"b"}]`))
+	books, err := r.Parse(context.Background(), src, "json", &ConvertOptions{ParserOptions: map[string]string{"json.title": "c"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "c", books[0].Title)
+
+	registered, err := r.Parser("json")
+	assert.NoError(t, err)
+	assert.Equal(t, "", registered.(*jsonparser.JSONParser).Config.Title)
+
+	_, err = r.Parsers.New("json", map[string]string{"json.unknown": "1"})
+	assert.Error(t, err)
+
+	// The new instances start from the options of the registered ones, e.g. set by the flags.
+	registered.(*jsonparser.JSONParser).Config.Author = "d"
+	p, err := r.Parsers.New("json", map[string]string{"json.title": "e"})
+	assert.NoError(t, err)
+	assert.Equal(t, jsonparser.Config{Author: "d", Title: "e"}, p.(*jsonparser.JSONParser).Config)
+
+	exp, err := r.Exporters.New("org-roam", map[string]string{"org-roam.author-subdir": "false"})
+	assert.NoError(t, err)
+	values := make(map[string]interface{})
+	for _, o := range exp.Options() {
+		values[o.Name] = o.Target
+	}
+	assert.Equal(t, "sqlite3", *values["org-roam.db-driver"].(*string))
+	assert.Equal(t, false, *values["org-roam.author-subdir"].(*bool))
+}
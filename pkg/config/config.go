@@ -5,8 +5,10 @@ Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
 
 package config
 
+import "time"
+
 const (
-	DefaultParser   = "kindle-html"
+	DefaultParser   = "auto"
 	DefaultExporter = "json"
 	DefaultStorage  = "mongodb"
 )
@@ -16,17 +18,26 @@ var GlobalCfg GlobalConfig
 type GlobalConfig struct {
 	PromptYesToAll bool
 	PromptNoToAll  bool
+
+	ConfigFile string
+	Profile    string
+
+	LogLevel  string
+	LogFormat string
+	Quiet     bool
 }
 
 type ConvertConfig struct {
-	ListParsers   bool
-	ListExporters bool
+	ListParsers    bool
+	ListExporters  bool
+	ListTransforms bool
 
-	InputPath string
-	OutputDir string
+	InputPaths []string
+	OutputDir  string
 
-	Parser   string
-	Exporter string
+	Parser     string
+	Exporter   string
+	Transforms []string
 }
 
 type StorageConfig struct {
@@ -37,6 +48,51 @@ type StorageConfig struct {
 	Filter string
 }
 
+// The defaults of the server config.
+const (
+	DefaultServerReadTimeout     = 2 * time.Minute
+	DefaultServerWriteTimeout    = 2 * time.Minute
+	DefaultServerIdleTimeout     = 2 * time.Minute
+	DefaultServerShutdownTimeout = 30 * time.Second
+	DefaultServerMaxBodySize     = 8 << 20
+	DefaultServerMaxUploadSize   = 64 << 20
+	DefaultServerTrashRetention  = 30 * 24 * time.Hour
+)
+
 type ServerConfig struct {
 	ListenAddr string
+	// TLSCertFile and TLSKeyFile serve https if they are set.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+
+	// MaxBodySize is the maximum size in bytes of the request bodies, except the ones of the import,
+	// which are limited by MaxUploadSize.
+	MaxBodySize   int64
+	MaxUploadSize int64
+
+	// GraphiQL serves the GraphiQL page at /graphql for the browsers.
+	GraphiQL bool
+	// PersistedQueriesFile is the json file of the queries that can be sent by their sha256 hashes,
+	// only these queries are allowed if PersistedQueriesOnly is set.
+	PersistedQueriesFile string
+	PersistedQueriesOnly bool
+	// ChangeStream feeds the subscriptions from the change stream of the storage instead of the writes
+	// through the server, so the changes made by other processes are included.
+	ChangeStream bool
+
+	// CORSOrigins are the origins that can call the server from browsers, "*" allows any origin.
+	CORSOrigins []string
+
+	// TrashRetention is how long the deleted marks are kept in the trash before they are purged,
+	// zero or negative keeps them forever.
+	TrashRetention time.Duration
+
+	// AuthTokens and AuthBasicUsers are the credentials in the form of "user[:scope]=secret".
+	AuthTokens     []string
+	AuthBasicUsers []string
 }
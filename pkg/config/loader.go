@@ -0,0 +1,219 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+const (
+	// DefaultConfigFile is the config file that is loaded if it exists.
+	DefaultConfigFile = "~/.config/bluenote/config.toml"
+	// EnvPrefix is the prefix of the environment variables that set the flags,
+	// e.g. BLUENOTE_MONGODB_HOST sets --mongodb.host.
+	EnvPrefix = "BLUENOTE_"
+
+	profilesKey = "profiles"
+	// secretFileSuffix is the suffix of the keys that read the value of a flag from a file,
+	// e.g. "mongodb.password-file" reads --mongodb.password from the given file.
+	secretFileSuffix = "-file"
+)
+
+// FileValues are the flag values loaded from a config file, keyed by the flag names.
+type FileValues map[string][]string
+
+// normalizeKey turns a config key into a flag name, e.g. "OUTPUT_DIR" into "output-dir".
+func normalizeKey(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "_", "-")
+}
+
+// EnvName returns the environment variable name for a flag, e.g. "BLUENOTE_MONGODB_HOST" for "mongodb.host".
+func EnvName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(flagName))
+}
+
+func expandHome(path string) (string, error) {
+	if !strings.HasPrefix(path, "~") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrap(err, "")
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+// LoadFile loads the flag values from the config file, the values of the profile, if given,
+// override the top level ones. A missing file is not an error unless required is true.
+func LoadFile(path, profile string, required bool) (FileValues, error) {
+	path, err := expandHome(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !required {
+			if profile != "" {
+				return nil, errors.New(fmt.Sprintf("profile %q is given, but config file %q doesn't exist", profile, path))
+			}
+			return FileValues{}, nil
+		}
+		return nil, errors.Wrap(err, "")
+	}
+	table, err := ParseTOML(data)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to parse config file %q", path))
+	}
+
+	values := make(FileValues)
+	profiles, _ := table[profilesKey].(map[string]interface{})
+	delete(table, profilesKey)
+	if err := flatten("", table, values); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("invalid config file %q", path))
+	}
+
+	if profile == "" {
+		return values, nil
+	}
+	profileTable, ok := profiles[profile].(map[string]interface{})
+	if !ok {
+		var names []string
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, errors.New(fmt.Sprintf("profile %q is not found in config file %q, available profiles: %v", profile, path, names))
+	}
+	if err := flatten("", profileTable, values); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("invalid profile %q in config file %q", profile, path))
+	}
+	return values, nil
+}
+
+func flatten(prefix string, table map[string]interface{}, values FileValues) error {
+	for key, val := range table {
+		name := normalizeKey(key)
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		switch v := val.(type) {
+		case map[string]interface{}:
+			if err := flatten(name, v, values); err != nil {
+				return err
+			}
+		case []interface{}:
+			var strs []string
+			for _, elem := range v {
+				if _, ok := elem.(map[string]interface{}); ok {
+					return errors.New(fmt.Sprintf("unexpected table in the array of %q", name))
+				}
+				strs = append(strs, fmt.Sprint(elem))
+			}
+			values[name] = strs
+		default:
+			values[name] = []string{fmt.Sprint(v)}
+		}
+	}
+	return nil
+}
+
+// ApplyFlags sets the flags that are not given on the command line, an environment
+// variable takes precedence over the config file values. The value of a flag can also be
+// read from a file with the "-file" suffixed key, e.g. BLUENOTE_MONGODB_PASSWORD_FILE
+// or "mongodb.password-file", so secrets don't need to appear in the argv.
+func ApplyFlags(fs *pflag.FlagSet, values FileValues) error {
+	var err error
+	fs.VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed {
+			return
+		}
+		var vals []string
+		var ok bool
+		if vals, ok, err = lookupFlagValue(fs, f.Name, values); err != nil || !ok {
+			return
+		}
+		err = setFlag(fs, f, vals)
+	})
+	return err
+}
+
+func lookupFlagValue(fs *pflag.FlagSet, name string, values FileValues) ([]string, bool, error) {
+	if val, ok := os.LookupEnv(EnvName(name)); ok {
+		return []string{val}, true, nil
+	}
+	if vals, ok := values[name]; ok {
+		return vals, true, nil
+	}
+
+	secretName := name + secretFileSuffix
+	if fs.Lookup(secretName) != nil {
+		// The flag reads its own secret file.
+		return nil, false, nil
+	}
+	path, ok := os.LookupEnv(EnvName(secretName))
+	if !ok {
+		if vals, found := values[secretName]; found && len(vals) == 1 {
+			path, ok = vals[0], true
+		}
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	secret, err := ReadSecretFile(path)
+	if err != nil {
+		return nil, false, errors.Wrap(err, fmt.Sprintf("failed to read the value of --%s", name))
+	}
+	return []string{secret}, true, nil
+}
+
+// Unknown returns the keys that are not any of the flags, including the "-file" suffixed keys of the secrets, in order.
+func (v FileValues) Unknown(isFlag func(name string) bool) []string {
+	var keys []string
+	for key := range v {
+		if !isFlag(key) && !(strings.HasSuffix(key, secretFileSuffix) && isFlag(strings.TrimSuffix(key, secretFileSuffix))) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ReadSecretFile reads a secret from the file, the trailing new line is trimmed.
+func ReadSecretFile(path string) (string, error) {
+	path, err := expandHome(path)
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrap(err, "")
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+func setFlag(fs *pflag.FlagSet, f *pflag.Flag, vals []string) error {
+	if sv, ok := f.Value.(pflag.SliceValue); ok {
+		if err := sv.Replace(vals); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("invalid value %q for --%s", vals, f.Name))
+		}
+		f.Changed = true
+		return nil
+	}
+	if len(vals) != 1 {
+		return errors.New(fmt.Sprintf("expect a single value for --%s, got %q", f.Name, vals))
+	}
+	if err := fs.Set(f.Name, vals[0]); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("invalid value %q for --%s", vals[0], f.Name))
+	}
+	return nil
+}
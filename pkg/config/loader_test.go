@@ -0,0 +1,144 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTOML(t *testing.T) {
+	data := `
+# comment
+OUTPUT_DIR="~/org/roam" # trailing comment
+"quoted.key" = 'literal \n'
+count = 1_000
+ratio = 0.8
+enabled = true
+list = [
+  "a", # first
+  "b",
+]
+inline = { x = 1, y.z = "w" }
+multiline = """
+a
+b"""
+
+[mongodb]
+host = "db:27017"
+
+[profiles.work.mongodb]
+host = "work:27017"
+
+[[rules]]
+tags = ["x"]
+
+[[rules]]
+tags = []
+`
+	table, err := ParseTOML([]byte(data))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"OUTPUT_DIR": "~/org/roam",
+		"quoted.key": `literal \n`,
+		"count":      int64(1000),
+		"ratio":      0.8,
+		"enabled":    true,
+		"list":       []interface{}{"a", "b"},
+		"inline":     map[string]interface{}{"x": int64(1), "y": map[string]interface{}{"z": "w"}},
+		"multiline":  "a\nb",
+		"mongodb":    map[string]interface{}{"host": "db:27017"},
+		"profiles": map[string]interface{}{
+			"work": map[string]interface{}{
+				"mongodb": map[string]interface{}{"host": "work:27017"},
+			},
+		},
+		"rules": []interface{}{
+			map[string]interface{}{"tags": []interface{}{"x"}},
+			map[string]interface{}{"tags": []interface{}{}},
+		},
+	}, table)
+
+	for i, invalid := range []string{
+		`key = `,
+		`key = "unterminated`,
+		`key = 1 2`,
+		`key = 1` + "\n" + `key = 2`,
+		`[table`,
+		`list = [1 2]`,
+		`enabled = trueish`,
+	} {
+		_, err := ParseTOML([]byte(invalid))
+		assert.Error(t, err, "case #%d", i)
+	}
+}
+
+func TestLoadFileAndApplyFlags(t *testing.T) {
+	dir := t.TempDir()
+	secretPath := filepath.Join(dir, "secret")
+	assert.NoError(t, os.WriteFile(secretPath, []byte("s3cr3t\n"), 0600))
+	configPath := filepath.Join(dir, "config.toml")
+	assert.NoError(t, os.WriteFile(configPath, []byte(`
+OUTPUT_DIR = "/notes"
+transform = ["drop-bookmarks", "strip-whitespace"]
+
+[mongodb]
+host = "home:27017"
+username = "me"
+password-file = "`+secretPath+`"
+
+[profiles.work]
+mongodb.host = "work:27017"
+mongodb.database = "work"
+`), 0644))
+
+	newFlagSet := func() (*pflag.FlagSet, map[string]*string, *[]string) {
+		fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		strs := make(map[string]*string)
+		for _, name := range []string{"output-dir", "mongodb.host", "mongodb.username", "mongodb.password", "mongodb.database"} {
+			strs[name] = fs.String(name, "default", "")
+		}
+		transforms := fs.StringArray("transform", nil, "")
+		return fs, strs, transforms
+	}
+
+	// Defaults are overridden by the config file.
+	values, err := LoadFile(configPath, "", true)
+	assert.NoError(t, err)
+	fs, strs, transforms := newFlagSet()
+	assert.NoError(t, ApplyFlags(fs, values))
+	assert.Equal(t, "/notes", *strs["output-dir"])
+	assert.Equal(t, "home:27017", *strs["mongodb.host"])
+	assert.Equal(t, "me", *strs["mongodb.username"])
+	assert.Equal(t, "s3cr3t", *strs["mongodb.password"])
+	assert.Equal(t, "default", *strs["mongodb.database"])
+	assert.Equal(t, []string{"drop-bookmarks", "strip-whitespace"}, *transforms)
+
+	assert.Empty(t, values.Unknown(func(name string) bool { return fs.Lookup(name) != nil }))
+	values["mongodb.hots"] = []string{"typo"}
+	assert.Equal(t, []string{"mongodb.hots"}, values.Unknown(func(name string) bool { return fs.Lookup(name) != nil }))
+
+	// The profile overrides the top level values, the env overrides the file and
+	// the command line overrides everything.
+	values, err = LoadFile(configPath, "work", true)
+	assert.NoError(t, err)
+	fs, strs, _ = newFlagSet()
+	assert.NoError(t, fs.Parse([]string{"--mongodb.username=cli"}))
+	os.Setenv("BLUENOTE_MONGODB_DATABASE", "env")
+	defer os.Unsetenv("BLUENOTE_MONGODB_DATABASE")
+	assert.NoError(t, ApplyFlags(fs, values))
+	assert.Equal(t, "work:27017", *strs["mongodb.host"])
+	assert.Equal(t, "env", *strs["mongodb.database"])
+	assert.Equal(t, "cli", *strs["mongodb.username"])
+
+	// Missing profiles and missing required files are errors.
+	_, err = LoadFile(configPath, "unknown", true)
+	assert.Error(t, err)
+	_, err = LoadFile(filepath.Join(dir, "missing.toml"), "", true)
+	assert.Error(t, err)
+	values, err = LoadFile(filepath.Join(dir, "missing.toml"), "", false)
+	assert.NoError(t, err)
+	assert.Empty(t, values)
+}
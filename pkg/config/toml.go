@@ -0,0 +1,45 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package config
+
+import (
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+// ParseTOML parses the TOML document, the tables are returned as map[string]interface{}
+// and the arrays, including the arrays of tables, as []interface{}.
+func ParseTOML(data []byte) (map[string]interface{}, error) {
+	doc := make(map[string]interface{})
+	if err := toml.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	return normalizeTOML(doc).(map[string]interface{}), nil
+}
+
+// normalizeTOML converts the arrays of tables decoded as []map[string]interface{} to []interface{}.
+func normalizeTOML(val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		for key, elem := range v {
+			v[key] = normalizeTOML(elem)
+		}
+		return v
+	case []map[string]interface{}:
+		ret := make([]interface{}, 0, len(v))
+		for _, elem := range v {
+			ret = append(ret, normalizeTOML(elem))
+		}
+		return ret
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = normalizeTOML(elem)
+		}
+		return v
+	default:
+		return val
+	}
+}
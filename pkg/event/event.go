@@ -0,0 +1,165 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+// Package event is the change feed of the marks, the writes to a storage are published to a bus,
+// which the subscribers, e.g. the GraphQL subscriptions, listen to.
+package event
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/util"
+)
+
+// Type is the type of a change.
+type Type string
+
+const (
+	Created Type = "CREATED"
+	Updated Type = "UPDATED"
+	Deleted Type = "DELETED"
+)
+
+// historySize is the number of the latest events the bus keeps for the subscriptions to resume.
+const historySize = 1024
+
+// ErrExpired is returned when a subscription can't resume after an event, as the bus no longer
+// keeps the events after it, or the event is not published by the bus, e.g. before a restart.
+var ErrExpired = errors.New("the events to resume after are expired")
+
+// Event is a change of a mark.
+type Event struct {
+	// ID is assigned by the bus in the order of publishing, a subscription can resume after it.
+	ID   uint64
+	Type Type
+	// Mark is the mark after the change, or the mark before the deletion. It only has the ID
+	// if the source doesn't know the mark, e.g. a deletion from a MongoDB change stream.
+	Mark *model.Mark
+}
+
+// Source is implemented by the storages that can feed the bus with their changes, including
+// the ones made by other processes, e.g. from the MongoDB change streams.
+type Source interface {
+	// Watch publishes the changes to the bus until the context is canceled.
+	Watch(ctx context.Context, bus *Bus) error
+}
+
+// Bus is an in-process bus that delivers the published events to all the subscriptions.
+type Bus struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+	// last is the ID of the latest event, the IDs start from the creation time in nanoseconds,
+	// so the IDs of a restarted process are larger than the ones before.
+	last uint64
+	// history is the latest events in order, up to historySize.
+	history []*Event
+}
+
+// NewBus creates a bus without subscriptions.
+func NewBus() *Bus {
+	return &Bus{subs: make(map[*Subscription]struct{}), last: uint64(time.Now().UnixNano())}
+}
+
+// Publish assigns the IDs to the events and delivers them to the subscriptions without blocking.
+// A subscription whose buffer is full is closed, so a slow subscriber can't block the writes,
+// and it can tell that it missed events.
+func (b *Bus) Publish(events ...*Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, ev := range events {
+		b.last++
+		ev.ID = b.last
+		b.history = append(b.history, ev)
+	}
+	if len(b.history) > historySize {
+		b.history = b.history[len(b.history)-historySize:]
+	}
+	for sub := range b.subs {
+		for _, ev := range events {
+			select {
+			case sub.ch <- ev:
+			default:
+				util.Debugf("Closing a subscription that falls behind by %d events", cap(sub.ch))
+				b.remove(sub)
+			}
+			if sub.closed {
+				break
+			}
+		}
+	}
+}
+
+// Subscribe creates a subscription that buffers up to buffer events.
+func (b *Bus) Subscribe(buffer int) *Subscription {
+	sub := &Subscription{bus: b, ch: make(chan *Event, buffer)}
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
+
+// SubscribeAfter creates a subscription like Subscribe, which first receives the events published
+// after the ID, e.g. the ones a reconnecting subscriber missed. It returns ErrExpired if the bus
+// doesn't keep all the events after the ID.
+func (b *Bus) SubscribeAfter(buffer int, id uint64) (*Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// The history has all the events after oldest.
+	oldest := b.last
+	if len(b.history) > 0 {
+		oldest = b.history[0].ID - 1
+	}
+	if id < oldest || id > b.last {
+		return nil, errors.Wrap(ErrExpired, fmt.Sprintf("event %d", id))
+	}
+	missed := b.history[len(b.history)-int(b.last-id):]
+	sub := &Subscription{bus: b, ch: make(chan *Event, buffer+len(missed))}
+	for _, ev := range missed {
+		sub.ch <- ev
+	}
+	b.subs[sub] = struct{}{}
+	return sub, nil
+}
+
+// Len returns the number of the subscriptions.
+func (b *Bus) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// remove closes the subscription, the lock must be held.
+func (b *Bus) remove(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	delete(b.subs, sub)
+	close(sub.ch)
+}
+
+// Subscription receives the events published after it's created, and the missed ones it resumes after.
+type Subscription struct {
+	bus    *Bus
+	ch     chan *Event
+	closed bool
+}
+
+// Events returns the channel of the events, which is closed when the subscription is closed.
+func (s *Subscription) Events() <-chan *Event {
+	return s.ch
+}
+
+// Close closes the subscription, it's safe to be called more than once.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.remove(s)
+}
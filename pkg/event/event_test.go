@@ -0,0 +1,123 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package event
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/model"
+)
+
+// received returns the events in the buffer of the subscription, and whether it's closed.
+func received(sub *Subscription) ([]*Event, bool) {
+	var events []*Event
+	for {
+		select {
+		case ev, ok := <-sub.Events():
+			if !ok {
+				return events, true
+			}
+			events = append(events, ev)
+		default:
+			return events, false
+		}
+	}
+}
+
+func TestBus(t *testing.T) {
+	created := &Event{Type: Created, Mark: &model.Mark{ID: "a"}}
+	updated := &Event{Type: Updated, Mark: &model.Mark{ID: "a"}}
+	deleted := &Event{Type: Deleted, Mark: &model.Mark{ID: "a"}}
+
+	tests := []struct {
+		buffer  int
+		publish [][]*Event
+		events  []*Event
+		closed  bool
+	}{
+		{buffer: 3, publish: [][]*Event{{created}, {updated, deleted}}, events: []*Event{created, updated, deleted}},
+		{buffer: 3, publish: nil, events: nil},
+		// The subscription falls behind and is closed.
+		{buffer: 1, publish: [][]*Event{{created}, {updated}, {deleted}}, events: []*Event{created}, closed: true},
+	}
+	for i, tt := range tests {
+		bus := NewBus()
+		sub := bus.Subscribe(tt.buffer)
+		for _, events := range tt.publish {
+			bus.Publish(events...)
+		}
+		events, closed := received(sub)
+		assert.Equal(t, tt.events, events, "case #%d", i)
+		assert.Equal(t, tt.closed, closed, "case #%d", i)
+		sub.Close()
+		sub.Close()
+		assert.Equal(t, 0, bus.Len(), "case #%d", i)
+	}
+}
+
+func TestBusClosedSubscription(t *testing.T) {
+	bus := NewBus()
+	closed, open := bus.Subscribe(1), bus.Subscribe(1)
+	closed.Close()
+	bus.Publish(&Event{Type: Created, Mark: &model.Mark{ID: "a"}})
+
+	events, isClosed := received(closed)
+	assert.Nil(t, events)
+	assert.True(t, isClosed)
+	events, isClosed = received(open)
+	assert.Equal(t, 1, len(events))
+	assert.False(t, isClosed)
+}
+
+func TestBusSubscribeAfter(t *testing.T) {
+	bus := NewBus()
+	var published []*Event
+	for i := 0; i < historySize+2; i++ {
+		ev := &Event{Type: Updated, Mark: &model.Mark{ID: "a"}}
+		bus.Publish(ev)
+		published = append(published, ev)
+	}
+	last := published[len(published)-1].ID
+
+	tests := []struct {
+		id     uint64
+		events []*Event
+		err    bool
+	}{
+		{id: last, events: nil},
+		{id: last - 2, events: published[len(published)-2:]},
+		// The oldest event kept, and the one before it.
+		{id: published[1].ID, events: published[2:]},
+		{id: published[0].ID, err: true},
+		// The events are not published by the bus.
+		{id: last + 1, err: true},
+		{id: 1, err: true},
+	}
+	for i, tt := range tests {
+		sub, err := bus.SubscribeAfter(1, tt.id)
+		if tt.err {
+			assert.True(t, errors.Is(err, ErrExpired), "case #%d", i)
+			continue
+		}
+		assert.NoError(t, err, "case #%d", i)
+		events, closed := received(sub)
+		assert.Equal(t, tt.events, events, "case #%d", i)
+		assert.False(t, closed, "case #%d", i)
+		sub.Close()
+	}
+
+	// The missed events don't take the buffer of the new ones.
+	sub, err := bus.SubscribeAfter(1, last-2)
+	assert.NoError(t, err)
+	ev := &Event{Type: Deleted, Mark: &model.Mark{ID: "a"}}
+	bus.Publish(ev)
+	events, closed := received(sub)
+	assert.Equal(t, append(published[len(published)-2:], ev), events)
+	assert.False(t, closed)
+	assert.Equal(t, last+1, ev.ID)
+}
@@ -0,0 +1,111 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package event
+
+import (
+	"context"
+
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// PublishingStorage is a storage that publishes the changes made through it to a bus.
+type PublishingStorage struct {
+	storage.Storage
+	bus *Bus
+}
+
+// NewPublishingStorage wraps the storage to publish its changes to the bus.
+func NewPublishingStorage(store storage.Storage, bus *Bus) *PublishingStorage {
+	return &PublishingStorage{Storage: store, bus: bus}
+}
+
+// publish reads the marks from the storage and publishes them as the events of the type.
+func (s *PublishingStorage) publish(ctx context.Context, typ Type, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	marks, err := s.Storage.GetMarks(ctx, bson.M{"_id": bson.M{"$in": ids}}, nil)
+	if err != nil {
+		return err
+	}
+	s.publishMarks(typ, marks)
+	return nil
+}
+
+func (s *PublishingStorage) publishMarks(typ Type, marks []*model.Mark) {
+	events := make([]*Event, len(marks))
+	for i, mark := range marks {
+		events[i] = &Event{Type: typ, Mark: mark}
+	}
+	s.bus.Publish(events...)
+}
+
+func (s *PublishingStorage) CreateMark(ctx context.Context, mark *model.Mark) (string, error) {
+	id, err := s.Storage.CreateMark(ctx, mark)
+	if err != nil {
+		return "", err
+	}
+	return id, s.publish(ctx, Created, id)
+}
+
+func (s *PublishingStorage) UpdateMarks(ctx context.Context, filter interface{}, patch *model.MarkPatch) ([]string, error) {
+	ids, err := s.Storage.UpdateMarks(ctx, filter, patch)
+	if err != nil {
+		return nil, err
+	}
+	return ids, s.publish(ctx, Updated, ids...)
+}
+
+func (s *PublishingStorage) UpdateOneMark(ctx context.Context, id string, patch *model.MarkPatch) error {
+	if err := s.Storage.UpdateOneMark(ctx, id, patch); err != nil {
+		return err
+	}
+	return s.publish(ctx, Updated, id)
+}
+
+func (s *PublishingStorage) DeleteMarks(ctx context.Context, filter interface{}) (int, error) {
+	marks, err := s.Storage.GetMarks(ctx, filter, nil)
+	if err != nil {
+		return 0, err
+	}
+	count, err := s.Storage.DeleteMarks(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	s.publishMarks(Deleted, marks)
+	return count, nil
+}
+
+func (s *PublishingStorage) DeleteOneMark(ctx context.Context, id string) error {
+	marks, err := s.Storage.GetMarks(ctx, bson.M{"_id": id}, nil)
+	if err != nil {
+		return err
+	}
+	if err := s.Storage.DeleteOneMark(ctx, id); err != nil {
+		return err
+	}
+	s.publishMarks(Deleted, marks)
+	return nil
+}
+
+// RestoreMarks publishes the restored marks as created, the purged marks are not published
+// as they are published as deleted when they are moved to the trash.
+func (s *PublishingStorage) RestoreMarks(ctx context.Context, filter interface{}) ([]string, error) {
+	ids, err := s.Storage.RestoreMarks(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return ids, s.publish(ctx, Created, ids...)
+}
+
+func (s *PublishingStorage) RevertMark(ctx context.Context, id, revisionID string) error {
+	if err := s.Storage.RevertMark(ctx, id, revisionID); err != nil {
+		return err
+	}
+	return s.publish(ctx, Updated, id)
+}
@@ -7,52 +7,89 @@ package exporter
 
 import (
 	"fmt"
+	"reflect"
+	"sort"
 	"strings"
 
-	"github.com/spf13/cobra"
+	"github.com/pkg/errors"
 	"github.com/yifan-gu/blueNote/pkg/config"
 	"github.com/yifan-gu/blueNote/pkg/model"
-	"github.com/yifan-gu/blueNote/pkg/util"
+	"github.com/yifan-gu/blueNote/pkg/option"
 )
 
-var registeredExporters map[string]Exporter
-
 type Exporter interface {
 	Name() string
-	LoadConfigs(cmd *cobra.Command)
-	Export(cfg *config.ConvertConfig, book []*model.Book) error
+	// Options returns the options of the exporter, which are bound to its fields.
+	Options() []*option.Option
+	// Export writes the books to the output, the output dir of the config is only used to
+	// generate the paths that refer to the exported files, e.g. in the org-roam database.
+	Export(cfg *config.ConvertConfig, out Output, books []*model.Book) error
+}
+
+// StorageExporter is implemented by the exporters that load the books into a storage
+// instead of writing them to the output, they are not served for downloading.
+type StorageExporter interface {
+	Exporter
+	StorageExporter()
+}
+
+// Registry holds the exporters by their names.
+type Registry struct {
+	exporters map[string]Exporter
+}
+
+func NewRegistry() *Registry {
+	return &Registry{exporters: make(map[string]Exporter)}
 }
 
-func RegisterExporter(exporter Exporter) {
+func (r *Registry) Register(exporter Exporter) error {
 	name := strings.ToLower(exporter.Name())
-	if registeredExporters == nil {
-		registeredExporters = make(map[string]Exporter)
-	}
-	if _, ok := registeredExporters[name]; ok {
-		util.Fatal(fmt.Errorf("Name conflict for exporter %q", name))
+	if _, ok := r.exporters[name]; ok {
+		return errors.New(fmt.Sprintf("Name conflict for exporter %q", name))
 	}
-	registeredExporters[name] = exporter
+	r.exporters[name] = exporter
+	return nil
 }
 
-func GetExporter(name string) Exporter {
+func (r *Registry) Get(name string) (Exporter, error) {
 	name = strings.ToLower(name)
-	exporter, ok := registeredExporters[name]
+	exporter, ok := r.exporters[name]
 	if !ok {
-		util.Fatal(fmt.Errorf("unrecognized exporter type: %q", name))
+		return nil, errors.New(fmt.Sprintf("unrecognized exporter type: %q", name))
 	}
-	return exporter
+	return exporter, nil
 }
 
-func ListExporters() []string {
+func (r *Registry) List() []string {
 	var names []string
-	for _, exporter := range registeredExporters {
+	for _, exporter := range r.exporters {
 		names = append(names, exporter.Name())
 	}
+	sort.Strings(names)
 	return names
 }
 
-func LoadConfigs(cmd *cobra.Command) {
-	for _, exporter := range registeredExporters {
-		exporter.LoadConfigs(cmd)
+// Options returns the options of all the exporters.
+func (r *Registry) Options() []*option.Option {
+	var opts []*option.Option
+	for _, name := range r.List() {
+		opts = append(opts, r.exporters[strings.ToLower(name)].Options()...)
+	}
+	return opts
+}
+
+// New creates a new instance of the exporter with the options of the registered one, overridden by the values,
+// so it can be configured without affecting the registered one, e.g. per http request.
+func (r *Registry) New(name string, values map[string]string) (Exporter, error) {
+	exporter, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	instance := reflect.New(reflect.TypeOf(exporter).Elem()).Interface().(Exporter)
+	opts := instance.Options()
+	option.Copy(opts, exporter.Options())
+	if err := option.Apply(opts, values); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("invalid options for exporter %q", name))
 	}
+	return instance, nil
 }
@@ -7,39 +7,52 @@ package json
 
 import (
 	jsonenc "encoding/json"
+	"fmt"
 
 	"github.com/pkg/errors"
-	"github.com/spf13/cobra"
 	"github.com/yifan-gu/blueNote/pkg/config"
+	"github.com/yifan-gu/blueNote/pkg/exporter"
 	"github.com/yifan-gu/blueNote/pkg/model"
-	"github.com/yifan-gu/blueNote/pkg/util"
+	"github.com/yifan-gu/blueNote/pkg/option"
 )
 
+const defaultIndent = "  "
+
+// Config is the config of the json exporter.
+type Config struct {
+	// Pretty prints the json with Indent.
+	Pretty bool
+	Indent string
+}
+
 type JSONExporter struct {
-	prettyPrint bool
-	indent      string
+	Config Config
 }
 
 func (e *JSONExporter) Name() string {
 	return "json"
 }
 
-func (e *JSONExporter) LoadConfigs(cmd *cobra.Command) {
-	cmd.PersistentFlags().BoolVar(&e.prettyPrint, "json.pretty", false, "print the json with indent")
-	cmd.PersistentFlags().StringVar(&e.indent, "json.indent", "  ", "sets the json indent")
+func (e *JSONExporter) Options() []*option.Option {
+	return []*option.Option{
+		{Name: "json.pretty", Target: &e.Config.Pretty, Description: "print the json with indent"},
+		{Name: "json.indent", Target: &e.Config.Indent, Default: defaultIndent, Description: "sets the json indent"},
+	}
 }
 
-func (e *JSONExporter) Export(cfg *config.ConvertConfig, books []*model.Book) error {
+func (e *JSONExporter) Export(cfg *config.ConvertConfig, out exporter.Output, books []*model.Book) error {
 	var b []byte
 	var err error
-	if e.prettyPrint {
-		b, err = jsonenc.MarshalIndent(books, "", e.indent)
+	if e.Config.Pretty {
+		b, err = jsonenc.MarshalIndent(books, "", e.Config.Indent)
 	} else {
 		b, err = jsonenc.Marshal(books)
 	}
 	if err != nil {
 		return errors.Wrap(err, "failed to marshal json")
 	}
-	util.Log(string(b))
+	if _, err := fmt.Fprintln(out.Writer(), string(b)); err != nil {
+		return errors.Wrap(err, "failed to write json")
+	}
 	return nil
 }
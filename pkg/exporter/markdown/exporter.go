@@ -0,0 +1,135 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package markdown
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/yifan-gu/blueNote/pkg/config"
+	"github.com/yifan-gu/blueNote/pkg/exporter"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/option"
+)
+
+// Config is the config of the markdown exporter.
+type Config struct {
+	// Split writes every book to its own file instead of the stream.
+	Split bool
+}
+
+type MarkdownExporter struct {
+	Config Config
+}
+
+func (e *MarkdownExporter) Name() string {
+	return "markdown"
+}
+
+func (e *MarkdownExporter) Options() []*option.Option {
+	return []*option.Option{
+		{Name: "markdown.split", Target: &e.Config.Split, Description: "write every book to its own file under the output dir"},
+	}
+}
+
+func (e *MarkdownExporter) Export(cfg *config.ConvertConfig, out exporter.Output, books []*model.Book) error {
+	if !e.Config.Split {
+		for i, bk := range books {
+			if i > 0 {
+				fmt.Fprintln(out.Writer())
+			}
+			if err := writeBook(out.Writer(), bk); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, bk := range books {
+		f, err := out.Create(fileName(bk))
+		if errors.Cause(err) == exporter.ErrSkipped {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = writeBook(f, bk)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileName returns the file name of the book, the path separators in the title and the author are replaced.
+func fileName(bk *model.Book) string {
+	name := bk.Title
+	if bk.Author != "" {
+		name = fmt.Sprintf("%s - %s", bk.Title, bk.Author)
+	}
+	return strings.NewReplacer("/", "_", "\\", "_").Replace(name) + ".md"
+}
+
+func formatLocation(loc *model.Location) string {
+	if loc == nil {
+		return ""
+	}
+	var parts []string
+	if loc.Page != nil {
+		parts = append(parts, fmt.Sprintf("Page %d", *loc.Page))
+	}
+	if loc.Location != nil {
+		parts = append(parts, fmt.Sprintf("Location %d", *loc.Location))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// quote formats the text as a markdown block quote.
+func quote(text string) string {
+	return "> " + strings.ReplaceAll(strings.TrimSpace(text), "\n", "\n> ")
+}
+
+func writeBook(w io.Writer, bk *model.Book) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n", bk.Title)
+	if bk.Author != "" {
+		fmt.Fprintf(&sb, "\n*%s*\n", bk.Author)
+	}
+
+	var chapter string
+	for _, mk := range bk.Marks {
+		if mk.Location != nil && mk.Location.Chapter != "" && mk.Location.Chapter != chapter {
+			chapter = mk.Location.Chapter
+			fmt.Fprintf(&sb, "\n## %s\n", chapter)
+		}
+		sb.WriteString("\n")
+		loc := formatLocation(mk.Location)
+		switch {
+		case mk.Type == model.MarkTypeBookmark:
+			fmt.Fprintf(&sb, "- Bookmark: %s\n", loc)
+		case mk.Data != "":
+			sb.WriteString(quote(mk.Data) + "\n")
+			if loc != "" {
+				fmt.Fprintf(&sb, ">\n> — %s\n", loc)
+			}
+		case loc != "":
+			fmt.Fprintf(&sb, "*%s*\n", loc)
+		}
+		if mk.UserNote != "" {
+			fmt.Fprintf(&sb, "\n**Note:** %s\n", strings.TrimSpace(mk.UserNote))
+		}
+		if len(mk.Tags) > 0 {
+			fmt.Fprintf(&sb, "\n**Tags:** %s\n", strings.Join(mk.Tags, ", "))
+		}
+	}
+	if _, err := io.WriteString(w, sb.String()); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to write book %q", bk.Title))
+	}
+	return nil
+}
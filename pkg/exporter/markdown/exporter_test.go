@@ -0,0 +1,60 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package markdown
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/config"
+	"github.com/yifan-gu/blueNote/pkg/exporter"
+	"github.com/yifan-gu/blueNote/pkg/model"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestExport(t *testing.T) {
+	books := []*model.Book{
+		{Title: "T/1", Author: "A", Marks: []*model.Mark{
+			{Type: model.MarkTypeHighlight, Data: "line1\nline2", Location: &model.Location{Chapter: "C1", Page: intPtr(8), Location: intPtr(541)}},
+			{Type: model.MarkTypeNote, Data: "d", UserNote: "n", Tags: []string{"x", "y"}, Location: &model.Location{Chapter: "C1"}},
+			{Type: model.MarkTypeBookmark, Location: &model.Location{Chapter: "C2", Location: intPtr(600)}},
+		}},
+		{Title: "T2"},
+	}
+
+	tests := []struct {
+		split  bool
+		stream string
+		files  map[string]string
+	}{
+		{
+			stream: "# T/1\n\n*A*\n\n## C1\n\n> line1\n> line2\n>\n> — Page 8, Location 541\n\n> d\n\n**Note:** n\n\n**Tags:** x, y\n\n## C2\n\n- Bookmark: Location 600\n\n# T2\n",
+			files:  map[string]string{},
+		},
+		{
+			split: true,
+			files: map[string]string{
+				"T_1 - A.md": "# T/1\n\n*A*\n\n## C1\n\n> line1\n> line2\n>\n> — Page 8, Location 541\n\n> d\n\n**Note:** n\n\n**Tags:** x, y\n\n## C2\n\n- Bookmark: Location 600\n",
+				"T2.md":      "# T2\n",
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		out := exporter.NewMemoryOutput()
+		e := &MarkdownExporter{Config: Config{Split: tt.split}}
+		assert.NoError(t, e.Export(&config.ConvertConfig{}, out, books), "case #%d", i)
+		assert.Equal(t, tt.stream, out.Stream.String(), "case #%d", i)
+		files := make(map[string]string)
+		for _, f := range out.Files {
+			files[f.Path] = f.Data.String()
+		}
+		assert.Equal(t, tt.files, files, "case #%d", i)
+	}
+}
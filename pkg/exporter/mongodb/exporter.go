@@ -8,34 +8,33 @@ package mongodb
 import (
 	"context"
 
-	"github.com/spf13/cobra"
 	"github.com/yifan-gu/blueNote/pkg/config"
+	"github.com/yifan-gu/blueNote/pkg/exporter"
 	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/option"
 	"github.com/yifan-gu/blueNote/pkg/storage/mongodb"
 	"github.com/yifan-gu/blueNote/pkg/util"
 )
 
 type MongoDBExporter struct {
-	mongodbConfig mongodb.Config
+	Config mongodb.Config
 }
 
 func (e *MongoDBExporter) Name() string {
 	return "mongodb"
 }
 
-func (e *MongoDBExporter) LoadConfigs(cmd *cobra.Command) {
-	cmd.PersistentFlags().StringVar(&e.mongodbConfig.Username, "mongodb.username", "", "username of the mongodb")
-	cmd.PersistentFlags().StringVar(&e.mongodbConfig.Password, "mongodb.password", "", "password of the mongodb")
-	cmd.PersistentFlags().StringVar(&e.mongodbConfig.Host, "mongodb.host", "localhost:27017", "host of the mongodb")
-	cmd.PersistentFlags().StringVar(&e.mongodbConfig.ConnOpt, "mongodb.conn-opt", "", "connection option of the mongodb")
-	cmd.PersistentFlags().StringVar(&e.mongodbConfig.DBName, "mongodb.database", "bluenote", "database to use in the mongodb")
-	cmd.PersistentFlags().StringVar(&e.mongodbConfig.CollectionName, "mongodb.collection", "marks", "the collection to use in the mongodb")
+func (e *MongoDBExporter) Options() []*option.Option {
+	return e.Config.Options()
 }
 
-func (e *MongoDBExporter) Export(cfg *config.ConvertConfig, books []*model.Book) error {
+// StorageExporter marks the exporter as one that loads the books into the mongodb.
+func (e *MongoDBExporter) StorageExporter() {}
+
+func (e *MongoDBExporter) Export(cfg *config.ConvertConfig, out exporter.Output, books []*model.Book) error {
 	ctx := context.Background()
 
-	conn := mongodb.NewMongoDBStorage(ctx, &e.mongodbConfig)
+	conn := mongodb.NewMongoDBStorage(ctx, &e.Config)
 	if err := conn.Connect(ctx); err != nil {
 		return err
 	}
@@ -48,11 +47,10 @@ func (e *MongoDBExporter) Export(cfg *config.ConvertConfig, books []*model.Book)
 			if err != nil {
 				return err
 			}
-			util.Logf("Mark created with id: %s\n", id)
+			util.Debugf("Mark created with id: %s", id)
 			totalInserted++
 		}
 	}
-	util.Logf("Successfully loaded to mongodb, (database: %s, collection: %s)\n", e.mongodbConfig.DBName, e.mongodbConfig.CollectionName)
-	util.Logf("Total inserted: %v\n", totalInserted)
+	util.LogFields("Successfully loaded to mongodb", util.Fields{"database": e.Config.DBName, "collection": e.Config.CollectionName, "inserted": totalInserted})
 	return nil
 }
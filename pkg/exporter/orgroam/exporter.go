@@ -9,17 +9,19 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
-	"os"
+	"io"
+	"path"
 	"path/filepath"
 	"text/template"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
-	"github.com/spf13/cobra"
 
 	"github.com/yifan-gu/blueNote/pkg/config"
+	"github.com/yifan-gu/blueNote/pkg/exporter"
 	"github.com/yifan-gu/blueNote/pkg/exporter/orgroam/db"
 	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/option"
 	"github.com/yifan-gu/blueNote/pkg/util"
 )
 
@@ -70,34 +72,28 @@ func convertFromModelBook(book *model.Book) *Book {
 			Section:  mk.Section,
 			Data:     mk.Data,
 			UserNote: mk.UserNote,
-			Location: Location{
+		}
+		// The marks created via the server may have no location.
+		if mk.Location != nil {
+			mark.Location = Location{
 				Chapter:  mk.Location.Chapter,
 				Page:     mk.Location.Page,
 				Location: mk.Location.Location,
-			},
+			}
 		}
 		bk.Marks = append(bk.Marks, mark)
 	}
 	return bk
 }
 
-func writeRunesToFile(fullpath string, runes []rune) error {
-	f, err := os.OpenFile(fullpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("failed to open or create file %s", fullpath))
-	}
-	defer f.Close()
-
-	buf := bufio.NewWriter(f)
-	defer buf.Flush()
-
+func writeRunes(w io.Writer, runes []rune) error {
+	buf := bufio.NewWriter(w)
 	for i := range runes {
-		_, err = fmt.Fprintf(buf, "%c", runes[i])
-		if err != nil {
-			return errors.Wrap(err, fmt.Sprintf("failed to write to file %s", fullpath))
+		if _, err := fmt.Fprintf(buf, "%c", runes[i]); err != nil {
+			return errors.Wrap(err, "")
 		}
 	}
-	return nil
+	return errors.Wrap(buf.Flush(), "")
 }
 
 type OrgRoamExporter struct {
@@ -113,25 +109,27 @@ func (e *OrgRoamExporter) Name() string {
 	return "org-roam"
 }
 
-func (e *OrgRoamExporter) LoadConfigs(cmd *cobra.Command) {
-	cmd.PersistentFlags().BoolVar(&e.updateRoamDB, "org-roam.update-db", false, "automatically update the roam sqlite db for links")
-	cmd.PersistentFlags().StringVarP(&e.roamDBPath, "org-roam.db-path", "d", defaultRoamDBPath, "path to the org-roam sqlite3 database")
-	cmd.PersistentFlags().StringVar(&e.dbDriver, "org-roam.db-driver", defaultSqlDriver, "the database driver to use")
-	cmd.PersistentFlags().BoolVarP(&e.insertRoamLink, "org-roam.insert-roam-link", "l", true, "insert the roam links")
-	cmd.PersistentFlags().IntVar(&e.templateType, "org-roam.template-type", defaultTemplateType, "the type of the template to use")
-	cmd.PersistentFlags().BoolVar(&e.authorSubDir, "org-roam.author-subdir", true, "create sub-directory with the name of the author")
+func (e *OrgRoamExporter) Options() []*option.Option {
+	return []*option.Option{
+		{Name: "org-roam.update-db", Target: &e.updateRoamDB, Local: true, Description: "automatically update the roam sqlite db for links"},
+		{Name: "org-roam.db-path", Shorthand: "d", Target: &e.roamDBPath, Local: true, Default: defaultRoamDBPath, Description: "path to the org-roam sqlite3 database"},
+		{Name: "org-roam.db-driver", Target: &e.dbDriver, Local: true, Default: defaultSqlDriver, Description: "the database driver to use"},
+		{Name: "org-roam.insert-roam-link", Shorthand: "l", Target: &e.insertRoamLink, Default: true, Description: "insert the roam links"},
+		{Name: "org-roam.template-type", Target: &e.templateType, Default: defaultTemplateType, Description: "the type of the template to use"},
+		{Name: "org-roam.author-subdir", Target: &e.authorSubDir, Default: true, Description: "create sub-directory with the name of the author"},
+	}
 }
 
-func (e *OrgRoamExporter) Export(cfg *config.ConvertConfig, books []*model.Book) error {
+func (e *OrgRoamExporter) Export(cfg *config.ConvertConfig, out exporter.Output, books []*model.Book) error {
 	for _, bk := range books {
-		if err := e.exportBook(cfg, bk); err != nil {
+		if err := e.exportBook(cfg, out, bk); err != nil {
 			return errors.Wrap(err, "")
 		}
 	}
 	return nil
 }
 
-func (e *OrgRoamExporter) exportBook(cfg *config.ConvertConfig, book *model.Book) error {
+func (e *OrgRoamExporter) exportBook(cfg *config.ConvertConfig, out exporter.Output, book *model.Book) error {
 	bk := convertFromModelBook(book)
 
 	sq, err := db.NewSqlInterface(e.roamDBPath, e.dbDriver)
@@ -140,62 +138,51 @@ func (e *OrgRoamExporter) exportBook(cfg *config.ConvertConfig, book *model.Book
 	}
 	defer sq.Close()
 
-	fullpath, err := util.ResolvePath(e.generateOutputPath(bk, cfg))
+	sp := newSqlPlanner(sq, e.updateRoamDB)
+	b, err := e.exportOrgRoam(bk, sp, cfg)
 	if err != nil {
 		return err
 	}
-	dir := filepath.Dir(fullpath)
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		confirm, err := util.PromptExportOverrideConfirmation(fmt.Sprintf("directory %s doesn't exit, create?", dir))
-		if err != nil {
-			return err
-		}
-		if confirm {
-			if err := os.MkdirAll(dir, 0755); err != nil {
-				return errors.Wrap(err, fmt.Sprintf("failed to create dir %q", dir))
-			}
-		}
-	}
 
-	if _, err := os.Stat(fullpath); err == nil || !os.IsNotExist(err) {
-		confirm, err := util.PromptExportOverrideConfirmation(fmt.Sprintf("file %s already exits, replace?", fullpath))
-		if err != nil {
-			return err
-		}
-		if !confirm {
-			return nil
-		}
+	relpath := e.generateRelativePath(bk)
+	f, err := out.Create(relpath)
+	if errors.Cause(err) == exporter.ErrSkipped {
+		return nil
 	}
-
-	sp := newSqlPlanner(sq, e.updateRoamDB)
-	b, err := e.exportOrgRoam(bk, sp, cfg)
 	if err != nil {
 		return err
 	}
 	// Workaround the unicode encoding.
-	if err := writeRunesToFile(fullpath, []rune(string(b))); err != nil {
+	if err := writeRunes(f, []rune(string(b))); err != nil {
+		f.Close()
+		return errors.Wrap(err, fmt.Sprintf("failed to write to file %s", relpath))
+	}
+	if err := f.Close(); err != nil {
 		return err
 	}
 
-	if err := sp.InsertFileEntry(bk, fullpath); err != nil {
+	fullpath, err := util.ResolvePath(e.generateOutputPath(bk, cfg))
+	if err != nil {
 		return err
 	}
-
-	if err := sp.CommitSql(); err != nil {
+	if err := sp.InsertFileEntry(bk, fullpath); err != nil {
 		return err
 	}
 
-	util.Log("Successfully created:", fullpath)
-
-	return nil
+	return sp.CommitSql()
 }
 
-func (e *OrgRoamExporter) generateOutputPath(b *Book, cfg *config.ConvertConfig) string {
+// generateRelativePath returns the slash separated path of the org file relative to the output dir.
+func (e *OrgRoamExporter) generateRelativePath(b *Book) string {
 	filename := fmt.Sprintf("《%s》 by %s.org", b.Title, b.Author)
 	if e.authorSubDir {
-		return filepath.Join(cfg.OutputDir, b.Author, filename)
+		return path.Join(b.Author, filename)
 	}
-	return filepath.Join(cfg.OutputDir, filename)
+	return filename
+}
+
+func (e *OrgRoamExporter) generateOutputPath(b *Book, cfg *config.ConvertConfig) string {
+	return filepath.Join(cfg.OutputDir, filepath.FromSlash(e.generateRelativePath(b)))
 }
 
 func (e *OrgRoamExporter) exportOrgRoam(b *Book, sp SqlPlanner, cfg *config.ConvertConfig) ([]byte, error) {
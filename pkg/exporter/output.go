@@ -0,0 +1,141 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package exporter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/yifan-gu/blueNote/pkg/util"
+)
+
+// ErrSkipped is returned by Output.Create if the file is not going to be written, e.g. the user
+// declines to replace an existing file. The exporters skip the file without failing.
+var ErrSkipped = errors.New("the file is skipped")
+
+// Output is where the exporters write to, so they don't depend on the stdout or the disk.
+type Output interface {
+	// Writer returns the writer for the exporters that write a single stream, e.g. the json exporter.
+	Writer() io.Writer
+	// Create creates a file at the slash separated path relative to the output root,
+	// for the exporters that write multiple files, e.g. the org-roam exporter.
+	Create(path string) (io.WriteCloser, error)
+}
+
+// DirOutput writes the stream to a writer (usually the stdout) and the files under a directory.
+type DirOutput struct {
+	dir    string
+	stream io.Writer
+}
+
+// NewDirOutput creates an output that writes the stream to w and the files under dir.
+func NewDirOutput(dir string, w io.Writer) *DirOutput {
+	return &DirOutput{dir: dir, stream: w}
+}
+
+func (o *DirOutput) Writer() io.Writer {
+	return o.stream
+}
+
+// Create creates the file under the directory, the user is prompted to create the missing directory
+// and to replace the existing file.
+func (o *DirOutput) Create(name string) (io.WriteCloser, error) {
+	fullpath, err := util.ResolvePath(filepath.Join(o.dir, filepath.FromSlash(name)))
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(fullpath)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		confirm, err := util.PromptExportOverrideConfirmation(fmt.Sprintf("directory %s doesn't exit, create?", dir))
+		if err != nil {
+			return nil, err
+		}
+		if confirm {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("failed to create dir %q", dir))
+			}
+		}
+	}
+
+	if _, err := os.Stat(fullpath); err == nil || !os.IsNotExist(err) {
+		confirm, err := util.PromptExportOverrideConfirmation(fmt.Sprintf("file %s already exits, replace?", fullpath))
+		if err != nil {
+			return nil, err
+		}
+		if !confirm {
+			return nil, ErrSkipped
+		}
+	}
+
+	f, err := os.OpenFile(fullpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to open or create file %s", fullpath))
+	}
+	return &dirFile{File: f}, nil
+}
+
+// dirFile logs the file once it's written.
+type dirFile struct {
+	*os.File
+}
+
+func (f *dirFile) Close() error {
+	if err := f.File.Close(); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to close file %s", f.Name()))
+	}
+	util.Log("Successfully created:", f.Name())
+	return nil
+}
+
+// File is a file written to a MemoryOutput.
+type File struct {
+	Path string
+	Data bytes.Buffer
+}
+
+func (f *File) Close() error {
+	return nil
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	return f.Data.Write(p)
+}
+
+// MemoryOutput keeps the stream and the files in memory, e.g. to be served over http.
+type MemoryOutput struct {
+	Stream bytes.Buffer
+	Files  []*File
+}
+
+// NewMemoryOutput creates an empty in-memory output.
+func NewMemoryOutput() *MemoryOutput {
+	return &MemoryOutput{}
+}
+
+func (o *MemoryOutput) Writer() io.Writer {
+	return &o.Stream
+}
+
+func (o *MemoryOutput) Create(name string) (io.WriteCloser, error) {
+	name = path.Clean("/" + filepath.ToSlash(name))[1:]
+	if name == "" {
+		return nil, errors.New("empty file name")
+	}
+	for _, f := range o.Files {
+		if f.Path == name {
+			f.Data.Reset()
+			return f, nil
+		}
+	}
+	f := &File{Path: name}
+	o.Files = append(o.Files, f)
+	return f, nil
+}
@@ -6,7 +6,6 @@ Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
 package model
 
 import (
-	"errors"
 	"fmt"
 	"sort"
 	"strings"
@@ -52,8 +51,10 @@ type Mark struct {
 	Data           string    `json:"data,omitempty"`
 	UserNote       string    `json:"note,omitempty"`
 	Tags           []string  `json:"tags,omitempty"`
+	Owner          string    `json:"owner,omitempty"` // The ID of the user who owns the mark, empty if the server doesn't authenticate the users.
 	CreatedAt      *int64    `json:"createdAt,omitempty"`
 	LastModifiedAt *int64    `json:"lastModifiedAt,omitempty"`
+	DeletedAt      *int64    `json:"deletedAt,omitempty"` // The time when the mark is moved to the trash, nil if it's not deleted.
 }
 
 // Location defines the location of a mark in the book.
@@ -68,14 +69,79 @@ func isSupportedType(typ string) bool {
 	return ok
 }
 
-func ValidateMark(m *Mark) error {
-	if !isSupportedType(m.Type) {
-		return errors.New(fmt.Sprintf("Type %v is not supported", m.Type))
+// FieldError is a problem of a field of a mark.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError reports all the problems of a mark.
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	var msgs []string
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// add adds a problem of the field.
+func (e *ValidationError) add(field, msg string) {
+	e.Errors = append(e.Errors, &FieldError{Field: field, Message: msg})
+}
+
+// Merge adds the problems of err with their fields prefixed, e.g. "marks.1.type", it returns false if err is not a *ValidationError.
+func (e *ValidationError) Merge(prefix string, err error) bool {
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		return false
+	}
+	for _, fe := range verr.Errors {
+		e.add(prefix+"."+fe.Field, fe.Message)
+	}
+	return true
+}
+
+// Err returns the error if there is any problem, or nil.
+func (e *ValidationError) Err() error {
+	if len(e.Errors) == 0 {
+		return nil
 	}
+	return e
+}
+
+// ValidateType returns a *ValidationError if the type of mark is not supported.
+func ValidateType(typ string) error {
+	verr := &ValidationError{}
+	validateType(verr, typ)
+	return verr.Err()
+}
+
+func validateType(verr *ValidationError, typ string) {
+	if !isSupportedType(typ) {
+		verr.add("type", fmt.Sprintf("Type %v is not supported", typ))
+	}
+}
+
+// ValidateMark returns a *ValidationError that reports all the problems of the mark, or nil if it's valid.
+func ValidateMark(m *Mark) error {
+	verr := &ValidationError{}
+	validateType(verr, m.Type)
 	if m.Data == "" && m.UserNote == "" {
-		return errors.New("Expect 'data' or 'note' to be set")
+		verr.add("data", "Expect 'data' or 'note' to be set")
+	}
+	if m.Location != nil {
+		if m.Location.Page != nil && *m.Location.Page < 0 {
+			verr.add("location.page", fmt.Sprintf("Expect a non-negative page, got %d", *m.Location.Page))
+		}
+		if m.Location.Location != nil && *m.Location.Location < 0 {
+			verr.add("location.location", fmt.Sprintf("Expect a non-negative location, got %d", *m.Location.Location))
+		}
 	}
-	return nil
+	return verr.Err()
 }
 
 func SortBooksByTitle(books []*Book) {
@@ -85,3 +151,20 @@ func SortBooksByTitle(books []*Book) {
 		return titleA < titleB
 	})
 }
+
+// MergeBooks merges the books that share the same title and author into one,
+// the order of the first appearance is kept.
+func MergeBooks(books []*Book) []*Book {
+	var merged []*Book
+	index := make(map[[2]string]*Book)
+	for _, bk := range books {
+		key := [2]string{bk.Title, bk.Author}
+		if existing, ok := index[key]; ok {
+			existing.Marks = append(existing.Marks, bk.Marks...)
+			continue
+		}
+		index[key] = bk
+		merged = append(merged, bk)
+	}
+	return merged
+}
@@ -0,0 +1,53 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateMark(t *testing.T) {
+	negative := -1
+	tests := []struct {
+		mark   *Mark
+		fields []string
+		msg    string
+	}{
+		{mark: &Mark{Type: MarkTypeHighlight, Data: "d"}},
+		{mark: &Mark{Type: MarkTypeNote, UserNote: "n", Location: &Location{Chapter: "1"}}},
+		{mark: &Mark{Type: "POEM", Data: "d"}, fields: []string{"type"}, msg: "Type POEM is not supported"},
+		{
+			mark:   &Mark{Type: "POEM", Location: &Location{Page: &negative, Location: &negative}},
+			fields: []string{"type", "data", "location.page", "location.location"},
+			msg:    "Type POEM is not supported; Expect 'data' or 'note' to be set; Expect a non-negative page, got -1; Expect a non-negative location, got -1",
+		},
+	}
+	for i, tt := range tests {
+		err := ValidateMark(tt.mark)
+		if tt.fields == nil {
+			assert.NoError(t, err, "case #%d", i)
+			continue
+		}
+		verr, ok := err.(*ValidationError)
+		if !assert.True(t, ok, "case #%d", i) {
+			continue
+		}
+		var fields []string
+		for _, fe := range verr.Errors {
+			fields = append(fields, fe.Field)
+		}
+		assert.Equal(t, tt.fields, fields, "case #%d", i)
+		assert.Equal(t, tt.msg, err.Error(), "case #%d", i)
+	}
+
+	verr := &ValidationError{}
+	assert.NoError(t, verr.Err())
+	assert.True(t, verr.Merge("marks.1", ValidateMark(&Mark{Type: "POEM", Data: "d"})))
+	assert.False(t, verr.Merge("marks.2", nil))
+	assert.Equal(t, []*FieldError{{Field: "marks.1.type", Message: "Type POEM is not supported"}}, verr.Errors)
+}
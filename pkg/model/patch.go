@@ -0,0 +1,274 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MarkFields are the fields of the marks that can be updated, in the names of the document keys,
+// they are the fields of the patches and the revisions, in the order of the changes.
+var MarkFields = []string{"type", "title", "author", "section", "location.chapter", "location.page", "location.location", "data", "note", "tags", "owner"}
+
+// requiredFields are the fields that can't be cleared.
+var requiredFields = map[string]bool{"type": true, "title": true, "author": true}
+
+// MarkPatch is a partial update of a mark, the fields in the mask are set to their values in the mark,
+// or cleared if the values are empty, and the other fields are left unchanged.
+type MarkPatch struct {
+	Mark *Mark
+	// Fields is the mask of the fields to update, in the names of MarkFields, e.g. "note" or "location.page".
+	Fields []string
+}
+
+// Has returns whether the field is in the mask.
+func (p *MarkPatch) Has(field string) bool {
+	for _, f := range p.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Set adds the fields to the mask.
+func (p *MarkPatch) Set(fields ...string) {
+	for _, field := range fields {
+		if !p.Has(field) {
+			p.Fields = append(p.Fields, field)
+		}
+	}
+}
+
+// Clear adds the fields to the mask and empties their values, so they are cleared.
+func (p *MarkPatch) Clear(fields ...string) {
+	if p.Mark == nil {
+		p.Mark = &Mark{}
+	}
+	m := p.Mark
+	for _, field := range fields {
+		switch field {
+		case "type":
+			m.Type = ""
+		case "title":
+			m.Title = ""
+		case "author":
+			m.Author = ""
+		case "section":
+			m.Section = ""
+		case "data":
+			m.Data = ""
+		case "note":
+			m.UserNote = ""
+		case "tags":
+			m.Tags = nil
+		case "owner":
+			m.Owner = ""
+		case "location.chapter", "location.page", "location.location":
+			if m.Location == nil {
+				break
+			}
+			switch field {
+			case "location.chapter":
+				m.Location.Chapter = ""
+			case "location.page":
+				m.Location.Page = nil
+			default:
+				m.Location.Location = nil
+			}
+		}
+	}
+	p.Set(fields...)
+}
+
+// SetString sets the field from its string form, an integer for the pages and the locations, and the tags
+// separated by ",", an empty value clears the field. It returns a *ValidationError for an unknown field or an invalid value.
+func (p *MarkPatch) SetString(field, value string) error {
+	if value == "" {
+		p.Clear(field)
+		return nil
+	}
+	if p.Mark == nil {
+		p.Mark = &Mark{}
+	}
+	m := p.Mark
+	switch field {
+	case "type":
+		m.Type = value
+	case "title":
+		m.Title = value
+	case "author":
+		m.Author = value
+	case "section":
+		m.Section = value
+	case "data":
+		m.Data = value
+	case "note":
+		m.UserNote = value
+	case "owner":
+		m.Owner = value
+	case "tags":
+		m.Tags = nil
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				m.Tags = append(m.Tags, tag)
+			}
+		}
+	case "location.chapter", "location.page", "location.location":
+		if m.Location == nil {
+			m.Location = &Location{}
+		}
+		if field == "location.chapter" {
+			m.Location.Chapter = value
+			break
+		}
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			verr := &ValidationError{}
+			verr.add(field, fmt.Sprintf("Invalid %s %q, expecting an integer", field, value))
+			return verr.Err()
+		}
+		if field == "location.page" {
+			m.Location.Page = &i
+		} else {
+			m.Location.Location = &i
+		}
+	default:
+		verr := &ValidationError{}
+		verr.add(field, fmt.Sprintf("Unknown field %q, expecting one of %s", field, strings.Join(MarkFields, ", ")))
+		return verr.Err()
+	}
+	p.Set(field)
+	return nil
+}
+
+// Without returns a copy of the patch without the fields in the mask.
+func (p *MarkPatch) Without(fields ...string) *MarkPatch {
+	ret := &MarkPatch{Mark: p.Mark}
+	for _, f := range p.Fields {
+		keep := true
+		for _, field := range fields {
+			keep = keep && f != field
+		}
+		if keep {
+			ret.Fields = append(ret.Fields, f)
+		}
+	}
+	return ret
+}
+
+// Value returns the value of the field in the patch in the types of FieldValues, nil if it's cleared.
+func (p *MarkPatch) Value(field string) interface{} {
+	if p.Mark == nil {
+		return nil
+	}
+	return FieldValues(p.Mark)[field]
+}
+
+// Validate returns a *ValidationError that reports the unknown fields in the mask, the required fields
+// that are cleared, and the invalid values.
+func (p *MarkPatch) Validate() error {
+	verr := &ValidationError{}
+	for _, field := range p.Fields {
+		known := false
+		for _, f := range MarkFields {
+			known = known || f == field
+		}
+		num, isNum := p.Value(field).(int)
+		switch {
+		case !known:
+			verr.add(field, fmt.Sprintf("Unknown field %q, expecting one of %s", field, strings.Join(MarkFields, ", ")))
+		case requiredFields[field] && p.Value(field) == nil:
+			verr.add(field, fmt.Sprintf("Field %q can't be cleared", field))
+		case field == "type":
+			validateType(verr, p.Value(field).(string))
+		case field == "location.page" && isNum && num < 0:
+			verr.add(field, fmt.Sprintf("Expect a non-negative page, got %d", num))
+		case field == "location.location" && isNum && num < 0:
+			verr.add(field, fmt.Sprintf("Expect a non-negative location, got %d", num))
+		}
+	}
+	return verr.Err()
+}
+
+// Apply applies the patch to the mark.
+func (p *MarkPatch) Apply(m *Mark) {
+	for _, field := range p.Fields {
+		val := p.Value(field)
+		str, _ := val.(string)
+		switch field {
+		case "type":
+			m.Type = str
+		case "title":
+			m.Title = str
+		case "author":
+			m.Author = str
+		case "section":
+			m.Section = str
+		case "data":
+			m.Data = str
+		case "note":
+			m.UserNote = str
+		case "owner":
+			m.Owner = str
+		case "tags":
+			m.Tags = p.Mark.Tags
+		case "location.chapter", "location.page", "location.location":
+			if m.Location == nil {
+				m.Location = &Location{}
+			}
+			i, ok := val.(int)
+			switch field {
+			case "location.chapter":
+				m.Location.Chapter = str
+			case "location.page":
+				m.Location.Page = nil
+				if ok {
+					m.Location.Page = &i
+				}
+			default:
+				m.Location.Location = nil
+				if ok {
+					m.Location.Location = &i
+				}
+			}
+		}
+	}
+}
+
+// FieldValues returns the values of the MarkFields of the mark that are set, an int for the pages and the locations,
+// a []string for the tags, and a string for the others.
+func FieldValues(m *Mark) map[string]interface{} {
+	values := map[string]interface{}{
+		"type":    m.Type,
+		"title":   m.Title,
+		"author":  m.Author,
+		"section": m.Section,
+		"data":    m.Data,
+		"note":    m.UserNote,
+		"owner":   m.Owner,
+	}
+	if len(m.Tags) > 0 {
+		values["tags"] = m.Tags
+	}
+	if m.Location != nil {
+		values["location.chapter"] = m.Location.Chapter
+		if m.Location.Page != nil {
+			values["location.page"] = *m.Location.Page
+		}
+		if m.Location.Location != nil {
+			values["location.location"] = *m.Location.Location
+		}
+	}
+	for _, field := range MarkFields {
+		if s, ok := values[field].(string); ok && s == "" {
+			delete(values, field)
+		}
+	}
+	return values
+}
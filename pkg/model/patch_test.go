@@ -0,0 +1,59 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkPatchApply(t *testing.T) {
+	page, loc := 1, 2
+	mark := &Mark{Type: MarkTypeNote, Title: "T", Author: "A", UserNote: "N", Location: &Location{Chapter: "C", Page: &page}, Tags: []string{"x"}}
+
+	patch := &MarkPatch{Mark: &Mark{Title: "U", Location: &Location{Location: &loc}}, Fields: []string{"title", "location.location"}}
+	patch.Clear("note", "tags", "location.chapter")
+	assert.NoError(t, patch.Validate())
+	patch.Apply(mark)
+	assert.Equal(t, &Mark{Type: MarkTypeNote, Title: "U", Author: "A", Location: &Location{Page: &page, Location: &loc}}, mark)
+
+	assert.Equal(t, []string{"location.location", "note"}, patch.Without("title", "tags", "location.chapter").Fields)
+}
+
+func TestMarkPatchValidate(t *testing.T) {
+	page := -1
+	for i, patch := range []*MarkPatch{
+		{Mark: &Mark{}, Fields: []string{"unknown"}},
+		{Mark: &Mark{}, Fields: []string{"title"}},
+		{Mark: &Mark{Type: "unknown"}, Fields: []string{"type"}},
+		{Mark: &Mark{Location: &Location{Page: &page}}, Fields: []string{"location.page"}},
+	} {
+		assert.Error(t, patch.Validate(), "case #%d", i)
+	}
+
+	for i, field := range []string{"location.chapter", "location.page", "location.location"} {
+		patch := &MarkPatch{}
+		patch.Clear(field)
+		assert.NoError(t, patch.Validate(), "case #%d", i)
+		patch = &MarkPatch{Mark: &Mark{Location: &Location{Chapter: "C", Page: &page, Location: &page}}}
+		patch.Clear(field)
+		assert.NoError(t, patch.Validate(), "case #%d", i)
+	}
+}
+
+func TestMarkPatchSetString(t *testing.T) {
+	patch := &MarkPatch{}
+	assert.NoError(t, patch.SetString("note", "N"))
+	assert.NoError(t, patch.SetString("location.page", "7"))
+	assert.NoError(t, patch.SetString("tags", "a, b/c,"))
+	assert.NoError(t, patch.SetString("section", ""))
+	assert.Equal(t, []string{"note", "location.page", "tags", "section"}, patch.Fields)
+	assert.Equal(t, map[string]interface{}{"note": "N", "location.page": 7, "tags": []string{"a", "b/c"}}, FieldValues(patch.Mark))
+
+	assert.Error(t, patch.SetString("location.location", "x"))
+	assert.Error(t, patch.SetString("unknown", "x"))
+}
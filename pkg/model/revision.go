@@ -0,0 +1,24 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package model
+
+// Revision records an update of a mark.
+type Revision struct {
+	ID      string    `json:"id"`
+	MarkID  string    `json:"markId"`
+	Changes []*Change `json:"changes"`
+	// Actor is the user who made the update, empty if it's unknown.
+	Actor     string `json:"actor,omitempty"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// Change is the change of a field in a revision, the values are nil if the field is not set,
+// an int for the pages and the locations, a []string for the tags, and a string for the others.
+type Change struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
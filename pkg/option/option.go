@@ -0,0 +1,203 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+// Package option describes the configurable options of the parsers, exporters and storages,
+// independently of where the values come from (flags, config files, http requests or Go code).
+package option
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+const (
+	TypeString      = "string"
+	TypeBool        = "bool"
+	TypeInt         = "int"
+	TypeFloat       = "float"
+	TypeStringSlice = "stringSlice"
+)
+
+// Option is a typed option whose value is stored in Target, which must be one of
+// *string, *bool, *int, *float64 and *[]string. Default must be of the element type of Target.
+type Option struct {
+	// Name is the name of the option, prefixed by the plugin name, e.g. "json.pretty".
+	Name        string
+	Shorthand   string
+	Default     interface{}
+	Description string
+	// Deprecated is the deprecation message, the option is hidden from the help if it's set.
+	Deprecated string
+	// Local is set for the options of the local resources, e.g. file paths, which can't be set remotely.
+	Local  bool
+	Target interface{}
+}
+
+// Type returns the type name of the option.
+func (o *Option) Type() string {
+	switch o.Target.(type) {
+	case *string:
+		return TypeString
+	case *bool:
+		return TypeBool
+	case *int:
+		return TypeInt
+	case *float64:
+		return TypeFloat
+	case *[]string:
+		return TypeStringSlice
+	default:
+		panic(fmt.Sprintf("unsupported target type %T of option %q", o.Target, o.Name))
+	}
+}
+
+// Reset sets the target to the default value.
+func (o *Option) Reset() {
+	switch t := o.Target.(type) {
+	case *string:
+		*t, _ = o.Default.(string)
+	case *bool:
+		*t, _ = o.Default.(bool)
+	case *int:
+		*t, _ = o.Default.(int)
+	case *float64:
+		*t, _ = o.Default.(float64)
+	case *[]string:
+		def, _ := o.Default.([]string)
+		*t = append([]string(nil), def...)
+	default:
+		panic(fmt.Sprintf("unsupported target type %T of option %q", o.Target, o.Name))
+	}
+}
+
+// Set parses the value and sets it to the target, the values of a string slice are separated by ",".
+func (o *Option) Set(value string) error {
+	var err error
+	switch t := o.Target.(type) {
+	case *string:
+		*t = value
+	case *bool:
+		*t, err = strconv.ParseBool(value)
+	case *int:
+		*t, err = strconv.Atoi(value)
+	case *float64:
+		*t, err = strconv.ParseFloat(value, 64)
+	case *[]string:
+		*t = nil
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				*t = append(*t, v)
+			}
+		}
+	default:
+		panic(fmt.Sprintf("unsupported target type %T of option %q", o.Target, o.Name))
+	}
+	if err != nil {
+		return errors.New(fmt.Sprintf("invalid value %q for option %q, expecting a %s", value, o.Name, o.Type()))
+	}
+	return nil
+}
+
+// Reset sets all the options to their default values.
+func Reset(opts []*Option) {
+	for _, o := range opts {
+		o.Reset()
+	}
+}
+
+// Copy sets the options to the values of the options with the same names in src,
+// the options that are missing in src are left unchanged.
+func Copy(opts, src []*Option) {
+	byName := make(map[string]*Option)
+	for _, o := range src {
+		byName[o.Name] = o
+	}
+	for _, o := range opts {
+		s, ok := byName[o.Name]
+		if !ok {
+			continue
+		}
+		switch t := o.Target.(type) {
+		case *string:
+			*t = *s.Target.(*string)
+		case *bool:
+			*t = *s.Target.(*bool)
+		case *int:
+			*t = *s.Target.(*int)
+		case *float64:
+			*t = *s.Target.(*float64)
+		case *[]string:
+			*t = append([]string(nil), *s.Target.(*[]string)...)
+		default:
+			panic(fmt.Sprintf("unsupported target type %T of option %q", o.Target, o.Name))
+		}
+	}
+}
+
+// Apply sets the options from the values keyed by the option names, unknown names are rejected.
+func Apply(opts []*Option, values map[string]string) error {
+	byName := make(map[string]*Option)
+	for _, o := range opts {
+		byName[o.Name] = o
+	}
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		o, ok := byName[name]
+		if !ok {
+			return errors.New(fmt.Sprintf("unknown option %q", name))
+		}
+		if err := o.Set(values[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckRemote returns an error if any of the values is for a local option, the unknown names are left to Apply.
+func CheckRemote(opts []*Option, values map[string]string) error {
+	for _, o := range opts {
+		if _, ok := values[o.Name]; ok && o.Local {
+			return errors.New(fmt.Sprintf("option %q can't be set remotely", o.Name))
+		}
+	}
+	return nil
+}
+
+// BindFlags defines a flag for each option in the flag set.
+func BindFlags(fs *pflag.FlagSet, opts []*Option) {
+	for _, o := range opts {
+		switch t := o.Target.(type) {
+		case *string:
+			def, _ := o.Default.(string)
+			fs.StringVarP(t, o.Name, o.Shorthand, def, o.Description)
+		case *bool:
+			def, _ := o.Default.(bool)
+			fs.BoolVarP(t, o.Name, o.Shorthand, def, o.Description)
+		case *int:
+			def, _ := o.Default.(int)
+			fs.IntVarP(t, o.Name, o.Shorthand, def, o.Description)
+		case *float64:
+			def, _ := o.Default.(float64)
+			fs.Float64VarP(t, o.Name, o.Shorthand, def, o.Description)
+		case *[]string:
+			def, _ := o.Default.([]string)
+			fs.StringSliceVarP(t, o.Name, o.Shorthand, def, o.Description)
+		default:
+			panic(fmt.Sprintf("unsupported target type %T of option %q", o.Target, o.Name))
+		}
+		if o.Deprecated != "" {
+			fs.MarkDeprecated(o.Name, o.Deprecated)
+		}
+	}
+}
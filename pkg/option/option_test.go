@@ -0,0 +1,90 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package option
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+type testConfig struct {
+	Name    string
+	Enabled bool
+	Count   int
+	Ratio   float64
+	Tags    []string
+}
+
+func (c *testConfig) options() []*Option {
+	return []*Option{
+		{Name: "test.name", Target: &c.Name, Default: "foo"},
+		{Name: "test.enabled", Target: &c.Enabled, Default: true},
+		{Name: "test.count", Target: &c.Count, Default: 3},
+		{Name: "test.ratio", Target: &c.Ratio, Default: 0.5},
+		{Name: "test.tags", Target: &c.Tags, Default: []string{"a"}},
+	}
+}
+
+func TestResetAndApply(t *testing.T) {
+	var cfg testConfig
+	opts := cfg.options()
+	Reset(opts)
+	assert.Equal(t, testConfig{Name: "foo", Enabled: true, Count: 3, Ratio: 0.5, Tags: []string{"a"}}, cfg)
+
+	for i, tt := range []struct {
+		values map[string]string
+		expect testConfig
+		err    string
+	}{
+		{
+			values: map[string]string{"test.name": "bar", "test.enabled": "false", "test.count": "7", "test.ratio": "0.9", "test.tags": "x, y"},
+			expect: testConfig{Name: "bar", Count: 7, Ratio: 0.9, Tags: []string{"x", "y"}},
+		},
+		{
+			values: map[string]string{"test.count": "many"},
+			err:    `invalid value "many" for option "test.count"`,
+		},
+		{
+			values: map[string]string{"test.unknown": "1"},
+			err:    `unknown option "test.unknown"`,
+		},
+	} {
+		Reset(opts)
+		err := Apply(opts, tt.values)
+		if tt.err != "" {
+			if assert.Error(t, err, "case #%d", i) {
+				assert.Contains(t, err.Error(), tt.err, "case #%d", i)
+			}
+			continue
+		}
+		assert.NoError(t, err, "case #%d", i)
+		assert.Equal(t, tt.expect, cfg, "case #%d", i)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	src := testConfig{Name: "bar", Count: 7, Tags: []string{"x"}}
+	var cfg testConfig
+	opts := cfg.options()
+	Reset(opts)
+	Copy(opts, src.options()[:4])
+	assert.Equal(t, testConfig{Name: "bar", Count: 7, Tags: []string{"a"}}, cfg)
+
+	Copy(opts, src.options())
+	src.Tags[0] = "y"
+	assert.Equal(t, []string{"x"}, cfg.Tags)
+}
+
+func TestBindFlags(t *testing.T) {
+	var cfg testConfig
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	BindFlags(fs, cfg.options())
+	assert.Equal(t, "foo", cfg.Name)
+	assert.NoError(t, fs.Parse([]string{"--test.name", "bar", "--test.count=2", "--test.tags", "b,c"}))
+	assert.Equal(t, testConfig{Name: "bar", Enabled: true, Count: 2, Ratio: 0.5, Tags: []string{"b", "c"}}, cfg)
+}
@@ -0,0 +1,81 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package parser
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// AutoParser is the parser name that detects the parser to use from the input.
+	AutoParser = "auto"
+
+	// ambiguityMargin is the minimum confidence lead the best parser needs over the others.
+	ambiguityMargin = 0.1
+)
+
+// ErrUndetected is wrapped by the errors of the inputs that no parser recognizes.
+var ErrUndetected = errors.New("unable to detect the format, please specify the parser")
+
+// Detector is implemented by the parsers that can recognize their input format.
+type Detector interface {
+	// Detect returns the confidence, from 0 to 1, that the input with the given
+	// header and filename can be handled by the parser.
+	Detect(header []byte, filename string) (confidence float64)
+}
+
+// Candidate is a parser that can possibly handle an input.
+type Candidate struct {
+	Parser     Parser
+	Confidence float64
+}
+
+func (c Candidate) String() string {
+	return fmt.Sprintf("%s (%.2f)", c.Parser.Name(), c.Confidence)
+}
+
+// Detect sniffs the source and returns the registered parser that fits it best.
+func (r *Registry) Detect(src *Source) (*Candidate, error) {
+	header, err := src.Header()
+	if err != nil {
+		return nil, err
+	}
+	filename := filepath.Base(src.Name())
+
+	var candidates []Candidate
+	for _, parser := range r.parsers {
+		detector, ok := parser.(Detector)
+		if !ok {
+			continue
+		}
+		if confidence := detector.Detect(header, filename); confidence > 0 {
+			candidates = append(candidates, Candidate{Parser: parser, Confidence: confidence})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Confidence == candidates[j].Confidence {
+			return candidates[i].Parser.Name() < candidates[j].Parser.Name()
+		}
+		return candidates[i].Confidence > candidates[j].Confidence
+	})
+
+	switch {
+	case len(candidates) == 0:
+		return nil, errors.Wrap(ErrUndetected, fmt.Sprintf("%q", src.Name()))
+	case len(candidates) > 1 && candidates[0].Confidence-candidates[1].Confidence < ambiguityMargin:
+		var names []string
+		for _, c := range candidates {
+			names = append(names, c.String())
+		}
+		return nil, errors.New(fmt.Sprintf("ambiguous format of %q, candidates: %s, please specify the parser", src.Name(), strings.Join(names, ", ")))
+	}
+	return &candidates[0], nil
+}
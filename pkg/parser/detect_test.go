@@ -0,0 +1,62 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/option"
+)
+
+type fakeParser struct {
+	name       string
+	confidence float64
+}
+
+func (p *fakeParser) Name() string                                  { return p.name }
+func (p *fakeParser) Options() []*option.Option                     { return nil }
+func (p *fakeParser) Parse(src *Source) ([]*model.Book, error)      { return nil, nil }
+func (p *fakeParser) Detect(header []byte, filename string) float64 { return p.confidence }
+
+func TestDetectParser(t *testing.T) {
+	tests := []struct {
+		parsers []*fakeParser
+		result  string
+		err     string
+	}{
+		{
+			parsers: []*fakeParser{{"a", 0.9}, {"b", 0.3}},
+			result:  "a",
+		},
+		{
+			parsers: []*fakeParser{{"a", 0.2}, {"b", 0.6}, {"c", 0}},
+			result:  "b",
+		},
+		{
+			parsers: []*fakeParser{{"a", 0}, {"b", 0}},
+			err:     "unable to detect",
+		},
+		{
+			parsers: []*fakeParser{{"a", 0.8}, {"b", 0.75}, {"c", 0.1}},
+			err:     "candidates: a (0.80), b (0.75), c (0.10)",
+		},
+	}
+
+	for i, tt := range tests {
+		registry := NewRegistry()
+		for _, p := range tt.parsers {
+			assert.NoError(t, registry.Register(p))
+		}
+		candidate, err := registry.Detect(NewSource("input", strings.NewReader("content")))
+		if tt.err != "" {
+			assert.Error(t, err, "case #%d", i)
+			assert.Contains(t, err.Error(), tt.err, "case #%d", i)
+			assert.Equal(t, tt.err == "unable to detect", errors.Is(err, ErrUndetected), "case #%d", i)
+			continue
+		}
+		assert.NoError(t, err, "case #%d", i)
+		assert.Equal(t, tt.result, candidate.Parser.Name(), "case #%d", i)
+	}
+}
@@ -7,51 +7,79 @@ package parser
 
 import (
 	"fmt"
+	"reflect"
+	"sort"
 	"strings"
 
-	"github.com/spf13/cobra"
+	"github.com/pkg/errors"
 	"github.com/yifan-gu/blueNote/pkg/model"
-	"github.com/yifan-gu/blueNote/pkg/util"
+	"github.com/yifan-gu/blueNote/pkg/option"
 )
 
-var registeredParsers map[string]Parser
-
 type Parser interface {
 	Name() string
-	LoadConfigs(cmd *cobra.Command)
-	Parse(inputPath string) ([]*model.Book, error)
+	// Options returns the options of the parser, which are bound to its fields.
+	Options() []*option.Option
+	Parse(src *Source) ([]*model.Book, error)
+}
+
+// Registry holds the parsers by their names.
+type Registry struct {
+	parsers map[string]Parser
+}
+
+func NewRegistry() *Registry {
+	return &Registry{parsers: make(map[string]Parser)}
 }
 
-func RegisterParser(parser Parser) {
+func (r *Registry) Register(parser Parser) error {
 	name := strings.ToLower(parser.Name())
-	if registeredParsers == nil {
-		registeredParsers = make(map[string]Parser)
+	if _, ok := r.parsers[name]; ok {
+		return errors.New(fmt.Sprintf("Name conflict for parser %q", name))
 	}
-	if _, ok := registeredParsers[name]; ok {
-		util.Fatal(fmt.Errorf("Name conflict for parser %q", name))
-	}
-	registeredParsers[name] = parser
+	r.parsers[name] = parser
+	return nil
 }
 
-func GetParser(name string) Parser {
+func (r *Registry) Get(name string) (Parser, error) {
 	name = strings.ToLower(name)
-	parser, ok := registeredParsers[name]
+	parser, ok := r.parsers[name]
 	if !ok {
-		util.Fatal(fmt.Errorf("unrecognized parser type: %q", name))
+		return nil, errors.New(fmt.Sprintf("unrecognized parser type: %q", name))
 	}
-	return parser
+	return parser, nil
 }
 
-func ListParsers() []string {
+func (r *Registry) List() []string {
 	var names []string
-	for _, parser := range registeredParsers {
+	for _, parser := range r.parsers {
 		names = append(names, parser.Name())
 	}
+	sort.Strings(names)
 	return names
 }
 
-func LoadConfigs(cmd *cobra.Command) {
-	for _, parser := range registeredParsers {
-		parser.LoadConfigs(cmd)
+// Options returns the options of all the parsers.
+func (r *Registry) Options() []*option.Option {
+	var opts []*option.Option
+	for _, name := range r.List() {
+		opts = append(opts, r.parsers[strings.ToLower(name)].Options()...)
+	}
+	return opts
+}
+
+// New creates a new instance of the parser with the options of the registered one, overridden by the values,
+// so it can be configured without affecting the registered one, e.g. per http request.
+func (r *Registry) New(name string, values map[string]string) (Parser, error) {
+	parser, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	instance := reflect.New(reflect.TypeOf(parser).Elem()).Interface().(Parser)
+	opts := instance.Options()
+	option.Copy(opts, parser.Options())
+	if err := option.Apply(opts, values); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("invalid options for parser %q", name))
 	}
+	return instance, nil
 }
@@ -6,66 +6,75 @@ Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
 package json
 
 import (
+	"bytes"
 	jsonenc "encoding/json"
-	"io/ioutil"
-	"os"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
 
 	"github.com/pkg/errors"
-	"github.com/spf13/cobra"
 	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/option"
+	"github.com/yifan-gu/blueNote/pkg/parser"
+	"github.com/yifan-gu/blueNote/pkg/transform"
 )
 
+// Config is the config of the json parser.
+type Config struct {
+	// Author overrides the book author name if it's not empty.
+	Author string
+	// Title overrides the book title name if it's not empty.
+	Title string
+}
+
 type JSONParser struct {
-	authorOverride string
-	titleOverride  string
-	stdin          bool
+	Config Config
+	stdin  bool
 }
 
 func (p *JSONParser) Name() string {
 	return "json"
 }
 
-func (p *JSONParser) LoadConfigs(cmd *cobra.Command) {
-	cmd.PersistentFlags().BoolVar(&p.stdin, "json.stdin", false, "Treat the input as a json object")
-	cmd.PersistentFlags().StringVar(&p.authorOverride, "json.author", "", "override the book author name")
-	cmd.PersistentFlags().StringVar(&p.titleOverride, "json.title", "", "override the book title name")
+func (p *JSONParser) Options() []*option.Option {
+	return []*option.Option{
+		{Name: "json.stdin", Target: &p.stdin, Description: "Treat the input as a json object", Deprecated: "pass \"-\" as the input or omit the input instead"},
+		{Name: "json.author", Target: &p.Config.Author, Description: "override the book author name"},
+		{Name: "json.title", Target: &p.Config.Title, Description: "override the book title name"},
+	}
 }
 
-func (p *JSONParser) Parse(inputPath string) ([]*model.Book, error) {
-	var books []*model.Book
-	var data []byte
-	var err error
-
-	if p.stdin {
-		data, err = ioutil.ReadAll(os.Stdin)
-	} else {
-		if inputPath == "" {
-			return nil, errors.New("Input file is missing!")
+// Detect recognizes a json array or object, preferably with the fields of a book.
+func (p *JSONParser) Detect(header []byte, filename string) float64 {
+	header = bytes.TrimSpace(bytes.TrimPrefix(header, []byte("\uFEFF")))
+	isJSONFile := strings.EqualFold(filepath.Ext(filename), ".json")
+	switch {
+	case len(header) == 0 || (header[0] != '[' && header[0] != '{'):
+		if isJSONFile {
+			return 0.2
 		}
-		data, err = ioutil.ReadFile(inputPath)
+		return 0
+	case bytes.Contains(header, []byte(`"title"`)) && bytes.Contains(header, []byte(`"author"`)):
+		return 0.9
+	case isJSONFile:
+		return 0.7
+	default:
+		return 0.5
 	}
+}
+
+func (p *JSONParser) Parse(src *parser.Source) ([]*model.Book, error) {
+	var books []*model.Book
+
+	data, err := io.ReadAll(src)
 	if err != nil {
 		return nil, errors.Wrap(err, "")
 	}
 	if err := jsonenc.Unmarshal(data, &books); err != nil {
-		return nil, errors.Wrap(err, "")
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to unmarshal json from %q", src.Name()))
 	}
 
-	if p.authorOverride != "" {
-		for _, bk := range books {
-			bk.Author = p.authorOverride
-			for i := range bk.Marks {
-				bk.Marks[i].Author = p.authorOverride
-			}
-		}
-	}
-	if p.titleOverride != "" {
-		for _, bk := range books {
-			bk.Title = p.titleOverride
-			for i := range bk.Marks {
-				bk.Marks[i].Title = p.titleOverride
-			}
-		}
-	}
+	transform.Override(books, p.Config.Title, p.Config.Author)
 	return books, nil
 }
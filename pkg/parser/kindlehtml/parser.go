@@ -6,49 +6,71 @@ Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
 package kindlehtml
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"io"
-	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
-	"github.com/spf13/cobra"
 	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/option"
+	"github.com/yifan-gu/blueNote/pkg/parser"
+	"github.com/yifan-gu/blueNote/pkg/transform"
 	"github.com/yifan-gu/blueNote/pkg/util"
 	"golang.org/x/net/html"
 )
 
 var numberRegexp = regexp.MustCompile(`\d+`)
 
+// Config is the config of the kindle html parser.
+type Config struct {
+	// Author overrides the book author name if it's not empty.
+	Author string
+	// Title overrides the book title name if it's not empty.
+	Title string
+	// Split splits the sub-sections into separate books.
+	Split bool
+}
+
 type KindleHTMLParser struct {
-	authorOverride string
-	titleOverride  string
-	splitBook      bool
+	Config Config
 }
 
 func (p *KindleHTMLParser) Name() string {
 	return "kindle-html"
 }
 
-func (p *KindleHTMLParser) LoadConfigs(cmd *cobra.Command) {
-	cmd.PersistentFlags().StringVar(&p.authorOverride, "kindle-html.author", "", "override the book author name")
-	cmd.PersistentFlags().StringVar(&p.titleOverride, "kindle-html.title", "", "override the book title name")
-	cmd.PersistentFlags().BoolVarP(&p.splitBook, "kindle-html.split", "s", false, "split sub-sections into separate books")
+func (p *KindleHTMLParser) Options() []*option.Option {
+	return []*option.Option{
+		{Name: "kindle-html.author", Target: &p.Config.Author, Description: "override the book author name"},
+		{Name: "kindle-html.title", Target: &p.Config.Title, Description: "override the book title name"},
+		{Name: "kindle-html.split", Shorthand: "s", Target: &p.Config.Split, Description: "split sub-sections into separate books"},
+	}
 }
 
-func (p *KindleHTMLParser) Parse(inputPath string) ([]*model.Book, error) {
-	f, err := os.Open(inputPath)
-	defer f.Close()
-	if err != nil {
-		return nil, errors.Wrap(err, "")
+// Detect recognizes the notebook html exported from the Kindle app by its class names.
+func (p *KindleHTMLParser) Detect(header []byte, filename string) float64 {
+	lower := bytes.ToLower(header)
+	isHTMLFile := strings.EqualFold(filepath.Ext(filename), ".html") || strings.EqualFold(filepath.Ext(filename), ".htm")
+	switch {
+	case bytes.Contains(header, []byte("bookTitle")) && bytes.Contains(header, []byte("noteHeading")):
+		return 0.95
+	case bytes.Contains(lower, []byte("<html")) && bytes.Contains(header, []byte("notebookFor")):
+		return 0.8
+	case bytes.Contains(lower, []byte("<html")):
+		return 0.3
+	case isHTMLFile:
+		return 0.2
+	default:
+		return 0
 	}
+}
 
-	buf := bufio.NewReader(f)
-	tokenizer := html.NewTokenizer(buf)
+func (p *KindleHTMLParser) Parse(src *parser.Source) ([]*model.Book, error) {
+	tokenizer := html.NewTokenizer(src)
 
 	var book model.Book
 	var section string
@@ -59,7 +81,7 @@ func (p *KindleHTMLParser) Parse(inputPath string) ([]*model.Book, error) {
 			if tokenizer.Err() == io.EOF {
 				break
 			}
-			return nil, errors.Wrap(tokenizer.Err(), fmt.Sprintf("tokenize error for %q", inputPath))
+			return nil, errors.Wrap(tokenizer.Err(), fmt.Sprintf("tokenize error for %q", src.Name()))
 		}
 
 		token := tokenizer.Token()
@@ -71,71 +93,27 @@ func (p *KindleHTMLParser) Parse(inputPath string) ([]*model.Book, error) {
 			switch attr.Val {
 			case "bookTitle":
 				tokenizer.Next()
-				if p.titleOverride != "" {
-					book.Title = p.titleOverride
-				} else {
-					book.Title = strings.TrimSpace(string(tokenizer.Raw()))
-				}
+				book.Title = strings.TrimSpace(string(tokenizer.Raw()))
 			case "authors":
 				tokenizer.Next()
-				if p.authorOverride != "" {
-					book.Author = p.authorOverride
-				} else {
-					book.Author = strings.Join(strings.Fields(strings.TrimSpace(string(tokenizer.Raw()))), ".")
-				}
+				book.Author = strings.Join(strings.Fields(strings.TrimSpace(string(tokenizer.Raw()))), ".")
 			case "sectionHeading":
 				tokenizer.Next()
 				section = strings.TrimSpace(string(tokenizer.Raw()))
 			case "noteHeading":
 				if err := handleNoteEntry(tokenizer, &book, section); err != nil {
-					return nil, errors.Wrap(err, fmt.Sprintf("failed to handle note for %q", inputPath))
+					return nil, errors.Wrap(err, fmt.Sprintf("failed to handle note for %q", src.Name()))
 				}
 			}
 		}
 	}
 
-	if p.splitBook {
-		return splitBook(&book), nil
+	books := []*model.Book{&book}
+	transform.Override(books, p.Config.Title, p.Config.Author)
+	if p.Config.Split {
+		return transform.SplitSections(&book), nil
 	}
-	return []*model.Book{&book}, nil
-}
-
-// splitBook will turn a book into multiple  books.
-// It's useful when the input is a book collection.
-func splitBook(bk *model.Book) []*model.Book {
-	var books []*model.Book
-	var sectionTitles []string
-	sectionMap := make(map[string][]*model.Mark)
-
-	for _, mk := range bk.Marks {
-		if mk.Section != "" {
-			if _, ok := sectionMap[mk.Section]; !ok {
-				sectionTitles = append(sectionTitles, mk.Section)
-			}
-			sectionMap[mk.Section] = append(sectionMap[mk.Section], &model.Mark{
-				Type:     mk.Type,
-				Title:    mk.Section,
-				Author:   bk.Author,
-				Section:  mk.Location.Chapter,
-				Location: mk.Location,
-				Data:     mk.Data,
-				UserNote: mk.UserNote,
-			})
-		}
-	}
-
-	for _, sectionTitle := range sectionTitles {
-		books = append(books, &model.Book{
-			Title:  sectionTitle,
-			Author: bk.Author,
-			Marks:  sectionMap[sectionTitle],
-		})
-	}
-	if len(books) == 0 {
-		books = []*model.Book{bk}
-	}
-
-	return books
+	return books, nil
 }
 
 func handleNextText(tokenizer *html.Tokenizer, f func(tokenizer *html.Tokenizer)) error {
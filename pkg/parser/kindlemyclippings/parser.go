@@ -7,58 +7,84 @@ package kindlemyclippings
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
-	"os"
+	"io"
 	"strings"
 	"time"
 	"unicode"
 
 	"github.com/pkg/errors"
-	"github.com/spf13/cobra"
 	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/option"
+	"github.com/yifan-gu/blueNote/pkg/parser"
+	"github.com/yifan-gu/blueNote/pkg/util"
 )
 
+const defaultMinSimilarity = 0.8
+
+// Config is the config of the "My Clippings.txt" parser.
+type Config struct {
+	MinSimilarity float64 // Threshold for deduplication (0 to 1)
+}
+
 type KindleMyClippingsParser struct {
-	minSimilarity float64 // Threshold for deduplication (0 to 1)
+	Config Config
 }
 
 func (p *KindleMyClippingsParser) Name() string { return "kindle-my-clippings" }
 
-// LoadConfigs sets up the flags for the parser.
-func (p *KindleMyClippingsParser) LoadConfigs(cmd *cobra.Command) {
-	cmd.Flags().Float64Var(&p.minSimilarity, "min-similarity", 0.8, "Minimum similarity percentage (0-1) to consider a highlight as duplicate")
+// Options returns the options of the parser.
+func (p *KindleMyClippingsParser) Options() []*option.Option {
+	return []*option.Option{
+		{Name: "kindle-my-clippings.min-similarity", Target: &p.Config.MinSimilarity, Default: defaultMinSimilarity, Description: "Minimum similarity percentage (0-1) to consider a highlight as duplicate"},
+		{Name: "min-similarity", Target: &p.Config.MinSimilarity, Default: defaultMinSimilarity, Description: "Minimum similarity percentage (0-1) to consider a highlight as duplicate", Deprecated: "use --kindle-my-clippings.min-similarity instead"},
+	}
 }
 
-func (p *KindleMyClippingsParser) Parse(inputPath string) ([]*model.Book, error) {
-	// Open the file
-	file, err := os.Open(inputPath)
-	defer file.Close()
+// Detect recognizes the "My Clippings.txt" file by its entry separators and metadata lines.
+func (p *KindleMyClippingsParser) Detect(header []byte, filename string) float64 {
+	hasSeparator := bytes.Contains(header, []byte("=========="))
+	hasMeta := bytes.Contains(header, []byte("- Your Highlight")) ||
+		bytes.Contains(header, []byte("- Your Note")) ||
+		bytes.Contains(header, []byte("- Your Bookmark"))
+	switch {
+	case hasSeparator && hasMeta:
+		return 0.95
+	case strings.EqualFold(filename, "My Clippings.txt"):
+		return 0.8
+	case hasSeparator || hasMeta:
+		return 0.5
+	default:
+		return 0
+	}
+}
+
+func (p *KindleMyClippingsParser) Parse(src *parser.Source) ([]*model.Book, error) {
+	// Read the whole input, as it can come from a non-seekable stream (e.g. stdin)
+	data, err := io.ReadAll(src)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to open input file")
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to read input %q", src.Name()))
 	}
 
-	// Count total lines in the file to calculate parsing progress
-	totalLines, err := countLines(file)
+	// Count total lines in the input to calculate parsing progress
+	totalLines, err := countLines(bytes.NewReader(data))
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to count lines in input file")
 	}
-	// Reset the file cursor to the beginning after counting lines
-	if _, err := file.Seek(0, 0); err != nil {
-		return nil, errors.Wrap(err, "failed to reset file cursor")
-	}
 
 	var books []*model.Book
 	markListMap := make(map[string][]*model.Mark) // Maps book title -> list of marks
 
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
 	lineCount := 0  // Total number of lines processed
 	entryCount := 0 // Total number of marks (entries)
 
 	// Function to print parsing progress
+	parsingProgress := util.NewProgress("Parsing lines", totalLines)
 	printParsingProgress := func() {
 		if lineCount%500 == 0 || lineCount == totalLines {
-			progress := (float64(lineCount) / float64(totalLines)) * 100
-			fmt.Fprintf(os.Stderr, "\rParsing Progress: %.2f%% (%d/%d lines processed, %d entries parsed)", progress, lineCount, totalLines, entryCount)
+			parsingProgress.Update(lineCount)
 		}
 	}
 
@@ -135,15 +161,18 @@ func (p *KindleMyClippingsParser) Parse(inputPath string) ([]*model.Book, error)
 		entryCount++
 	}
 
+	parsingProgress.Done()
+
 	// Deduplication phase
 	totalBooks := len(markListMap)
 	processedBooks := 0
+	dedupProgress := util.NewProgress("Deduplicating books", totalBooks)
 
 	for title, marks := range markListMap {
 		processedBooks++
-		fmt.Fprintf(os.Stderr, "\nStarting deduplication for book: %s (%d marks)\n", title, len(marks))
+		util.Debugf("Starting deduplication for book: %s (%d marks)", title, len(marks))
 
-		deduplicatedMarks := deduplicateMarksWithProgress(marks, p.minSimilarity) // Deduplication with progress inside
+		deduplicatedMarks := deduplicateMarksWithProgress(marks, p.Config.MinSimilarity) // Deduplication with progress inside
 		book := &model.Book{
 			Title:  title,
 			Author: marks[0].Author,
@@ -152,13 +181,12 @@ func (p *KindleMyClippingsParser) Parse(inputPath string) ([]*model.Book, error)
 		books = append(books, book)
 
 		// Print progress across books
-		bookProgress := (float64(processedBooks) / float64(totalBooks)) * 100
-		fmt.Fprintf(os.Stderr, "\rTotal Deduplication Progress: %.2f%% (%d/%d books processed)", bookProgress, processedBooks, totalBooks)
+		dedupProgress.Update(processedBooks)
 	}
+	dedupProgress.Done()
 
 	// Final summary
-	fmt.Fprintln(os.Stderr) // Add a newline after the progress output
-	fmt.Fprintf(os.Stderr, "Finished processing: %d lines parsed, %d books deduplicated, %d marks processed\n", lineCount, totalBooks, entryCount)
+	util.LogFields("Finished processing "+src.Name(), util.Fields{"lines": lineCount, "books": totalBooks, "marks": entryCount})
 
 	model.SortBooksByTitle(books)
 
@@ -187,18 +215,15 @@ func deduplicateMarksWithProgress(marks []*model.Mark, minSimilarity float64) []
 
 		// Print deduplication progress for current book every 100 marks
 		if (index+1)%100 == 0 || index+1 == totalMarks {
-			progress := (float64(index+1) / float64(totalMarks)) * 100
-			fmt.Fprintf(os.Stderr, "\rDeduplication Progress for current book: %.2f%% (%d/%d marks processed)", progress, index+1, totalMarks)
+			util.Debugf("Deduplication progress for current book: %d/%d marks processed", index+1, totalMarks)
 		}
 	}
 
-	// Print a new line after finishing the current book
-	fmt.Fprintln(os.Stderr)
 	return deduplicated
 }
 
-func countLines(file *os.File) (int, error) {
-	scanner := bufio.NewScanner(file)
+func countLines(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
 	lineCount := 0
 	for scanner.Scan() {
 		lineCount++
@@ -0,0 +1,185 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package parser
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// StdinInput is the input name that makes the parser read from the stdin.
+	StdinInput = "-"
+	// HeaderSize is the maximum size of the header that can be peeked from a source.
+	HeaderSize = 8192
+)
+
+// Source is a single named input stream that is handed to a parser.
+type Source struct {
+	name     string
+	r        *bufio.Reader
+	expanded bool
+}
+
+// NewSource creates a source with the given name that reads from r.
+func NewSource(name string, r io.Reader) *Source {
+	return &Source{name: name, r: bufio.NewReaderSize(r, HeaderSize)}
+}
+
+// Name returns the name of the source, usually the path of the file.
+func (s *Source) Name() string {
+	return s.name
+}
+
+// Expanded returns whether the source is found in a directory, a glob pattern or a zip archive,
+// instead of being given explicitly, such sources can be skipped if they are not notes.
+func (s *Source) Expanded() bool {
+	return s.expanded
+}
+
+func (s *Source) Read(p []byte) (int, error) {
+	return s.r.Read(p)
+}
+
+// Header returns up to HeaderSize bytes from the beginning of the source without consuming them.
+func (s *Source) Header() ([]byte, error) {
+	header, err := s.r.Peek(HeaderSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to read the header of %q", s.name))
+	}
+	return header, nil
+}
+
+// WalkSources expands the inputs and calls fn on each of the resulting sources.
+// An input can be "-" for the stdin, a regular file, a directory (walked recursively),
+// a glob pattern, or a ".zip" archive whose files are read in place.
+func WalkSources(inputs []string, fn func(src *Source) error) error {
+	for _, input := range inputs {
+		if input == StdinInput {
+			if err := fn(NewSource(StdinInput, os.Stdin)); err != nil {
+				return err
+			}
+			continue
+		}
+		if !isGlob(input) {
+			if err := walkPath(input, false, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		matches, err := filepath.Glob(input)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("invalid glob pattern %q", input))
+		}
+		if len(matches) == 0 {
+			return errors.New(fmt.Sprintf("no input matches %q", input))
+		}
+		for _, match := range matches {
+			if err := walkPath(match, true, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "__MACOSX")
+}
+
+func walkPath(path string, expanded bool, fn func(src *Source) error) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+	if !info.IsDir() {
+		return walkFile(path, expanded, fn)
+	}
+	return filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return errors.Wrap(err, "")
+		}
+		if p != path && isHidden(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		return walkFile(p, true, fn)
+	})
+}
+
+func walkFile(path string, expanded bool, fn func(src *Source) error) error {
+	if strings.EqualFold(filepath.Ext(path), ".zip") {
+		return walkZip(path, fn)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+	defer f.Close()
+	src := NewSource(path, f)
+	src.expanded = expanded
+	return fn(src)
+}
+
+func walkZip(path string, fn func(src *Source) error) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to open zip archive %q", path))
+	}
+	defer zr.Close()
+
+	files := zr.File
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	for _, zf := range files {
+		if zf.FileInfo().IsDir() || hasHiddenElem(zf.Name) {
+			continue
+		}
+		if err := walkZipFile(path, zf, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkZipFile(path string, zf *zip.File, fn func(src *Source) error) error {
+	rc, err := zf.Open()
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to open %q in zip archive %q", zf.Name, path))
+	}
+	defer rc.Close()
+	src := NewSource(filepath.Join(path, zf.Name), rc)
+	src.expanded = true
+	return fn(src)
+}
+
+func hasHiddenElem(name string) bool {
+	for _, elem := range strings.Split(name, "/") {
+		if isHidden(elem) {
+			return true
+		}
+	}
+	return false
+}
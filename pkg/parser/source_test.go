@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func collectSources(t *testing.T, inputs []string) map[string]string {
+	result := make(map[string]string)
+	err := WalkSources(inputs, func(src *Source) error {
+		b, err := io.ReadAll(src)
+		if err != nil {
+			return err
+		}
+		result[src.Name()] = string(b)
+		return nil
+	})
+	assert.NoError(t, err)
+	return result
+}
+
+func TestWalkSources(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "sub", ".hidden"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "b.html"), []byte("b"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "c.txt"), []byte("c"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "sub", ".hidden", "d.txt"), []byte("d"), 0644))
+
+	zipPath := filepath.Join(t.TempDir(), "export.zip")
+	f, err := os.Create(zipPath)
+	assert.NoError(t, err)
+	zw := zip.NewWriter(f)
+	for name, content := range map[string]string{
+		"export/e.html":      "e",
+		"__MACOSX/._e.html":  "x",
+		"export/.DS_Store":   "x",
+		"export/more/f.html": "f",
+	} {
+		w, err := zw.Create(name)
+		assert.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+	assert.NoError(t, f.Close())
+
+	tests := []struct {
+		inputs []string
+		result map[string]string
+	}{
+		{
+			inputs: []string{filepath.Join(dir, "a.txt")},
+			result: map[string]string{filepath.Join(dir, "a.txt"): "a"},
+		},
+		{
+			inputs: []string{dir},
+			result: map[string]string{
+				filepath.Join(dir, "a.txt"):        "a",
+				filepath.Join(dir, "b.html"):       "b",
+				filepath.Join(dir, "sub", "c.txt"): "c",
+			},
+		},
+		{
+			inputs: []string{filepath.Join(dir, "*.txt"), filepath.Join(dir, "sub", "*.txt")},
+			result: map[string]string{
+				filepath.Join(dir, "a.txt"):        "a",
+				filepath.Join(dir, "sub", "c.txt"): "c",
+			},
+		},
+		{
+			inputs: []string{zipPath},
+			result: map[string]string{
+				filepath.Join(zipPath, "export/e.html"):      "e",
+				filepath.Join(zipPath, "export/more/f.html"): "f",
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		assert.Equal(t, tt.result, collectSources(t, tt.inputs), "case #%d", i)
+	}
+}
+
+func TestWalkSourcesNoMatch(t *testing.T) {
+	err := WalkSources([]string{filepath.Join(t.TempDir(), "*.txt")}, func(src *Source) error {
+		return nil
+	})
+	assert.Error(t, err)
+}
+
+func TestWalkSourcesExpanded(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644))
+
+	for i, tt := range []struct {
+		input    string
+		expanded bool
+	}{
+		{input: filepath.Join(dir, "a.txt"), expanded: false},
+		{input: dir, expanded: true},
+		{input: filepath.Join(dir, "*.txt"), expanded: true},
+	} {
+		err := WalkSources([]string{tt.input}, func(src *Source) error {
+			assert.Equal(t, tt.expanded, src.Expanded(), "case #%d", i)
+			return nil
+		})
+		assert.NoError(t, err, "case #%d", i)
+	}
+}
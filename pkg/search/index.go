@@ -0,0 +1,319 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/yifan-gu/blueNote/pkg/model"
+)
+
+const (
+	// FieldData is the highlighted text of a mark.
+	FieldData = "data"
+	// FieldNote is the user note of a mark.
+	FieldNote = "note"
+
+	// The parameters of the BM25 ranking.
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// fieldWeights are the weights of the indexed fields in the ranking, the notes are written
+// by the users so they weigh more than the highlights.
+var fieldWeights = map[string]float64{
+	FieldData: 1.0,
+	FieldNote: 1.5,
+}
+
+func fieldText(mark *model.Mark, field string) string {
+	switch field {
+	case FieldData:
+		return mark.Data
+	case FieldNote:
+		return mark.UserNote
+	default:
+		return ""
+	}
+}
+
+// posting is an occurrence of a term in a document.
+type posting struct {
+	field string
+	pos   int
+	start int
+	end   int
+}
+
+type document struct {
+	mark    *model.Mark
+	lengths map[string]int
+	// terms are the distinct terms of the document, to remove it from the index.
+	terms []string
+}
+
+// Index is an in-memory inverted index of the marks, it's safe for concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[string]*document
+	postings map[string]map[string][]posting // term -> mark id -> postings
+	lengths  map[string]int                  // field -> total length of the field in all documents
+}
+
+// NewIndex creates an empty index.
+func NewIndex() *Index {
+	return &Index{
+		docs:     make(map[string]*document),
+		postings: make(map[string]map[string][]posting),
+		lengths:  make(map[string]int),
+	}
+}
+
+// Len returns the number of the indexed marks.
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docs)
+}
+
+// Add indexes the mark, replacing the previous version of it.
+func (idx *Index) Add(mark *model.Mark) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(mark.ID)
+
+	doc := &document{mark: mark, lengths: make(map[string]int)}
+	seen := make(map[string]bool)
+	for field := range fieldWeights {
+		tokens := Tokenize(fieldText(mark, field))
+		doc.lengths[field] = len(tokens)
+		idx.lengths[field] += len(tokens)
+		for _, token := range tokens {
+			byDoc, ok := idx.postings[token.Term]
+			if !ok {
+				byDoc = make(map[string][]posting)
+				idx.postings[token.Term] = byDoc
+			}
+			byDoc[mark.ID] = append(byDoc[mark.ID], posting{field: field, pos: token.Pos, start: token.Start, end: token.End})
+			if !seen[token.Term] {
+				seen[token.Term] = true
+				doc.terms = append(doc.terms, token.Term)
+			}
+		}
+	}
+	idx.docs[mark.ID] = doc
+}
+
+// Reset replaces all the marks of the index, the searches see either the old marks or the new ones.
+func (idx *Index) Reset(marks []*model.Mark) {
+	fresh := NewIndex()
+	for _, mark := range marks {
+		fresh.Add(mark)
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.docs, idx.postings, idx.lengths = fresh.docs, fresh.postings, fresh.lengths
+}
+
+// Remove removes the mark from the index.
+func (idx *Index) Remove(id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(id)
+}
+
+func (idx *Index) remove(id string) {
+	doc, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	for _, term := range doc.terms {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	for field, length := range doc.lengths {
+		idx.lengths[field] -= length
+	}
+	delete(idx.docs, id)
+}
+
+// Highlight is a match in a field of a mark, Start and End are the byte offsets in the field text.
+type Highlight struct {
+	Field string `json:"field"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// Result is a mark that matches the query.
+type Result struct {
+	Mark  *model.Mark `json:"mark"`
+	Score float64     `json:"score"`
+	// Field is the field that the snippet is taken from.
+	Field string `json:"field"`
+	// Snippet is an excerpt of the field around the matches, which are wrapped in <em></em>.
+	Snippet    string      `json:"snippet"`
+	Highlights []Highlight `json:"highlights"`
+}
+
+// Filter keeps the marks in the search results if it returns true.
+type Filter func(mark *model.Mark) bool
+
+// Search returns the marks that match all the terms, phrases (quoted) and prefixes (suffixed by "*")
+// of the query, ranked by relevance. A non-positive limit returns all the results, a nil filter keeps all the marks.
+func (idx *Index) Search(query string, limit int, filter Filter) ([]*Result, error) {
+	clauses, err := parseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	// Find the matches of each clause and keep the marks that match all of them.
+	var candidates map[string][]Highlight
+	var clauseMatches []map[string][]Highlight
+	for _, c := range clauses {
+		matches := idx.matchClause(c)
+		clauseMatches = append(clauseMatches, matches)
+		if candidates == nil {
+			candidates = make(map[string][]Highlight)
+			for id := range matches {
+				candidates[id] = nil
+			}
+			continue
+		}
+		for id := range candidates {
+			if _, ok := matches[id]; !ok {
+				delete(candidates, id)
+			}
+		}
+	}
+
+	var results []*Result
+	for id := range candidates {
+		doc := idx.docs[id]
+		if filter != nil && !filter(doc.mark) {
+			continue
+		}
+		result := &Result{Mark: doc.mark}
+		for _, matches := range clauseMatches {
+			result.Score += idx.score(doc, matches[id], len(matches))
+			result.Highlights = append(result.Highlights, matches[id]...)
+		}
+		sort.Slice(result.Highlights, func(i, j int) bool {
+			a, b := result.Highlights[i], result.Highlights[j]
+			if a.Field != b.Field {
+				return a.Field < b.Field
+			}
+			return a.Start < b.Start
+		})
+		result.Field, result.Snippet = snippet(doc.mark, result.Highlights)
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Mark.ID < results[j].Mark.ID
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// score computes the BM25 score of the matches of a clause in the document,
+// df is the number of the documents that match the clause.
+func (idx *Index) score(doc *document, matches []Highlight, df int) float64 {
+	n := float64(len(idx.docs))
+	idf := math.Log(1 + (n-float64(df)+0.5)/(float64(df)+0.5))
+	tfs := make(map[string]float64)
+	for _, m := range matches {
+		tfs[m.Field]++
+	}
+	var score float64
+	for field, tf := range tfs {
+		avgLength := float64(idx.lengths[field]) / n
+		if avgLength == 0 {
+			avgLength = 1
+		}
+		norm := 1 - bm25B + bm25B*float64(doc.lengths[field])/avgLength
+		score += fieldWeights[field] * idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+	}
+	return score
+}
+
+// lookup returns the postings of the term, or of all the terms with the prefix, by mark id.
+func (idx *Index) lookup(term string, prefix bool) map[string][]posting {
+	if !prefix {
+		return idx.postings[term]
+	}
+	ret := make(map[string][]posting)
+	for t, byDoc := range idx.postings {
+		if !strings.HasPrefix(t, term) {
+			continue
+		}
+		for id, postings := range byDoc {
+			ret[id] = append(ret[id], postings...)
+		}
+	}
+	return ret
+}
+
+// matchClause returns the matches of the clause by mark id.
+func (idx *Index) matchClause(c *clause) map[string][]Highlight {
+	last := len(c.terms) - 1
+	first := idx.lookup(c.terms[0], c.prefix && last == 0)
+	ret := make(map[string][]Highlight)
+	if last == 0 {
+		for id, postings := range first {
+			for _, p := range postings {
+				ret[id] = append(ret[id], Highlight{Field: p.field, Start: p.start, End: p.end})
+			}
+		}
+		return ret
+	}
+
+	// Match a phrase by looking for the following terms at the following positions.
+	type key struct {
+		field string
+		pos   int
+	}
+	rest := make([]map[string][]posting, last)
+	for i := range rest {
+		rest[i] = idx.lookup(c.terms[i+1], c.prefix && i+1 == last)
+	}
+	for id, postings := range first {
+		positions := make([]map[key]posting, last)
+		for i := range positions {
+			positions[i] = make(map[key]posting)
+			for _, p := range rest[i][id] {
+				positions[i][key{p.field, p.pos}] = p
+			}
+		}
+	nextPosting:
+		for _, p := range postings {
+			end := p.end
+			for i := range positions {
+				next, ok := positions[i][key{p.field, p.pos + i + 1}]
+				if !ok {
+					continue nextPosting
+				}
+				end = next.end
+			}
+			ret[id] = append(ret[id], Highlight{Field: p.field, Start: p.start, End: end})
+		}
+		if len(ret[id]) == 0 {
+			delete(ret, id)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,109 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package search
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/model"
+)
+
+func newTestIndex() *Index {
+	idx := NewIndex()
+	for _, mark := range []*model.Mark{
+		{ID: "1", Data: "It is an illusion that youth is happy, an illusion of those who have lost it."},
+		{ID: "2", Data: "The philosopher is happy.", UserNote: "happy philosophy"},
+		{ID: "3", Data: "People ask you for criticism, but they only want praise."},
+		{ID: "4", Data: "人生如梦，一尊还酹江月。", UserNote: "苏轼"},
+	} {
+		idx.Add(mark)
+	}
+	return idx
+}
+
+func resultIDs(results []*Result) []string {
+	var ids []string
+	for _, r := range results {
+		ids = append(ids, r.Mark.ID)
+	}
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	idx := newTestIndex()
+	tests := []struct {
+		query string
+		ids   []string
+	}{
+		{query: "happy", ids: []string{"2", "1"}},
+		{query: "HAPPY youth", ids: []string{"1"}},
+		{query: "philo*", ids: []string{"2"}},
+		{query: `"youth is happy"`, ids: []string{"1"}},
+		{query: `"happy youth"`, ids: nil},
+		{query: "人生", ids: []string{"4"}},
+		{query: "生人", ids: nil},
+		{query: "praise(", ids: []string{"3"}},
+		{query: "missing", ids: nil},
+	}
+	for i, tt := range tests {
+		results, err := idx.Search(tt.query, 0, nil)
+		assert.NoError(t, err, "case #%d", i)
+		assert.Equal(t, tt.ids, resultIDs(results), "case #%d", i)
+	}
+
+	results, err := idx.Search("illusion", 1, nil)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, FieldData, results[0].Field)
+	assert.Equal(t, "It is an <em>illusion</em> that youth is happy, an <em>illusion</em> of those who have lost it.", results[0].Snippet)
+	assert.Equal(t, []Highlight{{Field: FieldData, Start: 9, End: 17}, {Field: FieldData, Start: 42, End: 50}}, results[0].Highlights)
+
+	results, err = idx.Search("苏轼", 0, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, FieldNote, results[0].Field)
+	assert.Equal(t, "<em>苏轼</em>", results[0].Snippet)
+
+	results, err = idx.Search("happy", 0, func(mark *model.Mark) bool { return mark.ID != "2" })
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, resultIDs(results))
+}
+
+func TestIndexUpdate(t *testing.T) {
+	idx := newTestIndex()
+	assert.Equal(t, 4, idx.Len())
+
+	idx.Add(&model.Mark{ID: "1", Data: "Something else entirely."})
+	results, err := idx.Search("illusion", 0, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+	results, err = idx.Search("entirely", 0, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, resultIDs(results))
+
+	idx.Remove("1")
+	idx.Remove("unknown")
+	assert.Equal(t, 3, idx.Len())
+	results, err = idx.Search("entirely", 0, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestSnippet(t *testing.T) {
+	long := strings.Repeat("lorem ipsum dolor ", 10) + "needle " + strings.Repeat("sit amet consectetur ", 20)
+	mark := &model.Mark{ID: "1", Data: long}
+	idx := NewIndex()
+	idx.Add(mark)
+
+	results, err := idx.Search("needle", 0, nil)
+	assert.NoError(t, err)
+	snippet := results[0].Snippet
+	assert.True(t, strings.HasPrefix(snippet, "…"), snippet)
+	assert.True(t, strings.HasSuffix(snippet, "…"), snippet)
+	assert.Contains(t, snippet, " <em>needle</em> ")
+	assert.Less(t, len(snippet), len(long))
+}
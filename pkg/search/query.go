@@ -0,0 +1,57 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// clause is a term, a prefix (e.g. "philo*") or a phrase (e.g. "\"of human bondage\"") of a query.
+// A phrase with the prefix flag matches the last term as a prefix.
+type clause struct {
+	terms  []string
+	prefix bool
+}
+
+// parseQuery parses the query into the clauses that must all match.
+// Words that split into multiple tokens (e.g. CJK words) are matched as phrases.
+func parseQuery(query string) ([]*clause, error) {
+	var clauses []*clause
+	rest := strings.TrimSpace(query)
+	for rest != "" {
+		var text string
+		if rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				text, rest = rest[1:], ""
+			} else {
+				text, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				end = len(rest)
+			}
+			text, rest = rest[:end], rest[end:]
+		}
+		rest = strings.TrimSpace(rest)
+
+		c := &clause{prefix: strings.HasSuffix(text, "*")}
+		for _, token := range Tokenize(text) {
+			c.terms = append(c.terms, token.Term)
+		}
+		if len(c.terms) > 0 {
+			clauses = append(clauses, c)
+		}
+	}
+	if len(clauses) == 0 {
+		return nil, errors.New("empty search query")
+	}
+	return clauses, nil
+}
@@ -0,0 +1,111 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package search
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yifan-gu/blueNote/pkg/model"
+)
+
+const (
+	// snippetContext is the number of bytes before the first match in the snippet.
+	snippetContext = 60
+	// snippetLength is the maximum number of bytes of the snippet, excluding the markers.
+	snippetLength = 240
+
+	highlightStart = "<em>"
+	highlightEnd   = "</em>"
+	ellipsis       = "…"
+)
+
+// snippet returns the field with the most highlights and an excerpt of it around the first one,
+// the highlights must be sorted by the field and the start offset.
+func snippet(mark *model.Mark, highlights []Highlight) (string, string) {
+	counts := make(map[string]int)
+	for _, h := range highlights {
+		counts[h.Field]++
+	}
+	field := FieldData
+	if counts[FieldNote] > counts[FieldData] {
+		field = FieldNote
+	}
+	text := fieldText(mark, field)
+
+	var matches []Highlight
+	for _, h := range highlights {
+		if h.Field == field {
+			matches = append(matches, h)
+		}
+	}
+	if len(matches) == 0 {
+		return field, truncate(text, 0, snippetLength)
+	}
+
+	start := alignStart(text, matches[0].Start-snippetContext)
+	end := alignEnd(text, start+snippetLength)
+	var sb strings.Builder
+	if start > 0 {
+		sb.WriteString(ellipsis)
+	}
+	offset := start
+	for _, m := range matches {
+		if m.Start < offset {
+			// Overlapped with the previous match.
+			continue
+		}
+		if m.End > end {
+			break
+		}
+		sb.WriteString(text[offset:m.Start])
+		sb.WriteString(highlightStart)
+		sb.WriteString(text[m.Start:m.End])
+		sb.WriteString(highlightEnd)
+		offset = m.End
+	}
+	sb.WriteString(text[offset:end])
+	if end < len(text) {
+		sb.WriteString(ellipsis)
+	}
+	return field, sb.String()
+}
+
+func truncate(text string, start, length int) string {
+	end := alignEnd(text, start+length)
+	if end < len(text) {
+		return text[start:end] + ellipsis
+	}
+	return text[start:end]
+}
+
+// alignStart moves the offset forward to the beginning of a word.
+func alignStart(text string, offset int) int {
+	if offset <= 0 {
+		return 0
+	}
+	for offset < len(text) && !utf8.RuneStart(text[offset]) {
+		offset++
+	}
+	if i := strings.IndexByte(text[offset:], ' '); i >= 0 && i < snippetContext/2 {
+		return offset + i + 1
+	}
+	return offset
+}
+
+// alignEnd moves the offset backward to the end of a word.
+func alignEnd(text string, offset int) int {
+	if offset >= len(text) {
+		return len(text)
+	}
+	for offset > 0 && !utf8.RuneStart(text[offset]) {
+		offset--
+	}
+	if i := strings.LastIndexByte(text[:offset], ' '); i >= 0 && offset-i < snippetContext/2 {
+		return i
+	}
+	return offset
+}
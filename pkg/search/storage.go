@@ -0,0 +1,195 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package search
+
+import (
+	"context"
+
+	"github.com/yifan-gu/blueNote/pkg/event"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+	"github.com/yifan-gu/blueNote/pkg/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Searcher is implemented by the storages that support full-text search.
+type Searcher interface {
+	Search(ctx context.Context, query string, limit int, filter Filter) ([]*Result, error)
+}
+
+// followBuffer is the number of the events the index can fall behind before it's rebuilt.
+const followBuffer = 1024
+
+// IndexedStorage is a storage that maintains a search index of its marks.
+// The index is built on Connect and updated on every write through it, and by the events of the bus,
+// which include the changes made elsewhere if the bus is fed by a change stream.
+type IndexedStorage struct {
+	storage.Storage
+	index *Index
+	bus   *event.Bus
+	// stop stops following the bus.
+	stop context.CancelFunc
+}
+
+// NewIndexedStorage wraps the storage with a search index, which follows the events of the bus if it's not nil.
+func NewIndexedStorage(store storage.Storage, bus *event.Bus) *IndexedStorage {
+	return &IndexedStorage{Storage: store, index: NewIndex(), bus: bus}
+}
+
+func (s *IndexedStorage) Connect(ctx context.Context) error {
+	if err := s.Storage.Connect(ctx); err != nil {
+		return err
+	}
+	// Subscribe before building the index, so the changes in between are not missed.
+	var sub *event.Subscription
+	if s.bus != nil {
+		sub = s.bus.Subscribe(followBuffer)
+	}
+	if err := s.build(ctx); err != nil {
+		if sub != nil {
+			sub.Close()
+		}
+		return err
+	}
+	if sub != nil {
+		followCtx, cancel := context.WithCancel(context.Background())
+		s.stop = cancel
+		go s.follow(followCtx, sub)
+	}
+	return nil
+}
+
+func (s *IndexedStorage) Close(ctx context.Context) error {
+	if s.stop != nil {
+		s.stop()
+	}
+	return s.Storage.Close(ctx)
+}
+
+// build indexes all the marks in the storage.
+func (s *IndexedStorage) build(ctx context.Context) error {
+	marks, err := s.Storage.GetMarks(ctx, bson.M{}, nil)
+	if err != nil {
+		return err
+	}
+	s.index.Reset(marks)
+	util.LogFields("Search index is built", util.Fields{"marks": s.index.Len()})
+	return nil
+}
+
+// follow applies the events to the index until the context is canceled. If the subscription falls
+// behind, the index is rebuilt with a new subscription.
+func (s *IndexedStorage) follow(ctx context.Context, sub *event.Subscription) {
+	for {
+		select {
+		case <-ctx.Done():
+			sub.Close()
+			return
+		case ev, ok := <-sub.Events():
+			if ok {
+				s.apply(ev)
+				continue
+			}
+			util.Warn("The search index falls behind the changes, rebuilding it")
+			sub = s.bus.Subscribe(followBuffer)
+			if err := s.build(ctx); err != nil {
+				util.Error("Failed to rebuild the search index: ", err)
+			}
+		}
+	}
+}
+
+// apply updates the index with the event, the deleted marks are removed by their IDs,
+// as the ones from a change stream only have the IDs.
+func (s *IndexedStorage) apply(ev *event.Event) {
+	switch ev.Type {
+	case event.Deleted:
+		s.index.Remove(ev.Mark.ID)
+	default:
+		s.index.Add(ev.Mark)
+	}
+}
+
+func (s *IndexedStorage) Search(ctx context.Context, query string, limit int, filter Filter) ([]*Result, error) {
+	return s.index.Search(query, limit, filter)
+}
+
+// refresh re-indexes the marks from the storage.
+func (s *IndexedStorage) refresh(ctx context.Context, ids ...string) error {
+	for _, id := range ids {
+		marks, err := s.Storage.GetMarks(ctx, bson.M{"_id": id}, nil)
+		if err != nil {
+			return err
+		}
+		if len(marks) == 0 {
+			s.index.Remove(id)
+			continue
+		}
+		s.index.Add(marks[0])
+	}
+	return nil
+}
+
+func (s *IndexedStorage) CreateMark(ctx context.Context, mark *model.Mark) (string, error) {
+	id, err := s.Storage.CreateMark(ctx, mark)
+	if err != nil {
+		return "", err
+	}
+	return id, s.refresh(ctx, id)
+}
+
+func (s *IndexedStorage) UpdateMarks(ctx context.Context, filter interface{}, patch *model.MarkPatch) ([]string, error) {
+	ids, err := s.Storage.UpdateMarks(ctx, filter, patch)
+	if err != nil {
+		return nil, err
+	}
+	return ids, s.refresh(ctx, ids...)
+}
+
+func (s *IndexedStorage) UpdateOneMark(ctx context.Context, id string, patch *model.MarkPatch) error {
+	if err := s.Storage.UpdateOneMark(ctx, id, patch); err != nil {
+		return err
+	}
+	return s.refresh(ctx, id)
+}
+
+func (s *IndexedStorage) DeleteMarks(ctx context.Context, filter interface{}) (int, error) {
+	marks, err := s.Storage.GetMarks(ctx, filter, nil)
+	if err != nil {
+		return 0, err
+	}
+	count, err := s.Storage.DeleteMarks(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	for _, mark := range marks {
+		s.index.Remove(mark.ID)
+	}
+	return count, nil
+}
+
+func (s *IndexedStorage) DeleteOneMark(ctx context.Context, id string) error {
+	if err := s.Storage.DeleteOneMark(ctx, id); err != nil {
+		return err
+	}
+	s.index.Remove(id)
+	return nil
+}
+
+func (s *IndexedStorage) RestoreMarks(ctx context.Context, filter interface{}) ([]string, error) {
+	ids, err := s.Storage.RestoreMarks(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return ids, s.refresh(ctx, ids...)
+}
+
+func (s *IndexedStorage) RevertMark(ctx context.Context, id, revisionID string) error {
+	if err := s.Storage.RevertMark(ctx, id, revisionID); err != nil {
+		return err
+	}
+	return s.refresh(ctx, id)
+}
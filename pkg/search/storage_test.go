@@ -0,0 +1,60 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package search
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/event"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+)
+
+// fakeStorage only has the marks to build the index from.
+type fakeStorage struct {
+	storage.Storage
+	marks []*model.Mark
+}
+
+func (f *fakeStorage) Connect(ctx context.Context) error { return nil }
+func (f *fakeStorage) Close(ctx context.Context) error   { return nil }
+
+func (f *fakeStorage) GetMarks(ctx context.Context, filter interface{}, opts *storage.QueryOptions) ([]*model.Mark, error) {
+	return f.marks, nil
+}
+
+// searchEventually waits for the search to return the IDs, as the events are applied asynchronously.
+func searchEventually(t *testing.T, store *IndexedStorage, query string, ids []string) {
+	var got []string
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		results, err := store.Search(context.Background(), query, 0, nil)
+		assert.NoError(t, err)
+		if got = resultIDs(results); assert.ObjectsAreEqual(ids, got) {
+			return
+		}
+	}
+	assert.Equal(t, ids, got, query)
+}
+
+func TestIndexedStorageFollowsBus(t *testing.T) {
+	bus := event.NewBus()
+	store := NewIndexedStorage(&fakeStorage{marks: []*model.Mark{{ID: "1", Data: "happy youth"}}}, bus)
+	assert.NoError(t, store.Connect(context.Background()))
+	defer store.Close(context.Background())
+	searchEventually(t, store, "happy", []string{"1"})
+
+	// The changes made elsewhere, e.g. from a change stream, and the deletions only have the IDs.
+	bus.Publish(&event.Event{Type: event.Created, Mark: &model.Mark{ID: "2", Data: "happy philosopher"}})
+	searchEventually(t, store, "philosopher", []string{"2"})
+	bus.Publish(&event.Event{Type: event.Updated, Mark: &model.Mark{ID: "2", Data: "sad philosopher"}})
+	searchEventually(t, store, "happy", []string{"1"})
+	bus.Publish(&event.Event{Type: event.Deleted, Mark: &model.Mark{ID: "1"}})
+	searchEventually(t, store, "youth", nil)
+	assert.Equal(t, 1, store.index.Len())
+}
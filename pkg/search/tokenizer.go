@@ -0,0 +1,62 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+// Package search implements a full-text search index of the marks.
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Token is a term in the text.
+type Token struct {
+	// Term is the normalized (lower cased) term.
+	Term string
+	// Pos is the position of the token among the tokens of the text.
+	Pos int
+	// Start and End are the byte offsets of the token in the text.
+	Start int
+	End   int
+}
+
+// isCJK returns true for the characters of the languages that are not separated by spaces,
+// each of these characters is a token, so a word is matched as a phrase of its characters.
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+func isWordChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
+
+// Tokenize splits the text into the words of letters and digits, and the single CJK characters.
+func Tokenize(text string) []Token {
+	var tokens []Token
+	start := -1
+	flush := func(end int) {
+		if start >= 0 {
+			tokens = append(tokens, Token{Term: strings.ToLower(text[start:end]), Pos: len(tokens), Start: start, End: end})
+			start = -1
+		}
+	}
+	for i, r := range text {
+		switch {
+		case isCJK(r):
+			flush(i)
+			end := i + utf8.RuneLen(r)
+			tokens = append(tokens, Token{Term: text[i:end], Pos: len(tokens), Start: i, End: end})
+		case isWordChar(r):
+			if start < 0 {
+				start = i
+			}
+		default:
+			flush(i)
+		}
+	}
+	flush(len(text))
+	return tokens
+}
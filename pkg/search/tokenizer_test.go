@@ -0,0 +1,59 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package search
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text  string
+		terms []string
+	}{
+		{text: "", terms: nil},
+		{text: "Of Human Bondage, 1915!", terms: []string{"of", "human", "bondage", "1915"}},
+		{text: "café naïve", terms: []string{"café", "naïve"}},
+		{text: "人生如梦", terms: []string{"人", "生", "如", "梦"}},
+		{text: "读Maugham的书", terms: []string{"读", "maugham", "的", "书"}},
+	}
+	for i, tt := range tests {
+		var terms []string
+		for j, token := range Tokenize(tt.text) {
+			assert.Equal(t, j, token.Pos, "case #%d", i)
+			assert.Equal(t, token.Term, strings.ToLower(tt.text[token.Start:token.End]), "case #%d", i)
+			terms = append(terms, token.Term)
+		}
+		assert.Equal(t, tt.terms, terms, "case #%d", i)
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		clauses []*clause
+		err     bool
+	}{
+		{query: "  ", err: true},
+		{query: "((", err: true},
+		{query: "Human bondage", clauses: []*clause{{terms: []string{"human"}}, {terms: []string{"bondage"}}}},
+		{query: `"of human" philo*`, clauses: []*clause{{terms: []string{"of", "human"}}, {terms: []string{"philo"}, prefix: true}}},
+		{query: `"unterminated phrase`, clauses: []*clause{{terms: []string{"unterminated", "phrase"}}}},
+		{query: "人生", clauses: []*clause{{terms: []string{"人", "生"}}}},
+	}
+	for i, tt := range tests {
+		clauses, err := parseQuery(tt.query)
+		if tt.err {
+			assert.Error(t, err, "case #%d", i)
+			continue
+		}
+		assert.NoError(t, err, "case #%d", i)
+		assert.Equal(t, tt.clauses, clauses, "case #%d", i)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/auth"
+	"github.com/yifan-gu/blueNote/pkg/bluenote"
+	"github.com/yifan-gu/blueNote/pkg/config"
+	"github.com/yifan-gu/blueNote/pkg/model"
+)
+
+func quoteJSON(t *testing.T, s string) string {
+	b, err := json.Marshal(s)
+	assert.NoError(t, err)
+	return string(b)
+}
+
+func TestAuthentication(t *testing.T) {
+	store := &fakeStorage{marks: []*model.Mark{
+		{ID: "a", Type: model.MarkTypeHighlight, Title: "T", Data: "1", Owner: "alice"},
+		{ID: "b", Type: model.MarkTypeHighlight, Title: "T", Data: "2", Owner: "bob"},
+	}}
+	registry, err := bluenote.NewDefaultRegistry()
+	assert.NoError(t, err)
+	srv, err := NewServer(&config.ServerConfig{
+		AuthTokens:     []string{"alice=alice-token", "bob:read=bob-token"},
+		AuthBasicUsers: []string{"carol=carol-password"},
+	}, store, registry, nil)
+	assert.NoError(t, err)
+	s := srv.(*server)
+	handler := s.authenticate(auth.ScopeRead, s.handleGraphql)
+
+	tests := []struct {
+		token  string
+		query  string
+		code   int
+		result string
+	}{
+		{
+			query: `{marks{id}}`,
+			code:  http.StatusUnauthorized,
+		},
+		{
+			token: "wrong-token",
+			query: `{marks{id}}`,
+			code:  http.StatusUnauthorized,
+		},
+		{
+			token:  "alice-token",
+			query:  `{marks{id,owner}}`,
+			code:   http.StatusOK,
+			result: `{"data":{"marks":[{"id":"a","owner":"alice"}]}}`,
+		},
+		{
+			token:  "bob-token",
+			query:  `{marks(ids:["a","b"]){id}}`,
+			code:   http.StatusOK,
+			result: `{"data":{"marks":[{"id":"b"}]}}`,
+		},
+		{
+			token:  "bob-token",
+			query:  `mutation{deleteOne(id:"b"){id}}`,
+			code:   http.StatusOK,
+			result: `{"data":{"deleteOne":null},"errors":[{"message":"User \"bob\" doesn't have the write scope","locations":[{"line":1,"column":10}],"path":["deleteOne"],"extensions":{"code":"FORBIDDEN"}}]}`,
+		},
+		{
+			token:  "alice-token",
+			query:  `mutation{deleteOne(id:"b"){id}}`,
+			code:   http.StatusOK,
+			result: `{"data":{"deleteOne":null},"errors":[{"message":"Mark \"b\" is not found","locations":[{"line":1,"column":10}],"path":["deleteOne"],"extensions":{"code":"NOT_FOUND"}}]}`,
+		},
+		{
+			token:  "alice-token",
+			query:  `mutation{createOne(type:NOTE,title:"T",author:"A",note:"3"){id,owner}}`,
+			code:   http.StatusOK,
+			result: `{"data":{"createOne":{"id":"2","owner":"alice"}}}`,
+		},
+		{
+			token:  "alice-token",
+			query:  `mutation{updateMany(filter:{title:"T"},update:{note:"4"}){ids}}`,
+			code:   http.StatusOK,
+			result: `{"data":{"updateMany":{"ids":["a","2"]}}}`,
+		},
+	}
+	for i, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query":`+quoteJSON(t, tt.query)+`}`))
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, r)
+		assert.Equal(t, tt.code, rec.Code, "case #%d", i)
+		if tt.code == http.StatusUnauthorized {
+			assert.Equal(t, `Bearer realm="blueNote", Basic realm="blueNote"`, rec.Header().Get("WWW-Authenticate"), "case #%d", i)
+		}
+		if tt.result != "" {
+			assert.Equal(t, tt.result, strings.TrimSpace(rec.Body.String()), "case #%d", i)
+		}
+	}
+	assert.Equal(t, "bob", store.marks[1].Owner)
+	assert.Equal(t, "", store.marks[1].UserNote)
+
+	// The import requires the write scope.
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/import?parser=json", strings.NewReader(`[]`))
+	r.Header.Set("Authorization", "Bearer bob-token")
+	s.authenticate(auth.ScopeWrite, s.handleImport)(rec, r)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	// The REST API requires the write scope for the changes, and only serves the marks of the user.
+	for i, tt := range []struct {
+		method string
+		target string
+		code   int
+	}{
+		{method: http.MethodGet, target: "/api/v1/marks/b", code: http.StatusOK},
+		{method: http.MethodGet, target: "/api/v1/marks/a", code: http.StatusNotFound},
+		{method: http.MethodDelete, target: "/api/v1/marks/b", code: http.StatusForbidden},
+	} {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(tt.method, tt.target, nil)
+		r.Header.Set("Authorization", "Bearer bob-token")
+		s.handler().ServeHTTP(rec, r)
+		assert.Equal(t, tt.code, rec.Code, "case #%d", i)
+	}
+
+	// Basic auth.
+	rec = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query":"{marks{id}}"}`))
+	r.SetBasicAuth("carol", "carol-password")
+	handler(rec, r)
+	assert.Equal(t, `{"data":{"marks":[]}}`, strings.TrimSpace(rec.Body.String()))
+}
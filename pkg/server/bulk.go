@@ -0,0 +1,316 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"fmt"
+
+	"github.com/graphql-go/graphql"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// markFilterInputType has the same fields as the arguments of the marks query.
+var markFilterInputType = func() *graphql.InputObject {
+	fields := graphql.InputObjectConfigFieldMap{}
+	for name, arg := range markFilterArgs() {
+		fields[name] = &graphql.InputObjectFieldConfig{Type: arg.Type}
+	}
+	return graphql.NewInputObject(graphql.InputObjectConfig{Name: "MarkFilter", Fields: fields})
+}()
+
+var markInputType = graphql.NewInputObject(
+	graphql.InputObjectConfig{
+		Name: "MarkInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"type": &graphql.InputObjectFieldConfig{
+				Type: graphql.NewNonNull(markTypeEnum),
+			},
+			"title": &graphql.InputObjectFieldConfig{
+				Type: graphql.NewNonNull(graphql.String),
+			},
+			"author": &graphql.InputObjectFieldConfig{
+				Type: graphql.NewNonNull(graphql.String),
+			},
+			"section": &graphql.InputObjectFieldConfig{
+				Type: graphql.String,
+			},
+			"location": &graphql.InputObjectFieldConfig{
+				Type: locationInputType,
+			},
+			"data": &graphql.InputObjectFieldConfig{
+				Type: graphql.String,
+			},
+			"note": &graphql.InputObjectFieldConfig{
+				Type: graphql.String,
+			},
+			"tags": &graphql.InputObjectFieldConfig{
+				Type: graphql.NewList(graphql.String),
+			},
+		},
+	},
+)
+
+var markUpdateInputType = graphql.NewInputObject(
+	graphql.InputObjectConfig{
+		Name: "MarkUpdate",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"type": &graphql.InputObjectFieldConfig{
+				Type: markTypeEnum,
+			},
+			"title": &graphql.InputObjectFieldConfig{
+				Type: graphql.String,
+			},
+			"author": &graphql.InputObjectFieldConfig{
+				Type: graphql.String,
+			},
+			"section": &graphql.InputObjectFieldConfig{
+				Type: graphql.String,
+			},
+			"location": &graphql.InputObjectFieldConfig{
+				Type: locationInputType,
+			},
+			"data": &graphql.InputObjectFieldConfig{
+				Type: graphql.String,
+			},
+			"note": &graphql.InputObjectFieldConfig{
+				Type: graphql.String,
+			},
+			"tags": &graphql.InputObjectFieldConfig{
+				Type: graphql.NewList(graphql.String),
+			},
+			"clear": &graphql.InputObjectFieldConfig{
+				Type:        graphql.NewList(graphql.NewNonNull(graphql.String)),
+				Description: clearDescription,
+			},
+		},
+	},
+)
+
+var bulkResultType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "BulkResult",
+		Fields: graphql.Fields{
+			"ids": &graphql.Field{
+				Type:        graphql.NewList(graphql.String),
+				Description: "The IDs of the affected marks, empty for a dry run",
+			},
+			"count": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "The number of the affected marks",
+			},
+			"dryRun": &graphql.Field{
+				Type: graphql.Boolean,
+			},
+			"marks": &graphql.Field{
+				Type:        graphql.NewList(markType),
+				Description: "The affected marks, as they are (or would be, for a dry run) after the mutation, or before the deletion",
+			},
+		},
+	},
+)
+
+type bulkResult struct {
+	IDs    []string      `json:"ids"`
+	Count  int           `json:"count"`
+	DryRun bool          `json:"dryRun"`
+	Marks  []*model.Mark `json:"marks"`
+}
+
+// newBulkResult creates an empty result, the IDs are never null so the clients can iterate them safely.
+func newBulkResult(dryRun bool) *bulkResult {
+	return &bulkResult{IDs: []string{}, DryRun: dryRun}
+}
+
+// bulkArgs returns the arguments of the mutations on the marks that match the filter.
+func bulkArgs(extra graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	return withArgs(graphql.FieldConfigArgument{
+		"filter": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(markFilterInputType),
+		},
+		"dryRun": &graphql.ArgumentConfig{
+			Type:         graphql.Boolean,
+			DefaultValue: false,
+		},
+	}, extra)
+}
+
+// bulkFilterFromArgs returns the filter of a bulk mutation, an empty filter is rejected
+// so all the marks can't be modified by accident.
+func bulkFilterFromArgs(args map[string]interface{}) (bson.M, error) {
+	filterArgs, _ := args["filter"].(map[string]interface{})
+	filter, err := markFilterFromArgs(filterArgs)
+	if err != nil {
+		return nil, err
+	}
+	if len(filter) == 0 {
+		return nil, newAPIError(codeInvalidArgument, "Expect a non-empty filter")
+	}
+	return filter, nil
+}
+
+// stringsFromArgs returns the strings of a list argument.
+func stringsFromArgs(args map[string]interface{}, key string) []string {
+	var ret []string
+	list, _ := args[key].([]interface{})
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+func (s *server) createManyMarks(p graphql.ResolveParams) (interface{}, error) {
+	dryRun, _ := p.Args["dryRun"].(bool)
+	inputs, _ := p.Args["marks"].([]interface{})
+
+	result := newBulkResult(dryRun)
+	// Report the problems of all the marks at once.
+	verr := &model.ValidationError{}
+	for i, input := range inputs {
+		args, _ := input.(map[string]interface{})
+		mark := markFromArgs(args)
+		if err := model.ValidateMark(mark); err != nil && !verr.Merge(fmt.Sprintf("marks.%d", i), err) {
+			return nil, err
+		}
+		result.Marks = append(result.Marks, mark)
+	}
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+	result.Count = len(result.Marks)
+	if dryRun {
+		return result, nil
+	}
+	for i, mark := range result.Marks {
+		id, err := s.storeFor(p.Context).CreateMark(p.Context, mark)
+		if err != nil {
+			// The batch isn't atomic, the created marks are kept, so tell which ones they are.
+			apiErr := toAPIError(err)
+			return nil, &apiError{
+				Code:    apiErr.Code,
+				Message: fmt.Sprintf("Failed to create marks.%d after creating %d marks: %v", i, len(result.IDs), apiErr.Message),
+				Fields:  apiErr.Fields,
+				IDs:     result.IDs,
+			}
+		}
+		mark.ID = id
+		result.IDs = append(result.IDs, id)
+	}
+	return result, nil
+}
+
+func (s *server) updateManyMarks(p graphql.ResolveParams) (interface{}, error) {
+	dryRun, _ := p.Args["dryRun"].(bool)
+	filter, err := bulkFilterFromArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	updateArgs, _ := p.Args["update"].(map[string]interface{})
+	patch, err := patchFromArgs(updateArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		marks, err := s.storeFor(p.Context).GetMarks(p.Context, filter, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, mark := range marks {
+			patch.Apply(mark)
+		}
+		result := newBulkResult(true)
+		result.Count, result.Marks = len(marks), marks
+		return result, nil
+	}
+
+	ids, err := s.storeFor(p.Context).UpdateMarks(p.Context, filter, patch)
+	if err != nil {
+		return nil, err
+	}
+	result := newBulkResult(false)
+	result.IDs = append(result.IDs, ids...)
+	result.Count = len(ids)
+	if len(ids) > 0 {
+		if result.Marks, err = s.storeFor(p.Context).GetMarks(p.Context, bson.M{"_id": bson.M{"$in": ids}}, nil); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (s *server) deleteManyMarks(p graphql.ResolveParams) (interface{}, error) {
+	dryRun, _ := p.Args["dryRun"].(bool)
+	filter, err := bulkFilterFromArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	marks, err := s.storeFor(p.Context).GetMarks(p.Context, filter, nil)
+	if err != nil {
+		return nil, err
+	}
+	result := newBulkResult(dryRun)
+	result.Count, result.Marks = len(marks), marks
+	if dryRun {
+		return result, nil
+	}
+	if result.Count, err = s.storeFor(p.Context).DeleteMarks(p.Context, filter); err != nil {
+		return nil, err
+	}
+	for _, mark := range marks {
+		result.IDs = append(result.IDs, mark.ID)
+	}
+	return result, nil
+}
+
+func (s *server) addTags(p graphql.ResolveParams) (interface{}, error) {
+	tags := stringsFromArgs(p.Args, "tags")
+	return s.updateTags(p, func(mark *model.Mark) []string {
+		return util.MergeStrings(mark.Tags, tags)
+	})
+}
+
+func (s *server) removeTags(p graphql.ResolveParams) (interface{}, error) {
+	tags := stringsFromArgs(p.Args, "tags")
+	return s.updateTags(p, func(mark *model.Mark) []string {
+		return util.SubtractStrings(mark.Tags, tags)
+	})
+}
+
+// updateTags sets the tags of the marks that match the filter to the result of fn,
+// only the marks whose tags are changed are affected.
+func (s *server) updateTags(p graphql.ResolveParams, fn func(mark *model.Mark) []string) (interface{}, error) {
+	dryRun, _ := p.Args["dryRun"].(bool)
+	filter, err := bulkFilterFromArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	marks, err := s.storeFor(p.Context).GetMarks(p.Context, filter, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := newBulkResult(dryRun)
+	for _, mark := range marks {
+		tags := fn(mark)
+		if util.StringSlicesEqual(tags, mark.Tags) {
+			continue
+		}
+		if !dryRun {
+			if err := s.storeFor(p.Context).UpdateOneMark(p.Context, mark.ID, &model.MarkPatch{Mark: &model.Mark{Tags: tags}, Fields: []string{"tags"}}); err != nil {
+				return nil, err
+			}
+			result.IDs = append(result.IDs, mark.ID)
+		}
+		mark.Tags = tags
+		result.Marks = append(result.Marks, mark)
+	}
+	result.Count = len(result.Marks)
+	return result, nil
+}
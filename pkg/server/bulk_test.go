@@ -0,0 +1,117 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/model"
+)
+
+func newBulkTestStorage() *fakeStorage {
+	return &fakeStorage{marks: []*model.Mark{
+		{ID: "a", Type: model.MarkTypeHighlight, Title: "T", Author: "A", Data: "1", Tags: []string{"x"}},
+		{ID: "b", Type: model.MarkTypeHighlight, Title: "T", Author: "A", Data: "2", Tags: []string{"x", "y"}},
+		{ID: "c", Type: model.MarkTypeNote, Title: "T", Author: "A", UserNote: "3"},
+	}}
+}
+
+func TestBulkMutations(t *testing.T) {
+	tests := []struct {
+		query  string
+		result string
+		tags   map[string][]string
+		left   int
+	}{
+		{
+			query:  `mutation{createMany(marks:[{type:NOTE,title:"T",author:"A",note:"4"},{type:HIGHLIGHT,title:"T",author:"A",data:"5"}]){ids,count}}`,
+			result: `{"data":{"createMany":{"count":2,"ids":["3","4"]}}}`,
+			left:   5,
+		},
+		{
+			query: `mutation{createMany(marks:[{type:NOTE,title:"T",author:"A",note:"4"},{type:NOTE,title:"T",author:"A"}]){ids}}`,
+			result: `{"data":{"createMany":null},"errors":[{"message":"Expect 'data' or 'note' to be set","locations":[{"line":1,"column":10}],"path":["createMany"],` +
+				`"extensions":{"code":"INVALID_ARGUMENT","fields":[{"field":"marks.1.data","message":"Expect 'data' or 'note' to be set"}]}}]}`,
+			left: 3,
+		},
+		{
+			query:  `mutation{createMany(dryRun:true,marks:[{type:NOTE,title:"T",author:"A",note:"4"}]){ids,count,dryRun}}`,
+			result: `{"data":{"createMany":{"count":1,"dryRun":true,"ids":[]}}}`,
+			left:   3,
+		},
+		{
+			query:  `mutation{updateMany(filter:{ids:["a","c"]},update:{author:"B"},dryRun:true){ids,count,marks{id,author}}}`,
+			result: `{"data":{"updateMany":{"count":2,"ids":[],"marks":[{"author":"B","id":"a"},{"author":"B","id":"c"}]}}}`,
+			left:   3,
+		},
+		{
+			query: `mutation{updateMany(filter:{ids:["a"]},update:{type:UNKNOWN}){count}}`,
+			result: `{"data":null,"errors":[{"message":"Argument \"update\" has invalid value {type: UNKNOWN}.\nIn field \"type\": Expected type \"MarkType\", found UNKNOWN.",` +
+				`"locations":[{"line":1,"column":47}],"extensions":{"code":"INVALID_ARGUMENT"}}]}`,
+			left: 3,
+		},
+		{
+			query:  `mutation{updateMany(filter:{ids:["a","b"]},update:{section:"S",clear:["tags"]}){ids,count,marks{section,tags}}}`,
+			result: `{"data":{"updateMany":{"count":2,"ids":["a","b"],"marks":[{"section":"S","tags":[]},{"section":"S","tags":[]}]}}}`,
+			tags:   map[string][]string{"a": nil, "b": nil, "c": nil},
+			left:   3,
+		},
+		{
+			query: `mutation{updateMany(filter:{ids:["a"]},update:{author:"B",clear:["author"]}){count}}`,
+			result: `{"data":{"updateMany":null},"errors":[{"message":"Field \"author\" can't be both set and cleared","locations":[{"line":1,"column":10}],` +
+				`"path":["updateMany"],"extensions":{"code":"INVALID_ARGUMENT"}}]}`,
+			left: 3,
+		},
+		{
+			query:  `mutation{deleteMany(filter:{}){count}}`,
+			result: `{"data":{"deleteMany":null},"errors":[{"message":"Expect a non-empty filter","locations":[{"line":1,"column":10}],"path":["deleteMany"],"extensions":{"code":"INVALID_ARGUMENT"}}]}`,
+			left:   3,
+		},
+		{
+			query:  `mutation{deleteMany(filter:{id:"b"}){ids,count}}`,
+			result: `{"data":{"deleteMany":{"count":1,"ids":["b"]}}}`,
+			left:   2,
+		},
+		{
+			query:  `mutation{addTags(filter:{ids:["a","b","c"]},tags:["y","z"]){ids,count}}`,
+			result: `{"data":{"addTags":{"count":3,"ids":["a","b","c"]}}}`,
+			tags:   map[string][]string{"a": {"x", "y", "z"}, "b": {"x", "y", "z"}, "c": {"y", "z"}},
+			left:   3,
+		},
+		{
+			query:  `mutation{removeTags(filter:{ids:["a","b","c"]},tags:["x"]){ids,count}}`,
+			result: `{"data":{"removeTags":{"count":2,"ids":["a","b"]}}}`,
+			tags:   map[string][]string{"a": {}, "b": {"y"}, "c": nil},
+			left:   3,
+		},
+		{
+			query:  `mutation{removeTags(filter:{ids:["b"]},tags:["x"],dryRun:true){ids,count,marks{tags}}}`,
+			result: `{"data":{"removeTags":{"count":1,"ids":[],"marks":[{"tags":["y"]}]}}}`,
+			tags:   map[string][]string{"b": {"x", "y"}},
+			left:   3,
+		},
+	}
+	for i, tt := range tests {
+		store := newBulkTestStorage()
+		assert.Equal(t, tt.result, runQuery(t, store, tt.query), "case #%d", i)
+		assert.Len(t, store.marks, tt.left, "case #%d", i)
+		for _, mark := range store.marks {
+			if tags, ok := tt.tags[mark.ID]; ok {
+				assert.Equal(t, tags, mark.Tags, "case #%d: %s", i, mark.ID)
+			}
+		}
+	}
+}
+
+func TestCreateManyPartialFailure(t *testing.T) {
+	store := newBulkTestStorage()
+	store.maxMarks = 4
+	query := `mutation{createMany(marks:[{type:NOTE,title:"T",author:"A",note:"4"},{type:NOTE,title:"T",author:"A",note:"5"}]){ids}}`
+	assert.Equal(t, `{"data":{"createMany":null},"errors":[{"message":"Failed to create marks.1 after creating 1 marks: Internal error","locations":[{"line":1,"column":10}],`+
+		`"path":["createMany"],"extensions":{"code":"INTERNAL","ids":["3"]}}]}`, runQuery(t, store, query))
+	assert.Len(t, store.marks, 4)
+}
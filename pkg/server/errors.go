@@ -0,0 +1,149 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/graphql-go/graphql"
+	"github.com/yifan-gu/blueNote/pkg/bluenote"
+	"github.com/yifan-gu/blueNote/pkg/event"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+	"github.com/yifan-gu/blueNote/pkg/tag"
+	"github.com/yifan-gu/blueNote/pkg/util"
+)
+
+// errorCode is the code of an error in the "extensions" of the GraphQL errors and the REST responses.
+type errorCode string
+
+const (
+	codeNotFound        errorCode = "NOT_FOUND"
+	codeInvalidArgument errorCode = "INVALID_ARGUMENT"
+	codeConflict        errorCode = "CONFLICT"
+	codeForbidden       errorCode = "FORBIDDEN"
+	codeExpired         errorCode = "EXPIRED"
+	codeInternal        errorCode = "INTERNAL"
+)
+
+// apiError is an error with a code, and the problems of the fields if the arguments are invalid.
+type apiError struct {
+	Code    errorCode           `json:"code"`
+	Message string              `json:"error"`
+	Fields  []*model.FieldError `json:"fields,omitempty"`
+	// IDs are the marks changed before a batch fails, as the result of a failed field is null.
+	IDs []string `json:"ids,omitempty"`
+}
+
+func newAPIError(code errorCode, msg string) *apiError {
+	return &apiError{Code: code, Message: msg}
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+// Extensions implements gqlerrors.ExtendedError.
+func (e *apiError) Extensions() map[string]interface{} {
+	ext := map[string]interface{}{"code": e.Code}
+	if len(e.Fields) > 0 {
+		ext["fields"] = e.Fields
+	}
+	if len(e.IDs) > 0 {
+		ext["ids"] = e.IDs
+	}
+	return ext
+}
+
+// status returns the http status of the error.
+func (e *apiError) status() int {
+	switch e.Code {
+	case codeNotFound:
+		return http.StatusNotFound
+	case codeInvalidArgument:
+		return http.StatusBadRequest
+	case codeConflict:
+		return http.StatusConflict
+	case codeForbidden:
+		return http.StatusForbidden
+	case codeExpired:
+		return http.StatusGone
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// toAPIError classifies the error by the errors of the model and the storages, the others are internal
+// and have a generic message.
+func toAPIError(err error) *apiError {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	var verr *model.ValidationError
+	if errors.As(err, &verr) {
+		return &apiError{Code: codeInvalidArgument, Message: err.Error(), Fields: verr.Errors}
+	}
+	switch {
+	case errors.Is(err, storage.ErrNotFound), errors.Is(err, storage.ErrRevisionNotFound):
+		return newAPIError(codeNotFound, err.Error())
+	case errors.Is(err, storage.ErrInvalidID):
+		return newAPIError(codeInvalidArgument, err.Error())
+	case errors.Is(err, tag.ErrInvalid), errors.Is(err, bluenote.ErrInvalidSource):
+		return newAPIError(codeInvalidArgument, err.Error())
+	case errors.Is(err, storage.ErrConflict):
+		return newAPIError(codeConflict, err.Error())
+	case errors.Is(err, event.ErrExpired):
+		return newAPIError(codeExpired, err.Error())
+	default:
+		// The details, e.g. of the storage, are only logged, as they can reveal the internals to the clients.
+		util.Error(fmt.Sprintf("Internal error: %+v", err))
+		return newAPIError(codeInternal, "Internal error")
+	}
+}
+
+// withErrorCode converts the errors of the resolver to *apiError, so they carry the codes.
+func withErrorCode(resolve graphql.FieldResolveFn) graphql.FieldResolveFn {
+	if resolve == nil {
+		return nil
+	}
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		result, err := resolve(p)
+		if err != nil {
+			return nil, toAPIError(err)
+		}
+		return result, nil
+	}
+}
+
+// setErrorCodes sets the codes of the errors that don't have one, the errors without a path
+// are of the parsing and the validation of the request, and the others are internal.
+// The errors of subscribing lose the extensions when formatted, so they are taken from the original errors.
+func setErrorCodes(result *graphql.Result) {
+	for i := range result.Errors {
+		if result.Errors[i].Extensions != nil {
+			continue
+		}
+		var apiErr *apiError
+		if errors.As(result.Errors[i].OriginalError(), &apiErr) {
+			result.Errors[i].Extensions = apiErr.Extensions()
+			continue
+		}
+		code := codeInternal
+		if len(result.Errors[i].Path) == 0 {
+			code = codeInvalidArgument
+		}
+		result.Errors[i].Extensions = map[string]interface{}{"code": code}
+	}
+}
+
+// writeAPIError writes the error as a json response, the status is decided by the code.
+func writeAPIError(w http.ResponseWriter, err error) {
+	apiErr := toAPIError(err)
+	writeJSON(w, apiErr.status(), apiErr)
+}
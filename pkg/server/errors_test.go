@@ -0,0 +1,76 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/event"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+)
+
+func TestToAPIError(t *testing.T) {
+	tests := []struct {
+		err    error
+		code   errorCode
+		status int
+		fields int
+	}{
+		{err: newAPIError(codeForbidden, "no"), code: codeForbidden, status: http.StatusForbidden},
+		{err: fmt.Errorf("wrapped: %w", newAPIError(codeNotFound, "no")), code: codeNotFound, status: http.StatusNotFound},
+		{err: model.ValidateMark(&model.Mark{Type: "POEM"}), code: codeInvalidArgument, status: http.StatusBadRequest, fields: 2},
+		{err: errors.Wrapf(storage.ErrNotFound, "mark %q", "a"), code: codeNotFound, status: http.StatusNotFound},
+		{err: errors.Wrapf(storage.ErrInvalidID, "id %q", "a"), code: codeInvalidArgument, status: http.StatusBadRequest},
+		{err: errors.Wrap(storage.ErrConflict, "insert"), code: codeConflict, status: http.StatusConflict},
+		{err: errors.Wrap(event.ErrExpired, "event 1"), code: codeExpired, status: http.StatusGone},
+		{err: errors.New("connection refused"), code: codeInternal, status: http.StatusInternalServerError},
+	}
+	for i, tt := range tests {
+		apiErr := toAPIError(tt.err)
+		assert.Equal(t, tt.code, apiErr.Code, "case #%d", i)
+		assert.Equal(t, tt.status, apiErr.status(), "case #%d", i)
+		if tt.code == codeInternal {
+			assert.Equal(t, "Internal error", apiErr.Error(), "case #%d", i)
+		} else {
+			assert.Contains(t, tt.err.Error(), apiErr.Error(), "case #%d", i)
+		}
+		assert.Len(t, apiErr.Fields, tt.fields, "case #%d", i)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	store := &fakeStorage{marks: []*model.Mark{{ID: "a", Type: model.MarkTypeHighlight, Title: "T", Author: "A", Data: "1"}}}
+	tests := []struct {
+		query  string
+		result string
+	}{
+		{
+			query:  `{marks(id:"a",ids:["a"]){id}}`,
+			result: `{"data":{"marks":null},"errors":[{"message":"Expect only one of id and ids","locations":[{"line":1,"column":2}],"path":["marks"],"extensions":{"code":"INVALID_ARGUMENT"}}]}`,
+		},
+		{
+			query:  `{marks(type:POEM){id}}`,
+			result: `{"data":null,"errors":[{"message":"Argument \"type\" has invalid value POEM.\nExpected type \"MarkType\", found POEM.","locations":[{"line":1,"column":13}],"extensions":{"code":"INVALID_ARGUMENT"}}]}`,
+		},
+		{
+			query:  `mutation{updateOne(id:"b",note:"n"){id}}`,
+			result: `{"data":{"updateOne":null},"errors":[{"message":"Mark \"b\" is not found","locations":[{"line":1,"column":10}],"path":["updateOne"],"extensions":{"code":"NOT_FOUND"}}]}`,
+		},
+		{
+			query: `mutation{createOne(type:HIGHLIGHT,title:"T",author:"A",location:{page:-1}){id}}`,
+			result: `{"data":{"createOne":null},"errors":[{"message":"Expect 'data' or 'note' to be set; Expect a non-negative page, got -1","locations":[{"line":1,"column":10}],"path":["createOne"],` +
+				`"extensions":{"code":"INVALID_ARGUMENT","fields":[{"field":"data","message":"Expect 'data' or 'note' to be set"},{"field":"location.page","message":"Expect a non-negative page, got -1"}]}}]}`,
+		},
+	}
+	for i, tt := range tests {
+		assert.Equal(t, tt.result, runQuery(t, store, tt.query), "case #%d", i)
+	}
+}
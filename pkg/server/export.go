@@ -0,0 +1,231 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+
+	"github.com/yifan-gu/blueNote/pkg/config"
+	"github.com/yifan-gu/blueNote/pkg/exporter"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/option"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+	"github.com/yifan-gu/blueNote/pkg/util"
+)
+
+// exportName is the base name of the exported stream and zip archive.
+const exportName = "notes"
+
+// exportSort keeps the marks of a book in the reading order.
+var exportSort = []storage.Sort{{Field: storage.SortByTitle}, {Field: storage.SortByLocation}}
+
+// markFilterFromJSON parses a json object with the fields of a MarkFilter into a filter.
+func markFilterFromJSON(data string) (interface{}, error) {
+	args := make(map[string]interface{})
+	if data != "" {
+		if err := json.Unmarshal([]byte(data), &args); err != nil {
+			return nil, newAPIError(codeInvalidArgument, fmt.Sprintf("Invalid filter %q: %v", data, err))
+		}
+	}
+	// The timestamps are decoded as float64, but the graphql arguments are int.
+	for key, val := range args {
+		if f, ok := val.(float64); ok && f == float64(int(f)) {
+			args[key] = int(f)
+		}
+	}
+	return markFilterFromArgs(args)
+}
+
+// booksFromMarks groups the marks into books by their titles and authors.
+func booksFromMarks(marks []*model.Mark) []*model.Book {
+	var books []*model.Book
+	for _, mark := range marks {
+		books = append(books, &model.Book{Title: mark.Title, Author: mark.Author, Marks: []*model.Mark{mark}})
+	}
+	return model.MergeBooks(books)
+}
+
+// setAttachmentHeaders sets the headers of a file to download, the content type is detected from
+// the data if it can't be told by the extension.
+func setAttachmentHeaders(w http.ResponseWriter, name string, data []byte) {
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+}
+
+// attachmentOutput writes the export to the response as it goes. The stream is served as it is,
+// a single file is kept until the export is done and served as it is, more files are zipped.
+type attachmentOutput struct {
+	w          http.ResponseWriter
+	streamName string
+	streaming  bool
+	// first is the first file, which is zipped once the second one is created.
+	first *exporter.File
+	zw    *zip.Writer
+	names map[string]bool
+}
+
+func newAttachmentOutput(w http.ResponseWriter, streamName string) *attachmentOutput {
+	return &attachmentOutput{w: w, streamName: streamName, names: make(map[string]bool)}
+}
+
+// started returns whether the response has been started, after which the errors can't be written.
+func (o *attachmentOutput) started() bool {
+	return o.streaming || o.zw != nil
+}
+
+func (o *attachmentOutput) Writer() io.Writer {
+	return o
+}
+
+func (o *attachmentOutput) Write(p []byte) (int, error) {
+	if o.first != nil || o.zw != nil {
+		return 0, errors.New("the exporter writes both a stream and files")
+	}
+	if !o.streaming {
+		setAttachmentHeaders(o.w, o.streamName, p)
+		o.streaming = true
+	}
+	return o.w.Write(p)
+}
+
+func (o *attachmentOutput) Create(name string) (io.WriteCloser, error) {
+	name = path.Clean("/" + filepath.ToSlash(name))[1:]
+	switch {
+	case name == "":
+		return nil, errors.New("empty file name")
+	case o.streaming:
+		return nil, errors.New("the exporter writes both a stream and files")
+	case o.names[name]:
+		return nil, errors.New(fmt.Sprintf("file %q is created twice", name))
+	}
+	o.names[name] = true
+	if o.zw == nil && o.first == nil {
+		o.first = &exporter.File{Path: name}
+		return o.first, nil
+	}
+	if o.zw == nil {
+		setAttachmentHeaders(o.w, exportName+".zip", nil)
+		o.zw = zip.NewWriter(o.w)
+		if err := o.writeZipFile(o.first.Path, o.first.Data.Bytes()); err != nil {
+			return nil, err
+		}
+		o.first = nil
+	}
+	fw, err := o.zw.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return zipFile{fw}, nil
+}
+
+func (o *attachmentOutput) writeZipFile(name string, data []byte) error {
+	fw, err := o.zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write(data)
+	return err
+}
+
+// Close finishes the response, an empty stream is served if nothing is written.
+func (o *attachmentOutput) Close() error {
+	switch {
+	case o.zw != nil:
+		return o.zw.Close()
+	case o.first != nil:
+		setAttachmentHeaders(o.w, path.Base(o.first.Path), o.first.Data.Bytes())
+		_, err := o.w.Write(o.first.Data.Bytes())
+		return err
+	case !o.streaming:
+		setAttachmentHeaders(o.w, o.streamName, nil)
+		o.w.WriteHeader(http.StatusOK)
+	}
+	return nil
+}
+
+// zipFile is a file in the zip archive, which is closed by creating the next one.
+type zipFile struct {
+	io.Writer
+}
+
+func (zipFile) Close() error {
+	return nil
+}
+
+// handleExport exports the marks that match the filter with the exporter given by "format".
+// The parameters are "format", "filter" (a json object with the fields of a MarkFilter) and
+// "option" (repeatable, "name=value"). A single file is served as it is, multiple files are zipped,
+// both are written to the response while exporting.
+func (s *server) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	values := r.URL.Query()
+	format := values.Get("format")
+	if format == "" {
+		format = config.DefaultExporter
+	}
+	registered, err := s.registry.Exporter(format)
+	if err != nil {
+		writeAPIError(w, newAPIError(codeInvalidArgument, err.Error()))
+		return
+	}
+	if _, ok := registered.(exporter.StorageExporter); ok {
+		writeAPIError(w, newAPIError(codeInvalidArgument, fmt.Sprintf("Exporter %q doesn't support downloading", format)))
+		return
+	}
+	options, err := parseOptions(values["option"])
+	if err == nil {
+		err = option.CheckRemote(registered.Options(), options)
+	}
+	var exp exporter.Exporter
+	if err == nil {
+		exp, err = s.registry.Exporters.New(format, options)
+	}
+	if err != nil {
+		writeAPIError(w, newAPIError(codeInvalidArgument, err.Error()))
+		return
+	}
+	filter, err := markFilterFromJSON(values.Get("filter"))
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	marks, err := s.storeFor(r.Context()).GetMarks(r.Context(), filter, &storage.QueryOptions{Sort: exportSort})
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	out := newAttachmentOutput(w, fmt.Sprintf("%s.%s", exportName, exp.Name()))
+	err = exp.Export(&config.ConvertConfig{}, out, booksFromMarks(marks))
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		if !out.started() {
+			writeAPIError(w, err)
+			return
+		}
+		// The status is sent already, the response is aborted so the client doesn't take it as complete.
+		util.Error(fmt.Sprintf("Failed to export %d marks as %q to %v: ", len(marks), format, r.RemoteAddr), err)
+		panic(http.ErrAbortHandler)
+	}
+	util.Debugf("Exported %d marks as %q to %v", len(marks), format, r.RemoteAddr)
+}
@@ -0,0 +1,149 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/model"
+)
+
+func newExportTestStorage() *fakeStorage {
+	return &fakeStorage{marks: []*model.Mark{
+		{ID: "a", Type: model.MarkTypeHighlight, Title: "T1", Author: "A", Data: "1"},
+		{ID: "b", Type: model.MarkTypeNote, Title: "T2", Author: "B", Data: "2", UserNote: "n"},
+		{ID: "c", Type: model.MarkTypeHighlight, Title: "T1", Author: "A", Data: "3"},
+	}}
+}
+
+func TestHandleExport(t *testing.T) {
+	tests := []struct {
+		params      url.Values
+		code        int
+		filename    string
+		contentType string
+		body        string
+		zipFiles    []string
+	}{
+		{
+			params:      url.Values{"format": {"json"}, "filter": {`{"ids":["b"]}`}},
+			code:        http.StatusOK,
+			filename:    "notes.json",
+			contentType: "application/json",
+			body:        `[{"title":"T2","author":"B","marks":[{"id":"b","type":"NOTE","title":"T2","author":"B","data":"2","note":"n"}]}]` + "\n",
+		},
+		{
+			params:   url.Values{"format": {"markdown"}, "filter": {`{"ids":["a","c"]}`}},
+			code:     http.StatusOK,
+			filename: "notes.markdown",
+			body:     "# T1\n\n*A*\n\n> 1\n\n> 3\n",
+		},
+		{
+			params:      url.Values{"format": {"markdown"}, "option": {"markdown.split=true"}},
+			code:        http.StatusOK,
+			filename:    "notes.zip",
+			contentType: "application/zip",
+			zipFiles:    []string{"T1 - A.md", "T2 - B.md"},
+		},
+		{
+			params:      url.Values{"format": {"org-roam"}, "option": {"org-roam.author-subdir=true"}},
+			code:        http.StatusOK,
+			filename:    "notes.zip",
+			contentType: "application/zip",
+			zipFiles:    []string{"A/《T1》 by A.org", "B/《T2》 by B.org"},
+		},
+		{
+			params:   url.Values{"format": {"org-roam"}, "filter": {`{"id":"a"}`}},
+			code:     http.StatusOK,
+			filename: "《T1》 by A.org",
+		},
+		{
+			params: url.Values{"format": {"mongodb"}},
+			code:   http.StatusBadRequest,
+		},
+		{
+			params: url.Values{"format": {"unknown"}},
+			code:   http.StatusBadRequest,
+		},
+		{
+			params: url.Values{"format": {"org-roam"}, "option": {"org-roam.db-path=/tmp/db"}},
+			code:   http.StatusBadRequest,
+		},
+		{
+			params: url.Values{"format": {"json"}, "option": {"json.unknown=1"}},
+			code:   http.StatusBadRequest,
+		},
+		{
+			params: url.Values{"format": {"json"}, "option": {"json.pretty=maybe"}},
+			code:   http.StatusBadRequest,
+		},
+		{
+			params: url.Values{"format": {"json"}, "filter": {`{"id":`}},
+			code:   http.StatusBadRequest,
+		},
+	}
+
+	for i, tt := range tests {
+		s := newTestServer(t, newExportTestStorage())
+		rec := httptest.NewRecorder()
+		s.handleExport(rec, httptest.NewRequest(http.MethodGet, "/export?"+tt.params.Encode(), nil))
+		assert.Equal(t, tt.code, rec.Code, "case #%d", i)
+		if tt.code != http.StatusOK {
+			assert.Contains(t, rec.Body.String(), `"code":"INVALID_ARGUMENT"`, "case #%d", i)
+			continue
+		}
+		assert.Contains(t, rec.Header().Get("Content-Disposition"), "attachment", "case #%d", i)
+		assert.Contains(t, rec.Header().Get("Content-Disposition"), url.PathEscape(tt.filename), "case #%d", i)
+		if tt.contentType != "" {
+			assert.Equal(t, tt.contentType, rec.Header().Get("Content-Type"), "case #%d", i)
+		}
+		if tt.body != "" {
+			assert.Equal(t, tt.body, rec.Body.String(), "case #%d", i)
+		}
+		if tt.zipFiles != nil {
+			zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+			assert.NoError(t, err, "case #%d", i)
+			var names []string
+			for _, f := range zr.File {
+				names = append(names, f.Name)
+			}
+			sort.Strings(names)
+			assert.Equal(t, tt.zipFiles, names, "case #%d", i)
+		}
+	}
+}
+
+func TestAttachmentOutput(t *testing.T) {
+	rec := httptest.NewRecorder()
+	out := newAttachmentOutput(rec, "notes.json")
+	_, err := out.Writer().Write([]byte("{}"))
+	assert.NoError(t, err)
+	assert.True(t, out.started())
+	_, err = out.Create("a.org")
+	assert.Error(t, err)
+	assert.NoError(t, out.Close())
+	assert.Equal(t, "{}", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	out = newAttachmentOutput(rec, "notes.json")
+	f, err := out.Create("a.org")
+	assert.NoError(t, err)
+	f.Write([]byte("a"))
+	assert.False(t, out.started())
+	_, err = out.Create("a.org")
+	assert.Error(t, err)
+	_, err = out.Writer().Write([]byte("{}"))
+	assert.Error(t, err)
+	assert.NoError(t, out.Close())
+	assert.Equal(t, "a", rec.Body.String())
+}
@@ -0,0 +1,84 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"encoding/json"
+
+	"github.com/graphql-go/graphql"
+	"github.com/yifan-gu/blueNote/pkg/model"
+)
+
+// changeValueField resolves a value of a change as json, as the values are of different types.
+func changeValueField(description string, value func(c *model.Change) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type:        graphql.String,
+		Description: description,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			val := value(p.Source.(*model.Change))
+			if val == nil {
+				return nil, nil
+			}
+			b, err := json.Marshal(val)
+			if err != nil {
+				return nil, err
+			}
+			return string(b), nil
+		},
+	}
+}
+
+var changeType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "Change",
+		Fields: graphql.Fields{
+			"field": &graphql.Field{
+				Type:        graphql.String,
+				Description: "The field of the mark, e.g. \"note\" or \"location.page\"",
+			},
+			"old": changeValueField("The json of the value before the change, null if it's not set", func(c *model.Change) interface{} { return c.Old }),
+			"new": changeValueField("The json of the value after the change, null if it's not set", func(c *model.Change) interface{} { return c.New }),
+		},
+	},
+)
+
+var revisionType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "Revision",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.String,
+			},
+			"markId": &graphql.Field{
+				Type: graphql.String,
+			},
+			"changes": &graphql.Field{
+				Type: graphql.NewList(changeType),
+			},
+			"actor": &graphql.Field{
+				Type:        graphql.String,
+				Description: "The user who made the change",
+			},
+			"createdAt": &graphql.Field{
+				Type: int64Type,
+			},
+		},
+	},
+)
+
+func (s *server) resolveHistory(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["id"].(string)
+	return s.storeFor(p.Context).GetRevisions(p.Context, id)
+}
+
+func (s *server) revertMark(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["id"].(string)
+	revision, _ := p.Args["revision"].(string)
+	if err := s.storeFor(p.Context).RevertMark(p.Context, id, revision); err != nil {
+		return nil, err
+	}
+	return getMark(p.Context, s.storeFor(p.Context), id)
+}
@@ -0,0 +1,55 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/model"
+)
+
+func TestHistory(t *testing.T) {
+	newStorage := func() *fakeStorage {
+		return &fakeStorage{
+			marks: []*model.Mark{
+				{ID: "a", Type: model.MarkTypeNote, Title: "T", Author: "A", UserNote: "new", Tags: []string{"x"}},
+			},
+			revisions: map[string][]*model.Revision{
+				"a": {
+					{ID: "r1", MarkID: "a", Actor: "alice", CreatedAt: 1700000000000, Changes: []*model.Change{
+						{Field: "note", Old: nil, New: "new"},
+						{Field: "tags", Old: []string{}, New: []string{"x"}},
+					}},
+				},
+			},
+		}
+	}
+	tests := []struct {
+		query    string
+		result   string
+		reverted []string
+	}{
+		{
+			query:  `{history(id:"a"){id,markId,actor,createdAt,changes{field,old,new}}}`,
+			result: `{"data":{"history":[{"actor":"alice","changes":[{"field":"note","new":"\"new\"","old":null},{"field":"tags","new":"[\"x\"]","old":"[]"}],"createdAt":1700000000000,"id":"r1","markId":"a"}]}}`,
+		},
+		{
+			query:    `mutation{revertMark(id:"a",revision:"r1"){id}}`,
+			result:   `{"data":{"revertMark":{"id":"a"}}}`,
+			reverted: []string{"r1"},
+		},
+		{
+			query:  `mutation{revertMark(id:"a",revision:"r2"){id}}`,
+			result: `{"data":{"revertMark":null},"errors":[{"message":"revision \"r2\" of mark \"a\": revision not found","locations":[{"line":1,"column":10}],"path":["revertMark"],"extensions":{"code":"NOT_FOUND"}}]}`,
+		},
+	}
+	for i, tt := range tests {
+		store := newStorage()
+		assert.Equal(t, tt.result, runQuery(t, store, tt.query), "case #%d", i)
+		assert.Equal(t, tt.reverted, store.reverted, "case #%d", i)
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/yifan-gu/blueNote/pkg/auth"
+	"github.com/yifan-gu/blueNote/pkg/util"
+)
+
+//go:embed graphiql.html
+var graphiqlPage []byte
+
+const (
+	// readHeaderTimeout is the timeout of reading the request headers, which is not configurable
+	// as the headers are small, and a slow client shouldn't hold a connection.
+	readHeaderTimeout = 10 * time.Second
+	// readyzTimeout is the timeout of pinging the storage for /readyz.
+	readyzTimeout = 5 * time.Second
+)
+
+// Run serves until the context is canceled, then shuts down gracefully, waiting for the
+// in-flight requests until the shutdown timeout.
+func (s *server) Run(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:              s.config.ListenAddr,
+		Handler:           s.handler(),
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       s.config.ReadTimeout,
+		WriteTimeout:      s.config.WriteTimeout,
+		IdleTimeout:       s.config.IdleTimeout,
+	}
+	srv.RegisterOnShutdown(func() {
+		close(s.shutdown)
+	})
+	if s.auth == nil {
+		util.Warn("Authentication is disabled, anyone who can reach the server can read and write all the marks")
+	}
+	if s.config.GraphiQL && !hasIntegrity(graphiqlPage) {
+		util.Warn("The GraphiQL page loads its assets from unpkg without the integrity hashes, run scripts/graphiql-sri.sh to pin them")
+	}
+
+	if s.config.TrashRetention > 0 {
+		go s.purgeTrash(ctx)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		if s.config.TLSCertFile != "" {
+			util.Logf("Server is running on https://%v\n", s.config.ListenAddr)
+			errCh <- srv.ListenAndServeTLS(s.config.TLSCertFile, s.config.TLSKeyFile)
+			return
+		}
+		util.Logf("Server is running on http://%v\n", s.config.ListenAddr)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	util.Log("Shutting down the server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return errors.New(fmt.Sprintf("Failed to shut down the server gracefully: %v", err))
+	}
+	return nil
+}
+
+// hasIntegrity returns whether every external asset of the page has a subresource integrity hash.
+func hasIntegrity(page []byte) bool {
+	assets := regexp.MustCompile(`<(script|link)[^>]+(src|href)="https://[^>]*>`).FindAll(page, -1)
+	for _, asset := range assets {
+		if !bytes.Contains(asset, []byte(` integrity="sha`)) {
+			return false
+		}
+	}
+	return true
+}
+
+// handler returns the handler of all the endpoints.
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	graphqlHandler := s.authenticate(auth.ScopeRead, s.handleGraphql)
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		// The page is served before the authentication, the queries from it are authenticated.
+		if s.config.GraphiQL && isGraphiQLRequest(r) {
+			s.handleGraphiQL(w, r)
+			return
+		}
+		graphqlHandler(w, r)
+	})
+	mux.HandleFunc("/import", s.authenticate(auth.ScopeWrite, s.handleImport))
+	mux.HandleFunc("/export", s.authenticate(auth.ScopeRead, s.handleExport))
+	mux.HandleFunc(apiPrefix+"/marks", s.authenticateREST(s.handleMarks))
+	mux.HandleFunc(apiPrefix+"/marks/", s.authenticateREST(s.handleMark))
+	mux.HandleFunc(apiPrefix+"/books", s.authenticateREST(s.handleBooks))
+	mux.HandleFunc(apiPrefix+"/openapi.json", handleOpenAPI)
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	return s.cors(mux)
+}
+
+// readBody reads the request body up to the limit, it writes the error response and returns false on failure.
+func readBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, bool) {
+	defer r.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return nil, false
+	}
+	if int64(len(body)) > limit {
+		http.Error(w, fmt.Sprintf("Request body is larger than %d bytes", limit), http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	return body, true
+}
+
+// writeJSON writes the value as the json response.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		util.Debugf("Failed to write the response: %v", err)
+	}
+}
+
+// handleHealthz reports the server is alive.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz reports whether the server can serve the requests, i.e. the storage is reachable.
+func (s *server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyzTimeout)
+	defer cancel()
+	if err := s.store.Ping(ctx); err != nil {
+		// The error can reveal the internals of the storage, so it's only logged.
+		util.Warn(fmt.Sprintf("Storage %q is not ready: %v", s.store.Name(), err))
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "unavailable"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// cors allows the configured origins to call the server from browsers, the preflight requests
+// are answered before the authentication.
+func (s *server) cors(next http.Handler) http.Handler {
+	if len(s.config.CORSOrigins) == 0 {
+		return next
+	}
+	anyOrigin := false
+	allowed := make(map[string]bool)
+	for _, origin := range s.config.CORSOrigins {
+		anyOrigin = anyOrigin || origin == "*"
+		allowed[origin] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !(anyOrigin || allowed[origin]) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		if anyOrigin {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Add("Vary", "Origin")
+		}
+		h.Set("Access-Control-Expose-Headers", "Content-Disposition, Location, WWW-Authenticate, X-Total-Count")
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS")
+			h.Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			h.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
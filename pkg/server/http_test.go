@@ -0,0 +1,160 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/bluenote"
+	"github.com/yifan-gu/blueNote/pkg/config"
+	"github.com/yifan-gu/blueNote/pkg/model"
+)
+
+func newHTTPTestServer(t *testing.T, cfg *config.ServerConfig, store *fakeStorage) *server {
+	registry, err := bluenote.NewDefaultRegistry()
+	assert.NoError(t, err)
+	s, err := NewServer(cfg, store, registry, nil)
+	assert.NoError(t, err)
+	return s.(*server)
+}
+
+func TestHandler(t *testing.T) {
+	store := &fakeStorage{marks: []*model.Mark{
+		{ID: "a", Type: model.MarkTypeHighlight, Title: "T", Data: "1"},
+		{ID: "b", Type: model.MarkTypeHighlight, Title: "T", Data: "2"},
+	}}
+	handler := newHTTPTestServer(t, &config.ServerConfig{MaxBodySize: 200, GraphiQL: true, CORSOrigins: []string{"https://app.example.com"}}, store).handler()
+
+	tests := []struct {
+		method  string
+		target  string
+		body    string
+		headers map[string]string
+		pingErr error
+		code    int
+		result  string
+		respHdr map[string]string
+	}{
+		{method: http.MethodGet, target: "/healthz", code: http.StatusOK, result: `{"status":"ok"}`},
+		{method: http.MethodGet, target: "/readyz", code: http.StatusOK, result: `{"status":"ok"}`},
+		{method: http.MethodGet, target: "/readyz", pingErr: errors.New("down"), code: http.StatusServiceUnavailable, result: `{"status":"unavailable"}`},
+		{method: http.MethodPut, target: "/graphql", code: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, target: "/graphql", code: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/graphql?query=" + url.QueryEscape(`{marks(id:"b"){id}}`), code: http.StatusOK, result: `{"data":{"marks":[{"id":"b"}]}}`},
+		{
+			method: http.MethodGet,
+			target: "/graphql?query=" + url.QueryEscape(`query A($id:String){marks(id:$id){id}}`) + "&variables=" + url.QueryEscape(`{"id":"a"}`),
+			code:   http.StatusOK,
+			result: `{"data":{"marks":[{"id":"a"}]}}`,
+		},
+		{method: http.MethodGet, target: "/graphql?query={marks{id}}&variables=x", code: http.StatusBadRequest},
+		{
+			method:  http.MethodGet,
+			target:  "/graphql?query=" + url.QueryEscape(`mutation{deleteOne(id:"a"){id}}`),
+			code:    http.StatusMethodNotAllowed,
+			respHdr: map[string]string{"Allow": "POST"},
+		},
+		{
+			method:  http.MethodGet,
+			target:  "/graphql",
+			headers: map[string]string{"Accept": "text/html,application/xhtml+xml"},
+			code:    http.StatusOK,
+			respHdr: map[string]string{"Content-Type": "text/html; charset=utf-8"},
+		},
+		{method: http.MethodPost, target: "/graphql", body: `{}`, code: http.StatusBadRequest},
+		{method: http.MethodPost, target: "/graphql", body: `{"query":1}`, code: http.StatusBadRequest},
+		{method: http.MethodPost, target: "/graphql", body: `{"query":"{marks{id}}` + strings.Repeat(" ", 200) + `"}`, code: http.StatusRequestEntityTooLarge},
+		{
+			method: http.MethodPost,
+			target: "/graphql",
+			body:   `{"query":"query A($id:String){marks(id:$id){id}} query B{marks{id}}","variables":{"id":"b"},"operationName":"A"}`,
+			code:   http.StatusOK,
+			result: `{"data":{"marks":[{"id":"b"}]}}`,
+		},
+		{
+			method:  http.MethodOptions,
+			target:  "/graphql",
+			headers: map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "POST"},
+			code:    http.StatusNoContent,
+			respHdr: map[string]string{"Access-Control-Allow-Origin": "https://app.example.com", "Access-Control-Allow-Headers": "Authorization, Content-Type", "Vary": "Origin"},
+		},
+		{
+			method:  http.MethodOptions,
+			target:  "/graphql",
+			headers: map[string]string{"Origin": "https://evil.example.com", "Access-Control-Request-Method": "POST"},
+			code:    http.StatusMethodNotAllowed,
+			respHdr: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			method:  http.MethodPost,
+			target:  "/graphql",
+			body:    `{"query":"{marks(id:\"a\"){id}}"}`,
+			headers: map[string]string{"Origin": "https://app.example.com"},
+			code:    http.StatusOK,
+			result:  `{"data":{"marks":[{"id":"a"}]}}`,
+			respHdr: map[string]string{"Access-Control-Allow-Origin": "https://app.example.com", "Content-Type": "application/json"},
+		},
+	}
+	for i, tt := range tests {
+		store.pingErr = tt.pingErr
+		r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		assert.Equal(t, tt.code, rec.Code, "case #%d", i)
+		if tt.result != "" {
+			assert.Equal(t, tt.result, strings.TrimSpace(rec.Body.String()), "case #%d", i)
+		}
+		for k, v := range tt.respHdr {
+			assert.Equal(t, v, rec.Header().Get(k), "case #%d: %s", i, k)
+		}
+	}
+}
+
+func TestRunShutdown(t *testing.T) {
+	s := newHTTPTestServer(t, &config.ServerConfig{ListenAddr: "127.0.0.1:0"}, &fakeStorage{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.Run(ctx)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server doesn't shut down")
+	}
+
+	_, err := NewServer(&config.ServerConfig{TLSCertFile: "cert.pem"}, &fakeStorage{}, nil, nil)
+	assert.Error(t, err)
+}
+
+func TestHasIntegrity(t *testing.T) {
+	tests := []struct {
+		page   string
+		result bool
+	}{
+		{page: `<script src="/local.js"></script>`, result: true},
+		{page: `<script src="https://unpkg.com/react@18.2.0/umd/react.production.min.js" integrity="sha384-abc" crossorigin="anonymous"></script>`, result: true},
+		{page: `<link rel="stylesheet" href="https://unpkg.com/graphiql@3.0.0/graphiql.min.css" integrity="sha384-abc" />` +
+			`<script src="https://unpkg.com/graphiql@3.0.0/graphiql.min.js" crossorigin="anonymous"></script>`, result: false},
+	}
+	for i, tt := range tests {
+		assert.Equal(t, tt.result, hasIntegrity([]byte(tt.page)), "case #%d", i)
+	}
+}
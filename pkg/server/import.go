@@ -0,0 +1,230 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/yifan-gu/blueNote/pkg/bluenote"
+	"github.com/yifan-gu/blueNote/pkg/parser"
+	"github.com/yifan-gu/blueNote/pkg/util"
+)
+
+const (
+	// maxImportMemory is the maximum size of the uploaded files kept in memory, the rest are stored on disk.
+	maxImportMemory = 32 << 20
+	// defaultImportName is the source name of an upload without a file name.
+	defaultImportName = "upload"
+)
+
+var importJobType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "ImportJob",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.String,
+			},
+			"source": &graphql.Field{
+				Type: graphql.String,
+			},
+			"parser": &graphql.Field{
+				Type: graphql.String,
+			},
+			"books": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"marks": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"created": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"duplicates": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"ids": &graphql.Field{
+				Type: graphql.NewList(graphql.String),
+			},
+			"dryRun": &graphql.Field{
+				Type: graphql.Boolean,
+			},
+			"startedAt": &graphql.Field{
+				Type: int64Type,
+			},
+			"finishedAt": &graphql.Field{
+				Type: int64Type,
+			},
+		},
+	},
+)
+
+// importParams are the parameters of an import, shared by the http endpoint and the graphql mutation.
+type importParams struct {
+	parser     string
+	transforms []string
+	options    map[string]string
+	dedupe     bool
+	dryRun     bool
+}
+
+// parseOptions parses the parser options in the form of "name=value".
+func parseOptions(options []string) (map[string]string, error) {
+	ret := make(map[string]string)
+	for _, opt := range options {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, errors.New(fmt.Sprintf("Invalid option %q, expecting \"name=value\"", opt))
+		}
+		ret[kv[0]] = kv[1]
+	}
+	return ret, nil
+}
+
+// importParamsFromValues reads the import parameters from the form or the query values.
+func importParamsFromValues(values map[string][]string) (*importParams, error) {
+	get := func(key string) string {
+		if vals := values[key]; len(vals) > 0 {
+			return vals[0]
+		}
+		return ""
+	}
+	params := &importParams{parser: get("parser"), transforms: values["transform"], dedupe: true}
+	if params.parser == "" {
+		params.parser = parser.AutoParser
+	}
+	var err error
+	if params.options, err = parseOptions(values["option"]); err != nil {
+		return nil, err
+	}
+	for key, target := range map[string]*bool{"dedupe": &params.dedupe, "dryRun": &params.dryRun} {
+		if val := get(key); val != "" {
+			if *target, err = strconv.ParseBool(val); err != nil {
+				return nil, errors.New(fmt.Sprintf("Invalid %s %q, expecting a boolean", key, val))
+			}
+		}
+	}
+	return params, nil
+}
+
+func (s *server) importReader(ctx context.Context, name string, r io.Reader, params *importParams) (*bluenote.ImportSummary, error) {
+	convertOpts := &bluenote.ConvertOptions{Transforms: params.transforms, ParserOptions: params.options}
+	importOpts := &bluenote.ImportOptions{Dedupe: params.dedupe, DryRun: params.dryRun}
+	return s.registry.ImportSource(ctx, s.storeFor(ctx), parser.NewSource(name, r), params.parser, convertOpts, importOpts)
+}
+
+// handleImport imports the uploaded files, either as the "file" fields of a multipart form,
+// or as the request body. The parameters are given as the form fields or the query parameters:
+// "parser", "transform" (repeatable), "option" (repeatable, "name=value"), "dedupe" and "dryRun".
+// It returns the jobs of the files, and the errors of the files that failed, the marks created before a failure are kept.
+func (s *server) handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxUploadSize)
+	defer r.Body.Close()
+
+	values := r.URL.Query()
+	isMultipart := strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data")
+	if isMultipart {
+		if err := r.ParseMultipartForm(maxImportMemory); err != nil {
+			writeAPIError(w, newAPIError(codeInvalidArgument, fmt.Sprintf("Invalid multipart form: %v", err)))
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+		for key, vals := range r.MultipartForm.Value {
+			values[key] = append(values[key], vals...)
+		}
+	}
+	params, err := importParamsFromValues(values)
+	if err != nil {
+		writeAPIError(w, newAPIError(codeInvalidArgument, err.Error()))
+		return
+	}
+
+	// The files are imported independently, the jobs of the imported ones are returned
+	// together with the errors of the failed ones.
+	var jobs []*bluenote.ImportSummary
+	var errs []*importError
+	importFile := func(name string, f io.Reader) {
+		job, err := s.importReader(r.Context(), name, f, params)
+		if job != nil {
+			jobs = append(jobs, job)
+		}
+		if err != nil {
+			errs = append(errs, &importError{File: name, apiError: toAPIError(err)})
+		}
+	}
+	if !isMultipart {
+		name := values.Get("name")
+		if name == "" {
+			name = defaultImportName
+		}
+		importFile(name, r.Body)
+	} else {
+		files := r.MultipartForm.File["file"]
+		if len(files) == 0 {
+			writeAPIError(w, newAPIError(codeInvalidArgument, "Missing the \"file\" field"))
+			return
+		}
+		for _, fh := range files {
+			f, err := fh.Open()
+			if err != nil {
+				errs = append(errs, &importError{File: fh.Filename, apiError: newAPIError(codeInvalidArgument, fmt.Sprintf("Failed to open %q: %v", fh.Filename, err))})
+				continue
+			}
+			importFile(fh.Filename, f)
+			f.Close()
+		}
+	}
+
+	util.Debugf("Imported %d files from %v", len(jobs), r.RemoteAddr)
+	code := http.StatusOK
+	if len(errs) > 0 {
+		code = errs[0].status()
+	}
+	if jobs == nil {
+		jobs = []*bluenote.ImportSummary{}
+	}
+	resp := map[string]interface{}{"jobs": jobs}
+	if len(errs) > 0 {
+		resp["errors"] = errs
+	}
+	writeJSON(w, code, resp)
+}
+
+// importError is the error of importing a file, the status of the response is the one of the first error.
+type importError struct {
+	File string `json:"file"`
+	*apiError
+}
+
+func (s *server) importBooks(p graphql.ResolveParams) (interface{}, error) {
+	options, err := parseOptions(stringsFromArgs(p.Args, "options"))
+	if err != nil {
+		return nil, err
+	}
+	params := &importParams{parser: parser.AutoParser, transforms: stringsFromArgs(p.Args, "transforms"), options: options}
+	if val, ok := p.Args["parser"].(string); ok {
+		params.parser = val
+	}
+	params.dedupe, _ = p.Args["dedupe"].(bool)
+	params.dryRun, _ = p.Args["dryRun"].(bool)
+
+	name, _ := p.Args["name"].(string)
+	if name == "" {
+		name = defaultImportName
+	}
+	content, _ := p.Args["content"].(string)
+	return s.importReader(p.Context, name, strings.NewReader(content), params)
+}
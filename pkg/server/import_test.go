@@ -0,0 +1,150 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/bluenote"
+)
+
+func newImportRequest(t *testing.T, target string, paths ...string) *http.Request {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		fw, err := w.CreateFormFile("file", filepath.Base(path))
+		assert.NoError(t, err)
+		fw.Write(content)
+	}
+	assert.NoError(t, w.Close())
+
+	req := httptest.NewRequest(http.MethodPost, target, &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req
+}
+
+func TestHandleImport(t *testing.T) {
+	store := &fakeStorage{}
+	s := newTestServer(t, store)
+
+	tests := []struct {
+		target     string
+		code       int
+		created    int
+		duplicates int
+		stored     int
+	}{
+		{target: "/import?dryRun=true", code: http.StatusOK, created: 10, stored: 0},
+		{target: "/import", code: http.StatusOK, created: 10, stored: 10},
+		{target: "/import", code: http.StatusOK, created: 0, duplicates: 10, stored: 10},
+		{target: "/import?dedupe=false", code: http.StatusOK, created: 10, stored: 20},
+		{target: "/import?parser=unknown", code: http.StatusBadRequest, stored: 20},
+		{target: "/import?option=invalid", code: http.StatusBadRequest, stored: 20},
+	}
+
+	for i, tt := range tests {
+		rec := httptest.NewRecorder()
+		s.handleImport(rec, newImportRequest(t, tt.target, "../../examples/My Clippings.txt"))
+		assert.Equal(t, tt.code, rec.Code, "case #%d", i)
+		assert.Equal(t, tt.stored, len(store.marks), "case #%d", i)
+		if tt.code != http.StatusOK {
+			continue
+		}
+		var resp struct {
+			Jobs []*bluenote.ImportSummary `json:"jobs"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp), "case #%d", i)
+		assert.Equal(t, 1, len(resp.Jobs), "case #%d", i)
+		assert.Equal(t, "kindle-my-clippings", resp.Jobs[0].Parser, "case #%d", i)
+		assert.Equal(t, tt.created, resp.Jobs[0].Created, "case #%d", i)
+		assert.Equal(t, tt.duplicates, resp.Jobs[0].Duplicates, "case #%d", i)
+	}
+
+	// The marks in the trash are duplicates too.
+	store.trash, store.marks = store.marks[:10], store.marks[10:]
+	rec := httptest.NewRecorder()
+	s.handleImport(rec, newImportRequest(t, "/import", "../../examples/My Clippings.txt"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 10, len(store.marks))
+	assert.Contains(t, rec.Body.String(), `"created":0,"duplicates":10`)
+
+	rec = httptest.NewRecorder()
+	s.handleImport(rec, httptest.NewRequest(http.MethodGet, "/import", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestHandleImportFailures(t *testing.T) {
+	clippings := "../../examples/My Clippings.txt"
+	tests := []struct {
+		paths  []string
+		code   int
+		jobs   []int
+		errors []string
+	}{
+		{
+			paths:  []string{clippings, "../../examples/config.toml"},
+			code:   http.StatusBadRequest,
+			jobs:   []int{10},
+			errors: []string{"config.toml"},
+		},
+		{
+			// The storage fails in the middle of the second file.
+			paths:  []string{clippings, clippings},
+			code:   http.StatusInternalServerError,
+			jobs:   []int{10, 5},
+			errors: []string{"My Clippings.txt"},
+		},
+	}
+	for i, tt := range tests {
+		store := &fakeStorage{maxMarks: 15}
+		rec := httptest.NewRecorder()
+		newTestServer(t, store).handleImport(rec, newImportRequest(t, "/import?dedupe=false", tt.paths...))
+		assert.Equal(t, tt.code, rec.Code, "case #%d", i)
+
+		var resp struct {
+			Jobs   []*bluenote.ImportSummary `json:"jobs"`
+			Errors []struct {
+				File string `json:"file"`
+				Code string `json:"code"`
+			} `json:"errors"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp), "case #%d", i)
+		var created, files []string
+		for _, job := range resp.Jobs {
+			created = append(created, job.IDs...)
+			assert.Equal(t, tt.jobs[0], job.Created, "case #%d", i)
+			tt.jobs = tt.jobs[1:]
+		}
+		for _, e := range resp.Errors {
+			files = append(files, e.File)
+		}
+		assert.Empty(t, tt.jobs, "case #%d", i)
+		assert.Equal(t, tt.errors, files, "case #%d", i)
+		assert.Equal(t, len(store.marks), len(created), "case #%d", i)
+	}
+}
+
+func TestImportBooksMutation(t *testing.T) {
+	store := &fakeStorage{}
+	content := `[{"title":"T","author":"A","marks":[{"type":"HIGHLIGHT","data":"1"},{"type":"HIGHLIGHT","data":"1"},{"type":"NOTE","note":"2"}]}]`
+	quoted, err := json.Marshal(content)
+	assert.NoError(t, err)
+
+	result := runQuery(t, store, `mutation{importBooks(content:`+string(quoted)+`,parser:"json"){books,marks,created,duplicates,ids}}`)
+	assert.Equal(t, `{"data":{"importBooks":{"books":1,"created":2,"duplicates":1,"ids":["0","1"],"marks":3}}}`, result)
+	assert.Equal(t, "T", store.marks[0].Title)
+	assert.Equal(t, "A", store.marks[1].Author)
+}
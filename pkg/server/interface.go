@@ -5,6 +5,9 @@ Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
 
 package server
 
+import "context"
+
 type Server interface {
-	Run()
+	// Run serves until the context is canceled, then shuts down gracefully.
+	Run(ctx context.Context) error
 }
@@ -0,0 +1,159 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/search"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ownerStorage scopes the operations of a storage to the marks of an owner, the marks created
+// through it are owned by the owner, and the owner of the marks can't be changed.
+type ownerStorage struct {
+	storage.Storage
+	owner string
+}
+
+// scope adds the owner to the filter.
+func (s *ownerStorage) scope(filter interface{}) (bson.M, error) {
+	scoped := bson.M{}
+	switch f := filter.(type) {
+	case nil:
+	case bson.M:
+		for key, val := range f {
+			scoped[key] = val
+		}
+	default:
+		return nil, errors.New(fmt.Sprintf("Unsupported filter type %T", filter))
+	}
+	scoped["owner"] = s.owner
+	return scoped, nil
+}
+
+// checkOwned returns an error if the mark doesn't exist or is owned by others.
+func (s *ownerStorage) checkOwned(ctx context.Context, id string) error {
+	count, err := s.CountMarks(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return newAPIError(codeNotFound, fmt.Sprintf("Mark %q is not found", id))
+	}
+	return nil
+}
+
+func (s *ownerStorage) CreateMark(ctx context.Context, mark *model.Mark) (string, error) {
+	mark.Owner = s.owner
+	return s.Storage.CreateMark(ctx, mark)
+}
+
+func (s *ownerStorage) GetMarks(ctx context.Context, filter interface{}, opts *storage.QueryOptions) ([]*model.Mark, error) {
+	scoped, err := s.scope(filter)
+	if err != nil {
+		return nil, err
+	}
+	return s.Storage.GetMarks(ctx, scoped, opts)
+}
+
+func (s *ownerStorage) CountMarks(ctx context.Context, filter interface{}) (int, error) {
+	scoped, err := s.scope(filter)
+	if err != nil {
+		return 0, err
+	}
+	return s.Storage.CountMarks(ctx, scoped)
+}
+
+func (s *ownerStorage) AggregateMarks(ctx context.Context, filter interface{}, opts *storage.AggregateOptions) ([]*storage.Group, error) {
+	scoped, err := s.scope(filter)
+	if err != nil {
+		return nil, err
+	}
+	return s.Storage.AggregateMarks(ctx, scoped, opts)
+}
+
+func (s *ownerStorage) UpdateMarks(ctx context.Context, filter interface{}, patch *model.MarkPatch) ([]string, error) {
+	scoped, err := s.scope(filter)
+	if err != nil {
+		return nil, err
+	}
+	return s.Storage.UpdateMarks(storage.WithActor(ctx, s.owner), scoped, patch.Without("owner"))
+}
+
+func (s *ownerStorage) UpdateOneMark(ctx context.Context, id string, patch *model.MarkPatch) error {
+	if err := s.checkOwned(ctx, id); err != nil {
+		return err
+	}
+	return s.Storage.UpdateOneMark(storage.WithActor(ctx, s.owner), id, patch.Without("owner"))
+}
+
+func (s *ownerStorage) DeleteMarks(ctx context.Context, filter interface{}) (int, error) {
+	scoped, err := s.scope(filter)
+	if err != nil {
+		return 0, err
+	}
+	return s.Storage.DeleteMarks(ctx, scoped)
+}
+
+func (s *ownerStorage) DeleteOneMark(ctx context.Context, id string) error {
+	if err := s.checkOwned(ctx, id); err != nil {
+		return err
+	}
+	return s.Storage.DeleteOneMark(ctx, id)
+}
+
+func (s *ownerStorage) GetDeletedMarks(ctx context.Context, filter interface{}, opts *storage.QueryOptions) ([]*model.Mark, error) {
+	scoped, err := s.scope(filter)
+	if err != nil {
+		return nil, err
+	}
+	return s.Storage.GetDeletedMarks(ctx, scoped, opts)
+}
+
+func (s *ownerStorage) RestoreMarks(ctx context.Context, filter interface{}) ([]string, error) {
+	scoped, err := s.scope(filter)
+	if err != nil {
+		return nil, err
+	}
+	return s.Storage.RestoreMarks(ctx, scoped)
+}
+
+func (s *ownerStorage) PurgeMarks(ctx context.Context, filter interface{}) (int, error) {
+	scoped, err := s.scope(filter)
+	if err != nil {
+		return 0, err
+	}
+	return s.Storage.PurgeMarks(ctx, scoped)
+}
+
+func (s *ownerStorage) GetRevisions(ctx context.Context, id string) ([]*model.Revision, error) {
+	if err := s.checkOwned(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.Storage.GetRevisions(ctx, id)
+}
+
+func (s *ownerStorage) RevertMark(ctx context.Context, id, revisionID string) error {
+	if err := s.checkOwned(ctx, id); err != nil {
+		return err
+	}
+	return s.Storage.RevertMark(storage.WithActor(ctx, s.owner), id, revisionID)
+}
+
+func (s *ownerStorage) Search(ctx context.Context, query string, limit int, filter search.Filter) ([]*search.Result, error) {
+	searcher, ok := s.Storage.(search.Searcher)
+	if !ok {
+		return nil, errSearchNotSupported(s.Storage)
+	}
+	return searcher.Search(ctx, query, limit, func(mark *model.Mark) bool {
+		return mark.Owner == s.owner && (filter == nil || filter(mark))
+	})
+}
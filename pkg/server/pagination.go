@@ -0,0 +1,204 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/graphql-go/graphql"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+)
+
+var markOrderFieldEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "MarkOrderField",
+	Values: graphql.EnumValueConfigMap{
+		"CREATED_AT":       &graphql.EnumValueConfig{Value: storage.SortByCreatedAt},
+		"LAST_MODIFIED_AT": &graphql.EnumValueConfig{Value: storage.SortByLastModifiedAt},
+		"TITLE":            &graphql.EnumValueConfig{Value: storage.SortByTitle},
+		"LOCATION":         &graphql.EnumValueConfig{Value: storage.SortByLocation},
+	},
+})
+
+var orderDirectionEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "OrderDirection",
+	Values: graphql.EnumValueConfigMap{
+		"ASC":  &graphql.EnumValueConfig{Value: "ASC"},
+		"DESC": &graphql.EnumValueConfig{Value: "DESC"},
+	},
+})
+
+var markOrderInputType = graphql.NewInputObject(
+	graphql.InputObjectConfig{
+		Name: "MarkOrder",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"field": &graphql.InputObjectFieldConfig{
+				Type: graphql.NewNonNull(markOrderFieldEnum),
+			},
+			"direction": &graphql.InputObjectFieldConfig{
+				Type:         orderDirectionEnum,
+				DefaultValue: "ASC",
+			},
+		},
+	},
+)
+
+var pageInfoType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "PageInfo",
+		Fields: graphql.Fields{
+			"hasNextPage": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+			},
+			"hasPreviousPage": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+			},
+			"startCursor": &graphql.Field{
+				Type: graphql.String,
+			},
+			"endCursor": &graphql.Field{
+				Type: graphql.String,
+			},
+		},
+	},
+)
+
+var markEdgeType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "MarkEdge",
+		Fields: graphql.Fields{
+			"cursor": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+			},
+			"node": &graphql.Field{
+				Type: markType,
+			},
+		},
+	},
+)
+
+var markConnectionType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "MarkConnection",
+		Fields: graphql.Fields{
+			"edges": &graphql.Field{
+				Type: graphql.NewList(markEdgeType),
+			},
+			"pageInfo": &graphql.Field{
+				Type: graphql.NewNonNull(pageInfoType),
+			},
+			// The total count is only queried from the storage if it's requested.
+			"totalCount": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Int),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					conn, ok := p.Source.(*markConnection)
+					if !ok {
+						return nil, errors.New(fmt.Sprintf("unexpected source type %T", p.Source))
+					}
+					return conn.store.CountMarks(p.Context, conn.filter)
+				},
+			},
+		},
+	},
+)
+
+type pageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor"`
+	EndCursor       *string `json:"endCursor"`
+}
+
+type markEdge struct {
+	Cursor string      `json:"cursor"`
+	Node   *model.Mark `json:"node"`
+}
+
+type markConnection struct {
+	Edges    []*markEdge `json:"edges"`
+	PageInfo *pageInfo   `json:"pageInfo"`
+
+	store  storage.Storage
+	filter interface{}
+}
+
+// cursor is the position of a mark in the ordered results, i.e. the values of the fields
+// that the marks can be sorted by and the ID.
+type cursor struct {
+	ID             string          `json:"id"`
+	CreatedAt      *int64          `json:"createdAt,omitempty"`
+	LastModifiedAt *int64          `json:"lastModifiedAt,omitempty"`
+	Title          string          `json:"title,omitempty"`
+	Location       *model.Location `json:"location,omitempty"`
+}
+
+// encodeCursor encodes the position of the mark as an opaque cursor, so the next page starts
+// after the mark even if the marks before it are created or deleted.
+func encodeCursor(mark *model.Mark) string {
+	c := &cursor{ID: mark.ID, CreatedAt: mark.CreatedAt, LastModifiedAt: mark.LastModifiedAt, Title: mark.Title}
+	if mark.Location != nil {
+		c.Location = &model.Location{Page: mark.Location.Page, Location: mark.Location.Location}
+	}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor decodes the cursor to a mark with the ID and the fields that the marks can be sorted by.
+func decodeCursor(cur string) (*model.Mark, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cur)
+	if err != nil {
+		return nil, newAPIError(codeInvalidArgument, fmt.Sprintf("invalid cursor %q", cur))
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" {
+		return nil, newAPIError(codeInvalidArgument, fmt.Sprintf("invalid cursor %q", cur))
+	}
+	return &model.Mark{ID: c.ID, CreatedAt: c.CreatedAt, LastModifiedAt: c.LastModifiedAt, Title: c.Title, Location: c.Location}, nil
+}
+
+// sortFromArgs converts the "orderBy" argument to the sort keys of the storage.
+func sortFromArgs(args map[string]interface{}) ([]storage.Sort, error) {
+	orderBy, ok := args["orderBy"].([]interface{})
+	if !ok {
+		return nil, nil
+	}
+	var sorts []storage.Sort
+	for _, order := range orderBy {
+		orderVal, ok := order.(map[string]interface{})
+		if !ok {
+			return nil, newAPIError(codeInvalidArgument, fmt.Sprintf("Expect MarkOrder for orderBy, but got %T", order))
+		}
+		field, _ := orderVal["field"].(string)
+		direction, _ := orderVal["direction"].(string)
+		sorts = append(sorts, storage.Sort{Field: field, Descending: direction == "DESC"})
+	}
+	return sorts, nil
+}
+
+// newMarkConnection creates a connection of the marks, which follow a previous page if hasPrevious is set,
+// the marks are expected to contain one more mark than the page size if there is a next page.
+func newMarkConnection(store storage.Storage, filter interface{}, marks []*model.Mark, hasPrevious bool, first int) *markConnection {
+	conn := &markConnection{
+		PageInfo: &pageInfo{HasPreviousPage: hasPrevious},
+		store:    store,
+		filter:   filter,
+	}
+	if first >= 0 && len(marks) > first {
+		conn.PageInfo.HasNextPage = true
+		marks = marks[:first]
+	}
+	for _, mark := range marks {
+		conn.Edges = append(conn.Edges, &markEdge{Cursor: encodeCursor(mark), Node: mark})
+	}
+	if len(conn.Edges) > 0 {
+		conn.PageInfo.StartCursor = &conn.Edges[0].Cursor
+		conn.PageInfo.EndCursor = &conn.Edges[len(conn.Edges)-1].Cursor
+	}
+	return conn
+}
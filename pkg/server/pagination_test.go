@@ -0,0 +1,72 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/model"
+)
+
+func TestCursor(t *testing.T) {
+	createdAt, page := int64(100), 7
+	for i, mark := range []*model.Mark{
+		{ID: "1"},
+		{ID: "2", CreatedAt: &createdAt, LastModifiedAt: &createdAt, Title: "T", Location: &model.Location{Page: &page}},
+	} {
+		got, err := decodeCursor(encodeCursor(mark))
+		assert.NoError(t, err, "case #%d", i)
+		assert.Equal(t, mark, got, "case #%d", i)
+	}
+	// Only the fields that the marks can be sorted by are kept.
+	got, err := decodeCursor(encodeCursor(&model.Mark{ID: "3", Type: model.MarkTypeNote, Data: "d", Location: &model.Location{Chapter: "c"}}))
+	assert.NoError(t, err)
+	assert.Equal(t, &model.Mark{ID: "3", Location: &model.Location{}}, got)
+
+	for i, cursor := range []string{"", "not base64!", encodeCursor(&model.Mark{ID: "1"})[1:], base64.RawURLEncoding.EncodeToString([]byte(`{}`))} {
+		_, err := decodeCursor(cursor)
+		assert.Error(t, err, "case #%d", i)
+	}
+}
+
+func TestMarksConnection(t *testing.T) {
+	store := &fakeStorage{}
+	for i := 0; i < 5; i++ {
+		store.marks = append(store.marks, &model.Mark{ID: fmt.Sprint(i), Type: model.MarkTypeHighlight, Title: "T", Author: "A"})
+	}
+
+	tests := []struct {
+		query  string
+		result string
+	}{
+		{
+			query:  `{marksConnection(first:2,orderBy:[{field:CREATED_AT,direction:DESC}]){totalCount,pageInfo{hasNextPage,hasPreviousPage},edges{node{id}}}}`,
+			result: `{"data":{"marksConnection":{"edges":[{"node":{"id":"0"}},{"node":{"id":"1"}}],"pageInfo":{"hasNextPage":true,"hasPreviousPage":false},"totalCount":5}}}`,
+		},
+		{
+			query:  fmt.Sprintf(`{marksConnection(first:2,after:%q){pageInfo{hasNextPage,hasPreviousPage,endCursor},edges{node{id}}}}`, encodeCursor(store.marks[2])),
+			result: fmt.Sprintf(`{"data":{"marksConnection":{"edges":[{"node":{"id":"3"}},{"node":{"id":"4"}}],"pageInfo":{"endCursor":%q,"hasNextPage":false,"hasPreviousPage":true}}}}`, encodeCursor(store.marks[4])),
+		},
+		{
+			query:  fmt.Sprintf(`{marksConnection(first:1,after:%q,orderBy:[{field:TITLE}]){edges{node{id}}}}`, encodeCursor(store.marks[3])),
+			result: `{"data":{"marksConnection":{"edges":[{"node":{"id":"4"}}]}}}`,
+		},
+		{
+			query:  `{marksConnection(after:"bad"){totalCount}}`,
+			result: `{"data":{"marksConnection":null},"errors":[{"message":"invalid cursor \"bad\"","locations":[{"line":1,"column":2}],"path":["marksConnection"],"extensions":{"code":"INVALID_ARGUMENT"}}]}`,
+		},
+		{
+			query:  `{marks(offset:3,limit:1){id}}`,
+			result: `{"data":{"marks":[{"id":"3"}]}}`,
+		},
+	}
+	for i, tt := range tests {
+		assert.Equal(t, tt.result, runQuery(t, store, tt.query), "case #%d", i)
+	}
+}
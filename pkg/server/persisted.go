@@ -0,0 +1,79 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// errPersistedQueryNotFound is the error of an unknown hash, the message is the one
+// the Apollo clients expect.
+var errPersistedQueryNotFound = errors.New("PersistedQueryNotFound")
+
+// persistedQueries is the allow-list of the queries keyed by the hex encoded sha256 of their text.
+type persistedQueries map[string]string
+
+func hashQuery(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadPersistedQueries loads the queries from a json file, which is either an object of the
+// queries keyed by their sha256 hashes, or an array of the queries whose hashes are computed.
+func loadPersistedQueries(path string) (persistedQueries, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read the persisted queries: %v", err))
+	}
+	queries := make(persistedQueries)
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		for _, query := range list {
+			queries[hashQuery(query)] = query
+		}
+		return queries, nil
+	}
+	var byHash map[string]string
+	if err := json.Unmarshal(data, &byHash); err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid persisted queries %q, expecting a json object or array: %v", path, err))
+	}
+	for hash, query := range byHash {
+		hash = strings.ToLower(hash)
+		if hashQuery(query) != hash {
+			return nil, errors.New(fmt.Sprintf("Invalid persisted query %q, the hash doesn't match the sha256 of the query", hash))
+		}
+		queries[hash] = query
+	}
+	return queries, nil
+}
+
+// resolve sets the query text of a request with a persisted query hash. If only is set,
+// the requests must use the persisted queries.
+func (q persistedQueries) resolve(req *graphqlRequest, only bool) error {
+	pq := req.Extensions.PersistedQuery
+	if pq == nil {
+		if only {
+			return errors.New("Only the persisted queries are allowed")
+		}
+		return nil
+	}
+	hash := strings.ToLower(pq.SHA256Hash)
+	query, ok := q[hash]
+	if !ok {
+		return errPersistedQueryNotFound
+	}
+	if req.Query != "" && req.Query != query {
+		return errors.New("The query doesn't match the persisted query")
+	}
+	req.Query = query
+	return nil
+}
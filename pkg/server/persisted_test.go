@@ -0,0 +1,96 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/config"
+	"github.com/yifan-gu/blueNote/pkg/model"
+)
+
+func TestLoadPersistedQueries(t *testing.T) {
+	query := `{marks{id}}`
+	hash := hashQuery(query)
+	dir := t.TempDir()
+
+	tests := []struct {
+		content string
+		queries persistedQueries
+		err     bool
+	}{
+		{content: `["{marks{id}}"]`, queries: persistedQueries{hash: query}},
+		{content: `{"` + strings.ToUpper(hash) + `":"{marks{id}}"}`, queries: persistedQueries{hash: query}},
+		{content: `{"abc":"{marks{id}}"}`, err: true},
+		{content: `"{marks{id}}"`, err: true},
+	}
+	for i, tt := range tests {
+		path := filepath.Join(dir, "queries.json")
+		assert.NoError(t, os.WriteFile(path, []byte(tt.content), 0644), "case #%d", i)
+		queries, err := loadPersistedQueries(path)
+		if tt.err {
+			assert.Error(t, err, "case #%d", i)
+			continue
+		}
+		assert.NoError(t, err, "case #%d", i)
+		assert.Equal(t, tt.queries, queries, "case #%d", i)
+	}
+
+	_, err := loadPersistedQueries(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestPersistedQueries(t *testing.T) {
+	query := `{marks{id}}`
+	hash := hashQuery(query)
+	path := filepath.Join(t.TempDir(), "queries.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`["{marks{id}}"]`), 0644))
+	extensions := func(hash string) string {
+		return `{"persistedQuery":{"version":1,"sha256Hash":"` + hash + `"}}`
+	}
+	store := &fakeStorage{marks: []*model.Mark{{ID: "a", Type: model.MarkTypeHighlight, Title: "T"}}}
+
+	tests := []struct {
+		only   bool
+		method string
+		target string
+		body   string
+		code   int
+		result string
+	}{
+		{method: http.MethodGet, target: "/graphql?extensions=" + url.QueryEscape(extensions(hash)), code: http.StatusOK, result: `{"data":{"marks":[{"id":"a"}]}}`},
+		{method: http.MethodPost, body: `{"extensions":` + extensions(hash) + `}`, code: http.StatusOK, result: `{"data":{"marks":[{"id":"a"}]}}`},
+		{method: http.MethodPost, body: `{"extensions":` + extensions(hashQuery("{}")) + `}`, code: http.StatusOK, result: `{"data":null,"errors":[{"message":"PersistedQueryNotFound","locations":null}]}`},
+		{method: http.MethodPost, body: `{"query":"{marks{title}}","extensions":` + extensions(hash) + `}`, code: http.StatusBadRequest},
+		{method: http.MethodPost, body: `{"query":"{marks{title}}"}`, code: http.StatusOK, result: `{"data":{"marks":[{"title":"T"}]}}`},
+		{only: true, method: http.MethodPost, body: `{"query":"{marks{title}}"}`, code: http.StatusBadRequest},
+		{only: true, method: http.MethodPost, body: `{"query":"{marks{id}}","extensions":` + extensions(hash) + `}`, code: http.StatusOK, result: `{"data":{"marks":[{"id":"a"}]}}`},
+	}
+	for i, tt := range tests {
+		handler := newHTTPTestServer(t, &config.ServerConfig{PersistedQueriesFile: path, PersistedQueriesOnly: tt.only}, store).handler()
+		target := tt.target
+		if target == "" {
+			target = "/graphql"
+		}
+		r := httptest.NewRequest(tt.method, target, strings.NewReader(tt.body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		assert.Equal(t, tt.code, rec.Code, "case #%d", i)
+		if tt.result != "" {
+			assert.Equal(t, tt.result, strings.TrimSpace(rec.Body.String()), "case #%d", i)
+		}
+	}
+
+	_, err := NewServer(&config.ServerConfig{PersistedQueriesOnly: true}, store, nil, nil)
+	assert.Error(t, err)
+}
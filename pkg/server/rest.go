@@ -0,0 +1,351 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/yifan-gu/blueNote/pkg/auth"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+)
+
+// apiPrefix is the path prefix of the REST API.
+const apiPrefix = "/api/v1"
+
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// markInput is the request body of creating or updating a mark, the fields that are not set
+// are left unchanged by an update, and the fields in Clear are cleared.
+type markInput struct {
+	Type     *string         `json:"type"`
+	Title    *string         `json:"title"`
+	Author   *string         `json:"author"`
+	Section  *string         `json:"section"`
+	Location *model.Location `json:"location"`
+	Data     *string         `json:"data"`
+	Note     *string         `json:"note"`
+	Tags     *[]string       `json:"tags"`
+	Clear    []string        `json:"clear"`
+}
+
+// args converts the input to the arguments of createOne and updateOne, so they are handled
+// in the same way as the GraphQL mutations.
+func (in *markInput) args() map[string]interface{} {
+	args := make(map[string]interface{})
+	for name, val := range map[string]*string{
+		"type":    in.Type,
+		"title":   in.Title,
+		"author":  in.Author,
+		"section": in.Section,
+		"data":    in.Data,
+		"note":    in.Note,
+	} {
+		if val != nil {
+			args[name] = *val
+		}
+	}
+	if in.Tags != nil {
+		tags := []interface{}{}
+		for _, tag := range *in.Tags {
+			tags = append(tags, tag)
+		}
+		args["tags"] = tags
+	}
+	if in.Location != nil {
+		location := map[string]interface{}{}
+		if in.Location.Chapter != "" {
+			location["chapter"] = in.Location.Chapter
+		}
+		if in.Location.Page != nil {
+			location["page"] = *in.Location.Page
+		}
+		if in.Location.Location != nil {
+			location["location"] = *in.Location.Location
+		}
+		args["location"] = location
+	}
+	if in.Clear != nil {
+		clear := []interface{}{}
+		for _, field := range in.Clear {
+			clear = append(clear, field)
+		}
+		args["clear"] = clear
+	}
+	return args
+}
+
+// readMarkInput reads the mark from the request body, the unknown fields are rejected.
+func (s *server) readMarkInput(w http.ResponseWriter, r *http.Request) (*markInput, bool) {
+	body, ok := readBody(w, r, s.config.MaxBodySize)
+	if !ok {
+		return nil, false
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	in := &markInput{}
+	if err := dec.Decode(in); err != nil {
+		writeAPIError(w, newAPIError(codeInvalidArgument, fmt.Sprintf("Invalid JSON in request body: %v", err)))
+		return nil, false
+	}
+	return in, true
+}
+
+// writeError writes the error as a json response, for the errors of the protocol, e.g. the methods,
+// the errors of the operations are written by writeAPIError.
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// intArgs are the query parameters that are integers.
+var intArgs = map[string]bool{
+	"limit":              true,
+	"offset":             true,
+	"createdBefore":      true,
+	"createdAfter":       true,
+	"lastModifiedBefore": true,
+	"lastModifiedAfter":  true,
+}
+
+// argsFromQuery converts the query parameters to the arguments of the marks query, so the filter
+// is built in the same way. The lists ("ids", "tags" and "orderBy") can be repeated or separated by ",",
+// and "orderBy" is a field of MarkOrderField with an optional direction, e.g. "CREATED_AT:DESC".
+func argsFromQuery(values url.Values) (map[string]interface{}, error) {
+	args := make(map[string]interface{})
+	for name, vals := range values {
+		val := vals[len(vals)-1]
+		switch {
+		case name == "ids" || name == "tags":
+			list := []interface{}{}
+			for _, v := range splitValues(vals) {
+				list = append(list, v)
+			}
+			args[name] = list
+		case name == "orderBy":
+			var orders []interface{}
+			for _, v := range splitValues(vals) {
+				order, err := orderFromString(v)
+				if err != nil {
+					return nil, err
+				}
+				orders = append(orders, order)
+			}
+			args[name] = orders
+		case intArgs[name]:
+			n, err := strconv.Atoi(val)
+			if err != nil {
+				return nil, newAPIError(codeInvalidArgument, fmt.Sprintf("Invalid %s %q, expecting an integer", name, val))
+			}
+			args[name] = n
+		case name == "id" || name == "type" || name == "title" || name == "author" || name == "data" || name == "note":
+			args[name] = val
+		default:
+			return nil, newAPIError(codeInvalidArgument, fmt.Sprintf("Unknown query parameter %q", name))
+		}
+	}
+	return args, nil
+}
+
+// splitValues splits the values by ",".
+func splitValues(vals []string) []string {
+	var ret []string
+	for _, val := range vals {
+		for _, v := range strings.Split(val, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				ret = append(ret, v)
+			}
+		}
+	}
+	return ret
+}
+
+// orderFromString converts "FIELD[:ASC|DESC]" to a MarkOrder.
+func orderFromString(val string) (map[string]interface{}, error) {
+	name, direction := val, "ASC"
+	if i := strings.Index(val, ":"); i >= 0 {
+		name, direction = val[:i], strings.ToUpper(val[i+1:])
+	}
+	field := markOrderFieldEnum.ParseValue(strings.ToUpper(name))
+	if field == nil || (direction != "ASC" && direction != "DESC") {
+		return nil, newAPIError(codeInvalidArgument, fmt.Sprintf("Invalid orderBy %q, expecting a field of %s with an optional :ASC or :DESC", val, markOrderFieldEnum.Name()))
+	}
+	return map[string]interface{}{"field": field, "direction": direction}, nil
+}
+
+// marksQueryFromRequest returns the filter and the query options of the query parameters.
+func marksQueryFromRequest(r *http.Request) (interface{}, *storage.QueryOptions, error) {
+	args, err := argsFromQuery(r.URL.Query())
+	if err != nil {
+		return nil, nil, err
+	}
+	filter, err := markFilterFromArgs(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	sorts, err := sortFromArgs(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	limit, _ := args["limit"].(int)
+	offset, _ := args["offset"].(int)
+	return filter, &storage.QueryOptions{Limit: limit, Skip: offset, Sort: sorts}, nil
+}
+
+// getMarksFromQuery returns the marks that match the query parameters, and the total number of them.
+func (s *server) getMarksFromQuery(r *http.Request) ([]*model.Mark, int, error) {
+	filter, opts, err := marksQueryFromRequest(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	store := s.storeFor(r.Context())
+	marks, err := store.GetMarks(r.Context(), filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := store.CountMarks(r.Context(), filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	return marks, total, nil
+}
+
+// authenticateREST authenticates the request, the GET requests require the read scope, and others the write scope.
+func (s *server) authenticateREST(handler http.HandlerFunc) http.HandlerFunc {
+	return s.authenticate(auth.ScopeRead, func(w http.ResponseWriter, r *http.Request) {
+		if user := auth.UserFromContext(r.Context()); user != nil && r.Method != http.MethodGet && !user.Allows(auth.ScopeWrite) {
+			writeAPIError(w, newAPIError(codeForbidden, fmt.Sprintf("User %q doesn't have the %s scope", user.ID, auth.ScopeWrite)))
+			return
+		}
+		handler(w, r)
+	})
+}
+
+// handleMarks lists the marks that match the query parameters with GET, or creates a mark with POST.
+// The total number of the matched marks is in the X-Total-Count header.
+func (s *server) handleMarks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		marks, total, err := s.getMarksFromQuery(r)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		if marks == nil {
+			marks = []*model.Mark{}
+		}
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		writeJSON(w, http.StatusOK, marks)
+	case http.MethodPost:
+		in, ok := s.readMarkInput(w, r)
+		if !ok {
+			return
+		}
+		mark, err := s.createMark(r.Context(), in.args())
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		// Read it back for the fields set by the storage, e.g. the timestamps.
+		if created, err := getMark(r.Context(), s.storeFor(r.Context()), mark.ID); err == nil {
+			mark = created
+		}
+		w.Header().Set("Location", apiPrefix+"/marks/"+url.PathEscape(mark.ID))
+		writeJSON(w, http.StatusCreated, mark)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("Only GET and POST requests are allowed"))
+	}
+}
+
+// handleMark gets, updates (PATCH) or deletes the mark of the id in the path.
+func (s *server) handleMark(w http.ResponseWriter, r *http.Request) {
+	id, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), apiPrefix+"/marks/"))
+	if err != nil || id == "" || strings.Contains(id, "/") {
+		writeError(w, http.StatusNotFound, errors.New(fmt.Sprintf("Invalid path %q", r.URL.Path)))
+		return
+	}
+	var mark *model.Mark
+	code := http.StatusOK
+	switch r.Method {
+	case http.MethodGet:
+		mark, err = getMark(r.Context(), s.storeFor(r.Context()), id)
+	case http.MethodPatch:
+		in, ok := s.readMarkInput(w, r)
+		if !ok {
+			return
+		}
+		if mark, err = s.updateMark(r.Context(), id, in.args()); err == nil {
+			mark, err = getMark(r.Context(), s.storeFor(r.Context()), id)
+		}
+	case http.MethodDelete:
+		_, err = s.deleteMark(r.Context(), id)
+		code = http.StatusNoContent
+	default:
+		w.Header().Set("Allow", "GET, PATCH, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("Only GET, PATCH and DELETE requests are allowed"))
+		return
+	}
+
+	switch {
+	case err != nil:
+		writeAPIError(w, err)
+	case code == http.StatusNoContent:
+		w.WriteHeader(code)
+	default:
+		writeJSON(w, code, mark)
+	}
+}
+
+// handleBooks lists the books of the marks that match the query parameters, with their marks.
+// The limit and the offset page the books, and the total number of the books is in the X-Total-Count header.
+func (s *server) handleBooks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("Only GET requests are allowed"))
+		return
+	}
+	filter, opts, err := marksQueryFromRequest(r)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	limit, offset := opts.Limit, opts.Skip
+	opts.Limit, opts.Skip = 0, 0
+	marks, err := s.storeFor(r.Context()).GetMarks(r.Context(), filter, opts)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	books := booksFromMarks(marks)
+	total := len(books)
+	if offset > len(books) {
+		offset = len(books)
+	}
+	books = books[offset:]
+	if limit > 0 && limit < len(books) {
+		books = books[:limit]
+	}
+	if books == nil {
+		books = []*model.Book{}
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	writeJSON(w, http.StatusOK, books)
+}
+
+// handleOpenAPI serves the OpenAPI document of the REST API.
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDocument)
+}
@@ -0,0 +1,194 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/config"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+)
+
+func TestArgsFromQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		args  map[string]interface{}
+		err   bool
+	}{
+		{query: "", args: map[string]interface{}{}},
+		{
+			query: "title=Bondage&ids=a,b&ids=c&tags=x&limit=10&createdAfter=1000",
+			args: map[string]interface{}{
+				"title":        "Bondage",
+				"ids":          []interface{}{"a", "b", "c"},
+				"tags":         []interface{}{"x"},
+				"limit":        10,
+				"createdAfter": 1000,
+			},
+		},
+		{
+			query: "orderBy=created_at:desc,TITLE",
+			args: map[string]interface{}{"orderBy": []interface{}{
+				map[string]interface{}{"field": storage.SortByCreatedAt, "direction": "DESC"},
+				map[string]interface{}{"field": storage.SortByTitle, "direction": "ASC"},
+			}},
+		},
+		{query: "orderBy=PAGE", err: true},
+		{query: "orderBy=TITLE:UP", err: true},
+		{query: "limit=ten", err: true},
+		{query: "color=red", err: true},
+	}
+	for i, tt := range tests {
+		values, err := url.ParseQuery(tt.query)
+		assert.NoError(t, err, "case #%d", i)
+		args, err := argsFromQuery(values)
+		if tt.err {
+			assert.Error(t, err, "case #%d", i)
+			continue
+		}
+		assert.NoError(t, err, "case #%d", i)
+		assert.Equal(t, tt.args, args, "case #%d", i)
+	}
+}
+
+func TestREST(t *testing.T) {
+	store := &fakeStorage{marks: []*model.Mark{
+		{ID: "a", Type: model.MarkTypeHighlight, Title: "T1", Author: "A", Data: "1", Tags: []string{"x"}},
+		{ID: "b", Type: model.MarkTypeNote, Title: "T2", Author: "B", UserNote: "2"},
+	}}
+	handler := newHTTPTestServer(t, &config.ServerConfig{}, store).handler()
+
+	tests := []struct {
+		method  string
+		target  string
+		body    string
+		code    int
+		result  string
+		respHdr map[string]string
+	}{
+		{
+			method:  http.MethodGet,
+			target:  "/api/v1/marks?limit=1",
+			code:    http.StatusOK,
+			result:  `[{"id":"a","type":"HIGHLIGHT","title":"T1","author":"A","data":"1","tags":["x"]}]`,
+			respHdr: map[string]string{"X-Total-Count": "2"},
+		},
+		{method: http.MethodGet, target: "/api/v1/marks?ids=none", code: http.StatusOK, result: `[]`, respHdr: map[string]string{"X-Total-Count": "0"}},
+		{method: http.MethodGet, target: "/api/v1/marks?limit=x", code: http.StatusBadRequest, result: `{"code":"INVALID_ARGUMENT","error":"Invalid limit \"x\", expecting an integer"}`},
+		{method: http.MethodGet, target: "/api/v1/marks/b", code: http.StatusOK, result: `{"id":"b","type":"NOTE","title":"T2","author":"B","note":"2"}`},
+		{method: http.MethodGet, target: "/api/v1/marks/c", code: http.StatusNotFound, result: `{"code":"NOT_FOUND","error":"Mark \"c\" is not found"}`},
+		{method: http.MethodGet, target: "/api/v1/marks/a/b", code: http.StatusNotFound},
+		{
+			method:  http.MethodPost,
+			target:  "/api/v1/marks",
+			body:    `{"type":"HIGHLIGHT","title":"T3","author":"C","data":"3","location":{"page":7}}`,
+			code:    http.StatusCreated,
+			result:  `{"id":"2","type":"HIGHLIGHT","title":"T3","author":"C","location":{"page":7},"data":"3"}`,
+			respHdr: map[string]string{"Location": "/api/v1/marks/2"},
+		},
+		{method: http.MethodPost, target: "/api/v1/marks", body: `{"type":"HIGHLIGHT","title":"T3","author":"C"}`, code: http.StatusBadRequest, result: `{"code":"INVALID_ARGUMENT","error":"Expect 'data' or 'note' to be set","fields":[{"field":"data","message":"Expect 'data' or 'note' to be set"}]}`},
+		{method: http.MethodPost, target: "/api/v1/marks", body: `{"type":"HIGHLIGHT","titel":"T3"}`, code: http.StatusBadRequest},
+		{method: http.MethodPost, target: "/api/v1/marks", body: `{"type":1}`, code: http.StatusBadRequest},
+		{method: http.MethodPatch, target: "/api/v1/marks", code: http.StatusMethodNotAllowed, respHdr: map[string]string{"Allow": "GET, POST"}},
+		{
+			method: http.MethodPatch,
+			target: "/api/v1/marks/a",
+			body:   `{"note":"new","tags":["y","z"]}`,
+			code:   http.StatusOK,
+			result: `{"id":"a","type":"HIGHLIGHT","title":"T1","author":"A","data":"1","note":"new","tags":["y","z"]}`,
+		},
+		{
+			method: http.MethodPatch,
+			target: "/api/v1/marks/a",
+			body:   `{"section":"S","clear":["note","tags"]}`,
+			code:   http.StatusOK,
+			result: `{"id":"a","type":"HIGHLIGHT","title":"T1","author":"A","section":"S","data":"1"}`,
+		},
+		{method: http.MethodPatch, target: "/api/v1/marks/a", body: `{"clear":["title"]}`, code: http.StatusBadRequest, result: `{"code":"INVALID_ARGUMENT","error":"Field \"title\" can't be cleared","fields":[{"field":"title","message":"Field \"title\" can't be cleared"}]}`},
+		{method: http.MethodPatch, target: "/api/v1/marks/a", body: `{"type":"POEM"}`, code: http.StatusBadRequest, result: `{"code":"INVALID_ARGUMENT","error":"Type POEM is not supported","fields":[{"field":"type","message":"Type POEM is not supported"}]}`},
+		{method: http.MethodPatch, target: "/api/v1/marks/c", body: `{"note":"new"}`, code: http.StatusNotFound},
+		{method: http.MethodDelete, target: "/api/v1/marks/b", code: http.StatusNoContent},
+		{method: http.MethodDelete, target: "/api/v1/marks/b", code: http.StatusNotFound},
+		{method: http.MethodPut, target: "/api/v1/marks/a", code: http.StatusMethodNotAllowed},
+		{
+			method: http.MethodGet,
+			target: "/api/v1/books?orderBy=TITLE",
+			code:   http.StatusOK,
+			result: `[{"title":"T1","author":"A","marks":[{"id":"a","type":"HIGHLIGHT","title":"T1","author":"A","section":"S","data":"1"}]},` +
+				`{"title":"T3","author":"C","marks":[{"id":"2","type":"HIGHLIGHT","title":"T3","author":"C","location":{"page":7},"data":"3"}]}]`,
+		},
+		{
+			method:  http.MethodGet,
+			target:  "/api/v1/books?orderBy=TITLE&limit=1&offset=1",
+			code:    http.StatusOK,
+			result:  `[{"title":"T3","author":"C","marks":[{"id":"2","type":"HIGHLIGHT","title":"T3","author":"C","location":{"page":7},"data":"3"}]}]`,
+			respHdr: map[string]string{"X-Total-Count": "2"},
+		},
+		{method: http.MethodPost, target: "/api/v1/books", code: http.StatusMethodNotAllowed},
+	}
+	for i, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		assert.Equal(t, tt.code, rec.Code, "case #%d", i)
+		if tt.result != "" {
+			assert.Equal(t, tt.result, strings.TrimSpace(rec.Body.String()), "case #%d", i)
+		}
+		for k, v := range tt.respHdr {
+			assert.Equal(t, v, rec.Header().Get(k), "case #%d: %s", i, k)
+		}
+	}
+}
+
+func TestClearLocation(t *testing.T) {
+	newStore := func() *fakeStorage {
+		page, loc := 7, 70
+		return &fakeStorage{marks: []*model.Mark{
+			{ID: "a", Type: model.MarkTypeHighlight, Title: "T", Author: "A", Data: "1", Location: &model.Location{Chapter: "C", Page: &page, Location: &loc}},
+		}}
+	}
+	for i, field := range []string{"chapter", "page", "location"} {
+		store := newStore()
+		handler := newHTTPTestServer(t, &config.ServerConfig{}, store).handler()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPatch, "/api/v1/marks/a", strings.NewReader(`{"clear":["location.`+field+`"]}`)))
+		assert.Equal(t, http.StatusOK, rec.Code, "case #%d: %s", i, rec.Body.String())
+		assert.NotContains(t, model.FieldValues(store.marks[0]), "location."+field, "case #%d", i)
+
+		store = newStore()
+		result := runQuery(t, store, `mutation{updateOne(id:"a",clear:["location.`+field+`"]){id}}`)
+		assert.Equal(t, `{"data":{"updateOne":{"id":"a"}}}`, result, "case #%d", i)
+		assert.NotContains(t, model.FieldValues(store.marks[0]), "location."+field, "case #%d", i)
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	handler := newHTTPTestServer(t, &config.ServerConfig{}, &fakeStorage{}).handler()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var doc struct {
+		Paths map[string]map[string]interface{} `json:"paths"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	var operations []string
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			if method != "parameters" {
+				operations = append(operations, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+	assert.ElementsMatch(t, []string{"GET /marks", "POST /marks", "GET /marks/{id}", "PATCH /marks/{id}", "DELETE /marks/{id}", "GET /books"}, operations)
+}
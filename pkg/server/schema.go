@@ -9,9 +9,13 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/graphql-go/graphql"
 	"github.com/graphql-go/graphql/language/ast"
+	"github.com/yifan-gu/blueNote/pkg/auth"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/parser"
 	"github.com/yifan-gu/blueNote/pkg/util"
 )
 
@@ -72,6 +76,9 @@ var int64Type = graphql.NewScalar(graphql.ScalarConfig{
 	},
 })
 
+// clearDescription describes the "clear" argument of the updates.
+var clearDescription = fmt.Sprintf("The fields to clear, one of %s, the type, title and author can't be cleared", strings.Join(model.MarkFields, ", "))
+
 var locationInputType = graphql.NewInputObject(
 	graphql.InputObjectConfig{
 		Name: "LocationInput",
@@ -106,6 +113,15 @@ var locationType = graphql.NewObject(
 	},
 )
 
+var markTypeEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "MarkType",
+	Values: graphql.EnumValueConfigMap{
+		model.MarkTypeHighlight: &graphql.EnumValueConfig{Value: model.MarkTypeHighlight},
+		model.MarkTypeNote:      &graphql.EnumValueConfig{Value: model.MarkTypeNote},
+		model.MarkTypeBookmark:  &graphql.EnumValueConfig{Value: model.MarkTypeBookmark},
+	},
+})
+
 var markType = graphql.NewObject(
 	graphql.ObjectConfig{
 		Name: "Mark",
@@ -114,7 +130,7 @@ var markType = graphql.NewObject(
 				Type: graphql.String,
 			},
 			"type": &graphql.Field{
-				Type: graphql.String,
+				Type: markTypeEnum,
 			},
 			"title": &graphql.Field{
 				Type: graphql.String,
@@ -137,12 +153,115 @@ var markType = graphql.NewObject(
 			"tags": &graphql.Field{
 				Type: graphql.NewList(graphql.String),
 			},
+			"owner": &graphql.Field{
+				Type:        graphql.String,
+				Description: "The ID of the user who owns the mark",
+			},
 			"createdAt": &graphql.Field{
 				Type: int64Type,
 			},
 			"lastModifiedAt": &graphql.Field{
 				Type: int64Type,
 			},
+			"deletedAt": &graphql.Field{
+				Type:        int64Type,
+				Description: "The time when the mark is moved to the trash",
+			},
+		},
+	},
+)
+
+// markFilterArgs returns the arguments that filter the marks.
+func markFilterArgs() graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"id": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+		"ids": &graphql.ArgumentConfig{
+			Type: graphql.NewList(graphql.NewNonNull(graphql.String)),
+		},
+		"type": &graphql.ArgumentConfig{
+			Type: markTypeEnum,
+		},
+		"title": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+		"author": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+		"data": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+		"note": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+		"tags": &graphql.ArgumentConfig{
+			Type: graphql.NewList(graphql.String),
+		},
+		"location": &graphql.ArgumentConfig{
+			Type: locationInputType,
+		},
+		"createdBefore": &graphql.ArgumentConfig{
+			Type: graphql.Int,
+		},
+		"createdAfter": &graphql.ArgumentConfig{
+			Type: graphql.Int,
+		},
+		"lastModifiedBefore": &graphql.ArgumentConfig{
+			Type: graphql.Int,
+		},
+		"lastModifiedAfter": &graphql.ArgumentConfig{
+			Type: graphql.Int,
+		},
+	}
+}
+
+// withArgs merges the extra arguments into args.
+func withArgs(args, extra graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	for name, arg := range extra {
+		args[name] = arg
+	}
+	return args
+}
+
+const defaultSearchLimit = 20
+
+var highlightType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "Highlight",
+		Fields: graphql.Fields{
+			"field": &graphql.Field{
+				Type: graphql.String,
+			},
+			"start": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"end": &graphql.Field{
+				Type: graphql.Int,
+			},
+		},
+	},
+)
+
+var searchResultType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "SearchResult",
+		Fields: graphql.Fields{
+			"mark": &graphql.Field{
+				Type: markType,
+			},
+			"score": &graphql.Field{
+				Type: graphql.Float,
+			},
+			"field": &graphql.Field{
+				Type: graphql.String,
+			},
+			"snippet": &graphql.Field{
+				Type: graphql.String,
+			},
+			"highlights": &graphql.Field{
+				Type: graphql.NewList(highlightType),
+			},
 		},
 	},
 )
@@ -153,52 +272,104 @@ func (s *server) graphqlQueryType() *graphql.Object {
 			Name: "Query",
 			Fields: graphql.Fields{
 				// Get (read) single mark at
-				//  http://localhost:11212/marks?query={marks(id:1){title,author,data,note...}}
+				//  http://localhost:11212/graphql?query={marks(id:1){title,author,data,note...}}
 				"marks": &graphql.Field{
 					Type:        graphql.NewList(markType),
 					Description: "Get one or more marks",
-					Args: graphql.FieldConfigArgument{
-						"id": &graphql.ArgumentConfig{
-							Type: graphql.String,
-						},
-						"type": &graphql.ArgumentConfig{
-							Type: graphql.String,
+					Args: withArgs(markFilterArgs(), graphql.FieldConfigArgument{
+						"limit": &graphql.ArgumentConfig{
+							Type: graphql.Int,
 						},
-						"title": &graphql.ArgumentConfig{
-							Type: graphql.String,
+						"offset": &graphql.ArgumentConfig{
+							Type: graphql.Int,
 						},
-						"author": &graphql.ArgumentConfig{
-							Type: graphql.String,
+						"orderBy": &graphql.ArgumentConfig{
+							Type: graphql.NewList(graphql.NewNonNull(markOrderInputType)),
 						},
-						"data": &graphql.ArgumentConfig{
-							Type: graphql.String,
+					}),
+					Resolve: s.resolveMarksQuery,
+				},
+				// Get the revisions of a mark from the oldest, e.g.
+				//  history(id:"<id>"){id,actor,createdAt,changes{field,old,new}}
+				"history": &graphql.Field{
+					Type:        graphql.NewList(revisionType),
+					Description: "Get the revisions recorded by the updates of a mark, from the oldest",
+					Args: graphql.FieldConfigArgument{
+						"id": &graphql.ArgumentConfig{
+							Type: graphql.NewNonNull(graphql.String),
 						},
-						"note": &graphql.ArgumentConfig{
-							Type: graphql.String,
+					},
+					Resolve: s.resolveHistory,
+				},
+				// Get the marks in the trash, e.g.
+				//  trash(title:"Bondage"){id,title,deletedAt}
+				"trash": &graphql.Field{
+					Type:        graphql.NewList(markType),
+					Description: "Get the deleted marks in the trash, which are purged after the retention of the server",
+					Args: withArgs(markFilterArgs(), graphql.FieldConfigArgument{
+						"limit": &graphql.ArgumentConfig{
+							Type: graphql.Int,
 						},
-						"tags": &graphql.ArgumentConfig{
-							Type: graphql.NewList(graphql.String),
+						"offset": &graphql.ArgumentConfig{
+							Type: graphql.Int,
 						},
-						"location": &graphql.ArgumentConfig{
-							Type: locationInputType,
+					}),
+					Resolve: s.resolveTrash,
+				},
+				// Search the highlights and notes, e.g.
+				//  search(query:"\"human bondage\" philo*"){score,snippet,mark{title,author}}
+				"search": &graphql.Field{
+					Type:        graphql.NewList(searchResultType),
+					Description: "Search the marks by the terms, quoted phrases and prefixes (e.g. \"philo*\") in the highlights and notes, ranked by relevance",
+					Args: graphql.FieldConfigArgument{
+						"query": &graphql.ArgumentConfig{
+							Type: graphql.NewNonNull(graphql.String),
 						},
-						"createdBefore": &graphql.ArgumentConfig{
-							Type: graphql.Int,
+						"limit": &graphql.ArgumentConfig{
+							Type:         graphql.Int,
+							DefaultValue: defaultSearchLimit,
 						},
-						"createdAfter": &graphql.ArgumentConfig{
-							Type: graphql.Int,
+					},
+					Resolve: s.resolveSearch,
+				},
+				// Get the statistics of the marks, e.g.
+				//  stats(groupBy:CREATED_AT,interval:MONTH){count,averageLength,groups{key,count}}
+				"stats": &graphql.Field{
+					Type:        statsType,
+					Description: "Count the marks and the average length of the highlights, in total and by the groups",
+					Args:        statsArgs(),
+					Resolve:     s.resolveStats,
+				},
+				// Count the marks of the tags, e.g.
+				//  tags(under:"philosophy"){name,parent,count,total}
+				"tags": &graphql.Field{
+					Type:        graphql.NewList(tagCountType),
+					Description: "Count the marks of the tags that match the filter, the descendants of a hierarchical tag follow it",
+					Args: withArgs(markFilterArgs(), graphql.FieldConfigArgument{
+						"under": &graphql.ArgumentConfig{
+							Type:        graphql.String,
+							Description: "Only the tag and its descendants",
 						},
-						"lastModifiedBefore": &graphql.ArgumentConfig{
+					}),
+					Resolve: s.resolveTags,
+				},
+				// Page through the marks, e.g.
+				//  marksConnection(first:20,after:"<cursor>",orderBy:[{field:CREATED_AT,direction:DESC}]){totalCount,pageInfo{hasNextPage,endCursor},edges{cursor,node{title,data}}}
+				"marksConnection": &graphql.Field{
+					Type:        markConnectionType,
+					Description: "Page through the marks with cursors, which keep their positions in the order when the marks before them change",
+					Args: withArgs(markFilterArgs(), graphql.FieldConfigArgument{
+						"first": &graphql.ArgumentConfig{
 							Type: graphql.Int,
 						},
-						"lastModifiedAfter": &graphql.ArgumentConfig{
-							Type: graphql.Int,
+						"after": &graphql.ArgumentConfig{
+							Type: graphql.String,
 						},
-						"limit": &graphql.ArgumentConfig{
-							Type: graphql.Int,
+						"orderBy": &graphql.ArgumentConfig{
+							Type: graphql.NewList(graphql.NewNonNull(markOrderInputType)),
 						},
-					},
-					Resolve: s.resolveMarksQuery,
+					}),
+					Resolve: s.resolveMarksConnection,
 				},
 			},
 		},
@@ -211,13 +382,13 @@ func (s *server) graphqlMutationType() *graphql.Object {
 			Name: "Mutation",
 			Fields: graphql.Fields{
 				// Create a new mark
-				// http://localhost:11212/marks?query=mutation+_{createOne(type:"",title:"",author:"",data:"",note:"",tags:[]){type,title,author,data,note,tags}}
+				// http://localhost:11212/graphql?query=mutation+_{createOne(type:HIGHLIGHT,title:"",author:"",data:"",note:"",tags:[]){type,title,author,data,note,tags}}
 				"createOne": &graphql.Field{
 					Type:        markType,
 					Description: "Create a new mark",
 					Args: graphql.FieldConfigArgument{
 						"type": &graphql.ArgumentConfig{
-							Type: graphql.NewNonNull(graphql.String), // TODO(yifan): Use Enum?
+							Type: graphql.NewNonNull(markTypeEnum),
 						},
 						"title": &graphql.ArgumentConfig{
 							Type: graphql.NewNonNull(graphql.String),
@@ -244,7 +415,9 @@ func (s *server) graphqlMutationType() *graphql.Object {
 					Resolve: s.createOneMark,
 				},
 				// Update a mark by id
-				// http://localhost:11212/marks?query=mutation+_{updateOne(id:1,type:"",title:"",author:"",data:"",note:"",tags:[]){type,title,author,data,note,tags}}
+				// http://localhost:11212/graphql?query=mutation+_{updateOne(id:1,type:HIGHLIGHT,title:"",author:"",data:"",note:"",tags:[]){type,title,author,data,note,tags}}
+				// Clear the fields, e.g.
+				//  mutation{updateOne(id:"<id>",clear:["note","location.page"]){id,note,location{page}}}
 				"updateOne": &graphql.Field{
 					Type:        markType,
 					Description: "Update a mark by its ID",
@@ -253,7 +426,7 @@ func (s *server) graphqlMutationType() *graphql.Object {
 							Type: graphql.NewNonNull(graphql.String),
 						},
 						"type": &graphql.ArgumentConfig{
-							Type: graphql.String, // TODO(yifan): Use Enum?
+							Type: markTypeEnum,
 						},
 						"title": &graphql.ArgumentConfig{
 							Type: graphql.String,
@@ -276,14 +449,186 @@ func (s *server) graphqlMutationType() *graphql.Object {
 						"tags": &graphql.ArgumentConfig{
 							Type: graphql.NewList(graphql.String),
 						},
+						"clear": &graphql.ArgumentConfig{
+							Type:        graphql.NewList(graphql.NewNonNull(graphql.String)),
+							Description: clearDescription,
+						},
 					},
 					Resolve: s.updateOneMarkByID,
 				},
+				// Revert a mark to how it was before a revision, e.g.
+				//  mutation{revertMark(id:"<id>",revision:"<revision id>"){id,note}}
+				"revertMark": &graphql.Field{
+					Type:        markType,
+					Description: "Undo the revision of the mark and the ones after it, which records a new revision",
+					Args: graphql.FieldConfigArgument{
+						"id": &graphql.ArgumentConfig{
+							Type: graphql.NewNonNull(graphql.String),
+						},
+						"revision": &graphql.ArgumentConfig{
+							Type: graphql.NewNonNull(graphql.String),
+						},
+					},
+					Resolve: s.revertMark,
+				},
+				// Create marks in a batch, e.g.
+				//  mutation{createMany(marks:[{type:NOTE,title:"",author:"",note:""}]){ids,count}}
+				"createMany": &graphql.Field{
+					Type:        bulkResultType,
+					Description: "Create marks in a batch, all of them are validated before any is created. The batch is not atomic, if a mark fails to be created, the ones created before it are kept, and their IDs are in the \"ids\" of the error extensions",
+					Args: graphql.FieldConfigArgument{
+						"marks": &graphql.ArgumentConfig{
+							Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(markInputType))),
+						},
+						"dryRun": &graphql.ArgumentConfig{
+							Type:         graphql.Boolean,
+							DefaultValue: false,
+						},
+					},
+					Resolve: s.createManyMarks,
+				},
+				// Update the marks that match the filter, e.g.
+				//  mutation{updateMany(filter:{author:"Maugham"},update:{author:"W. Somerset Maugham"},dryRun:true){count,marks{id,author}}}
+				"updateMany": &graphql.Field{
+					Type:        bulkResultType,
+					Description: "Update the marks that match the filter",
+					Args: bulkArgs(graphql.FieldConfigArgument{
+						"update": &graphql.ArgumentConfig{
+							Type: graphql.NewNonNull(markUpdateInputType),
+						},
+					}),
+					Resolve: s.updateManyMarks,
+				},
+				// Delete the marks that match the filter
+				"deleteMany": &graphql.Field{
+					Type:        bulkResultType,
+					Description: "Move the marks that match the filter to the trash",
+					Args:        bulkArgs(nil),
+					Resolve:     s.deleteManyMarks,
+				},
+				// Restore the marks in the trash that match the filter, e.g.
+				//  mutation{restoreMarks(filter:{ids:["<id>"]}){ids,count}}
+				"restoreMarks": &graphql.Field{
+					Type:        bulkResultType,
+					Description: "Restore the marks in the trash that match the filter",
+					Args:        bulkArgs(nil),
+					Resolve:     s.restoreMarks,
+				},
+				// Add tags to the marks that match the filter, e.g.
+				//  mutation{addTags(filter:{title:"Bondage"},tags:["novel"]){ids,count}}
+				"addTags": &graphql.Field{
+					Type:        bulkResultType,
+					Description: "Add the tags to the marks that match the filter",
+					Args: bulkArgs(graphql.FieldConfigArgument{
+						"tags": &graphql.ArgumentConfig{
+							Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))),
+						},
+					}),
+					Resolve: s.addTags,
+				},
+				// Remove tags from the marks that match the filter
+				"removeTags": &graphql.Field{
+					Type:        bulkResultType,
+					Description: "Remove the tags from the marks that match the filter",
+					Args: bulkArgs(graphql.FieldConfigArgument{
+						"tags": &graphql.ArgumentConfig{
+							Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))),
+						},
+					}),
+					Resolve: s.removeTags,
+				},
+				// Rename a tag and its descendants on all the marks, e.g.
+				//  mutation{renameTag(from:"stoa",to:"philosophy/stoicism"){count}}
+				"renameTag": &graphql.Field{
+					Type:        bulkResultType,
+					Description: "Rename the tag and its descendants on all the marks",
+					Args: graphql.FieldConfigArgument{
+						"from": &graphql.ArgumentConfig{
+							Type: graphql.NewNonNull(graphql.String),
+						},
+						"to": &graphql.ArgumentConfig{
+							Type: graphql.NewNonNull(graphql.String),
+						},
+						"dryRun": &graphql.ArgumentConfig{
+							Type:         graphql.Boolean,
+							DefaultValue: false,
+						},
+					},
+					Resolve: s.renameTag,
+				},
+				// Merge the tags and their descendants into one tag on all the marks
+				"mergeTags": &graphql.Field{
+					Type:        bulkResultType,
+					Description: "Merge the tags and their descendants into the target on all the marks",
+					Args: graphql.FieldConfigArgument{
+						"from": &graphql.ArgumentConfig{
+							Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))),
+						},
+						"to": &graphql.ArgumentConfig{
+							Type: graphql.NewNonNull(graphql.String),
+						},
+						"dryRun": &graphql.ArgumentConfig{
+							Type:         graphql.Boolean,
+							DefaultValue: false,
+						},
+					},
+					Resolve: s.mergeTags,
+				},
+				// Delete the tags and their descendants from all the marks
+				"deleteTags": &graphql.Field{
+					Type:        bulkResultType,
+					Description: "Delete the tags and their descendants from all the marks",
+					Args: graphql.FieldConfigArgument{
+						"tags": &graphql.ArgumentConfig{
+							Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))),
+						},
+						"dryRun": &graphql.ArgumentConfig{
+							Type:         graphql.Boolean,
+							DefaultValue: false,
+						},
+					},
+					Resolve: s.deleteTags,
+				},
+				// Import the books from the content of a file, e.g.
+				//  mutation{importBooks(name:"My Clippings.txt",content:"...",dryRun:true){marks,created,duplicates}}
+				"importBooks": &graphql.Field{
+					Type:        importJobType,
+					Description: "Import the marks from the content of a file with a parser, the duplicated marks are skipped unless dedupe is false",
+					Args: graphql.FieldConfigArgument{
+						"content": &graphql.ArgumentConfig{
+							Type: graphql.NewNonNull(graphql.String),
+						},
+						"name": &graphql.ArgumentConfig{
+							Type:        graphql.String,
+							Description: "The file name, which helps detecting the parser",
+						},
+						"parser": &graphql.ArgumentConfig{
+							Type:         graphql.String,
+							DefaultValue: parser.AutoParser,
+						},
+						"transforms": &graphql.ArgumentConfig{
+							Type: graphql.NewList(graphql.NewNonNull(graphql.String)),
+						},
+						"options": &graphql.ArgumentConfig{
+							Type:        graphql.NewList(graphql.NewNonNull(graphql.String)),
+							Description: "The parser options in the form of \"name=value\"",
+						},
+						"dedupe": &graphql.ArgumentConfig{
+							Type:         graphql.Boolean,
+							DefaultValue: true,
+						},
+						"dryRun": &graphql.ArgumentConfig{
+							Type:         graphql.Boolean,
+							DefaultValue: false,
+						},
+					},
+					Resolve: s.importBooks,
+				},
 				// Delete a mark by id
-				// http://localhost:11212/marks?query=mutation+_{delete(id:1,){type,title,author,data,note,tags}}
+				// http://localhost:11212/graphql?query=mutation+_{delete(id:1,){type,title,author,data,note,tags}}
 				"deleteOne": &graphql.Field{
 					Type:        markType,
-					Description: "Delete a mark by its ID",
+					Description: "Move a mark to the trash by its ID",
 					Args: graphql.FieldConfigArgument{
 						"id": &graphql.ArgumentConfig{
 							Type: graphql.NewNonNull(graphql.String),
@@ -298,10 +643,23 @@ func (s *server) graphqlMutationType() *graphql.Object {
 }
 
 func (s *server) graphqlSchema() graphql.Schema {
+	query, mutation, subscription := s.graphqlQueryType(), s.graphqlMutationType(), s.graphqlSubscriptionType()
+	// The mutations require the write scope.
+	for _, field := range mutation.Fields() {
+		field.Resolve = requireScope(auth.ScopeWrite, field.Resolve)
+	}
+	// The errors of the root fields carry the codes.
+	for _, obj := range []*graphql.Object{query, mutation, subscription} {
+		for _, field := range obj.Fields() {
+			field.Resolve = withErrorCode(field.Resolve)
+			field.Subscribe = withErrorCode(field.Subscribe)
+		}
+	}
 	schema, err := graphql.NewSchema(
 		graphql.SchemaConfig{
-			Query:    s.graphqlQueryType(),
-			Mutation: s.graphqlMutationType(),
+			Query:        query,
+			Mutation:     mutation,
+			Subscription: subscription,
 		},
 	)
 	if err != nil {
@@ -310,16 +668,17 @@ func (s *server) graphqlSchema() graphql.Schema {
 	return schema
 }
 
-var schema graphql.Schema
-
-func executeQuery(ctx context.Context, query string) *graphql.Result {
+func (s *server) executeQuery(ctx context.Context, req *graphqlRequest) *graphql.Result {
 	result := graphql.Do(graphql.Params{
-		Schema:        schema,
-		RequestString: query,
-		Context:       ctx,
+		Schema:         s.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        ctx,
 	})
 	if len(result.Errors) > 0 {
 		util.Logf("Errors running graphql query: %v\n", result.Errors)
 	}
+	setErrorCodes(result)
 	return result
 }
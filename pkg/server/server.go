@@ -6,118 +6,382 @@ Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/yifan-gu/blueNote/pkg/auth"
+	"github.com/yifan-gu/blueNote/pkg/bluenote"
 	"github.com/yifan-gu/blueNote/pkg/config"
+	"github.com/yifan-gu/blueNote/pkg/event"
 	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/search"
 	"github.com/yifan-gu/blueNote/pkg/storage"
+	"github.com/yifan-gu/blueNote/pkg/tag"
 	"github.com/yifan-gu/blueNote/pkg/util"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
 type server struct {
-	config *config.ServerConfig
-	store  storage.Storage
+	config   *config.ServerConfig
+	store    storage.Storage
+	registry *bluenote.Registry
+	schema   graphql.Schema
+	// persistedQueries is the allow-list of the queries that can be referred by their hashes.
+	persistedQueries persistedQueries
+	// auth is nil if the authentication is disabled.
+	auth auth.Authenticator
+	// bus is the change feed of the store for the subscriptions, which are not supported if it's nil.
+	bus *event.Bus
+	// shutdown is closed when the server shuts down, to end the streams of the subscriptions.
+	shutdown chan struct{}
 }
 
-func NewServer(config *config.ServerConfig, store storage.Storage) Server {
-	return &server{config: config, store: store}
+// NewServer creates a server that serves the marks in the store, the parsers of the registry are used to import files.
+// The subscriptions listen to the changes on the bus, which the writes to the store are expected to be published to.
+// The users are authenticated if any token or basic auth user is configured, then every user only sees its own marks.
+// The zero values of the limits and the timeouts in the config take the defaults.
+func NewServer(cfg *config.ServerConfig, store storage.Storage, registry *bluenote.Registry, bus *event.Bus) (Server, error) {
+	authenticator, err := auth.New(cfg.AuthTokens, cfg.AuthBasicUsers)
+	if err != nil {
+		return nil, err
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, errors.New("Expect both the TLS certificate and key files to be set")
+	}
+	withDefaults := *cfg
+	for _, d := range []struct {
+		val *time.Duration
+		def time.Duration
+	}{
+		{&withDefaults.ReadTimeout, config.DefaultServerReadTimeout},
+		{&withDefaults.WriteTimeout, config.DefaultServerWriteTimeout},
+		{&withDefaults.IdleTimeout, config.DefaultServerIdleTimeout},
+		{&withDefaults.ShutdownTimeout, config.DefaultServerShutdownTimeout},
+	} {
+		if *d.val <= 0 {
+			*d.val = d.def
+		}
+	}
+	if withDefaults.MaxBodySize <= 0 {
+		withDefaults.MaxBodySize = config.DefaultServerMaxBodySize
+	}
+	if withDefaults.MaxUploadSize <= 0 {
+		withDefaults.MaxUploadSize = config.DefaultServerMaxUploadSize
+	}
+	s := &server{config: &withDefaults, store: store, registry: registry, auth: authenticator, bus: bus, shutdown: make(chan struct{})}
+	if cfg.PersistedQueriesFile != "" {
+		if s.persistedQueries, err = loadPersistedQueries(cfg.PersistedQueriesFile); err != nil {
+			return nil, err
+		}
+	} else if cfg.PersistedQueriesOnly {
+		return nil, errors.New("Expect the persisted queries file to allow only the persisted queries")
+	}
+	s.schema = s.graphqlSchema()
+	return s, nil
 }
 
-func (s *server) Run() {
-	schema = s.graphqlSchema()
-	http.HandleFunc("/graphql", handleGraphqlMarks)
-	util.Logf("Server is running on %v\n", s.config.ListenAddr)
-	http.ListenAndServe(s.config.ListenAddr, nil)
+// authenticate authenticates the request and requires the scope before calling the handler,
+// the user is carried by the context of the request. It returns the handler if the authentication is disabled.
+func (s *server) authenticate(scope auth.Scope, handler http.HandlerFunc) http.HandlerFunc {
+	if s.auth == nil {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := s.auth.Authenticate(r)
+		if err != nil {
+			util.Debugf("Failed to authenticate the request from %v: %v", r.RemoteAddr, err)
+			w.Header().Set("WWW-Authenticate", s.auth.Challenge())
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !user.Allows(scope) {
+			http.Error(w, fmt.Sprintf("User %q doesn't have the %s scope", user.ID, scope), http.StatusForbidden)
+			return
+		}
+		handler(w, r.WithContext(auth.WithUser(r.Context(), user)))
+	}
+}
 
+// requireScope requires the scope of the user before resolving the field.
+func requireScope(scope auth.Scope, resolve graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		if user := auth.UserFromContext(p.Context); user != nil && !user.Allows(scope) {
+			return nil, newAPIError(codeForbidden, fmt.Sprintf("User %q doesn't have the %s scope", user.ID, scope))
+		}
+		return resolve(p)
+	}
 }
 
-func handleGraphqlMarks(w http.ResponseWriter, r *http.Request) {
-	// Ensure the request method is POST
-	if r.Method != http.MethodPost {
-		http.Error(w, "Only POST requests are allowed", http.StatusMethodNotAllowed)
-		return
+// storeFor returns the storage scoped to the marks of the user of the context.
+func (s *server) storeFor(ctx context.Context) storage.Storage {
+	if user := auth.UserFromContext(ctx); user != nil {
+		return &ownerStorage{Storage: s.store, owner: user.ID}
+	}
+	return s.store
+}
+
+// graphqlRequest is a graphql request, the body of a POST request or the parameters of a GET request.
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+	Extensions    struct {
+		// PersistedQuery refers to a query in the allow-list by its hash, in the format of the Apollo clients.
+		PersistedQuery *struct {
+			Version    int    `json:"version"`
+			SHA256Hash string `json:"sha256Hash"`
+		} `json:"persistedQuery"`
+	} `json:"extensions"`
+}
+
+// graphqlRequestFromValues reads a graphql request from the query parameters of a GET request,
+// the variables and the extensions are json encoded.
+func graphqlRequestFromValues(values url.Values) (*graphqlRequest, error) {
+	req := &graphqlRequest{Query: values.Get("query"), OperationName: values.Get("operationName")}
+	if val := values.Get("variables"); val != "" {
+		if err := json.Unmarshal([]byte(val), &req.Variables); err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid variables: %v", err))
+		}
 	}
+	if val := values.Get("extensions"); val != "" {
+		if err := json.Unmarshal([]byte(val), &req.Extensions); err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid extensions: %v", err))
+		}
+	}
+	return req, nil
+}
 
-	// Read the POST body
-	body, err := io.ReadAll(r.Body)
+// operationType returns the type ("query", "mutation" or "subscription") of the operation to run,
+// which is the one of the name, or the only one in the query. It returns "" if it can't be told,
+// the errors are left to the execution.
+func operationType(query, operationName string) string {
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		return ""
+	}
+	var ops []*ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		if op, ok := def.(*ast.OperationDefinition); ok {
+			ops = append(ops, op)
+		}
+	}
+	for _, op := range ops {
+		if (operationName == "" && len(ops) == 1) || (op.Name != nil && op.Name.Value == operationName) {
+			return op.Operation
+		}
+	}
+	return ""
+}
+
+// isGraphiQLRequest returns whether the request is from a browser opening the GraphiQL page.
+func isGraphiQLRequest(r *http.Request) bool {
+	return r.Method == http.MethodGet && len(r.URL.Query()) == 0 && strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+func (s *server) handleGraphiQL(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(graphiqlPage)
+}
+
+// handleGraphql runs a graphql request, the mutations are only allowed in the POST requests,
+// and the subscriptions are streamed as server-sent events.
+func (s *server) handleGraphql(w http.ResponseWriter, r *http.Request) {
+	var req *graphqlRequest
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		if req, err = graphqlRequestFromValues(r.URL.Query()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodPost:
+		body, ok := readBody(w, r, s.config.MaxBodySize)
+		if !ok {
+			return
+		}
+		req = &graphqlRequest{}
+		if err := json.Unmarshal(body, req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid JSON in request body: %v", err), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Only GET and POST requests are allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	defer r.Body.Close()
 
-	// Parse the body as JSON
-	var requestData map[string]interface{}
-	if err := json.Unmarshal(body, &requestData); err != nil {
-		http.Error(w, "Invalid JSON in request body", http.StatusBadRequest)
+	if err := s.persistedQueries.resolve(req, s.config.PersistedQueriesOnly); err != nil {
+		if err == errPersistedQueryNotFound {
+			writeJSON(w, http.StatusOK, &graphql.Result{Errors: []gqlerrors.FormattedError{{Message: err.Error()}}})
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if req.Query == "" {
+		http.Error(w, "Missing the query in request", http.StatusBadRequest)
+		return
+	}
+	typ := operationType(req.Query, req.OperationName)
+	if r.Method == http.MethodGet && typ == ast.OperationTypeMutation {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Only queries and subscriptions are allowed in GET requests", http.StatusMethodNotAllowed)
+		return
+	}
+
+	util.Debugf("Received request from %v, request is %+v", r.RemoteAddr, req)
 
-	util.Logf("Received request from %v, request is %v\n", r.Host, requestData)
+	if typ == ast.OperationTypeSubscription {
+		if !wantsEventStream(r) {
+			http.Error(w, "Subscriptions are served as server-sent events, expecting \"Accept: text/event-stream\"", http.StatusNotAcceptable)
+			return
+		}
+		s.serveSubscription(w, r, req)
+		return
+	}
 
-	result := executeQuery(r.Context(), requestData["query"].(string))
-	json.NewEncoder(w).Encode(result)
+	result := s.executeQuery(r.Context(), req)
+	writeJSON(w, http.StatusOK, result)
 }
 
 func (s *server) resolveMarksQuery(p graphql.ResolveParams) (interface{}, error) {
+	filter, err := markFilterFromArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	sorts, err := sortFromArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	limit, _ := p.Args["limit"].(int)
+	offset, _ := p.Args["offset"].(int)
+	return s.storeFor(p.Context).GetMarks(p.Context, filter, &storage.QueryOptions{Limit: limit, Skip: offset, Sort: sorts})
+}
+
+func (s *server) resolveMarksConnection(p graphql.ResolveParams) (interface{}, error) {
+	filter, err := markFilterFromArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	sorts, err := sortFromArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	opts := &storage.QueryOptions{Sort: sorts}
+	if after, ok := p.Args["after"].(string); ok {
+		if opts.After, err = decodeCursor(after); err != nil {
+			return nil, err
+		}
+	}
+	first, firstOK := p.Args["first"].(int)
+	if !firstOK {
+		first = -1
+	} else if first < 0 {
+		return nil, newAPIError(codeInvalidArgument, fmt.Sprintf("Expect a non-negative first, got %d", first))
+	} else {
+		// Fetch one more mark to tell whether there is a next page.
+		opts.Limit = first + 1
+	}
+	store := s.storeFor(p.Context)
+	marks, err := store.GetMarks(p.Context, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	return newMarkConnection(store, filter, marks, opts.After != nil, first), nil
+}
+
+func (s *server) resolveSearch(p graphql.ResolveParams) (interface{}, error) {
+	store := s.storeFor(p.Context)
+	searcher, ok := store.(search.Searcher)
+	if !ok {
+		return nil, errSearchNotSupported(store)
+	}
+	query, _ := p.Args["query"].(string)
+	limit, _ := p.Args["limit"].(int)
+	return searcher.Search(p.Context, query, limit, nil)
+}
+
+func errSearchNotSupported(store storage.Storage) error {
+	return errors.New(fmt.Sprintf("Search is not supported by the storage %q", store.Name()))
+}
+
+// markFilterFromArgs constructs the storage filter from the arguments of markFilterArgs.
+func markFilterFromArgs(args map[string]interface{}) (bson.M, error) {
 	// TODO(yifan): Maybe use a more generic filter type than bson.M{} ?
 	filter := bson.M{}
 	andCondition := []bson.M{}
 
-	limit, _ := p.Args["limit"].(int)
-	id, idOK := p.Args["id"].(string)
+	id, idOK := args["id"].(string)
 	if idOK {
 		filter["_id"] = id
 	}
-	typ, typOK := p.Args["type"].(string)
+	ids, idsOK := args["ids"].([]interface{})
+	if idsOK {
+		if idOK {
+			return nil, newAPIError(codeInvalidArgument, "Expect only one of id and ids")
+		}
+		filter["_id"] = bson.M{"$in": ids}
+	}
+	typ, typOK := args["type"].(string)
 	if typOK {
 		filter["type"] = typ
 	}
-	title, titleOK := p.Args["title"].(string)
+	title, titleOK := args["title"].(string)
 	if titleOK {
 		filter["title"] = bson.M{"$regex": title, "$options": "i"}
 	}
-	author, authorOK := p.Args["author"].(string)
+	author, authorOK := args["author"].(string)
 	if authorOK {
 		filter["author"] = bson.M{"$regex": author, "$options": "i"}
 	}
-	data, dataOK := p.Args["data"].(string)
+	// The text of the highlights and the notes is matched literally, while the title and the author
+	// are regular expressions, e.g. "^Of Human".
+	data, dataOK := args["data"].(string)
 	if dataOK {
-		filter["data"] = bson.M{"$regex": data, "$options": "i"}
+		filter["data"] = bson.M{"$regex": regexp.QuoteMeta(data), "$options": "i"}
 	}
-	note, noteOK := p.Args["note"].(string)
+	note, noteOK := args["note"].(string)
 	if noteOK {
-		filter["note"] = bson.M{"$regex": note, "$options": "i"}
+		filter["note"] = bson.M{"$regex": regexp.QuoteMeta(note), "$options": "i"}
 	}
-	tags, tagsOK := p.Args["tags"].([]interface{})
+	tags, tagsOK := args["tags"].([]interface{})
 	if tagsOK {
-		for _, tag := range tags {
-			tagVal, ok := tag.(string)
+		for _, t := range tags {
+			tagVal, ok := t.(string)
 			if !ok {
-				return nil, errors.New(fmt.Sprintf("Expect []string for tags, but got []%T", tag))
+				return nil, newAPIError(codeInvalidArgument, fmt.Sprintf("Expect []string for tags, but got []%T", t))
 			}
-			andCondition = append(andCondition, bson.M{"tags": bson.M{"$regex": tagVal, "$options": "i"}})
+			// A tag matches itself and its descendants, e.g. "philosophy" matches "philosophy/stoicism".
+			if tagVal = tag.Normalize(tagVal); tagVal == "" {
+				return nil, newAPIError(codeInvalidArgument, "Expect non-empty tags")
+			}
+			andCondition = append(andCondition, tag.Filter([]string{tagVal}))
 		}
 	}
-	createdBefore, createdBeforeOK := p.Args["createdBefore"].(int)
+	createdBefore, createdBeforeOK := args["createdBefore"].(int)
 	if createdBeforeOK {
 		andCondition = append(andCondition, bson.M{"createdAt": bson.M{"$lt": createdBefore}})
 	}
-	createdAfter, createdAfterOK := p.Args["createdAfter"].(int)
+	createdAfter, createdAfterOK := args["createdAfter"].(int)
 	if createdAfterOK {
 		andCondition = append(andCondition, bson.M{"createdAt": bson.M{"$gt": createdAfter}})
 	}
-	lastModifiedBefore, lastModifiedBeforeOK := p.Args["lastModifiedBefore"].(int)
+	lastModifiedBefore, lastModifiedBeforeOK := args["lastModifiedBefore"].(int)
 	if lastModifiedBeforeOK {
 		andCondition = append(andCondition, bson.M{"lastModifiedAt": bson.M{"$lt": lastModifiedBefore}})
 	}
-	lastModifiedAfter, lastModifiedAfterOK := p.Args["lastModifiedAfter"].(int)
+	lastModifiedAfter, lastModifiedAfterOK := args["lastModifiedAfter"].(int)
 	if lastModifiedAfterOK {
 		andCondition = append(andCondition, bson.M{"lastModifiedAt": bson.M{"$gt": lastModifiedAfter}})
 	}
@@ -125,42 +389,20 @@ func (s *server) resolveMarksQuery(p graphql.ResolveParams) (interface{}, error)
 	if len(andCondition) > 0 {
 		filter["$and"] = andCondition
 	}
-	return s.store.GetMarks(p.Context, filter, limit)
+	return filter, nil
 }
 
 func (s *server) createOneMark(p graphql.ResolveParams) (interface{}, error) {
-	mark := &model.Mark{
-		Type:   p.Args["type"].(string),
-		Title:  p.Args["title"].(string),
-		Author: p.Args["author"].(string),
-	}
-	section, sectionOK := p.Args["section"]
-	if sectionOK {
-		mark.Section = section.(string)
-	}
-	data, dataOK := p.Args["data"]
-	if dataOK {
-		mark.Data = data.(string)
-	}
-	note, noteOK := p.Args["note"]
-	if noteOK {
-		mark.UserNote = note.(string)
-	}
-	tags, tagsOK := p.Args["tags"].([]interface{})
-	if tagsOK {
-		for i := range tags {
-			mark.Tags = append(mark.Tags, tags[i].(string))
-		}
-	}
-	location, locationOK := p.Args["location"].(map[string]interface{})
-	if locationOK {
-		createLocationField(mark, location)
-	}
+	return s.createMark(p.Context, p.Args)
+}
 
+// createMark creates a mark from the arguments of createOne.
+func (s *server) createMark(ctx context.Context, args map[string]interface{}) (*model.Mark, error) {
+	mark := markFromArgs(args)
 	if err := model.ValidateMark(mark); err != nil {
 		return nil, err
 	}
-	id, err := s.store.CreateMark(p.Context, mark)
+	id, err := s.storeFor(ctx).CreateMark(ctx, mark)
 	if err != nil {
 		return nil, err
 	}
@@ -168,96 +410,122 @@ func (s *server) createOneMark(p graphql.ResolveParams) (interface{}, error) {
 	return mark, nil
 }
 
-func (s *server) updateOneMarkByID(p graphql.ResolveParams) (interface{}, error) {
-	id, idOK := p.Args["id"].(string)
-	if !idOK {
-		return nil, errors.New("No id is given")
+// markFromArgs constructs a new mark from the arguments of createOne, or the fields of a MarkInput.
+func markFromArgs(args map[string]interface{}) *model.Mark {
+	mark := &model.Mark{}
+	mark.Type, _ = args["type"].(string)
+	mark.Title, _ = args["title"].(string)
+	mark.Author, _ = args["author"].(string)
+	mark.Section, _ = args["section"].(string)
+	mark.Data, _ = args["data"].(string)
+	mark.UserNote, _ = args["note"].(string)
+	mark.Tags = stringsFromArgs(args, "tags")
+	location, locationOK := args["location"].(map[string]interface{})
+	if locationOK {
+		createLocationField(mark, location)
 	}
-	marks, err := s.store.GetMarks(p.Context, bson.M{"_id": id}, 0)
+	return mark
+}
+
+// getMark returns the mark of the id, or a NOT_FOUND error.
+func getMark(ctx context.Context, store storage.Storage, id string) (*model.Mark, error) {
+	marks, err := store.GetMarks(ctx, bson.M{"_id": id}, nil)
 	if err != nil {
 		return nil, err
 	}
+	if len(marks) == 0 {
+		return nil, newAPIError(codeNotFound, fmt.Sprintf("Mark %q is not found", id))
+	}
 	if len(marks) != 1 {
 		return nil, errors.New(fmt.Sprintf("Expect 1 mark, got %d", len(marks)))
 	}
-	update := marks[0]
-	typ, typOK := p.Args["type"].(string)
-	if typOK {
-		update.Type = typ
-	}
-	title, titleOK := p.Args["title"].(string)
-	if titleOK {
-		update.Title = title
+	return marks[0], nil
+}
+
+func (s *server) updateOneMarkByID(p graphql.ResolveParams) (interface{}, error) {
+	id, idOK := p.Args["id"].(string)
+	if !idOK {
+		return nil, newAPIError(codeInvalidArgument, "No id is given")
 	}
-	author, authorOK := p.Args["author"].(string)
-	if authorOK {
-		update.Author = author
+	return s.updateMark(p.Context, id, p.Args)
+}
+
+// updateMark updates the mark of the id with the arguments of updateOne, the fields that are not set are left unchanged,
+// and the fields in "clear" are cleared.
+func (s *server) updateMark(ctx context.Context, id string, args map[string]interface{}) (*model.Mark, error) {
+	mark, err := getMark(ctx, s.storeFor(ctx), id)
+	if err != nil {
+		return nil, err
 	}
-	section, sectionOK := p.Args["section"]
-	if sectionOK {
-		update.Section = section.(string)
+	patch, err := patchFromArgs(args)
+	if err != nil {
+		return nil, err
 	}
-	data, dataOK := p.Args["data"].(string)
-	if dataOK {
-		update.Data = data
+	patch.Apply(mark)
+	if err := model.ValidateMark(mark); err != nil {
+		return nil, err
 	}
-	note, noteOK := p.Args["note"].(string)
-	if noteOK {
-		update.UserNote = note
+
+	if err := s.storeFor(ctx).UpdateOneMark(ctx, id, patch); err != nil {
+		return nil, err
 	}
-	location, locationOK := p.Args["location"].(map[string]interface{})
-	if locationOK {
-		createLocationField(update, location)
+	return mark, nil
+}
+
+// patchFromArgs constructs a patch from the arguments of updateOne, or the fields of a MarkUpdate,
+// the fields that are given are set, and the fields in "clear" are cleared.
+func patchFromArgs(args map[string]interface{}) (*model.MarkPatch, error) {
+	patch := &model.MarkPatch{Mark: markFromArgs(args)}
+	for _, field := range []string{"type", "title", "author", "section", "data", "note", "tags"} {
+		if _, ok := args[field]; ok {
+			patch.Set(field)
+		}
 	}
-	tags, tagsOK := p.Args["tags"].([]interface{})
-	if tagsOK {
-		update.Tags = nil
-		for i := range tags {
-			update.Tags = append(update.Tags, tags[i].(string))
+	location, _ := args["location"].(map[string]interface{})
+	for _, field := range []string{"chapter", "page", "location"} {
+		if _, ok := location[field]; ok {
+			patch.Set("location." + field)
 		}
 	}
-
-	if err := model.ValidateMark(update); err != nil {
-		return nil, err
+	for _, field := range stringsFromArgs(args, "clear") {
+		if patch.Has(field) {
+			return nil, newAPIError(codeInvalidArgument, fmt.Sprintf("Field %q can't be both set and cleared", field))
+		}
+		patch.Clear(field)
 	}
-
-	if err := s.store.UpdateOneMark(p.Context, id, update); err != nil {
+	if err := patch.Validate(); err != nil {
 		return nil, err
 	}
-	return update, nil
+	return patch, nil
 }
 
 func createLocationField(mark *model.Mark, location map[string]interface{}) {
 	mark.Location = &model.Location{}
-	for k, v := range location {
-		switch k {
-		case "chapter":
-			mark.Location.Chapter = v.(string)
-		case "page":
-			page := v.(int)
-			mark.Location.Page = &page
-		case "location":
-			location := v.(int)
-			mark.Location.Location = &location
-		}
+	mark.Location.Chapter, _ = location["chapter"].(string)
+	if page, ok := location["page"].(int); ok {
+		mark.Location.Page = &page
+	}
+	if loc, ok := location["location"].(int); ok {
+		mark.Location.Location = &loc
 	}
 }
 
 func (s *server) deleteOneMarkByID(p graphql.ResolveParams) (interface{}, error) {
 	id, idOK := p.Args["id"].(string)
 	if !idOK {
-		return nil, errors.New("No id is given")
+		return nil, newAPIError(codeInvalidArgument, "No id is given")
 	}
+	return s.deleteMark(p.Context, id)
+}
 
-	marks, err := s.store.GetMarks(p.Context, bson.M{"_id": id}, 0)
+// deleteMark deletes the mark of the id and returns it.
+func (s *server) deleteMark(ctx context.Context, id string) (*model.Mark, error) {
+	mark, err := getMark(ctx, s.storeFor(ctx), id)
 	if err != nil {
 		return nil, err
 	}
-	if len(marks) != 1 {
-		return nil, errors.New(fmt.Sprintf("Expect 1 mark, got %d", len(marks)))
-	}
-	if err := s.store.DeleteOneMark(p.Context, id); err != nil {
+	if err := s.storeFor(ctx).DeleteOneMark(ctx, id); err != nil {
 		return nil, err
 	}
-	return marks[0], nil
+	return mark, nil
 }
@@ -0,0 +1,266 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/bluenote"
+	"github.com/yifan-gu/blueNote/pkg/config"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/option"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// fakeStorage is an in-memory storage that only filters by "_id" and "owner", other filters match all the marks.
+type fakeStorage struct {
+	marks   []*model.Mark
+	trash   []*model.Mark
+	pingErr error
+	// maxMarks makes CreateMark fail once there are so many marks, 0 for no limit.
+	maxMarks int
+	// revisions are the revisions of the marks by their IDs, reverted records the reverted revisions.
+	revisions map[string][]*model.Revision
+	reverted  []string
+}
+
+func (f *fakeStorage) match(filter interface{}) []*model.Mark {
+	return matchMarks(f.marks, filter)
+}
+
+func matchMarks(all []*model.Mark, filter interface{}) []*model.Mark {
+	m, _ := filter.(bson.M)
+	if owner, ok := m["owner"].(string); ok {
+		var marks []*model.Mark
+		for _, mark := range matchID(all, m) {
+			if mark.Owner == owner {
+				marks = append(marks, mark)
+			}
+		}
+		return marks
+	}
+	return matchID(all, m)
+}
+
+func matchID(all []*model.Mark, m bson.M) []*model.Mark {
+	var ids []interface{}
+	switch id := m["_id"].(type) {
+	case nil:
+		return all
+	case string:
+		ids = []interface{}{id}
+	case bson.M:
+		switch in := id["$in"].(type) {
+		case []interface{}:
+			ids = in
+		case []string:
+			for _, v := range in {
+				ids = append(ids, v)
+			}
+		}
+	}
+	var marks []*model.Mark
+	for _, mark := range all {
+		for _, id := range ids {
+			if mark.ID == id {
+				marks = append(marks, mark)
+			}
+		}
+	}
+	return marks
+}
+
+func (f *fakeStorage) Name() string                      { return "fake" }
+func (f *fakeStorage) Options() []*option.Option         { return nil }
+func (f *fakeStorage) Connect(ctx context.Context) error { return nil }
+func (f *fakeStorage) Ping(ctx context.Context) error    { return f.pingErr }
+func (f *fakeStorage) Close(ctx context.Context) error   { return nil }
+
+func (f *fakeStorage) CreateMark(ctx context.Context, mark *model.Mark) (string, error) {
+	if f.maxMarks > 0 && len(f.marks) >= f.maxMarks {
+		return "", errors.New("storage is full")
+	}
+	mark.ID = fmt.Sprint(len(f.marks))
+	f.marks = append(f.marks, mark)
+	return mark.ID, nil
+}
+
+func (f *fakeStorage) GetMarks(ctx context.Context, filter interface{}, opts *storage.QueryOptions) ([]*model.Mark, error) {
+	// Return copies like a real storage does.
+	var marks []*model.Mark
+	for _, mark := range f.match(filter) {
+		copied := *mark
+		copied.Tags = append([]string(nil), mark.Tags...)
+		marks = append(marks, &copied)
+	}
+	if opts == nil {
+		return marks, nil
+	}
+	// The marks are kept in the stored order, only the ones after the cursor are returned.
+	if opts.After != nil {
+		var after []*model.Mark
+		for _, mark := range marks {
+			if storage.CompareMarks(mark, opts.After, opts.Sort) > 0 {
+				after = append(after, mark)
+			}
+		}
+		marks = after
+	}
+	if opts.Skip >= len(marks) {
+		return nil, nil
+	}
+	marks = marks[opts.Skip:]
+	if opts.Limit > 0 && opts.Limit < len(marks) {
+		marks = marks[:opts.Limit]
+	}
+	return marks, nil
+}
+
+func (f *fakeStorage) CountMarks(ctx context.Context, filter interface{}) (int, error) {
+	return len(f.match(filter)), nil
+}
+
+func (f *fakeStorage) AggregateMarks(ctx context.Context, filter interface{}, opts *storage.AggregateOptions) ([]*storage.Group, error) {
+	return storage.GroupMarks(f.match(filter), opts)
+}
+
+func (f *fakeStorage) UpdateMarks(ctx context.Context, filter interface{}, patch *model.MarkPatch) ([]string, error) {
+	var ids []string
+	for _, mark := range f.match(filter) {
+		patch.Apply(mark)
+		ids = append(ids, mark.ID)
+	}
+	return ids, nil
+}
+
+func (f *fakeStorage) UpdateOneMark(ctx context.Context, id string, patch *model.MarkPatch) error {
+	_, err := f.UpdateMarks(ctx, bson.M{"_id": id}, patch)
+	return err
+}
+
+// without returns the marks that are not in removed.
+func without(marks, removed []*model.Mark) []*model.Mark {
+	var ret []*model.Mark
+	for _, mark := range marks {
+		keep := true
+		for _, r := range removed {
+			keep = keep && r != mark
+		}
+		if keep {
+			ret = append(ret, mark)
+		}
+	}
+	return ret
+}
+
+func (f *fakeStorage) DeleteMarks(ctx context.Context, filter interface{}) (int, error) {
+	deleted := f.match(filter)
+	f.marks = without(f.marks, deleted)
+	now := int64(1700000000000)
+	for _, mark := range deleted {
+		mark.DeletedAt = &now
+	}
+	f.trash = append(f.trash, deleted...)
+	return len(deleted), nil
+}
+
+func (f *fakeStorage) DeleteOneMark(ctx context.Context, id string) error {
+	_, err := f.DeleteMarks(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (f *fakeStorage) GetDeletedMarks(ctx context.Context, filter interface{}, opts *storage.QueryOptions) ([]*model.Mark, error) {
+	var marks []*model.Mark
+	for _, mark := range matchMarks(f.trash, filter) {
+		copied := *mark
+		marks = append(marks, &copied)
+	}
+	return marks, nil
+}
+
+func (f *fakeStorage) RestoreMarks(ctx context.Context, filter interface{}) ([]string, error) {
+	restored := matchMarks(f.trash, filter)
+	f.trash = without(f.trash, restored)
+	var ids []string
+	for _, mark := range restored {
+		mark.DeletedAt = nil
+		ids = append(ids, mark.ID)
+	}
+	f.marks = append(f.marks, restored...)
+	return ids, nil
+}
+
+func (f *fakeStorage) PurgeMarks(ctx context.Context, filter interface{}) (int, error) {
+	purged := matchMarks(f.trash, filter)
+	f.trash = without(f.trash, purged)
+	return len(purged), nil
+}
+
+func (f *fakeStorage) GetRevisions(ctx context.Context, id string) ([]*model.Revision, error) {
+	return f.revisions[id], nil
+}
+
+func (f *fakeStorage) RevertMark(ctx context.Context, id, revisionID string) error {
+	for _, revision := range f.revisions[id] {
+		if revision.ID == revisionID {
+			f.reverted = append(f.reverted, revisionID)
+			return nil
+		}
+	}
+	return errors.Wrap(storage.ErrRevisionNotFound, fmt.Sprintf("revision %q of mark %q", revisionID, id))
+}
+
+func newTestServer(t *testing.T, store storage.Storage) *server {
+	registry, err := bluenote.NewDefaultRegistry()
+	assert.NoError(t, err)
+	s, err := NewServer(&config.ServerConfig{}, store, registry, nil)
+	assert.NoError(t, err)
+	return s.(*server)
+}
+
+// runQuery runs the graphql query against the storage and returns the json encoded result.
+func runQuery(t *testing.T, store storage.Storage, query string) string {
+	s := newTestServer(t, store)
+	result := graphql.Do(graphql.Params{
+		Schema:        s.graphqlSchema(),
+		RequestString: query,
+		Context:       context.Background(),
+	})
+	setErrorCodes(result)
+	b, err := json.Marshal(result)
+	assert.NoError(t, err)
+	return string(b)
+}
+
+func TestMarkFilterFromArgsText(t *testing.T) {
+	filter, err := markFilterFromArgs(map[string]interface{}{"title": "^Of Human", "author": "Maugham|Orwell", "data": "a.b", "note": "(why?)"})
+	assert.NoError(t, err)
+	assert.Equal(t, bson.M{
+		"title":  bson.M{"$regex": "^Of Human", "$options": "i"},
+		"author": bson.M{"$regex": "Maugham|Orwell", "$options": "i"},
+		"data":   bson.M{"$regex": `a\.b`, "$options": "i"},
+		"note":   bson.M{"$regex": `\(why\?\)`, "$options": "i"},
+	}, filter)
+}
+
+func TestMarkFilterFromArgsTags(t *testing.T) {
+	filter, err := markFilterFromArgs(map[string]interface{}{"tags": []interface{}{"philosophy", " stoa / ethics "}})
+	assert.NoError(t, err)
+	assert.Equal(t, bson.M{"$and": []bson.M{
+		{"tags": bson.M{"$regex": "^(philosophy)(/|$)"}},
+		{"tags": bson.M{"$regex": "^(stoa/ethics)(/|$)"}},
+	}}, filter)
+
+	_, err = markFilterFromArgs(map[string]interface{}{"tags": []interface{}{""}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,104 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"github.com/graphql-go/graphql"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+)
+
+var statsGroupByEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "StatsGroupBy",
+	Values: graphql.EnumValueConfigMap{
+		"BOOK":       &graphql.EnumValueConfig{Value: storage.GroupByBook, Description: "The key is the title"},
+		"AUTHOR":     &graphql.EnumValueConfig{Value: storage.GroupByAuthor},
+		"TAG":        &graphql.EnumValueConfig{Value: storage.GroupByTag},
+		"TYPE":       &graphql.EnumValueConfig{Value: storage.GroupByType},
+		"CHAPTER":    &graphql.EnumValueConfig{Value: storage.GroupByChapter, Description: "The key is the chapter of the location, per book"},
+		"CREATED_AT": &graphql.EnumValueConfig{Value: storage.GroupByCreatedAt, Description: "The key is the bucket in UTC, e.g. \"2022-01\" for a month"},
+	},
+})
+
+var statsIntervalEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "StatsInterval",
+	Values: graphql.EnumValueConfigMap{
+		"YEAR":  &graphql.EnumValueConfig{Value: storage.IntervalYear},
+		"MONTH": &graphql.EnumValueConfig{Value: storage.IntervalMonth},
+		"WEEK":  &graphql.EnumValueConfig{Value: storage.IntervalWeek},
+		"DAY":   &graphql.EnumValueConfig{Value: storage.IntervalDay},
+	},
+})
+
+var statsGroupType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "StatsGroup",
+		Fields: graphql.Fields{
+			"key": &graphql.Field{
+				Type: graphql.String,
+			},
+			"title": &graphql.Field{
+				Type: graphql.String,
+			},
+			"author": &graphql.Field{
+				Type: graphql.String,
+			},
+			"count": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"averageLength": &graphql.Field{
+				Type:        graphql.Float,
+				Description: "The average number of the characters of the highlights",
+			},
+		},
+	},
+)
+
+var statsType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "Stats",
+		Fields: graphql.Fields{
+			"count": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"averageLength": &graphql.Field{
+				Type:        graphql.Float,
+				Description: "The average number of the characters of the highlights",
+			},
+			"groups": &graphql.Field{
+				Type: graphql.NewList(statsGroupType),
+			},
+		},
+	},
+)
+
+// statsArgs returns the arguments of the stats query.
+func statsArgs() graphql.FieldConfigArgument {
+	return withArgs(markFilterArgs(), graphql.FieldConfigArgument{
+		"groupBy": &graphql.ArgumentConfig{
+			Type: statsGroupByEnum,
+		},
+		"interval": &graphql.ArgumentConfig{
+			Type:        statsIntervalEnum,
+			Description: "The size of the buckets of CREATED_AT, MONTH by default",
+		},
+		"limit": &graphql.ArgumentConfig{
+			Type:        graphql.Int,
+			Description: "The maximum number of the groups",
+		},
+	})
+}
+
+func (s *server) resolveStats(p graphql.ResolveParams) (interface{}, error) {
+	filter, err := markFilterFromArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	opts := &storage.AggregateOptions{}
+	opts.GroupBy, _ = p.Args["groupBy"].(string)
+	opts.Interval, _ = p.Args["interval"].(string)
+	opts.Limit, _ = p.Args["limit"].(int)
+	return storage.GetStats(p.Context, s.storeFor(p.Context), filter, opts)
+}
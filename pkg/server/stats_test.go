@@ -0,0 +1,45 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/model"
+)
+
+func TestStats(t *testing.T) {
+	store := &fakeStorage{marks: []*model.Mark{
+		{ID: "a", Type: model.MarkTypeHighlight, Title: "T1", Author: "A", Data: "12", Tags: []string{"x"}},
+		{ID: "b", Type: model.MarkTypeHighlight, Title: "T1", Author: "A", Data: "1234", Tags: []string{"x", "y"}},
+		{ID: "c", Type: model.MarkTypeNote, Title: "T2", Author: "B", UserNote: "n"},
+	}}
+	tests := []struct {
+		query  string
+		result string
+	}{
+		{
+			query:  `{stats{count,averageLength,groups{key}}}`,
+			result: `{"data":{"stats":{"averageLength":3,"count":3,"groups":[]}}}`,
+		},
+		{
+			query:  `{stats(groupBy:BOOK){count,groups{key,title,author,count,averageLength}}}`,
+			result: `{"data":{"stats":{"count":3,"groups":[{"author":"A","averageLength":3,"count":2,"key":"T1","title":"T1"},{"author":"B","averageLength":0,"count":1,"key":"T2","title":"T2"}]}}}`,
+		},
+		{
+			query:  `{stats(groupBy:TAG,limit:1,ids:["a","b"]){count,groups{key,count}}}`,
+			result: `{"data":{"stats":{"count":2,"groups":[{"count":2,"key":"x"}]}}}`,
+		},
+		{
+			query:  `{stats(groupBy:CREATED_AT,interval:WEEK){groups{key}}}`,
+			result: `{"data":{"stats":{"groups":[]}}}`,
+		},
+	}
+	for i, tt := range tests {
+		assert.Equal(t, tt.result, runQuery(t, store, tt.query), "case #%d", i)
+	}
+}
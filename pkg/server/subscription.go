@@ -0,0 +1,435 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/yifan-gu/blueNote/pkg/auth"
+	"github.com/yifan-gu/blueNote/pkg/event"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/tag"
+	"github.com/yifan-gu/blueNote/pkg/util"
+)
+
+const (
+	// subscriptionBuffer is the number of the events a subscription can fall behind before it's closed.
+	subscriptionBuffer = 64
+	// keepAliveInterval is the interval of the comments sent to keep the idle streams open through the proxies.
+	keepAliveInterval = 30 * time.Second
+)
+
+var markEventTypeEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "MarkEventType",
+	Values: graphql.EnumValueConfigMap{
+		"CREATED": &graphql.EnumValueConfig{Value: event.Created},
+		"UPDATED": &graphql.EnumValueConfig{Value: event.Updated},
+		"DELETED": &graphql.EnumValueConfig{Value: event.Deleted},
+	},
+})
+
+var markEventType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "MarkEvent",
+		Fields: graphql.Fields{
+			"type": &graphql.Field{
+				Type: markEventTypeEnum,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*event.Event).Type, nil
+				},
+			},
+			"mark": &graphql.Field{
+				Type:        markType,
+				Description: "The mark after the change, or the deleted mark, which may only have the id",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*event.Event).Mark, nil
+				},
+			},
+		},
+	},
+)
+
+func (s *server) graphqlSubscriptionType() *graphql.Object {
+	return graphql.NewObject(
+		graphql.ObjectConfig{
+			Name: "Subscription",
+			Fields: graphql.Fields{
+				// Listen to the changes of the marks, served as server-sent events, e.g.
+				//  subscription{markChanged(author:"Maugham",events:[CREATED,UPDATED]){type,mark{id,title,data}}}
+				"markChanged": &graphql.Field{
+					Type:        markEventType,
+					Description: "Listen to the marks that are created, updated or deleted",
+					Args: graphql.FieldConfigArgument{
+						"id": &graphql.ArgumentConfig{
+							Type: graphql.String,
+						},
+						"ids": &graphql.ArgumentConfig{
+							Type: graphql.NewList(graphql.NewNonNull(graphql.String)),
+						},
+						"type": &graphql.ArgumentConfig{
+							Type: markTypeEnum,
+						},
+						"title": &graphql.ArgumentConfig{
+							Type: graphql.String,
+						},
+						"author": &graphql.ArgumentConfig{
+							Type: graphql.String,
+						},
+						"tags": &graphql.ArgumentConfig{
+							Type: graphql.NewList(graphql.String),
+						},
+						"events": &graphql.ArgumentConfig{
+							Type:        graphql.NewList(graphql.NewNonNull(markEventTypeEnum)),
+							Description: "The types of the events, all of them if not set",
+						},
+					},
+					Subscribe: s.subscribeMarkChanged,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source, nil
+					},
+				},
+			},
+		},
+	)
+}
+
+// eventMatcher returns whether an event is wanted by a subscription.
+type eventMatcher func(ev *event.Event) bool
+
+// containsFold returns whether s contains substr, ignoring the case, like the filters of the marks.
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// eventMatcherFromArgs constructs the matcher from the arguments of markChanged, the fields
+// are matched in the same way as markFilterFromArgs.
+func eventMatcherFromArgs(args map[string]interface{}) (eventMatcher, error) {
+	ids := make(map[string]bool)
+	id, idOK := args["id"].(string)
+	if idOK {
+		ids[id] = true
+	}
+	if list, ok := args["ids"].([]interface{}); ok {
+		if idOK {
+			return nil, newAPIError(codeInvalidArgument, "Expect only one of id and ids")
+		}
+		for _, id := range list {
+			if id, ok := id.(string); ok {
+				ids[id] = true
+			}
+		}
+	}
+	types := make(map[event.Type]bool)
+	if list, ok := args["events"].([]interface{}); ok {
+		for _, typ := range list {
+			if typ, ok := typ.(event.Type); ok {
+				types[typ] = true
+			}
+		}
+	}
+	var tags []string
+	if list, ok := args["tags"].([]interface{}); ok {
+		for _, t := range list {
+			tagVal, ok := t.(string)
+			if !ok {
+				return nil, newAPIError(codeInvalidArgument, fmt.Sprintf("Expect []string for tags, but got []%T", t))
+			}
+			if tagVal = tag.Normalize(tagVal); tagVal == "" {
+				return nil, newAPIError(codeInvalidArgument, "Expect non-empty tags")
+			}
+			tags = append(tags, tagVal)
+		}
+	}
+	typ, typOK := args["type"].(string)
+	title, titleOK := args["title"].(string)
+	author, authorOK := args["author"].(string)
+	_, idsOK := args["ids"]
+
+	return func(ev *event.Event) bool {
+		mark := ev.Mark
+		switch {
+		case len(types) > 0 && !types[ev.Type]:
+			return false
+		case (idOK || idsOK) && !ids[mark.ID]:
+			return false
+		case typOK && mark.Type != typ:
+			return false
+		case titleOK && !containsFold(mark.Title, title):
+			return false
+		case authorOK && !containsFold(mark.Author, author):
+			return false
+		}
+		for _, t := range tags {
+			if !hasTagUnder(mark, t) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// hasTagUnder returns whether the mark has the tag or one of its descendants, like tag.Filter.
+func hasTagUnder(mark *model.Mark, ancestor string) bool {
+	for _, t := range mark.Tags {
+		if tag.IsUnder(t, ancestor) {
+			return true
+		}
+	}
+	return false
+}
+
+// subscribeMarkChanged subscribes to the bus, the events of the marks that the user of the context
+// doesn't own are not delivered.
+func (s *server) subscribeMarkChanged(p graphql.ResolveParams) (interface{}, error) {
+	if s.bus == nil {
+		return nil, errors.New("Subscriptions are not supported by the server")
+	}
+	match, err := eventMatcherFromArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	if user := auth.UserFromContext(p.Context); user != nil {
+		matchFields := match
+		match = func(ev *event.Event) bool {
+			return ev.Mark.Owner == user.ID && matchFields(ev)
+		}
+	}
+
+	stream, _ := p.Context.Value(eventStreamKey{}).(*eventStream)
+	var sub *event.Subscription
+	if stream != nil && stream.resume {
+		if sub, err = s.bus.SubscribeAfter(subscriptionBuffer, stream.lastEventID); err != nil {
+			return nil, err
+		}
+	} else {
+		sub = s.bus.Subscribe(subscriptionBuffer)
+	}
+	ch := make(chan interface{})
+	go func() {
+		defer close(ch)
+		defer sub.Close()
+		for {
+			select {
+			case <-p.Context.Done():
+				return
+			case ev, ok := <-sub.Events():
+				if !ok {
+					// The bus closed the subscription as it fell behind.
+					stream.setBehind()
+					return
+				}
+				if !match(ev) {
+					stream.skip(ev.ID)
+					continue
+				}
+				stream.push(ev.ID)
+				select {
+				case ch <- ev:
+				case <-p.Context.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// eventStreamKey is the context key of the *eventStream of a subscription.
+type eventStreamKey struct{}
+
+// eventStream tracks the IDs of the events of a subscription served as server-sent events,
+// so the clients can resume after the last event they received. All the methods are no-ops on nil.
+type eventStream struct {
+	// lastEventID is the Last-Event-ID of the request, the subscription resumes after it if resume is set.
+	lastEventID uint64
+	resume      bool
+
+	mu sync.Mutex
+	// pending is the IDs of the events sent to the execution, in order, whose results are not written yet.
+	pending []uint64
+	// written is the latest ID written to the stream.
+	written uint64
+	// skipped is the ID of the latest event that doesn't match, and is after all the pending ones.
+	skipped uint64
+	// behind is set if the subscription fell behind and is closed by the bus.
+	behind bool
+}
+
+func (e *eventStream) push(id uint64) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pending = append(e.pending, id)
+}
+
+// pop returns the ID of the event of the next result, every event sent to the execution has one result.
+func (e *eventStream) pop() (uint64, bool) {
+	if e == nil {
+		return 0, false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.pending) == 0 {
+		return 0, false
+	}
+	id := e.pending[0]
+	e.pending = e.pending[1:]
+	e.written = id
+	return id, true
+}
+
+func (e *eventStream) skip(id uint64) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.pending) == 0 {
+		e.skipped = id
+	}
+}
+
+// idle returns the ID of the latest skipped event if it's not written yet, so a client that
+// doesn't receive any event can still resume after the events it's not interested in.
+func (e *eventStream) idle() (uint64, bool) {
+	if e == nil {
+		return 0, false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.pending) > 0 || e.skipped <= e.written {
+		return 0, false
+	}
+	e.written = e.skipped
+	return e.written, true
+}
+
+func (e *eventStream) setBehind() {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.behind = true
+}
+
+func (e *eventStream) isBehind() bool {
+	if e == nil {
+		return false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.behind
+}
+
+// wantsEventStream returns whether the client accepts server-sent events.
+func wantsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// serveSubscription streams the results of a subscription as server-sent events, in the
+// "distinct connections" mode of the GraphQL over SSE protocol: a "next" event for every result,
+// then a "complete" event when the subscription ends, e.g. on an error.
+// Every "next" event has the ID of the mark event. The stream is closed without "complete"
+// before the write timeout of the server, when the server shuts down, or when the subscription
+// falls behind, then the clients reconnect with the Last-Event-ID header to receive the missed events.
+func (s *server) serveSubscription(w http.ResponseWriter, r *http.Request, req *graphqlRequest) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	stream := &eventStream{}
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		id, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			writeAPIError(w, newAPIError(codeInvalidArgument, fmt.Sprintf("Invalid Last-Event-ID %q", lastEventID)))
+			return
+		}
+		stream.lastEventID, stream.resume = id, true
+	}
+	ctx, cancel := context.WithCancel(context.WithValue(r.Context(), eventStreamKey{}, stream))
+	results := graphql.Subscribe(graphql.Params{
+		Schema:         s.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        ctx,
+	})
+	defer func() {
+		cancel()
+		// Unblock the execution if it's sending a result.
+		go func() {
+			for range results {
+			}
+		}()
+	}()
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	// Leave the time to write the last event before the write timeout, the client resumes after it.
+	deadline := time.NewTimer(s.config.WriteTimeout * 9 / 10)
+	defer deadline.Stop()
+
+	for {
+		select {
+		case result, ok := <-results:
+			if !ok {
+				if !stream.isBehind() {
+					fmt.Fprint(w, "event: complete\ndata:\n\n")
+					flusher.Flush()
+				}
+				return
+			}
+			if id, ok := stream.pop(); ok {
+				fmt.Fprintf(w, "id: %d\n", id)
+			}
+			if len(result.Errors) > 0 {
+				util.Logf("Errors running graphql subscription: %v\n", result.Errors)
+			}
+			setErrorCodes(result)
+			data, err := json.Marshal(result)
+			if err != nil {
+				util.Debugf("Failed to encode the subscription result: %v", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: next\ndata: %s\n\n", data)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n")
+			if id, ok := stream.idle(); ok {
+				// An "id" without "data" updates the last event ID of the client without an event.
+				fmt.Fprintf(w, "id: %d\n", id)
+			}
+			fmt.Fprint(w, "\n")
+			flusher.Flush()
+		case <-deadline.C:
+			return
+		case <-s.shutdown:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,208 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/bluenote"
+	"github.com/yifan-gu/blueNote/pkg/config"
+	"github.com/yifan-gu/blueNote/pkg/event"
+	"github.com/yifan-gu/blueNote/pkg/model"
+)
+
+func TestEventMatcherFromArgs(t *testing.T) {
+	mark := &model.Mark{ID: "a", Type: model.MarkTypeHighlight, Title: "Of Human Bondage", Author: "Maugham", Tags: []string{"novel/russian", "classic"}}
+	created := &event.Event{Type: event.Created, Mark: mark}
+	deleted := &event.Event{Type: event.Deleted, Mark: &model.Mark{ID: "a"}}
+
+	tests := []struct {
+		args   map[string]interface{}
+		event  *event.Event
+		result bool
+		err    bool
+	}{
+		{args: map[string]interface{}{}, event: created, result: true},
+		{args: map[string]interface{}{}, event: deleted, result: true},
+		{args: map[string]interface{}{"id": "a"}, event: deleted, result: true},
+		{args: map[string]interface{}{"id": "b"}, event: created, result: false},
+		{args: map[string]interface{}{"ids": []interface{}{"b", "a"}}, event: created, result: true},
+		{args: map[string]interface{}{"ids": []interface{}{}}, event: created, result: false},
+		{args: map[string]interface{}{"id": "a", "ids": []interface{}{"a"}}, err: true},
+		{args: map[string]interface{}{"title": "human", "author": "MAUGHAM"}, event: created, result: true},
+		{args: map[string]interface{}{"title": "human"}, event: deleted, result: false},
+		{args: map[string]interface{}{"type": model.MarkTypeNote}, event: created, result: false},
+		{args: map[string]interface{}{"tags": []interface{}{"novel", "classic"}}, event: created, result: true},
+		{args: map[string]interface{}{"tags": []interface{}{"novel/russian"}}, event: created, result: true},
+		{args: map[string]interface{}{"tags": []interface{}{"nov"}}, event: created, result: false},
+		{args: map[string]interface{}{"tags": []interface{}{"novel", "poem"}}, event: created, result: false},
+		{args: map[string]interface{}{"tags": []interface{}{" "}}, err: true},
+		{args: map[string]interface{}{"tags": []interface{}{1}}, err: true},
+		{args: map[string]interface{}{"events": []interface{}{event.Created, event.Updated}}, event: created, result: true},
+		{args: map[string]interface{}{"events": []interface{}{event.Created, event.Updated}}, event: deleted, result: false},
+	}
+	for i, tt := range tests {
+		match, err := eventMatcherFromArgs(tt.args)
+		if tt.err {
+			assert.Error(t, err, "case #%d", i)
+			continue
+		}
+		assert.NoError(t, err, "case #%d", i)
+		assert.Equal(t, tt.result, match(tt.event), "case #%d", i)
+	}
+}
+
+// readEvent reads the next server-sent event, skipping the comments, it returns the id and the other fields.
+func readEvent(t *testing.T, r *bufio.Reader) (string, string) {
+	var id string
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if !assert.NoError(t, err) {
+			return "", ""
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && len(lines) > 0:
+			return id, strings.Join(lines, "\n")
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case line != "" && !strings.HasPrefix(line, ":"):
+			lines = append(lines, line)
+		}
+	}
+}
+
+// subscribe requests the subscription as server-sent events.
+func subscribe(t *testing.T, ctx context.Context, url, query, lastEventID string) *http.Response {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/graphql?query="+neturl.QueryEscape(query), nil)
+	assert.NoError(t, err)
+	req.Header.Set("Accept", "text/event-stream")
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	return resp
+}
+
+func TestSubscription(t *testing.T) {
+	bus := event.NewBus()
+	store := event.NewPublishingStorage(&fakeStorage{}, bus)
+	registry, err := bluenote.NewDefaultRegistry()
+	assert.NoError(t, err)
+	srv, err := NewServer(&config.ServerConfig{}, store, registry, bus)
+	assert.NoError(t, err)
+	ts := httptest.NewServer(srv.(*server).handler())
+	defer ts.Close()
+
+	query := `subscription{markChanged(title:"bondage"){type,mark{id,title}}}`
+
+	// The subscriptions are only served as server-sent events.
+	resp, err := http.Post(ts.URL+"/graphql", "application/json", strings.NewReader(`{"query":`+quoteJSON(t, query)+`}`))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotAcceptable, resp.StatusCode)
+
+	// Don't hang if the events are missing.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp = subscribe(t, ctx, ts.URL, query, "")
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	for start := time.Now(); bus.Len() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("the subscription isn't created")
+		}
+	}
+
+	for _, mutation := range []string{
+		`mutation{createOne(type:HIGHLIGHT,title:"Of Human Bondage",author:"Maugham",data:"d"){id}}`,
+		`mutation{createOne(type:HIGHLIGHT,title:"Cakes and Ale",author:"Maugham",data:"d"){id}}`,
+		`mutation{deleteOne(id:"1"){id}}`,
+		`mutation{deleteOne(id:"0"){id}}`,
+	} {
+		resp, err := http.Post(ts.URL+"/graphql", "application/json", strings.NewReader(`{"query":`+quoteJSON(t, mutation)+`}`))
+		assert.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	r := bufio.NewReader(resp.Body)
+	id, ev := readEvent(t, r)
+	assert.NotEmpty(t, id)
+	assert.Equal(t, `event: next
+data: {"data":{"markChanged":{"mark":{"id":"0","title":"Of Human Bondage"},"type":"CREATED"}}}`, ev)
+	nextID, ev := readEvent(t, r)
+	assert.Greater(t, nextID, id)
+	assert.Equal(t, `event: next
+data: {"data":{"markChanged":{"mark":{"id":"0","title":"Of Human Bondage"},"type":"DELETED"}}}`, ev)
+}
+
+func TestSubscriptionResume(t *testing.T) {
+	bus := event.NewBus()
+	registry, err := bluenote.NewDefaultRegistry()
+	assert.NoError(t, err)
+	srv, err := NewServer(&config.ServerConfig{WriteTimeout: time.Second}, &fakeStorage{}, registry, bus)
+	assert.NoError(t, err)
+	ts := httptest.NewServer(srv.(*server).handler())
+	defer ts.Close()
+
+	var events []*event.Event
+	for _, title := range []string{"Of Human Bondage", "Cakes and Ale", "The Moon and Sixpence"} {
+		events = append(events, &event.Event{Type: event.Created, Mark: &model.Mark{ID: title, Title: title}})
+	}
+	bus.Publish(events...)
+	id := func(ev *event.Event) string {
+		return strconv.FormatUint(ev.ID, 10)
+	}
+	query := `subscription{markChanged(author:"",title:"a"){mark{id}}}`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The missed events are replayed, then the stream is closed without "complete" before the write timeout.
+	resp := subscribe(t, ctx, ts.URL, query, id(events[0]))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	r := bufio.NewReader(resp.Body)
+	eventID, ev := readEvent(t, r)
+	assert.Equal(t, id(events[1]), eventID)
+	assert.Equal(t, `event: next
+data: {"data":{"markChanged":{"mark":{"id":"Cakes and Ale"}}}}`, ev)
+	eventID, ev = readEvent(t, r)
+	assert.Equal(t, id(events[2]), eventID)
+	assert.Equal(t, `event: next
+data: {"data":{"markChanged":{"mark":{"id":"The Moon and Sixpence"}}}}`, ev)
+	rest, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(rest), "complete")
+	resp.Body.Close()
+
+	// The events before the bus are expired.
+	resp = subscribe(t, ctx, ts.URL, query, "1")
+	r = bufio.NewReader(resp.Body)
+	eventID, ev = readEvent(t, r)
+	assert.Empty(t, eventID)
+	assert.Contains(t, ev, `"extensions":{"code":"EXPIRED"}`)
+	_, ev = readEvent(t, r)
+	assert.Equal(t, "event: complete\ndata:", ev)
+	resp.Body.Close()
+
+	resp = subscribe(t, ctx, ts.URL, query, "last")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,87 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"github.com/graphql-go/graphql"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/tag"
+)
+
+var tagCountType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "TagCount",
+		Fields: graphql.Fields{
+			"name": &graphql.Field{
+				Type: graphql.String,
+			},
+			"parent": &graphql.Field{
+				Type:        graphql.String,
+				Description: "The parent of a hierarchical tag, e.g. \"philosophy\" for \"philosophy/stoicism\"",
+			},
+			"count": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "The number of the marks with the tag itself",
+			},
+			"total": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "The number of the marks with the tag or any of its descendants",
+			},
+		},
+	},
+)
+
+func (s *server) resolveTags(p graphql.ResolveParams) (interface{}, error) {
+	filter, err := markFilterFromArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	under, _ := p.Args["under"].(string)
+	return tag.List(p.Context, s.storeFor(p.Context), filter, under)
+}
+
+// tagsResult converts the marks changed by a tag operation to a bulk result.
+func tagsResult(marks []*model.Mark, dryRun bool) *bulkResult {
+	result := newBulkResult(dryRun)
+	for _, mark := range marks {
+		if !dryRun {
+			result.IDs = append(result.IDs, mark.ID)
+		}
+	}
+	result.Marks = marks
+	result.Count = len(marks)
+	return result
+}
+
+func (s *server) renameTag(p graphql.ResolveParams) (interface{}, error) {
+	from, _ := p.Args["from"].(string)
+	to, _ := p.Args["to"].(string)
+	dryRun, _ := p.Args["dryRun"].(bool)
+	marks, err := tag.Rename(p.Context, s.storeFor(p.Context), from, to, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	return tagsResult(marks, dryRun), nil
+}
+
+func (s *server) mergeTags(p graphql.ResolveParams) (interface{}, error) {
+	to, _ := p.Args["to"].(string)
+	dryRun, _ := p.Args["dryRun"].(bool)
+	marks, err := tag.Merge(p.Context, s.storeFor(p.Context), stringsFromArgs(p.Args, "from"), to, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	return tagsResult(marks, dryRun), nil
+}
+
+func (s *server) deleteTags(p graphql.ResolveParams) (interface{}, error) {
+	dryRun, _ := p.Args["dryRun"].(bool)
+	marks, err := tag.Delete(p.Context, s.storeFor(p.Context), stringsFromArgs(p.Args, "tags"), dryRun)
+	if err != nil {
+		return nil, err
+	}
+	return tagsResult(marks, dryRun), nil
+}
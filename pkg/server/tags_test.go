@@ -0,0 +1,60 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/model"
+)
+
+func TestTags(t *testing.T) {
+	newStorage := func() *fakeStorage {
+		return &fakeStorage{marks: []*model.Mark{
+			{ID: "a", Type: model.MarkTypeHighlight, Title: "T", Author: "A", Data: "1", Tags: []string{"stoa/ethics", "novel"}},
+			{ID: "b", Type: model.MarkTypeHighlight, Title: "T", Author: "A", Data: "2", Tags: []string{"novel"}},
+		}}
+	}
+	tests := []struct {
+		query  string
+		result string
+		tags   map[string][]string
+	}{
+		{
+			query:  `{tags{name,parent,count}}`,
+			result: `{"data":{"tags":[{"count":2,"name":"novel","parent":""},{"count":0,"name":"stoa","parent":""},{"count":1,"name":"stoa/ethics","parent":"stoa"}]}}`,
+		},
+		{
+			query:  `mutation{renameTag(from:"stoa",to:"philosophy/stoicism"){ids,count,marks{tags}}}`,
+			result: `{"data":{"renameTag":{"count":1,"ids":["a"],"marks":[{"tags":["philosophy/stoicism/ethics","novel"]}]}}}`,
+			tags:   map[string][]string{"a": {"philosophy/stoicism/ethics", "novel"}},
+		},
+		{
+			query:  `mutation{mergeTags(from:["stoa","novel"],to:"read",dryRun:true){ids,count}}`,
+			result: `{"data":{"mergeTags":{"count":2,"ids":[]}}}`,
+			tags:   map[string][]string{"a": {"stoa/ethics", "novel"}, "b": {"novel"}},
+		},
+		{
+			query:  `mutation{deleteTags(tags:["novel"]){ids}}`,
+			result: `{"data":{"deleteTags":{"ids":["a","b"]}}}`,
+			tags:   map[string][]string{"a": {"stoa/ethics"}, "b": {}},
+		},
+		{
+			query:  `mutation{renameTag(from:"stoa",to:"stoa/old"){count}}`,
+			result: `{"data":{"renameTag":null},"errors":[{"message":"can't move \"stoa\" to \"stoa/old\" under itself: invalid tag","locations":[{"line":1,"column":10}],"path":["renameTag"],"extensions":{"code":"INVALID_ARGUMENT"}}]}`,
+		},
+	}
+	for i, tt := range tests {
+		store := newStorage()
+		assert.Equal(t, tt.result, runQuery(t, store, tt.query), "case #%d", i)
+		for _, mark := range store.marks {
+			if tags, ok := tt.tags[mark.ID]; ok {
+				assert.Equal(t, tags, mark.Tags, "case #%d: %s", i, mark.ID)
+			}
+		}
+	}
+}
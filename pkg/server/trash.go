@@ -0,0 +1,78 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+	"github.com/yifan-gu/blueNote/pkg/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// trashPurgeInterval is the interval of purging the expired marks from the trash.
+const trashPurgeInterval = time.Hour
+
+func (s *server) resolveTrash(p graphql.ResolveParams) (interface{}, error) {
+	filter, err := markFilterFromArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	limit, _ := p.Args["limit"].(int)
+	offset, _ := p.Args["offset"].(int)
+	return s.storeFor(p.Context).GetDeletedMarks(p.Context, filter, &storage.QueryOptions{Limit: limit, Skip: offset})
+}
+
+func (s *server) restoreMarks(p graphql.ResolveParams) (interface{}, error) {
+	dryRun, _ := p.Args["dryRun"].(bool)
+	filter, err := bulkFilterFromArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	store := s.storeFor(p.Context)
+	result := newBulkResult(dryRun)
+	if dryRun {
+		if result.Marks, err = store.GetDeletedMarks(p.Context, filter, nil); err != nil {
+			return nil, err
+		}
+		result.Count = len(result.Marks)
+		return result, nil
+	}
+	ids, err := store.RestoreMarks(p.Context, filter)
+	if err != nil {
+		return nil, err
+	}
+	result.IDs = append(result.IDs, ids...)
+	result.Count = len(ids)
+	if len(ids) > 0 {
+		if result.Marks, err = store.GetMarks(p.Context, bson.M{"_id": bson.M{"$in": ids}}, nil); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// purgeTrash purges the marks that have been in the trash for longer than the retention
+// of all the users periodically, until the context is canceled.
+func (s *server) purgeTrash(ctx context.Context) {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+	for {
+		count, err := storage.PurgeExpired(ctx, s.store, s.config.TrashRetention)
+		if err != nil {
+			util.Error("Failed to purge the trash:", err)
+		} else if count > 0 {
+			util.LogFields("Purged the expired marks from the trash", util.Fields{"marks": count})
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
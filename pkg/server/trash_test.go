@@ -0,0 +1,88 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/model"
+)
+
+func TestTrash(t *testing.T) {
+	deletedAt := int64(1700000000000)
+	newStorage := func() *fakeStorage {
+		return &fakeStorage{
+			marks: []*model.Mark{
+				{ID: "a", Type: model.MarkTypeHighlight, Title: "T", Author: "A", Data: "1"},
+			},
+			trash: []*model.Mark{
+				{ID: "b", Type: model.MarkTypeHighlight, Title: "T", Author: "A", Data: "2", DeletedAt: &deletedAt},
+			},
+		}
+	}
+	tests := []struct {
+		query  string
+		result string
+		marks  []string
+		trash  []string
+	}{
+		{
+			query:  `{trash{id,deletedAt}}`,
+			result: `{"data":{"trash":[{"deletedAt":1700000000000,"id":"b"}]}}`,
+			marks:  []string{"a"},
+			trash:  []string{"b"},
+		},
+		{
+			query:  `mutation{deleteOne(id:"a"){id}}`,
+			result: `{"data":{"deleteOne":{"id":"a"}}}`,
+			trash:  []string{"b", "a"},
+		},
+		{
+			query:  `mutation{restoreMarks(filter:{ids:["b"]},dryRun:true){ids,count}}`,
+			result: `{"data":{"restoreMarks":{"count":1,"ids":[]}}}`,
+			marks:  []string{"a"},
+			trash:  []string{"b"},
+		},
+		{
+			query:  `mutation{restoreMarks(filter:{ids:["b"]}){ids,count,marks{id,deletedAt}}}`,
+			result: `{"data":{"restoreMarks":{"count":1,"ids":["b"],"marks":[{"deletedAt":null,"id":"b"}]}}}`,
+			marks:  []string{"a", "b"},
+		},
+		{
+			query:  `mutation{restoreMarks(filter:{}){count}}`,
+			result: `{"data":{"restoreMarks":null},"errors":[{"message":"Expect a non-empty filter","locations":[{"line":1,"column":10}],"path":["restoreMarks"],"extensions":{"code":"INVALID_ARGUMENT"}}]}`,
+			marks:  []string{"a"},
+			trash:  []string{"b"},
+		},
+	}
+	ids := func(marks []*model.Mark) []string {
+		var ret []string
+		for _, mark := range marks {
+			ret = append(ret, mark.ID)
+		}
+		return ret
+	}
+	for i, tt := range tests {
+		store := newStorage()
+		assert.Equal(t, tt.result, runQuery(t, store, tt.query), "case #%d", i)
+		assert.Equal(t, tt.marks, ids(store.marks), "case #%d", i)
+		assert.Equal(t, tt.trash, ids(store.trash), "case #%d", i)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	store := &fakeStorage{trash: []*model.Mark{{ID: "a"}}}
+	s := newTestServer(t, store)
+	s.config.TrashRetention = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// The expired marks are purged before the context is checked.
+	s.purgeTrash(ctx)
+	assert.Nil(t, store.trash)
+}
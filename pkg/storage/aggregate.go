@@ -0,0 +1,238 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/yifan-gu/blueNote/pkg/model"
+)
+
+// The fields that the marks can be grouped by.
+const (
+	// GroupByNone puts all the marks in one group.
+	GroupByNone = ""
+	// GroupByBook groups the marks by their titles and authors.
+	GroupByBook   = "book"
+	GroupByAuthor = "author"
+	// GroupByTag groups the marks by each of their tags, the marks without tags are not counted.
+	GroupByTag  = "tag"
+	GroupByType = "type"
+	// GroupByChapter groups the marks by their books and the chapters of their locations,
+	// the marks without chapters are not counted.
+	GroupByChapter = "chapter"
+	// GroupByCreatedAt groups the marks by the buckets of their creation times in UTC, see the intervals.
+	GroupByCreatedAt = "createdAt"
+)
+
+var groupByFields = []string{GroupByBook, GroupByAuthor, GroupByTag, GroupByType, GroupByChapter, GroupByCreatedAt}
+
+// The intervals of the buckets of GroupByCreatedAt, the keys of the buckets are
+// "2006", "2006-01", "2006-W01" (the ISO week) and "2006-01-02".
+const (
+	IntervalYear  = "year"
+	IntervalMonth = "month"
+	IntervalWeek  = "week"
+	IntervalDay   = "day"
+)
+
+var intervals = []string{IntervalYear, IntervalMonth, IntervalWeek, IntervalDay}
+
+// AggregateOptions are the options of aggregating the marks.
+type AggregateOptions struct {
+	GroupBy string
+	// Interval is the size of the buckets of GroupByCreatedAt, IntervalMonth if empty.
+	Interval string
+	// Limit is the maximum number of groups to return, 0 or negative returns all.
+	Limit int
+}
+
+// Group is the statistics of a group of the marks.
+type Group struct {
+	// Key is the value of the field of the group, e.g. the tag, or the bucket of createdAt like "2022-01".
+	Key string `json:"key"`
+	// Title and Author are set for the groups of the books and the chapters.
+	Title  string `json:"title,omitempty"`
+	Author string `json:"author,omitempty"`
+	Count  int    `json:"count"`
+	// AverageLength is the average number of the characters of the highlights (the data), 0 if there isn't any.
+	AverageLength float64 `json:"averageLength"`
+}
+
+// Stats is the statistics of all the marks, and of their groups.
+type Stats struct {
+	Count         int      `json:"count"`
+	AverageLength float64  `json:"averageLength"`
+	Groups        []*Group `json:"groups"`
+}
+
+// GetStats returns the statistics of the marks that match the filter, the groups are only
+// returned if opts.GroupBy is set.
+func GetStats(ctx context.Context, store Storage, filter interface{}, opts *AggregateOptions) (*Stats, error) {
+	if err := ValidateAggregateOptions(opts); err != nil {
+		return nil, err
+	}
+	stats := &Stats{Groups: []*Group{}}
+	all, err := store.AggregateMarks(ctx, filter, &AggregateOptions{GroupBy: GroupByNone})
+	if err != nil {
+		return nil, err
+	}
+	if len(all) > 0 {
+		stats.Count, stats.AverageLength = all[0].Count, all[0].AverageLength
+	}
+	if opts.GroupBy == GroupByNone {
+		return stats, nil
+	}
+	groups, err := store.AggregateMarks(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	if groups != nil {
+		stats.Groups = groups
+	}
+	return stats, nil
+}
+
+// ValidateAggregateOptions checks the aggregate options, and fills the default interval.
+func ValidateAggregateOptions(opts *AggregateOptions) error {
+	if opts.GroupBy != GroupByNone && !contains(groupByFields, opts.GroupBy) {
+		return errors.New(fmt.Sprintf("unrecognized group by field %q, expecting one of %v", opts.GroupBy, groupByFields))
+	}
+	if opts.GroupBy != GroupByCreatedAt {
+		return nil
+	}
+	if opts.Interval == "" {
+		opts.Interval = IntervalMonth
+	}
+	if !contains(intervals, opts.Interval) {
+		return errors.New(fmt.Sprintf("unrecognized interval %q, expecting one of %v", opts.Interval, intervals))
+	}
+	return nil
+}
+
+// ParseGroupBy parses the field to group by, case-insensitive.
+func ParseGroupBy(field string) (string, error) {
+	for _, f := range groupByFields {
+		if strings.EqualFold(field, f) {
+			return f, nil
+		}
+	}
+	return "", errors.New(fmt.Sprintf("unrecognized group by field %q, expecting one of %v", field, groupByFields))
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// BucketKey returns the key of the bucket of the unix milliseconds in UTC.
+func BucketKey(msec int64, interval string) string {
+	t := time.Unix(msec/1000, (msec%1000)*int64(time.Millisecond)).UTC()
+	switch interval {
+	case IntervalYear:
+		return t.Format("2006")
+	case IntervalWeek:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	case IntervalDay:
+		return t.Format("2006-01-02")
+	default:
+		return t.Format("2006-01")
+	}
+}
+
+// sortGroups orders the buckets of createdAt by time, and the other groups by their counts
+// in the descending order, then by their keys, and truncates them to the limit.
+func sortGroups(groups []*Group, opts *AggregateOptions) []*Group {
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		if opts.GroupBy != GroupByCreatedAt && a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+		if a.Title != b.Title {
+			return a.Title < b.Title
+		}
+		return a.Author < b.Author
+	})
+	if opts.Limit > 0 && opts.Limit < len(groups) {
+		groups = groups[:opts.Limit]
+	}
+	return groups
+}
+
+// GroupMarks aggregates the marks in memory, for the storages that can't aggregate by themselves.
+func GroupMarks(marks []*model.Mark, opts *AggregateOptions) ([]*Group, error) {
+	if err := ValidateAggregateOptions(opts); err != nil {
+		return nil, err
+	}
+	type stats struct {
+		group    *Group
+		length   int
+		withData int
+	}
+	var groups []*stats
+	index := make(map[Group]*stats)
+	add := func(key Group, mark *model.Mark) {
+		st, ok := index[key]
+		if !ok {
+			group := key
+			st = &stats{group: &group}
+			index[key] = st
+			groups = append(groups, st)
+		}
+		st.group.Count++
+		if mark.Data != "" {
+			st.length += utf8.RuneCountInString(mark.Data)
+			st.withData++
+		}
+	}
+	for _, mark := range marks {
+		switch opts.GroupBy {
+		case GroupByNone:
+			add(Group{}, mark)
+		case GroupByBook:
+			add(Group{Key: mark.Title, Title: mark.Title, Author: mark.Author}, mark)
+		case GroupByAuthor:
+			add(Group{Key: mark.Author}, mark)
+		case GroupByTag:
+			for _, tag := range mark.Tags {
+				add(Group{Key: tag}, mark)
+			}
+		case GroupByType:
+			add(Group{Key: mark.Type}, mark)
+		case GroupByChapter:
+			if mark.Location != nil && mark.Location.Chapter != "" {
+				add(Group{Key: mark.Location.Chapter, Title: mark.Title, Author: mark.Author}, mark)
+			}
+		case GroupByCreatedAt:
+			if mark.CreatedAt != nil {
+				add(Group{Key: BucketKey(*mark.CreatedAt, opts.Interval)}, mark)
+			}
+		}
+	}
+
+	var ret []*Group
+	for _, st := range groups {
+		if st.withData > 0 {
+			st.group.AverageLength = float64(st.length) / float64(st.withData)
+		}
+		ret = append(ret, st.group)
+	}
+	return sortGroups(ret, opts), nil
+}
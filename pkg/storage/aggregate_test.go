@@ -0,0 +1,97 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/model"
+)
+
+func TestBucketKey(t *testing.T) {
+	// 2021-01-03T23:30:00Z, a Sunday in the last ISO week of 2020.
+	msec := int64(1609716600000)
+	tests := []struct {
+		interval string
+		key      string
+	}{
+		{interval: IntervalYear, key: "2021"},
+		{interval: IntervalMonth, key: "2021-01"},
+		{interval: IntervalWeek, key: "2020-W53"},
+		{interval: IntervalDay, key: "2021-01-03"},
+	}
+	for i, tt := range tests {
+		assert.Equal(t, tt.key, BucketKey(msec, tt.interval), "case #%d", i)
+	}
+}
+
+func TestGroupMarks(t *testing.T) {
+	jan, feb := int64(1609716600000), int64(1612395000000)
+	marks := []*model.Mark{
+		{Type: model.MarkTypeHighlight, Title: "T1", Author: "A", Data: "1234", Tags: []string{"x", "y"}, Location: &model.Location{Chapter: "C1"}, CreatedAt: &jan},
+		{Type: model.MarkTypeHighlight, Title: "T1", Author: "A", Data: "好好", Tags: []string{"x"}, Location: &model.Location{Chapter: "C1"}, CreatedAt: &feb},
+		{Type: model.MarkTypeNote, Title: "T1", Author: "A", UserNote: "n", Location: &model.Location{Chapter: "C2"}, CreatedAt: &feb},
+		{Type: model.MarkTypeHighlight, Title: "T2", Author: "B", Data: "123456", CreatedAt: &feb},
+		{Type: model.MarkTypeHighlight, Title: "T3", Author: "B", Data: "1"},
+	}
+	tests := []struct {
+		opts   *AggregateOptions
+		groups []*Group
+		err    bool
+	}{
+		{
+			opts:   &AggregateOptions{},
+			groups: []*Group{{Count: 5, AverageLength: 13.0 / 4}},
+		},
+		{
+			opts: &AggregateOptions{GroupBy: GroupByBook, Limit: 2},
+			groups: []*Group{
+				{Key: "T1", Title: "T1", Author: "A", Count: 3, AverageLength: 3},
+				{Key: "T2", Title: "T2", Author: "B", Count: 1, AverageLength: 6},
+			},
+		},
+		{
+			opts: &AggregateOptions{GroupBy: GroupByAuthor},
+			groups: []*Group{
+				{Key: "A", Count: 3, AverageLength: 3},
+				{Key: "B", Count: 2, AverageLength: 3.5},
+			},
+		},
+		{
+			opts: &AggregateOptions{GroupBy: GroupByTag},
+			groups: []*Group{
+				{Key: "x", Count: 2, AverageLength: 3},
+				{Key: "y", Count: 1, AverageLength: 4},
+			},
+		},
+		{
+			opts: &AggregateOptions{GroupBy: GroupByChapter},
+			groups: []*Group{
+				{Key: "C1", Title: "T1", Author: "A", Count: 2, AverageLength: 3},
+				{Key: "C2", Title: "T1", Author: "A", Count: 1},
+			},
+		},
+		{
+			opts: &AggregateOptions{GroupBy: GroupByCreatedAt},
+			groups: []*Group{
+				{Key: "2021-01", Count: 1, AverageLength: 4},
+				{Key: "2021-02", Count: 3, AverageLength: 4},
+			},
+		},
+		{opts: &AggregateOptions{GroupBy: "page"}, err: true},
+		{opts: &AggregateOptions{GroupBy: GroupByCreatedAt, Interval: "hour"}, err: true},
+	}
+	for i, tt := range tests {
+		groups, err := GroupMarks(marks, tt.opts)
+		if tt.err {
+			assert.Error(t, err, "case #%d", i)
+			continue
+		}
+		assert.NoError(t, err, "case #%d", i)
+		assert.Equal(t, tt.groups, groups, "case #%d", i)
+	}
+}
@@ -0,0 +1,22 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package storage
+
+import (
+	"github.com/pkg/errors"
+)
+
+// The errors of the storages, which are wrapped with the details, use errors.Is to check them.
+var (
+	// ErrNotFound is returned if the mark of the id doesn't exist.
+	ErrNotFound = errors.New("mark not found")
+	// ErrInvalidID is returned if the id is not in the format of the storage.
+	ErrInvalidID = errors.New("invalid mark id")
+	// ErrConflict is returned if the mark conflicts with an existing one, e.g. of the same id.
+	ErrConflict = errors.New("mark already exists")
+	// ErrRevisionNotFound is returned if the revision of the mark doesn't exist.
+	ErrRevisionNotFound = errors.New("revision not found")
+)
@@ -8,58 +8,105 @@ package storage
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"sort"
 	"strings"
 
-	"github.com/spf13/cobra"
+	"github.com/pkg/errors"
 	"github.com/yifan-gu/blueNote/pkg/model"
-	"github.com/yifan-gu/blueNote/pkg/util"
+	"github.com/yifan-gu/blueNote/pkg/option"
 )
 
-var registeredStorages map[string]Storage
-
 type Storage interface {
 	Name() string
-	LoadConfigs(cmd *cobra.Command)
+	// Options returns the options of the storage, which are bound to its fields.
+	Options() []*option.Option
 	Connect(ctx context.Context) error
+	// Ping checks whether the storage is connected and reachable.
+	Ping(ctx context.Context) error
 	CreateMark(ctx context.Context, mark *model.Mark) (id string, err error)
-	GetMarks(ctx context.Context, filter interface{}, limit int) ([]*model.Mark, error)
-	UpdateMarks(ctx context.Context, filter interface{}, update *model.Mark) (ids []string, err error)
-	UpdateOneMark(ctx context.Context, id string, update *model.Mark) error
+	// GetMarks returns the marks that match the filter, opts can be nil to return all of them.
+	GetMarks(ctx context.Context, filter interface{}, opts *QueryOptions) ([]*model.Mark, error)
+	CountMarks(ctx context.Context, filter interface{}) (int, error)
+	// AggregateMarks groups the marks that match the filter, and returns the statistics of the groups.
+	AggregateMarks(ctx context.Context, filter interface{}, opts *AggregateOptions) ([]*Group, error)
+	// UpdateMarks and UpdateOneMark set the fields in the mask of the patch, and clear the ones with empty values.
+	UpdateMarks(ctx context.Context, filter interface{}, patch *model.MarkPatch) (ids []string, err error)
+	UpdateOneMark(ctx context.Context, id string, patch *model.MarkPatch) error
+	// DeleteMarks and DeleteOneMark move the marks to the trash, where they are hidden from the other
+	// operations until they are restored or purged.
 	DeleteMarks(ctx context.Context, filter interface{}) (int, error)
 	DeleteOneMark(ctx context.Context, id string) error
+	// GetDeletedMarks returns the marks in the trash that match the filter, opts can be nil to return all of them.
+	GetDeletedMarks(ctx context.Context, filter interface{}, opts *QueryOptions) ([]*model.Mark, error)
+	// RestoreMarks moves the marks in the trash that match the filter back.
+	RestoreMarks(ctx context.Context, filter interface{}) (ids []string, err error)
+	// PurgeMarks permanently deletes the marks in the trash that match the filter, with their revisions.
+	PurgeMarks(ctx context.Context, filter interface{}) (int, error)
+	// GetRevisions returns the revisions recorded by the updates of the mark, from the oldest.
+	GetRevisions(ctx context.Context, id string) ([]*model.Revision, error)
+	// RevertMark undoes the revision of the mark and the ones after it, which records a new revision.
+	RevertMark(ctx context.Context, id, revisionID string) error
 	Close(ctx context.Context) error
 }
 
-func RegisterStorage(storage Storage) {
+// Registry holds the storages by their names.
+type Registry struct {
+	storages map[string]Storage
+}
+
+func NewRegistry() *Registry {
+	return &Registry{storages: make(map[string]Storage)}
+}
+
+func (r *Registry) Register(storage Storage) error {
 	name := strings.ToLower(storage.Name())
-	if registeredStorages == nil {
-		registeredStorages = make(map[string]Storage)
+	if _, ok := r.storages[name]; ok {
+		return errors.New(fmt.Sprintf("Name conflict for storage %q", name))
 	}
-	if _, ok := registeredStorages[name]; ok {
-		util.Fatal(fmt.Errorf("Name conflict for storage %q", name))
-	}
-	registeredStorages[name] = storage
+	r.storages[name] = storage
+	return nil
 }
 
-func GetStorages(name string) Storage {
+func (r *Registry) Get(name string) (Storage, error) {
 	name = strings.ToLower(name)
-	storage, ok := registeredStorages[name]
+	storage, ok := r.storages[name]
 	if !ok {
-		util.Fatal(fmt.Errorf("unrecognized storage type: %q", name))
+		return nil, errors.New(fmt.Sprintf("unrecognized storage type: %q", name))
 	}
-	return storage
+	return storage, nil
 }
 
-func ListStorages() []string {
+func (r *Registry) List() []string {
 	var names []string
-	for _, storage := range registeredStorages {
+	for _, storage := range r.storages {
 		names = append(names, storage.Name())
 	}
+	sort.Strings(names)
 	return names
 }
 
-func LoadConfigs(cmd *cobra.Command) {
-	for _, storage := range registeredStorages {
-		storage.LoadConfigs(cmd)
+// Options returns the options of all the storages.
+func (r *Registry) Options() []*option.Option {
+	var opts []*option.Option
+	for _, name := range r.List() {
+		opts = append(opts, r.storages[strings.ToLower(name)].Options()...)
+	}
+	return opts
+}
+
+// New creates a new instance of the storage with the options of the registered one, overridden by the values,
+// so it can be configured without affecting the registered one, e.g. per http request.
+func (r *Registry) New(name string, values map[string]string) (Storage, error) {
+	storage, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	instance := reflect.New(reflect.TypeOf(storage).Elem()).Interface().(Storage)
+	opts := instance.Options()
+	option.Copy(opts, storage.Options())
+	if err := option.Apply(opts, values); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("invalid options for storage %q", name))
 	}
+	return instance, nil
 }
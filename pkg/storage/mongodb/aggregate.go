@@ -0,0 +1,116 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package mongodb
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// bucketFormats are the formats of $dateToString for the intervals, the same as storage.BucketKey.
+var bucketFormats = map[string]string{
+	storage.IntervalYear:  "%Y",
+	storage.IntervalMonth: "%Y-%m",
+	storage.IntervalWeek:  "%G-W%V",
+	storage.IntervalDay:   "%Y-%m-%d",
+}
+
+// groupResult is a document of the output of the aggregation.
+type groupResult struct {
+	ID struct {
+		Key    string `bson:"key"`
+		Title  string `bson:"title"`
+		Author string `bson:"author"`
+	} `bson:"_id"`
+	Count int `bson:"count"`
+	// AverageLength is null if none of the marks has data.
+	AverageLength *float64 `bson:"averageLength"`
+}
+
+func (s *MongoDBStorage) AggregateMarks(ctx context.Context, filter interface{}, opts *storage.AggregateOptions) ([]*storage.Group, error) {
+	filterVal, err := parseTrashFilter(filter, false)
+	if err != nil {
+		return nil, err
+	}
+	pipeline, err := constructAggregatePipeline(filterVal, opts)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := s.coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	var groups []*storage.Group
+	for cur.Next(ctx) {
+		var result groupResult
+		if err := cur.Decode(&result); err != nil {
+			return nil, errors.Wrap(err, "")
+		}
+		group := &storage.Group{Key: result.ID.Key, Title: result.ID.Title, Author: result.ID.Author, Count: result.Count}
+		if result.AverageLength != nil {
+			group.AverageLength = *result.AverageLength
+		}
+		groups = append(groups, group)
+	}
+	if err := cur.Err(); err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	return groups, nil
+}
+
+// constructAggregatePipeline constructs the pipeline that groups the marks, the groups are ordered in the same
+// way as storage.GroupMarks, the _id of a group is a document of the key (and the title and the author of the book).
+func constructAggregatePipeline(filter bson.M, opts *storage.AggregateOptions) ([]bson.M, error) {
+	if err := storage.ValidateAggregateOptions(opts); err != nil {
+		return nil, err
+	}
+	pipeline := []bson.M{{"$match": filter}}
+	book := bson.D{{Key: "title", Value: "$title"}, {Key: "author", Value: "$author"}}
+	var id bson.D
+	switch opts.GroupBy {
+	case storage.GroupByNone:
+		id = bson.D{{Key: "key", Value: bson.M{"$literal": ""}}}
+	case storage.GroupByBook:
+		id = append(bson.D{{Key: "key", Value: "$title"}}, book...)
+	case storage.GroupByAuthor:
+		id = bson.D{{Key: "key", Value: "$author"}}
+	case storage.GroupByTag:
+		pipeline = append(pipeline, bson.M{"$unwind": "$tags"})
+		id = bson.D{{Key: "key", Value: "$tags"}}
+	case storage.GroupByType:
+		id = bson.D{{Key: "key", Value: "$type"}}
+	case storage.GroupByChapter:
+		pipeline = append(pipeline, bson.M{"$match": bson.M{"location.chapter": bson.M{"$nin": bson.A{nil, ""}}}})
+		id = append(bson.D{{Key: "key", Value: "$location.chapter"}}, book...)
+	case storage.GroupByCreatedAt:
+		pipeline = append(pipeline, bson.M{"$match": bson.M{"createdAt": bson.M{"$ne": nil}}})
+		id = bson.D{{Key: "key", Value: bson.M{"$dateToString": bson.M{
+			"format": bucketFormats[opts.Interval],
+			"date":   bson.M{"$toDate": "$createdAt"},
+		}}}}
+	}
+
+	length := bson.M{"$strLenCP": bson.M{"$ifNull": bson.A{"$data", ""}}}
+	pipeline = append(pipeline, bson.M{"$group": bson.M{
+		"_id":   id,
+		"count": bson.M{"$sum": 1},
+		// $avg skips the nulls, so the marks without data are not counted.
+		"averageLength": bson.M{"$avg": bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{length, 0}}, length, nil}}},
+	}})
+
+	sort := bson.D{{Key: "_id", Value: 1}}
+	if opts.GroupBy != storage.GroupByCreatedAt {
+		sort = append(bson.D{{Key: "count", Value: -1}}, sort...)
+	}
+	pipeline = append(pipeline, bson.M{"$sort": sort})
+	if opts.Limit > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": opts.Limit})
+	}
+	return pipeline, nil
+}
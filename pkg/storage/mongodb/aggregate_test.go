@@ -0,0 +1,83 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package mongodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestConstructAggregatePipeline(t *testing.T) {
+	filter := bson.M{"author": "A"}
+	length := bson.M{"$strLenCP": bson.M{"$ifNull": bson.A{"$data", ""}}}
+	group := func(id bson.D) bson.M {
+		return bson.M{"$group": bson.M{
+			"_id":           id,
+			"count":         bson.M{"$sum": 1},
+			"averageLength": bson.M{"$avg": bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{length, 0}}, length, nil}}},
+		}}
+	}
+	byCount := bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}
+
+	tests := []struct {
+		opts     *storage.AggregateOptions
+		pipeline []bson.M
+		err      bool
+	}{
+		{
+			opts: &storage.AggregateOptions{},
+			pipeline: []bson.M{
+				{"$match": filter},
+				group(bson.D{{Key: "key", Value: bson.M{"$literal": ""}}}),
+				byCount,
+			},
+		},
+		{
+			opts: &storage.AggregateOptions{GroupBy: storage.GroupByTag, Limit: 10},
+			pipeline: []bson.M{
+				{"$match": filter},
+				{"$unwind": "$tags"},
+				group(bson.D{{Key: "key", Value: "$tags"}}),
+				byCount,
+				{"$limit": 10},
+			},
+		},
+		{
+			opts: &storage.AggregateOptions{GroupBy: storage.GroupByChapter},
+			pipeline: []bson.M{
+				{"$match": filter},
+				{"$match": bson.M{"location.chapter": bson.M{"$nin": bson.A{nil, ""}}}},
+				group(bson.D{{Key: "key", Value: "$location.chapter"}, {Key: "title", Value: "$title"}, {Key: "author", Value: "$author"}}),
+				byCount,
+			},
+		},
+		{
+			opts: &storage.AggregateOptions{GroupBy: storage.GroupByCreatedAt, Interval: storage.IntervalWeek},
+			pipeline: []bson.M{
+				{"$match": filter},
+				{"$match": bson.M{"createdAt": bson.M{"$ne": nil}}},
+				group(bson.D{{Key: "key", Value: bson.M{"$dateToString": bson.M{"format": "%G-W%V", "date": bson.M{"$toDate": "$createdAt"}}}}}),
+				{"$sort": bson.D{{Key: "_id", Value: 1}}},
+			},
+		},
+		{
+			opts: &storage.AggregateOptions{GroupBy: "unknown"},
+			err:  true,
+		},
+	}
+	for i, tt := range tests {
+		pipeline, err := constructAggregatePipeline(filter, tt.opts)
+		if tt.err {
+			assert.Error(t, err, "case #%d", i)
+			continue
+		}
+		assert.NoError(t, err, "case #%d", i)
+		assert.Equal(t, tt.pipeline, pipeline, "case #%d", i)
+	}
+}
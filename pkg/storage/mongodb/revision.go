@@ -0,0 +1,213 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/pkg/errors"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+	"github.com/yifan-gu/blueNote/pkg/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PersistentRevision defines the details of a revision object that will be stored in the revisions collection.
+type PersistentRevision struct {
+	ID        primitive.ObjectID  `bson:"_id"`
+	MarkID    primitive.ObjectID  `bson:"markId"`
+	Changes   []*PersistentChange `bson:"changes"`
+	Actor     string              `bson:"actor,omitempty"`
+	CreatedAt int64               `bson:"createdAt"`
+}
+
+// PersistentChange is the change of a field in a revision, the field is the key of the document, e.g. "location.page".
+type PersistentChange struct {
+	Field string      `bson:"field"`
+	Old   interface{} `bson:"old"`
+	New   interface{} `bson:"new"`
+}
+
+// PersistentRevisionToRevision converts a PersistentRevision to a Revision.
+func PersistentRevisionToRevision(pr *PersistentRevision) *model.Revision {
+	revision := &model.Revision{
+		ID:        pr.ID.Hex(),
+		MarkID:    pr.MarkID.Hex(),
+		Changes:   []*model.Change{},
+		Actor:     pr.Actor,
+		CreatedAt: pr.CreatedAt,
+	}
+	for _, c := range pr.Changes {
+		revision.Changes = append(revision.Changes, &model.Change{Field: c.Field, Old: normalizeValue(c.Old), New: normalizeValue(c.New)})
+	}
+	return revision
+}
+
+// normalizeValue converts a value of a field to the type of model.Change.
+func normalizeValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case *int:
+		if v == nil {
+			return nil
+		}
+		return *v
+	case primitive.A:
+		tags := []string{}
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				tags = append(tags, s)
+			}
+		}
+		return tags
+	case string:
+		if v == "" {
+			return nil
+		}
+		return v
+	default:
+		return val
+	}
+}
+
+// changesFromUpdate returns the changes of the fields set or unset by the update, see constructUpdateFromPatch.
+func changesFromUpdate(original *model.Mark, update bson.M) []*PersistentChange {
+	set, _ := update["$set"].(bson.M)
+	unset, _ := update["$unset"].(bson.M)
+	old := model.FieldValues(original)
+	var changes []*PersistentChange
+	for _, field := range model.MarkFields {
+		if val, ok := set[field]; ok {
+			changes = append(changes, &PersistentChange{Field: field, Old: old[field], New: normalizeValue(val)})
+		} else if _, ok := unset[field]; ok {
+			changes = append(changes, &PersistentChange{Field: field, Old: old[field], New: nil})
+		}
+	}
+	return changes
+}
+
+// recordRevision records the changes of the mark as a revision, nothing is recorded if there isn't any change.
+func (s *MongoDBStorage) recordRevision(ctx context.Context, markID primitive.ObjectID, changes []*PersistentChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	revision := &PersistentRevision{
+		ID:        primitive.NewObjectID(),
+		MarkID:    markID,
+		Changes:   changes,
+		Actor:     storage.ActorFromContext(ctx),
+		CreatedAt: util.NowUnixMilli(),
+	}
+	if _, err := s.revisions.InsertOne(ctx, revision); err != nil {
+		return errors.Wrap(err, "failed to record the revision")
+	}
+	return nil
+}
+
+func (s *MongoDBStorage) GetRevisions(ctx context.Context, id string) ([]*model.Revision, error) {
+	objectID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	sort := bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}
+	cur, err := s.revisions.Find(ctx, bson.M{"markId": objectID}, options.Find().SetSort(sort))
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	var result []*model.Revision
+	for cur.Next(ctx) {
+		var revision PersistentRevision
+		if err := cur.Decode(&revision); err != nil {
+			return nil, errors.Wrap(err, "")
+		}
+		result = append(result, PersistentRevisionToRevision(&revision))
+	}
+	if err := cur.Err(); err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	return result, nil
+}
+
+func (s *MongoDBStorage) RevertMark(ctx context.Context, id, revisionID string) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	marks, err := s.GetMarks(ctx, bson.M{"_id": objectID}, nil)
+	if err != nil {
+		return err
+	}
+	if len(marks) == 0 {
+		return errors.Wrap(storage.ErrNotFound, fmt.Sprintf("mark %q", id))
+	}
+	revisions, err := s.GetRevisions(ctx, id)
+	if err != nil {
+		return err
+	}
+	update, changes, err := constructRevert(marks[0], revisions, revisionID)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	if _, err := s.coll.UpdateByID(ctx, objectID, update); err != nil {
+		return errors.Wrap(err, "")
+	}
+	return s.recordRevision(ctx, objectID, changes)
+}
+
+// constructRevert constructs the update that restores the values of the fields before the revision and the ones after it.
+func constructRevert(mark *model.Mark, revisions []*model.Revision, revisionID string) (bson.M, []*PersistentChange, error) {
+	start := -1
+	for i, revision := range revisions {
+		if revision.ID == revisionID {
+			start = i
+		}
+	}
+	if start < 0 {
+		return nil, nil, errors.Wrap(storage.ErrRevisionNotFound, fmt.Sprintf("revision %q of mark %q", revisionID, mark.ID))
+	}
+	// Undo the revisions from the latest, so the oldest value of a field wins.
+	values := make(map[string]interface{})
+	for i := len(revisions) - 1; i >= start; i-- {
+		for _, change := range revisions[i].Changes {
+			values[change.Field] = change.Old
+		}
+	}
+
+	current := model.FieldValues(mark)
+	set, unset := bson.M{}, bson.M{}
+	var changes []*PersistentChange
+	for _, field := range model.MarkFields {
+		val, ok := values[field]
+		if !ok || reflect.DeepEqual(val, current[field]) {
+			continue
+		}
+		if val == nil {
+			unset[field] = ""
+		} else {
+			set[field] = val
+		}
+		changes = append(changes, &PersistentChange{Field: field, Old: current[field], New: val})
+	}
+	if len(changes) == 0 {
+		return nil, nil, nil
+	}
+	set["lastModifiedAt"] = util.NowUnixMilli()
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return update, changes, nil
+}
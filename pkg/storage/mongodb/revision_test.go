@@ -0,0 +1,103 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package mongodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestChangesFromUpdate(t *testing.T) {
+	page := 10
+	original := &model.Mark{Type: model.MarkTypeNote, Title: "T", Author: "A", UserNote: "old", Tags: []string{"b", "a"}}
+	update := &model.Mark{UserNote: "new", Location: &model.Location{Page: &page}, Tags: []string{"c"}}
+	changes := changesFromUpdate(original, constructUpdateFromPatch(original, &model.MarkPatch{Mark: update, Fields: []string{"location.page", "note", "tags"}}))
+	assert.Equal(t, []*PersistentChange{
+		{Field: "location.page", Old: nil, New: 10},
+		{Field: "note", Old: "old", New: "new"},
+		{Field: "tags", Old: []string{"b", "a"}, New: []string{"c"}},
+	}, changes)
+
+	assert.Nil(t, changesFromUpdate(original, constructUpdateFromPatch(original, &model.MarkPatch{Mark: &model.Mark{Title: "T"}, Fields: []string{"title"}})))
+
+	patch := &model.MarkPatch{Mark: &model.Mark{}, Fields: []string{"note", "section"}}
+	assert.Equal(t, []*PersistentChange{{Field: "note", Old: "old", New: nil}}, changesFromUpdate(original, constructUpdateFromPatch(original, patch)))
+}
+
+func TestPersistentRevisionToRevision(t *testing.T) {
+	id, markID := primitive.NewObjectID(), primitive.NewObjectID()
+	b, err := bson.Marshal(&PersistentRevision{ID: id, MarkID: markID, Actor: "alice", CreatedAt: 1, Changes: []*PersistentChange{
+		{Field: "location.page", Old: nil, New: 10},
+		{Field: "tags", Old: []string{"a"}, New: []string{}},
+	}})
+	assert.NoError(t, err)
+	var pr PersistentRevision
+	assert.NoError(t, bson.Unmarshal(b, &pr))
+	assert.Equal(t, &model.Revision{ID: id.Hex(), MarkID: markID.Hex(), Actor: "alice", CreatedAt: 1, Changes: []*model.Change{
+		{Field: "location.page", Old: nil, New: 10},
+		{Field: "tags", Old: []string{"a"}, New: []string{}},
+	}}, PersistentRevisionToRevision(&pr))
+}
+
+func TestConstructRevert(t *testing.T) {
+	page := 10
+	mark := &model.Mark{ID: "m", Type: model.MarkTypeNote, Title: "T", Author: "A", UserNote: "v3", Location: &model.Location{Page: &page}, Tags: []string{"x"}}
+	revisions := []*model.Revision{
+		{ID: "r1", Changes: []*model.Change{{Field: "note", Old: "v1", New: "v2"}}},
+		{ID: "r2", Changes: []*model.Change{{Field: "note", Old: "v2", New: "v3"}, {Field: "location.page", Old: nil, New: 10}}},
+		{ID: "r3", Changes: []*model.Change{{Field: "tags", Old: nil, New: []string{"x"}}}},
+	}
+
+	tests := []struct {
+		revision string
+		set      bson.M
+		unset    bson.M
+		changes  []*PersistentChange
+	}{
+		{
+			revision: "r3",
+			unset:    bson.M{"tags": ""},
+			changes:  []*PersistentChange{{Field: "tags", Old: []string{"x"}, New: nil}},
+		},
+		{
+			revision: "r1",
+			set:      bson.M{"note": "v1"},
+			unset:    bson.M{"location.page": "", "tags": ""},
+			changes: []*PersistentChange{
+				{Field: "location.page", Old: 10, New: nil},
+				{Field: "note", Old: "v3", New: "v1"},
+				{Field: "tags", Old: []string{"x"}, New: nil},
+			},
+		},
+	}
+	for i, tt := range tests {
+		update, changes, err := constructRevert(mark, revisions, tt.revision)
+		assert.NoError(t, err, "case #%d", i)
+		set := update["$set"].(bson.M)
+		assert.NotNil(t, set["lastModifiedAt"], "case #%d", i)
+		delete(set, "lastModifiedAt")
+		if tt.set == nil {
+			tt.set = bson.M{}
+		}
+		assert.Equal(t, tt.set, set, "case #%d", i)
+		assert.Equal(t, tt.unset, update["$unset"], "case #%d", i)
+		assert.Equal(t, tt.changes, changes, "case #%d", i)
+	}
+
+	_, _, err := constructRevert(mark, revisions, "r4")
+	assert.ErrorIs(t, err, storage.ErrRevisionNotFound)
+
+	// Nothing to revert if the values are the same.
+	update, changes, err := constructRevert(&model.Mark{ID: "m", UserNote: "v2"}, revisions[1:2], "r2")
+	assert.NoError(t, err)
+	assert.Nil(t, update)
+	assert.Nil(t, changes)
+}
@@ -9,11 +9,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"sort"
 
 	"github.com/pkg/errors"
-	"github.com/spf13/cobra"
+	"github.com/yifan-gu/blueNote/pkg/config"
 	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/option"
 	"github.com/yifan-gu/blueNote/pkg/storage"
 	"github.com/yifan-gu/blueNote/pkg/util"
 	"go.mongodb.org/mongo-driver/bson"
@@ -40,32 +42,61 @@ type PersistentMark struct {
 	Data           string             `bson:"data,omitempty"`
 	UserNote       string             `bson:"note,omitempty"`
 	Tags           []string           `bson:"tags,omitempty"`
+	Owner          string             `bson:"owner,omitempty"`
 	CreatedAt      *int64             `bson:"createdAt"`
 	LastModifiedAt *int64             `bson:"lastModifiedAt"`
+	DeletedAt      *int64             `bson:"deletedAt,omitempty"`
 }
 
 type MongoDBStorage struct {
 	cfg    *Config
 	client *mongo.Client
 	coll   *mongo.Collection
+	// revisions is the collection of the revisions of the marks.
+	revisions *mongo.Collection
 }
 
 type Config struct {
 	Username       string
 	Password       string
+	PasswordFile   string
 	Host           string
 	ConnOpt        string
 	DBName         string
 	CollectionName string
+	// RevisionsCollectionName is the collection of the revisions of the marks.
+	RevisionsCollectionName string
 }
 
-func (c *Config) constructConnectionURI() string {
+// Options returns the options of the mongodb connection, they are shared by the storage and the exporter.
+func (c *Config) Options() []*option.Option {
+	return []*option.Option{
+		{Name: "mongodb.username", Target: &c.Username, Description: "username of the mongodb"},
+		{Name: "mongodb.password", Target: &c.Password, Description: "password of the mongodb"},
+		{Name: "mongodb.password-file", Target: &c.PasswordFile, Description: "the file to read the password of the mongodb from, used if --mongodb.password is not set"},
+		{Name: "mongodb.host", Target: &c.Host, Default: "localhost:27017", Description: "host of the mongodb"},
+		{Name: "mongodb.conn-opt", Target: &c.ConnOpt, Description: "connection option of the mongodb"},
+		{Name: "mongodb.database", Target: &c.DBName, Default: "bluenote", Description: "database to use in the mongodb"},
+		{Name: "mongodb.collection", Target: &c.CollectionName, Default: "marks", Description: "the collection to use in the mongodb"},
+		{Name: "mongodb.revisions-collection", Target: &c.RevisionsCollectionName, Default: "revisions", Description: "the collection of the revisions of the marks in the mongodb"},
+	}
+}
+
+func (c *Config) constructConnectionURI() (string, error) {
+	password := c.Password
+	if password == "" && c.PasswordFile != "" {
+		secret, err := config.ReadSecretFile(c.PasswordFile)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to read the password file of the mongodb")
+		}
+		password = secret
+	}
 	uri := "mongodb://"
-	if c.Username != "" && c.Password != "" {
-		uri += fmt.Sprintf("%s:%s@", c.Username, c.Password)
+	if c.Username != "" && password != "" {
+		uri += url.UserPassword(c.Username, password).String() + "@"
 	}
 	uri += fmt.Sprintf("%s/?%s", c.Host, c.ConnOpt)
-	return uri
+	return uri, nil
 }
 
 func NewMongoDBStorage(ctx context.Context, cfg *Config) storage.Storage {
@@ -76,20 +107,19 @@ func (s *MongoDBStorage) Name() string {
 	return "mongodb"
 }
 
-func (s *MongoDBStorage) LoadConfigs(cmd *cobra.Command) {
+func (s *MongoDBStorage) Options() []*option.Option {
 	if s.cfg == nil {
 		s.cfg = &Config{}
 	}
-	cmd.PersistentFlags().StringVar(&s.cfg.Username, "mongodb.username", "", "username of the mongodb")
-	cmd.PersistentFlags().StringVar(&s.cfg.Password, "mongodb.password", "", "password of the mongodb")
-	cmd.PersistentFlags().StringVar(&s.cfg.Host, "mongodb.host", "localhost:27017", "host of the mongodb")
-	cmd.PersistentFlags().StringVar(&s.cfg.ConnOpt, "mongodb.conn-opt", "", "connection option of the mongodb")
-	cmd.PersistentFlags().StringVar(&s.cfg.DBName, "mongodb.database", "bluenote", "database to use in the mongodb")
-	cmd.PersistentFlags().StringVar(&s.cfg.CollectionName, "mongodb.collection", "marks", "the collection to use in the mongodb")
+	return s.cfg.Options()
 }
 
 func (s *MongoDBStorage) Connect(ctx context.Context) error {
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(s.cfg.constructConnectionURI()))
+	uri, err := s.cfg.constructConnectionURI()
+	if err != nil {
+		return err
+	}
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
 	if err != nil {
 		return errors.Wrap(err, "")
 	}
@@ -98,9 +128,24 @@ func (s *MongoDBStorage) Connect(ctx context.Context) error {
 	}
 	s.client = client
 	s.coll = client.Database(s.cfg.DBName).Collection(s.cfg.CollectionName)
+	s.revisions = client.Database(s.cfg.DBName).Collection(s.cfg.RevisionsCollectionName)
+	// The revisions are looked up and deleted by their marks, and listed in the order of creation.
+	// Creating an existing index is a no-op.
+	if _, err := s.revisions.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "markId", Value: 1}, {Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}},
+	}); err != nil {
+		return errors.Wrap(err, "failed to create the index of the revisions")
+	}
 	return nil
 }
 
+func (s *MongoDBStorage) Ping(ctx context.Context) error {
+	if s.client == nil {
+		return errors.New("mongodb is not connected")
+	}
+	return errors.Wrap(s.client.Ping(ctx, nil), "")
+}
+
 func (s *MongoDBStorage) CreateMark(ctx context.Context, mark *model.Mark) (string, error) {
 	pm, err := MarkToPersistentMark(mark)
 	if err != nil {
@@ -110,23 +155,60 @@ func (s *MongoDBStorage) CreateMark(ctx context.Context, mark *model.Mark) (stri
 	pm.CreatedAt = &now
 	pm.LastModifiedAt = &now
 	result, err := s.coll.InsertOne(ctx, pm)
+	if mongo.IsDuplicateKeyError(err) {
+		return "", errors.Wrap(storage.ErrConflict, fmt.Sprintf("mark %q", pm.ID.Hex()))
+	}
 	if err != nil {
 		return "", errors.Wrap(err, "")
 	}
 	return result.InsertedID.(primitive.ObjectID).Hex(), nil
 }
 
-func (s *MongoDBStorage) GetMarks(ctx context.Context, filter interface{}, limit int) ([]*model.Mark, error) {
+// withTrash adds the condition of whether the marks are in the trash to the filter.
+func withTrash(filter bson.M, inTrash bool) bson.M {
+	return bson.M{"$and": bson.A{filter, bson.M{"deletedAt": bson.M{"$exists": inTrash}}}}
+}
+
+// parseTrashFilter parses the filter, and adds the condition of whether the marks are in the trash.
+func parseTrashFilter(filter interface{}, inTrash bool) (bson.M, error) {
 	filterVal, err := parseFilter(filter)
 	if err != nil {
 		return nil, err
 	}
+	return withTrash(filterVal, inTrash), nil
+}
 
-	var result []*model.Mark
-	if limit < 0 {
-		limit = 0
+func (s *MongoDBStorage) GetMarks(ctx context.Context, filter interface{}, opts *storage.QueryOptions) ([]*model.Mark, error) {
+	filterVal, err := parseTrashFilter(filter, false)
+	if err != nil {
+		return nil, err
 	}
-	cur, err := s.coll.Find(ctx, filterVal, options.Find().SetLimit(int64(limit)))
+	return s.findMarks(ctx, filterVal, opts)
+}
+
+func (s *MongoDBStorage) GetDeletedMarks(ctx context.Context, filter interface{}, opts *storage.QueryOptions) ([]*model.Mark, error) {
+	filterVal, err := parseTrashFilter(filter, true)
+	if err != nil {
+		return nil, err
+	}
+	return s.findMarks(ctx, filterVal, opts)
+}
+
+func (s *MongoDBStorage) findMarks(ctx context.Context, filterVal bson.M, opts *storage.QueryOptions) ([]*model.Mark, error) {
+	findOpts, err := constructFindOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts != nil && opts.After != nil {
+		after, err := constructAfterFilter(opts.After, opts.Sort)
+		if err != nil {
+			return nil, err
+		}
+		filterVal = bson.M{"$and": bson.A{filterVal, after}}
+	}
+
+	var result []*model.Mark
+	cur, err := s.coll.Find(ctx, filterVal, findOpts)
 	if err != nil {
 		return nil, errors.Wrap(err, "")
 	}
@@ -143,9 +225,110 @@ func (s *MongoDBStorage) GetMarks(ctx context.Context, filter interface{}, limit
 	return result, nil
 }
 
-func (s *MongoDBStorage) UpdateMarks(ctx context.Context, filter interface{}, update *model.Mark) ([]string, error) {
+func (s *MongoDBStorage) CountMarks(ctx context.Context, filter interface{}) (int, error) {
+	filterVal, err := parseTrashFilter(filter, false)
+	if err != nil {
+		return 0, err
+	}
+	count, err := s.coll.CountDocuments(ctx, filterVal)
+	if err != nil {
+		return 0, errors.Wrap(err, "")
+	}
+	return int(count), nil
+}
+
+// sortKeys maps the sort fields to the document keys.
+var sortKeys = map[string][]string{
+	storage.SortByCreatedAt:      {"createdAt"},
+	storage.SortByLastModifiedAt: {"lastModifiedAt"},
+	storage.SortByTitle:          {"title"},
+	storage.SortByLocation:       {"location.page", "location.location"},
+}
+
+func constructFindOptions(opts *storage.QueryOptions) (*options.FindOptions, error) {
+	findOpts := options.Find()
+	if opts == nil {
+		return findOpts, nil
+	}
+	if err := storage.ValidateQueryOptions(opts); err != nil {
+		return nil, err
+	}
+	if opts.Limit > 0 {
+		findOpts.SetLimit(int64(opts.Limit))
+	}
+	if opts.Skip > 0 {
+		findOpts.SetSkip(int64(opts.Skip))
+	}
+	// The pages are only stable in a defined order, so they are at least sorted by the ID.
+	if len(opts.Sort) > 0 || opts.Limit > 0 || opts.Skip > 0 || opts.After != nil {
+		sort := bson.D{}
+		for _, s := range opts.Sort {
+			order := 1
+			if s.Descending {
+				order = -1
+			}
+			for _, key := range sortKeys[s.Field] {
+				sort = append(sort, bson.E{Key: key, Value: order})
+			}
+		}
+		// Break the ties with the ID so the pages are stable.
+		sort = append(sort, bson.E{Key: "_id", Value: 1})
+		findOpts.SetSort(sort)
+	}
+	return findOpts, nil
+}
+
+// constructAfterFilter matches the marks after the mark in the order of the sort keys and the ID, i.e. the ones
+// that have the same values for the first keys and a value after the mark's for the next key.
+// The missing values are sorted first, and can't be compared with $gt or $lt, so they are matched by null.
+func constructAfterFilter(mark *model.Mark, sorts []storage.Sort) (bson.M, error) {
+	id, err := parseID(mark.ID)
+	if err != nil {
+		return nil, err
+	}
+	type keyValue struct {
+		key        string
+		value      interface{}
+		descending bool
+	}
+	var keys []keyValue
+	for _, s := range sorts {
+		values := storage.SortValues(mark, s.Field)
+		for i, key := range sortKeys[s.Field] {
+			keys = append(keys, keyValue{key: key, value: values[i], descending: s.Descending})
+		}
+	}
+	keys = append(keys, keyValue{key: "_id", value: id})
+
+	var or bson.A
+	for i, kv := range keys {
+		var after bson.M
+		switch {
+		case kv.value == nil && kv.descending:
+			// Nothing is after the missing values in the descending order.
+			continue
+		case kv.value == nil:
+			after = bson.M{kv.key: bson.M{"$ne": nil}}
+		case kv.descending:
+			after = bson.M{"$or": bson.A{bson.M{kv.key: bson.M{"$lt": kv.value}}, bson.M{kv.key: nil}}}
+		default:
+			after = bson.M{kv.key: bson.M{"$gt": kv.value}}
+		}
+		cond := bson.A{}
+		for _, prev := range keys[:i] {
+			cond = append(cond, bson.M{prev.key: prev.value})
+		}
+		or = append(or, bson.M{"$and": append(cond, after)})
+	}
+	return bson.M{"$or": or}, nil
+}
+
+func (s *MongoDBStorage) UpdateMarks(ctx context.Context, filter interface{}, patch *model.MarkPatch) ([]string, error) {
+	if err := patch.Validate(); err != nil {
+		return nil, err
+	}
 	var ids []string
-	marks, err := s.GetMarks(ctx, filter, 0)
+	marks, err := s.GetMarks(ctx, filter, nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "")
 	}
@@ -154,59 +337,122 @@ func (s *MongoDBStorage) UpdateMarks(ctx context.Context, filter interface{}, up
 		if err != nil {
 			return nil, errors.Wrap(err, "")
 		}
-		if _, err := s.coll.UpdateByID(ctx, objectID, constructUpdateFromMark(mk, update)); err != nil {
-			return nil, errors.Wrap(err, "")
+		if err := s.updateMark(ctx, objectID, mk, patch); err != nil {
+			return nil, err
 		}
 		ids = append(ids, mk.ID)
 	}
 	return ids, nil
 }
 
-func (s *MongoDBStorage) UpdateOneMark(ctx context.Context, id string, update *model.Mark) error {
-	objectID, err := primitive.ObjectIDFromHex(id)
+func (s *MongoDBStorage) UpdateOneMark(ctx context.Context, id string, patch *model.MarkPatch) error {
+	if err := patch.Validate(); err != nil {
+		return err
+	}
+	objectID, err := parseID(id)
 	if err != nil {
-		return errors.Wrap(err, "")
+		return err
 	}
-	marks, err := s.GetMarks(ctx, bson.M{"_id": objectID}, 0)
+	marks, err := s.GetMarks(ctx, bson.M{"_id": objectID}, nil)
 	if err != nil {
 		return errors.Wrap(err, "")
 	}
+	if len(marks) == 0 {
+		return errors.Wrap(storage.ErrNotFound, fmt.Sprintf("mark %q", id))
+	}
 	if len(marks) != 1 {
 		return errors.New(fmt.Sprintf("Expecting 1 mark for id %q, but saw %v", id, len(marks)))
 	}
-	if _, err := s.coll.UpdateByID(ctx, objectID, constructUpdateFromMark(marks[0], update)); err != nil {
+	return s.updateMark(ctx, objectID, marks[0], patch)
+}
+
+// updateMark updates the mark, and records the changes as a revision.
+func (s *MongoDBStorage) updateMark(ctx context.Context, objectID primitive.ObjectID, original *model.Mark, patch *model.MarkPatch) error {
+	b := constructUpdateFromPatch(original, patch)
+	changes := changesFromUpdate(original, b)
+	if _, err := s.coll.UpdateByID(ctx, objectID, b); err != nil {
 		return errors.Wrap(err, "")
 	}
-	return nil
+	return s.recordRevision(ctx, objectID, changes)
 }
 
 func (s *MongoDBStorage) DeleteMarks(ctx context.Context, filter interface{}) (int, error) {
-	filterVal, err := parseFilter(filter)
+	filterVal, err := parseTrashFilter(filter, false)
 	if err != nil {
 		return 0, err
 	}
-	result, err := s.coll.DeleteMany(ctx, filterVal)
+	result, err := s.coll.UpdateMany(ctx, filterVal, bson.M{"$set": bson.M{"deletedAt": util.NowUnixMilli()}})
 	if err != nil {
 		return 0, errors.Wrap(err, "")
 	}
-	return int(result.DeletedCount), nil
+	return int(result.ModifiedCount), nil
 }
 
 func (s *MongoDBStorage) DeleteOneMark(ctx context.Context, id string) error {
-	objectID, err := primitive.ObjectIDFromHex(id)
+	objectID, err := parseID(id)
 	if err != nil {
-		return errors.Wrap(err, "")
+		return err
 	}
-	result, err := s.coll.DeleteOne(ctx, bson.M{"_id": objectID})
+	result, err := s.coll.UpdateOne(ctx, withTrash(bson.M{"_id": objectID}, false), bson.M{"$set": bson.M{"deletedAt": util.NowUnixMilli()}})
 	if err != nil {
 		return errors.Wrap(err, "")
 	}
-	if result.DeletedCount == 0 {
-		return errors.New(fmt.Sprintf("no such mark found for id: %q", id))
+	if result.MatchedCount == 0 {
+		return errors.Wrap(storage.ErrNotFound, fmt.Sprintf("mark %q", id))
 	}
 	return nil
 }
 
+func (s *MongoDBStorage) RestoreMarks(ctx context.Context, filter interface{}) ([]string, error) {
+	marks, err := s.GetDeletedMarks(ctx, filter, nil)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	var objectIDs bson.A
+	for _, mark := range marks {
+		objectID, err := parseID(mark.ID)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, mark.ID)
+		objectIDs = append(objectIDs, objectID)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	if _, err := s.coll.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": objectIDs}}, bson.M{"$unset": bson.M{"deletedAt": ""}}); err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	return ids, nil
+}
+
+func (s *MongoDBStorage) PurgeMarks(ctx context.Context, filter interface{}) (int, error) {
+	marks, err := s.GetDeletedMarks(ctx, filter, nil)
+	if err != nil {
+		return 0, err
+	}
+	var objectIDs bson.A
+	for _, mark := range marks {
+		objectID, err := parseID(mark.ID)
+		if err != nil {
+			return 0, err
+		}
+		objectIDs = append(objectIDs, objectID)
+	}
+	if len(objectIDs) == 0 {
+		return 0, nil
+	}
+	result, err := s.coll.DeleteMany(ctx, withTrash(bson.M{"_id": bson.M{"$in": objectIDs}}, true))
+	if err != nil {
+		return 0, errors.Wrap(err, "")
+	}
+	if _, err := s.revisions.DeleteMany(ctx, bson.M{"markId": bson.M{"$in": objectIDs}}); err != nil {
+		return 0, errors.Wrap(err, "failed to delete the revisions")
+	}
+	return int(result.DeletedCount), nil
+}
+
 func (s *MongoDBStorage) Close(ctx context.Context) error {
 	if err := s.client.Disconnect(ctx); err != nil {
 		return errors.Wrap(err, "")
@@ -227,16 +473,12 @@ func parseFilter(filter interface{}) (bson.M, error) {
 
 func parseFilterBSONM(filter bson.M) (bson.M, error) {
 	ret := filter
-	id := ret["_id"]
-	if id != nil {
-		hexID, ok := id.(string)
-		if ok {
-			objID, err := primitive.ObjectIDFromHex(hexID)
-			if err != nil {
-				return nil, errors.Wrap(err, "")
-			}
-			ret["_id"] = objID
+	if id := ret["_id"]; id != nil {
+		objID, err := parseFilterID(id)
+		if err != nil {
+			return nil, err
 		}
+		ret["_id"] = objID
 	}
 	return ret, nil
 }
@@ -246,18 +488,57 @@ func parseFilterString(filter string) (bson.M, error) {
 	if err := json.Unmarshal([]byte(filter), &ret); err != nil {
 		return nil, errors.Wrap(err, "")
 	}
+	return parseFilterBSONM(ret)
+}
+
+// parseID converts the hex ID to primitive.ObjectID.
+func parseID(id string) (primitive.ObjectID, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return objID, errors.Wrap(storage.ErrInvalidID, fmt.Sprintf("expect a hex object id, got %q", id))
+	}
+	return objID, nil
+}
+
+// parseFilterID converts the hex IDs in the "_id" filter to primitive.ObjectID,
+// the filter can be an ID or a list operator, e.g. {"$in": ["<id>", ...]}.
+func parseFilterID(id interface{}) (interface{}, error) {
+	switch val := id.(type) {
+	case string:
+		return parseID(val)
+	case bson.M:
+		return parseFilterIDOperators(val)
+	case map[string]interface{}:
+		return parseFilterIDOperators(val)
+	default:
+		return id, nil
+	}
+}
 
-	// Convert "_id" from string to primitive.ObjectID
-	id := ret["_id"]
-	if id != nil {
-		hexID, ok := id.(string)
-		if ok {
-			objID, err := primitive.ObjectIDFromHex(hexID)
+func parseFilterIDOperators(ops map[string]interface{}) (bson.M, error) {
+	ret := bson.M{}
+	for op, val := range ops {
+		var ids []interface{}
+		switch list := val.(type) {
+		case []string:
+			for _, id := range list {
+				ids = append(ids, id)
+			}
+		case []interface{}:
+			ids = list
+		default:
+			ret[op] = val
+			continue
+		}
+		var objIDs []interface{}
+		for _, id := range ids {
+			objID, err := parseFilterID(id)
 			if err != nil {
-				return nil, errors.Wrap(err, "")
+				return nil, err
 			}
-			ret["_id"] = objID
+			objIDs = append(objIDs, objID)
 		}
+		ret[op] = objIDs
 	}
 	return ret, nil
 }
@@ -268,25 +549,28 @@ func MarkToPersistentMark(mark *model.Mark) (*PersistentMark, error) {
 		return nil, err
 	}
 	ret := &PersistentMark{
-		Type:    mark.Type,
-		Title:   mark.Title,
-		Author:  mark.Author,
-		Section: mark.Section,
-		Location: &Location{
-			Chapter:  mark.Location.Chapter,
-			Page:     mark.Location.Page,
-			Location: mark.Location.Location,
-		},
+		Type:           mark.Type,
+		Title:          mark.Title,
+		Author:         mark.Author,
+		Section:        mark.Section,
 		Data:           mark.Data,
 		UserNote:       mark.UserNote,
 		Tags:           mark.Tags,
+		Owner:          mark.Owner,
 		CreatedAt:      mark.CreatedAt,
 		LastModifiedAt: mark.LastModifiedAt,
 	}
+	if mark.Location != nil {
+		ret.Location = &Location{
+			Chapter:  mark.Location.Chapter,
+			Page:     mark.Location.Page,
+			Location: mark.Location.Location,
+		}
+	}
 	if mark.ID != "" {
-		id, err := primitive.ObjectIDFromHex(mark.ID)
+		id, err := parseID(mark.ID)
 		if err != nil {
-			return nil, errors.Wrap(err, "")
+			return nil, err
 		}
 		ret.ID = id
 	} else {
@@ -306,8 +590,10 @@ func PersistentMarkToMark(pm *PersistentMark) *model.Mark {
 		Data:           pm.Data,
 		UserNote:       pm.UserNote,
 		Tags:           pm.Tags,
+		Owner:          pm.Owner,
 		CreatedAt:      pm.CreatedAt,
 		LastModifiedAt: pm.LastModifiedAt,
+		DeletedAt:      pm.DeletedAt,
 	}
 	if pm.Location != nil {
 		mark.Location = &model.Location{
@@ -319,59 +605,52 @@ func PersistentMarkToMark(pm *PersistentMark) *model.Mark {
 	return mark
 }
 
-func constructUpdateFromMark(original, update *model.Mark) bson.M {
-	b := bson.M{}
-	var modified bool
-
-	if update.Type != "" && update.Type != original.Type {
-		b["type"] = update.Type
-		modified = true
-	}
-	if update.Title != "" && update.Title != original.Title {
-		b["title"] = update.Title
-		modified = true
-	}
-	if update.Author != "" && update.Author != original.Author {
-		b["author"] = update.Author
-		modified = true
-	}
-	if update.Section != "" && update.Section != original.Section {
-		b["section"] = update.Section
-		modified = true
-	}
-	if update.Location != nil {
-		if update.Location.Chapter != "" && (original.Location == nil || update.Location.Chapter != original.Location.Chapter) {
-			b["location.chapter"] = update.Location.Chapter
-			modified = true
+// constructUpdateFromPatch returns the update that sets the changed fields in the mask of the patch,
+// and unsets the cleared ones, the tags are set to an empty array when they are cleared.
+func constructUpdateFromPatch(original *model.Mark, patch *model.MarkPatch) bson.M {
+	set, unset := bson.M{}, bson.M{}
+	old := model.FieldValues(original)
+	for _, field := range model.MarkFields {
+		if !patch.Has(field) {
+			continue
 		}
-		if update.Location.Page != nil && (original.Location == nil || original.Location.Page == nil || *update.Location.Page != *original.Location.Page) {
-			b["location.page"] = update.Location.Page
-			modified = true
+		val := patch.Value(field)
+		if field == "tags" {
+			// A patch without the mark clears the tags. The tags are compared as sets, the original
+			// ones are copied before sorting, as they are also the old values of the revision.
+			tags := []string{}
+			if patch.Mark != nil {
+				tags = append(tags, patch.Mark.Tags...)
+			}
+			originalTags := append([]string{}, original.Tags...)
+			sort.StringSlice(tags).Sort()
+			sort.StringSlice(originalTags).Sort()
+			if !util.StringSlicesEqual(tags, originalTags) {
+				set[field] = tags
+			}
+			continue
 		}
-		if update.Location.Location != nil && (original.Location == nil || original.Location.Location == nil || *update.Location.Location != *original.Location.Location) {
-			b["location.location"] = update.Location.Location
-			modified = true
+		if val == old[field] {
+			continue
 		}
-	}
-	if update.Data != "" && update.Data != original.Data {
-		b["data"] = update.Data
-		modified = true
-	}
-	if update.UserNote != "" && update.UserNote != original.UserNote {
-		b["note"] = update.UserNote
-		modified = true
-	}
-	if update.Tags != nil {
-		sort.StringSlice(update.Tags).Sort()
-		sort.StringSlice(original.Tags).Sort()
-		if !util.StringSlicesEqual(update.Tags, original.Tags) {
-			b["tags"] = update.Tags
-			modified = true
+		switch {
+		case val == nil:
+			unset[field] = ""
+		case field == "location.page":
+			set[field] = patch.Mark.Location.Page
+		case field == "location.location":
+			set[field] = patch.Mark.Location.Location
+		default:
+			set[field] = val
 		}
 	}
-	if modified {
-		b["lastModifiedAt"] = util.NowUnixMilli()
-	}
 
-	return bson.M{"$set": b}
+	b := bson.M{"$set": set}
+	if len(unset) > 0 {
+		b["$unset"] = unset
+	}
+	if len(set) > 0 || len(unset) > 0 {
+		set["lastModifiedAt"] = util.NowUnixMilli()
+	}
+	return b
 }
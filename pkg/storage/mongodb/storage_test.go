@@ -6,16 +6,19 @@ Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
 package mongodb
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/storage"
 	"github.com/yifan-gu/blueNote/pkg/util"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func TestConstructUpdateFromMark(t *testing.T) {
+func TestConstructUpdateFromPatchFields(t *testing.T) {
 	page10, loc100 := 10, 100
 	page42, loc420 := 42, 420
 
@@ -36,6 +39,7 @@ func TestConstructUpdateFromMark(t *testing.T) {
 	tests := []struct {
 		original *model.Mark
 		update   *model.Mark
+		fields   []string
 		result   bson.M
 	}{
 		{
@@ -46,56 +50,67 @@ func TestConstructUpdateFromMark(t *testing.T) {
 		{
 			original: &originalMark1,
 			update:   &originalMark1,
+			fields:   model.MarkFields,
 			result:   bson.M{"$set": bson.M{}},
 		},
 		{
 			original: &originalMark1,
 			update:   &model.Mark{Type: "NOTE"},
+			fields:   []string{"type"},
 			result:   bson.M{"$set": bson.M{"type": "NOTE", "lastModifiedAt": int64(1)}},
 		},
 		{
 			original: &originalMark1,
 			update:   &model.Mark{Title: "Title I"},
+			fields:   []string{"title"},
 			result:   bson.M{"$set": bson.M{"title": "Title I", "lastModifiedAt": int64(2)}},
 		},
 		{
 			original: &originalMark1,
 			update:   &model.Mark{Author: "Author U"},
+			fields:   []string{"author"},
 			result:   bson.M{"$set": bson.M{"author": "Author U", "lastModifiedAt": int64(3)}},
 		},
 		{
 			original: &originalMark1,
 			update:   &model.Mark{Section: "Section E"},
+			fields:   []string{"section"},
 			result:   bson.M{"$set": bson.M{"section": "Section E", "lastModifiedAt": int64(4)}},
 		},
 		{
 			original: &originalMark1,
 			update:   &model.Mark{Location: &model.Location{Chapter: "Chapter H"}},
+			fields:   []string{"location.chapter"},
 			result:   bson.M{"$set": bson.M{"location.chapter": "Chapter H", "lastModifiedAt": int64(5)}},
 		},
 		{
 			original: &originalMark1,
 			update:   &model.Mark{Location: &model.Location{Page: &page42}},
+			fields:   []string{"location.page"},
 			result:   bson.M{"$set": bson.M{"location.page": &page42, "lastModifiedAt": int64(6)}},
 		},
 		{
 			original: &originalMark1,
 			update:   &model.Mark{Location: &model.Location{Location: &loc420}},
+			fields:   []string{"location.location"},
 			result:   bson.M{"$set": bson.M{"location.location": &loc420, "lastModifiedAt": int64(7)}},
 		},
 		{
 			original: &originalMark1,
 			update:   &model.Mark{Data: "Data A"},
+			fields:   []string{"data"},
 			result:   bson.M{"$set": bson.M{"data": "Data A", "lastModifiedAt": int64(8)}},
 		},
 		{
 			original: &originalMark1,
 			update:   &model.Mark{UserNote: "Note O"},
+			fields:   []string{"note"},
 			result:   bson.M{"$set": bson.M{"note": "Note O", "lastModifiedAt": int64(9)}},
 		},
 		{
 			original: &originalMark1,
 			update:   &model.Mark{Tags: []string{"tag d", "tag c", "tag b", "tag a"}},
+			fields:   []string{"tags"},
 			result:   bson.M{"$set": bson.M{"tags": []string{"tag a", "tag b", "tag c", "tag d"}, "lastModifiedAt": int64(10)}},
 		},
 		{
@@ -113,6 +128,7 @@ func TestConstructUpdateFromMark(t *testing.T) {
 				Data:     "Data A",
 				UserNote: "Note O",
 				Tags:     []string{"tag d", "tag c", "tag b", "tag a"}},
+			fields: model.MarkFields,
 			result: bson.M{"$set": bson.M{
 				"type":              "NOTE",
 				"title":             "Title I",
@@ -142,6 +158,7 @@ func TestConstructUpdateFromMark(t *testing.T) {
 				Data:     "Data A",
 				UserNote: "Note O",
 				Tags:     []string{"tag d", "tag c", "tag b", "tag a"}},
+			fields: model.MarkFields,
 			result: bson.M{"$set": bson.M{
 				"type":              "NOTE",
 				"title":             "Title I",
@@ -162,7 +179,243 @@ func TestConstructUpdateFromMark(t *testing.T) {
 	util.ResetFakeClock()
 
 	for i, tt := range tests {
-		result := constructUpdateFromMark(tt.original, tt.update)
+		result := constructUpdateFromPatch(tt.original, &model.MarkPatch{Mark: tt.update, Fields: tt.fields})
 		assert.Equal(t, tt.result, result, fmt.Sprintf("Invalid result for test case #%d", i))
 	}
 }
+
+func TestConstructUpdateFromPatch(t *testing.T) {
+	page := 10
+	original := &model.Mark{Type: "NOTE", Title: "T", Author: "A", UserNote: "N", Location: &model.Location{Chapter: "C", Page: &page}, Tags: []string{"b", "a"}}
+	tests := []struct {
+		patch  *model.MarkPatch
+		result bson.M
+	}{
+		{
+			patch:  &model.MarkPatch{Mark: &model.Mark{}, Fields: []string{"section", "data"}},
+			result: bson.M{"$set": bson.M{}},
+		},
+		{
+			patch:  &model.MarkPatch{Mark: &model.Mark{Title: "U"}, Fields: []string{"title", "note", "location.page"}},
+			result: bson.M{"$set": bson.M{"title": "U", "lastModifiedAt": int64(1)}, "$unset": bson.M{"note": "", "location.page": ""}},
+		},
+		{
+			patch:  &model.MarkPatch{Mark: &model.Mark{UserNote: "O", Tags: []string{"b", "a"}}, Fields: []string{"tags"}},
+			result: bson.M{"$set": bson.M{}},
+		},
+		{
+			patch:  &model.MarkPatch{Mark: &model.Mark{}, Fields: []string{"tags"}},
+			result: bson.M{"$set": bson.M{"tags": []string{}, "lastModifiedAt": int64(2)}},
+		},
+		{
+			// A patch without the mark clears the fields.
+			patch:  &model.MarkPatch{Fields: []string{"tags", "note"}},
+			result: bson.M{"$set": bson.M{"tags": []string{}, "lastModifiedAt": int64(3)}, "$unset": bson.M{"note": ""}},
+		},
+	}
+
+	util.UseFakeClock()
+	util.ResetFakeClock()
+
+	for i, tt := range tests {
+		assert.Equal(t, tt.result, constructUpdateFromPatch(original, tt.patch), "case #%d", i)
+	}
+	// The original tags are the old values of the revision, they are not sorted in place.
+	assert.Equal(t, []string{"b", "a"}, original.Tags)
+}
+
+func TestConstructFindOptions(t *testing.T) {
+	tests := []struct {
+		opts  *storage.QueryOptions
+		limit *int64
+		skip  *int64
+		sort  interface{}
+		err   bool
+	}{
+		{
+			opts: nil,
+		},
+		{
+			opts: &storage.QueryOptions{},
+		},
+		{
+			opts:  &storage.QueryOptions{Limit: 10, Skip: 20},
+			limit: int64Ptr(10),
+			skip:  int64Ptr(20),
+			sort:  bson.D{{Key: "_id", Value: 1}},
+		},
+		{
+			opts: &storage.QueryOptions{Sort: []storage.Sort{{Field: storage.SortByCreatedAt, Descending: true}, {Field: storage.SortByLocation}}},
+			sort: bson.D{{Key: "createdAt", Value: -1}, {Key: "location.page", Value: 1}, {Key: "location.location", Value: 1}, {Key: "_id", Value: 1}},
+		},
+		{
+			opts: &storage.QueryOptions{After: &model.Mark{ID: "5f8f8c44b54764421b7156c9"}},
+			sort: bson.D{{Key: "_id", Value: 1}},
+		},
+		{
+			opts: &storage.QueryOptions{Sort: []storage.Sort{{Field: "unknown"}}},
+			err:  true,
+		},
+		{
+			opts: &storage.QueryOptions{Skip: -1},
+			err:  true,
+		},
+	}
+	for i, tt := range tests {
+		findOpts, err := constructFindOptions(tt.opts)
+		if tt.err {
+			assert.Error(t, err, "case #%d", i)
+			continue
+		}
+		assert.NoError(t, err, "case #%d", i)
+		assert.Equal(t, tt.limit, findOpts.Limit, "case #%d", i)
+		assert.Equal(t, tt.skip, findOpts.Skip, "case #%d", i)
+		assert.Equal(t, tt.sort, findOpts.Sort, "case #%d", i)
+	}
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
+
+func TestConstructAfterFilter(t *testing.T) {
+	id := primitive.NewObjectID()
+	page := 7
+	tests := []struct {
+		mark   *model.Mark
+		sorts  []storage.Sort
+		result bson.M
+		err    bool
+	}{
+		{
+			mark:   &model.Mark{ID: id.Hex()},
+			result: bson.M{"$or": bson.A{bson.M{"$and": bson.A{bson.M{"_id": bson.M{"$gt": id}}}}}},
+		},
+		{
+			mark:  &model.Mark{ID: id.Hex(), CreatedAt: int64Ptr(100), Location: &model.Location{Page: &page}},
+			sorts: []storage.Sort{{Field: storage.SortByCreatedAt, Descending: true}, {Field: storage.SortByLocation}},
+			result: bson.M{"$or": bson.A{
+				bson.M{"$and": bson.A{
+					bson.M{"$or": bson.A{bson.M{"createdAt": bson.M{"$lt": int64(100)}}, bson.M{"createdAt": nil}}},
+				}},
+				bson.M{"$and": bson.A{
+					bson.M{"createdAt": int64(100)},
+					bson.M{"location.page": bson.M{"$gt": 7}},
+				}},
+				bson.M{"$and": bson.A{
+					bson.M{"createdAt": int64(100)},
+					bson.M{"location.page": 7},
+					bson.M{"location.location": bson.M{"$ne": nil}},
+				}},
+				bson.M{"$and": bson.A{
+					bson.M{"createdAt": int64(100)},
+					bson.M{"location.page": 7},
+					bson.M{"location.location": nil},
+					bson.M{"_id": bson.M{"$gt": id}},
+				}},
+			}},
+		},
+		{
+			mark:  &model.Mark{ID: id.Hex(), Title: "T"},
+			sorts: []storage.Sort{{Field: storage.SortByLastModifiedAt, Descending: true}, {Field: storage.SortByTitle}},
+			result: bson.M{"$or": bson.A{
+				bson.M{"$and": bson.A{
+					bson.M{"lastModifiedAt": nil},
+					bson.M{"title": bson.M{"$gt": "T"}},
+				}},
+				bson.M{"$and": bson.A{
+					bson.M{"lastModifiedAt": nil},
+					bson.M{"title": "T"},
+					bson.M{"_id": bson.M{"$gt": id}},
+				}},
+			}},
+		},
+		{
+			mark: &model.Mark{ID: "1"},
+			err:  true,
+		},
+	}
+	for i, tt := range tests {
+		result, err := constructAfterFilter(tt.mark, tt.sorts)
+		if tt.err {
+			assert.Error(t, err, "case #%d", i)
+			continue
+		}
+		assert.NoError(t, err, "case #%d", i)
+		assert.Equal(t, tt.result, result, "case #%d", i)
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	id1, id2 := primitive.NewObjectID(), primitive.NewObjectID()
+	tests := []struct {
+		filter interface{}
+		result bson.M
+		err    bool
+	}{
+		{
+			filter: `{"_id": "` + id1.Hex() + `"}`,
+			result: bson.M{"_id": id1},
+		},
+		{
+			filter: bson.M{"_id": bson.M{"$in": []interface{}{id1.Hex(), id2.Hex()}}, "title": "T"},
+			result: bson.M{"_id": bson.M{"$in": []interface{}{id1, id2}}, "title": "T"},
+		},
+		{
+			filter: `{"_id": {"$nin": ["` + id2.Hex() + `"]}}`,
+			result: bson.M{"_id": bson.M{"$nin": []interface{}{id2}}},
+		},
+		{
+			filter: bson.M{"_id": "not a hex id"},
+			err:    true,
+		},
+		{
+			filter: 42,
+			err:    true,
+		},
+	}
+	for i, tt := range tests {
+		result, err := parseFilter(tt.filter)
+		if tt.err {
+			assert.Error(t, err, "case #%d", i)
+			continue
+		}
+		assert.NoError(t, err, "case #%d", i)
+		assert.Equal(t, tt.result, result, "case #%d", i)
+	}
+}
+
+func TestMarkToPersistentMark(t *testing.T) {
+	id := primitive.NewObjectID()
+	tests := []struct {
+		mark   *model.Mark
+		result *PersistentMark
+		err    error
+	}{
+		{
+			mark:   &model.Mark{ID: id.Hex(), Type: model.MarkTypeHighlight, Title: "T", Data: "d"},
+			result: &PersistentMark{ID: id, Type: model.MarkTypeHighlight, Title: "T", Data: "d"},
+		},
+		{
+			mark:   &model.Mark{ID: id.Hex(), Type: model.MarkTypeNote, UserNote: "n", Location: &model.Location{Chapter: "1"}},
+			result: &PersistentMark{ID: id, Type: model.MarkTypeNote, UserNote: "n", Location: &Location{Chapter: "1"}},
+		},
+		{
+			mark: &model.Mark{ID: "not a hex id", Type: model.MarkTypeHighlight, Data: "d"},
+			err:  storage.ErrInvalidID,
+		},
+	}
+	for i, tt := range tests {
+		result, err := MarkToPersistentMark(tt.mark)
+		if tt.err != nil {
+			assert.True(t, errors.Is(err, tt.err), "case #%d: %v", i, err)
+			continue
+		}
+		assert.NoError(t, err, "case #%d", i)
+		assert.Equal(t, tt.result, result, "case #%d", i)
+	}
+
+	_, err := MarkToPersistentMark(&model.Mark{Type: "POEM"})
+	_, ok := err.(*model.ValidationError)
+	assert.True(t, ok)
+}
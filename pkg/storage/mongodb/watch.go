@@ -0,0 +1,96 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package mongodb
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/yifan-gu/blueNote/pkg/event"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/util"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// changeEvent is a document of the change stream, see
+// https://www.mongodb.com/docs/manual/reference/change-events/
+type changeEvent struct {
+	OperationType string          `bson:"operationType"`
+	FullDocument  *PersistentMark `bson:"fullDocument"`
+	DocumentKey   struct {
+		ID primitive.ObjectID `bson:"_id"`
+	} `bson:"documentKey"`
+	UpdateDescription *struct {
+		RemovedFields []string `bson:"removedFields"`
+	} `bson:"updateDescription"`
+}
+
+// restored returns whether the change moves the mark out of the trash.
+func (c *changeEvent) restored() bool {
+	if c.UpdateDescription == nil {
+		return false
+	}
+	for _, field := range c.UpdateDescription.RemovedFields {
+		if field == "deletedAt" {
+			return true
+		}
+	}
+	return false
+}
+
+// eventFromChange converts a change to an event, it returns nil for the changes that are not of a mark.
+func eventFromChange(change *changeEvent) *event.Event {
+	switch change.OperationType {
+	case "insert", "update", "replace":
+		if change.FullDocument == nil {
+			// The mark is deleted before the update is looked up, the deletion follows.
+			return nil
+		}
+		typ := event.Updated
+		switch {
+		case change.FullDocument.DeletedAt != nil:
+			// The mark is moved to the trash.
+			typ = event.Deleted
+		case change.OperationType == "insert" || change.restored():
+			typ = event.Created
+		}
+		return &event.Event{Type: typ, Mark: PersistentMarkToMark(change.FullDocument)}
+	case "delete":
+		// The mark is purged from the trash, the deleted document is not in the change.
+		return &event.Event{Type: event.Deleted, Mark: &model.Mark{ID: change.DocumentKey.ID.Hex()}}
+	default:
+		return nil
+	}
+}
+
+// Watch publishes the changes of the collection from the change stream, including the ones made by
+// other processes, until the context is canceled. The change streams require a replica set.
+func (s *MongoDBStorage) Watch(ctx context.Context, bus *event.Bus) error {
+	if s.coll == nil {
+		return errors.New("mongodb is not connected")
+	}
+	stream, err := s.coll.Watch(ctx, mongo.Pipeline{}, options.ChangeStream().SetFullDocument(options.UpdateLookup))
+	if err != nil {
+		return errors.Wrap(err, "failed to watch the change stream, which requires a replica set")
+	}
+	defer stream.Close(context.Background())
+	for stream.Next(ctx) {
+		var change changeEvent
+		if err := stream.Decode(&change); err != nil {
+			util.Debugf("Failed to decode the change: %v", err)
+			continue
+		}
+		if ev := eventFromChange(&change); ev != nil {
+			bus.Publish(ev)
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return errors.Wrap(stream.Err(), "the change stream is closed")
+}
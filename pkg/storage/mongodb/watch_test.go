@@ -0,0 +1,69 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package mongodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/event"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestEventFromChange(t *testing.T) {
+	id := primitive.NewObjectID()
+	doc := bson.M{"_id": id, "type": "HIGHLIGHT", "title": "T", "owner": "alice"}
+	mark := &model.Mark{ID: id.Hex(), Type: "HIGHLIGHT", Title: "T", Owner: "alice"}
+	deletedAt := int64(1700000000000)
+	deleted := bson.M{"_id": id, "type": "HIGHLIGHT", "title": "T", "owner": "alice", "deletedAt": deletedAt}
+	deletedMark := &model.Mark{ID: id.Hex(), Type: "HIGHLIGHT", Title: "T", Owner: "alice", DeletedAt: &deletedAt}
+
+	tests := []struct {
+		change bson.M
+		event  *event.Event
+	}{
+		{
+			change: bson.M{"operationType": "insert", "fullDocument": doc, "documentKey": bson.M{"_id": id}},
+			event:  &event.Event{Type: event.Created, Mark: mark},
+		},
+		{
+			change: bson.M{"operationType": "update", "fullDocument": doc, "documentKey": bson.M{"_id": id}},
+			event:  &event.Event{Type: event.Updated, Mark: mark},
+		},
+		{
+			change: bson.M{"operationType": "replace", "fullDocument": doc, "documentKey": bson.M{"_id": id}},
+			event:  &event.Event{Type: event.Updated, Mark: mark},
+		},
+		{
+			change: bson.M{"operationType": "update", "fullDocument": deleted, "documentKey": bson.M{"_id": id}},
+			event:  &event.Event{Type: event.Deleted, Mark: deletedMark},
+		},
+		{
+			change: bson.M{"operationType": "update", "fullDocument": doc, "documentKey": bson.M{"_id": id}, "updateDescription": bson.M{"removedFields": bson.A{"deletedAt"}}},
+			event:  &event.Event{Type: event.Created, Mark: mark},
+		},
+		{
+			// The mark is deleted before the update is looked up.
+			change: bson.M{"operationType": "update", "fullDocument": nil, "documentKey": bson.M{"_id": id}},
+		},
+		{
+			change: bson.M{"operationType": "delete", "documentKey": bson.M{"_id": id}},
+			event:  &event.Event{Type: event.Deleted, Mark: &model.Mark{ID: id.Hex()}},
+		},
+		{
+			change: bson.M{"operationType": "drop"},
+		},
+	}
+	for i, tt := range tests {
+		b, err := bson.Marshal(tt.change)
+		assert.NoError(t, err, "case #%d", i)
+		var change changeEvent
+		assert.NoError(t, bson.Unmarshal(b, &change), "case #%d", i)
+		assert.Equal(t, tt.event, eventFromChange(&change), "case #%d", i)
+	}
+}
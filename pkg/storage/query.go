@@ -0,0 +1,173 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/yifan-gu/blueNote/pkg/model"
+)
+
+// The fields that the marks can be sorted by.
+const (
+	SortByCreatedAt      = "createdAt"
+	SortByLastModifiedAt = "lastModifiedAt"
+	SortByTitle          = "title"
+	SortByLocation       = "location"
+)
+
+var sortFields = []string{SortByCreatedAt, SortByLastModifiedAt, SortByTitle, SortByLocation}
+
+// Sort is a sort key of the marks.
+type Sort struct {
+	Field      string
+	Descending bool
+}
+
+// QueryOptions are the options of getting the marks.
+type QueryOptions struct {
+	// Limit is the maximum number of marks to return, 0 or negative returns all.
+	Limit int
+	// Skip is the number of marks to skip before returning.
+	Skip int
+	// Sort are the sort keys applied in order, the marks are finally ordered by their IDs
+	// so the pages are stable.
+	Sort []Sort
+	// After is the last mark of the previous page, only its ID and the fields of the sort keys are used.
+	// The marks after it in the order are returned, so the pages don't shift when the marks before them
+	// are created or deleted.
+	After *model.Mark
+}
+
+// ParseSort parses a sort key in the form of "field" or "-field" for the descending order, e.g. "-createdAt".
+func ParseSort(spec string) (Sort, error) {
+	var s Sort
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "-") {
+		s.Descending = true
+		spec = spec[1:]
+	}
+	for _, field := range sortFields {
+		if strings.EqualFold(spec, field) {
+			s.Field = field
+			return s, nil
+		}
+	}
+	return s, errors.New(fmt.Sprintf("unrecognized sort field %q, expecting one of %v", spec, sortFields))
+}
+
+// ValidateQueryOptions checks the query options, nil is valid.
+func ValidateQueryOptions(opts *QueryOptions) error {
+	if opts == nil {
+		return nil
+	}
+	if opts.Skip < 0 {
+		return errors.New(fmt.Sprintf("invalid skip %d, expecting a non-negative number", opts.Skip))
+	}
+	for _, s := range opts.Sort {
+		if !isSortField(s.Field) {
+			return errors.New(fmt.Sprintf("unrecognized sort field %q, expecting one of %v", s.Field, sortFields))
+		}
+	}
+	if opts.After != nil && opts.After.ID == "" {
+		return errors.New("the mark to get the marks after has no ID")
+	}
+	return nil
+}
+
+// SortValues returns the values of the mark for the sort field, nil for the missing ones.
+// The location has two values, the page and the location.
+func SortValues(mark *model.Mark, field string) []interface{} {
+	intValue := func(v *int) interface{} {
+		if v == nil {
+			return nil
+		}
+		return *v
+	}
+	int64Value := func(v *int64) interface{} {
+		if v == nil {
+			return nil
+		}
+		return *v
+	}
+	switch field {
+	case SortByCreatedAt:
+		return []interface{}{int64Value(mark.CreatedAt)}
+	case SortByLastModifiedAt:
+		return []interface{}{int64Value(mark.LastModifiedAt)}
+	case SortByTitle:
+		return []interface{}{mark.Title}
+	case SortByLocation:
+		if mark.Location == nil {
+			return []interface{}{nil, nil}
+		}
+		return []interface{}{intValue(mark.Location.Page), intValue(mark.Location.Location)}
+	default:
+		return nil
+	}
+}
+
+// CompareMarks compares the marks by the sort keys and then by their IDs, like the storages order them.
+// The missing values come first in the ascending order.
+func CompareMarks(a, b *model.Mark, sorts []Sort) int {
+	for _, s := range sorts {
+		av, bv := SortValues(a, s.Field), SortValues(b, s.Field)
+		for i := range av {
+			c := compareValues(av[i], bv[i])
+			if s.Descending {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+// compareValues compares the values of SortValues, which are of the same type or nil.
+func compareValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	switch av := a.(type) {
+	case int:
+		return compareInt64(int64(av), int64(b.(int)))
+	case int64:
+		return compareInt64(av, b.(int64))
+	case string:
+		return strings.Compare(av, b.(string))
+	default:
+		panic(fmt.Sprintf("unsupported sort value type %T", a))
+	}
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func isSortField(field string) bool {
+	for _, f := range sortFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/model"
+)
+
+func TestCompareMarks(t *testing.T) {
+	ts := func(v int64) *int64 { return &v }
+	page := func(v int) *model.Location { return &model.Location{Page: &v} }
+	tests := []struct {
+		a, b   *model.Mark
+		sorts  []Sort
+		result int
+	}{
+		{a: &model.Mark{ID: "1"}, b: &model.Mark{ID: "2"}, result: -1},
+		{a: &model.Mark{ID: "1", CreatedAt: ts(2)}, b: &model.Mark{ID: "2", CreatedAt: ts(1)}, sorts: []Sort{{Field: SortByCreatedAt}}, result: 1},
+		{a: &model.Mark{ID: "1", CreatedAt: ts(2)}, b: &model.Mark{ID: "2", CreatedAt: ts(1)}, sorts: []Sort{{Field: SortByCreatedAt, Descending: true}}, result: -1},
+		{a: &model.Mark{ID: "2"}, b: &model.Mark{ID: "1", CreatedAt: ts(1)}, sorts: []Sort{{Field: SortByCreatedAt}}, result: -1},
+		{a: &model.Mark{ID: "2", Title: "A"}, b: &model.Mark{ID: "1", Title: "A"}, sorts: []Sort{{Field: SortByTitle}}, result: 1},
+		{a: &model.Mark{ID: "1", Title: "A", Location: page(9)}, b: &model.Mark{ID: "2", Title: "A", Location: page(10)}, sorts: []Sort{{Field: SortByTitle}, {Field: SortByLocation}}, result: -1},
+		{a: &model.Mark{ID: "1", Location: page(9)}, b: &model.Mark{ID: "1", Location: &model.Location{}}, sorts: []Sort{{Field: SortByLocation}}, result: 1},
+	}
+	for i, tt := range tests {
+		assert.Equal(t, tt.result, CompareMarks(tt.a, tt.b, tt.sorts), "case #%d", i)
+	}
+}
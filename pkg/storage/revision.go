@@ -0,0 +1,23 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package storage
+
+import (
+	"context"
+)
+
+type actorKey struct{}
+
+// WithActor returns a context that carries the user who makes the updates, which is recorded in the revisions.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the user carried by the context, or "" if there isn't any.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
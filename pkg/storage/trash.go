@@ -0,0 +1,24 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/yifan-gu/blueNote/pkg/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DeletedBefore returns the filter of the marks that are moved to the trash before the unix milliseconds.
+func DeletedBefore(msec int64) bson.M {
+	return bson.M{"deletedAt": bson.M{"$lt": msec}}
+}
+
+// PurgeExpired permanently deletes the marks that have been in the trash for longer than the retention.
+func PurgeExpired(ctx context.Context, store Storage, retention time.Duration) (int, error) {
+	return store.PurgeMarks(ctx, DeletedBefore(util.NowUnixMilli()-retention.Milliseconds()))
+}
@@ -0,0 +1,158 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package tag
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+	"github.com/yifan-gu/blueNote/pkg/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Count is the number of the marks of a tag.
+type Count struct {
+	Name   string `json:"name"`
+	Parent string `json:"parent,omitempty"`
+	// Count is the number of the marks with the tag itself.
+	Count int `json:"count"`
+	// Total is the number of the marks with the tag or any of its descendants.
+	Total int `json:"total"`
+}
+
+// List returns the counts of the tags of the marks that match the filter, ordered by the levels
+// of the names, so the descendants follow their ancestors. The ancestors are included even if
+// no mark has them. If under is set, only the tag and its descendants are returned.
+func List(ctx context.Context, store storage.Storage, filter bson.M, under string) ([]*Count, error) {
+	if filter == nil {
+		filter = bson.M{}
+	}
+	if under != "" {
+		under = Normalize(under)
+		filter = withFilter(filter, []string{under})
+	}
+	groups, err := store.AggregateMarks(ctx, filter, &storage.AggregateOptions{GroupBy: storage.GroupByTag})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]*Count)
+	add := func(name string) *Count {
+		c, ok := counts[name]
+		if !ok {
+			c = &Count{Name: name, Parent: Parent(name)}
+			counts[name] = c
+		}
+		return c
+	}
+	for _, group := range groups {
+		if under != "" && !IsUnder(group.Key, under) {
+			continue
+		}
+		add(group.Key).Count += group.Count
+		for _, ancestor := range Ancestors(group.Key) {
+			if under == "" || IsUnder(ancestor, under) {
+				add(ancestor)
+			}
+		}
+	}
+
+	hasChildren := make(map[string]bool)
+	for _, c := range counts {
+		hasChildren[c.Parent] = true
+	}
+	var ret []*Count
+	for _, c := range counts {
+		c.Total = c.Count
+		if hasChildren[c.Name] {
+			// A mark can have several tags of the subtree, so count the marks instead of adding up the children.
+			if c.Total, err = store.CountMarks(ctx, withFilter(filter, []string{c.Name})); err != nil {
+				return nil, err
+			}
+		}
+		ret = append(ret, c)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return lessLevels(strings.Split(ret[i].Name, Separator), strings.Split(ret[j].Name, Separator))
+	})
+	return ret, nil
+}
+
+func lessLevels(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// Rename renames the tag and its descendants on all the marks, see Merge.
+func Rename(ctx context.Context, store storage.Storage, from, to string, dryRun bool) ([]*model.Mark, error) {
+	return Merge(ctx, store, []string{from}, to, dryRun)
+}
+
+// Merge replaces the tags and their descendants with the target on all the marks, e.g. merging
+// "stoa" into "stoicism" turns "stoa/ethics" into "stoicism/ethics". It returns the changed marks,
+// which are not saved if dryRun is set.
+func Merge(ctx context.Context, store storage.Storage, from []string, to string, dryRun bool) ([]*model.Mark, error) {
+	from, err := normalizeAll(from)
+	if err != nil {
+		return nil, err
+	}
+	if to = Normalize(to); to == "" {
+		return nil, errors.Wrap(ErrInvalid, "expect a non-empty target")
+	}
+	for _, f := range from {
+		if IsUnder(to, f) {
+			return nil, errors.Wrap(ErrInvalid, fmt.Sprintf("can't move %q to %q under itself", f, to))
+		}
+	}
+	return update(ctx, store, from, dryRun, func(tags []string) []string {
+		return Replace(tags, from, to)
+	})
+}
+
+// Delete removes the tags and their descendants from all the marks, it returns the changed marks,
+// which are not saved if dryRun is set.
+func Delete(ctx context.Context, store storage.Storage, tags []string, dryRun bool) ([]*model.Mark, error) {
+	tags, err := normalizeAll(tags)
+	if err != nil {
+		return nil, err
+	}
+	return update(ctx, store, tags, dryRun, func(current []string) []string {
+		return Remove(current, tags)
+	})
+}
+
+// update sets the tags of the marks that have any of the tags to the result of fn,
+// only the marks whose tags are changed are updated.
+func update(ctx context.Context, store storage.Storage, tags []string, dryRun bool, fn func(tags []string) []string) ([]*model.Mark, error) {
+	marks, err := store.GetMarks(ctx, Filter(tags), nil)
+	if err != nil {
+		return nil, err
+	}
+	var changed []*model.Mark
+	for _, mark := range marks {
+		updated := fn(mark.Tags)
+		if util.StringSlicesEqual(updated, mark.Tags) {
+			continue
+		}
+		if !dryRun {
+			if err := store.UpdateOneMark(ctx, mark.ID, &model.MarkPatch{Mark: &model.Mark{Tags: updated}, Fields: []string{"tags"}}); err != nil {
+				return nil, err
+			}
+		}
+		mark.Tags = updated
+		changed = append(changed, mark)
+	}
+	return changed, nil
+}
@@ -0,0 +1,184 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package tag
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// fakeStorage keeps the marks in memory, it only supports the filters of the tags.
+type fakeStorage struct {
+	storage.Storage
+	marks []*model.Mark
+}
+
+func matches(mark *model.Mark, filter bson.M) bool {
+	if cond, ok := filter["tags"].(bson.M); ok {
+		re := regexp.MustCompile(cond["$regex"].(string))
+		found := false
+		for _, tag := range mark.Tags {
+			found = found || re.MatchString(tag)
+		}
+		if !found {
+			return false
+		}
+	}
+	conds, _ := filter["$and"].([]interface{})
+	for _, cond := range conds {
+		if !matches(mark, cond.(bson.M)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *fakeStorage) match(filter interface{}) []*model.Mark {
+	var marks []*model.Mark
+	for _, mark := range f.marks {
+		if matches(mark, filter.(bson.M)) {
+			copied := *mark
+			marks = append(marks, &copied)
+		}
+	}
+	return marks
+}
+
+func (f *fakeStorage) GetMarks(ctx context.Context, filter interface{}, opts *storage.QueryOptions) ([]*model.Mark, error) {
+	return f.match(filter), nil
+}
+
+func (f *fakeStorage) CountMarks(ctx context.Context, filter interface{}) (int, error) {
+	return len(f.match(filter)), nil
+}
+
+func (f *fakeStorage) AggregateMarks(ctx context.Context, filter interface{}, opts *storage.AggregateOptions) ([]*storage.Group, error) {
+	return storage.GroupMarks(f.match(filter), opts)
+}
+
+func (f *fakeStorage) UpdateOneMark(ctx context.Context, id string, patch *model.MarkPatch) error {
+	for _, mark := range f.marks {
+		if mark.ID == id {
+			patch.Apply(mark)
+		}
+	}
+	return nil
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{marks: []*model.Mark{
+		{ID: "a", Tags: []string{"philosophy", "philosophy/stoicism"}},
+		{ID: "b", Tags: []string{"philosophy/stoicism/ethics", "novel"}},
+		{ID: "c", Tags: []string{"stoa"}},
+		{ID: "d"},
+	}}
+}
+
+func TestList(t *testing.T) {
+	tests := []struct {
+		under  string
+		counts []*Count
+	}{
+		{
+			counts: []*Count{
+				{Name: "novel", Count: 1, Total: 1},
+				{Name: "philosophy", Count: 1, Total: 2},
+				{Name: "philosophy/stoicism", Parent: "philosophy", Count: 1, Total: 2},
+				{Name: "philosophy/stoicism/ethics", Parent: "philosophy/stoicism", Count: 1, Total: 1},
+				{Name: "stoa", Count: 1, Total: 1},
+			},
+		},
+		{
+			under: "philosophy/stoicism",
+			counts: []*Count{
+				{Name: "philosophy/stoicism", Parent: "philosophy", Count: 1, Total: 2},
+				{Name: "philosophy/stoicism/ethics", Parent: "philosophy/stoicism", Count: 1, Total: 1},
+			},
+		},
+		{under: "poem"},
+	}
+	for i, tt := range tests {
+		counts, err := List(context.Background(), newFakeStorage(), nil, tt.under)
+		assert.NoError(t, err, "case #%d", i)
+		assert.Equal(t, tt.counts, counts, "case #%d", i)
+	}
+}
+
+func TestOperations(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		run     func(store storage.Storage) ([]*model.Mark, error)
+		changed []string
+		tags    map[string][]string
+		err     bool
+	}{
+		{
+			run: func(store storage.Storage) ([]*model.Mark, error) {
+				return Rename(ctx, store, "philosophy/stoicism", "stoicism", false)
+			},
+			changed: []string{"a", "b"},
+			tags:    map[string][]string{"a": {"philosophy", "stoicism"}, "b": {"stoicism/ethics", "novel"}},
+		},
+		{
+			run: func(store storage.Storage) ([]*model.Mark, error) {
+				return Merge(ctx, store, []string{"stoa", " philosophy / stoicism "}, "stoicism", true)
+			},
+			changed: []string{"a", "b", "c"},
+			tags:    map[string][]string{"a": {"philosophy", "philosophy/stoicism"}, "c": {"stoa"}},
+		},
+		{
+			run: func(store storage.Storage) ([]*model.Mark, error) {
+				return Merge(ctx, store, []string{"stoa", "philosophy/stoicism"}, "stoicism", false)
+			},
+			changed: []string{"a", "b", "c"},
+			tags:    map[string][]string{"a": {"philosophy", "stoicism"}, "c": {"stoicism"}},
+		},
+		{
+			run: func(store storage.Storage) ([]*model.Mark, error) {
+				return Delete(ctx, store, []string{"philosophy"}, false)
+			},
+			changed: []string{"a", "b"},
+			tags:    map[string][]string{"a": {}, "b": {"novel"}, "c": {"stoa"}},
+		},
+		{
+			run: func(store storage.Storage) ([]*model.Mark, error) {
+				return Rename(ctx, store, "philosophy", "philosophy/old", false)
+			},
+			err: true,
+		},
+		{
+			run: func(store storage.Storage) ([]*model.Mark, error) {
+				return Delete(ctx, store, []string{"/"}, false)
+			},
+			err: true,
+		},
+	}
+	for i, tt := range tests {
+		store := newFakeStorage()
+		marks, err := tt.run(store)
+		if tt.err {
+			assert.ErrorIs(t, err, ErrInvalid, "case #%d", i)
+			continue
+		}
+		assert.NoError(t, err, "case #%d", i)
+		var changed []string
+		for _, mark := range marks {
+			changed = append(changed, mark.ID)
+		}
+		assert.Equal(t, tt.changed, changed, "case #%d", i)
+		for _, mark := range store.marks {
+			if tags, ok := tt.tags[mark.ID]; ok {
+				assert.Equal(t, tags, mark.Tags, "case #%d: %s", i, mark.ID)
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+// Package tag manages the tags of the marks, which are hierarchical with the levels separated
+// by "/", e.g. "philosophy/stoicism" is under "philosophy".
+package tag
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Separator separates the levels of the tags.
+const Separator = "/"
+
+// ErrInvalid is wrapped by the errors of the invalid tags in the operations.
+var ErrInvalid = errors.New("invalid tag")
+
+// Normalize trims the spaces around the levels of the tag and drops the empty levels,
+// e.g. " philosophy / stoicism/" becomes "philosophy/stoicism".
+func Normalize(tag string) string {
+	var levels []string
+	for _, level := range strings.Split(tag, Separator) {
+		if level = strings.TrimSpace(level); level != "" {
+			levels = append(levels, level)
+		}
+	}
+	return strings.Join(levels, Separator)
+}
+
+// normalizeAll normalizes the tags, and returns an error if any of them is empty.
+func normalizeAll(tags []string) ([]string, error) {
+	var ret []string
+	for _, tag := range tags {
+		normalized := Normalize(tag)
+		if normalized == "" {
+			return nil, errors.Wrap(ErrInvalid, fmt.Sprintf("%q", tag))
+		}
+		ret = append(ret, normalized)
+	}
+	if len(ret) == 0 {
+		return nil, errors.Wrap(ErrInvalid, "expect at least one tag")
+	}
+	return ret, nil
+}
+
+// Parent returns the parent of the tag, or "" if it's at the top level.
+func Parent(tag string) string {
+	if i := strings.LastIndex(tag, Separator); i >= 0 {
+		return tag[:i]
+	}
+	return ""
+}
+
+// Ancestors returns the ancestors of the tag from the top level, e.g. ["a", "a/b"] for "a/b/c".
+func Ancestors(tag string) []string {
+	var ret []string
+	levels := strings.Split(tag, Separator)
+	for i := 1; i < len(levels); i++ {
+		ret = append(ret, strings.Join(levels[:i], Separator))
+	}
+	return ret
+}
+
+// IsUnder returns whether the tag is the ancestor or one of its descendants.
+func IsUnder(tag, ancestor string) bool {
+	return tag == ancestor || strings.HasPrefix(tag, ancestor+Separator)
+}
+
+// Replace replaces the tags that are under any of from with to, keeping their descendant levels,
+// e.g. "stoa/ethics" becomes "stoicism/ethics" when "stoa" is replaced with "stoicism".
+// The duplicates are removed and the order is kept.
+func Replace(tags, from []string, to string) []string {
+	ret := []string{}
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		for _, f := range from {
+			if IsUnder(tag, f) {
+				tag = to + tag[len(f):]
+				break
+			}
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			ret = append(ret, tag)
+		}
+	}
+	return ret
+}
+
+// Remove removes the tags that are under any of removed.
+func Remove(tags, removed []string) []string {
+	ret := []string{}
+	for _, tag := range tags {
+		keep := true
+		for _, r := range removed {
+			keep = keep && !IsUnder(tag, r)
+		}
+		if keep {
+			ret = append(ret, tag)
+		}
+	}
+	return ret
+}
+
+// Filter returns the storage filter of the marks that have any of the tags or their descendants.
+func Filter(tags []string) bson.M {
+	var patterns []string
+	for _, tag := range tags {
+		patterns = append(patterns, regexp.QuoteMeta(tag))
+	}
+	return bson.M{"tags": bson.M{"$regex": "^(" + strings.Join(patterns, "|") + ")(" + regexp.QuoteMeta(Separator) + "|$)"}}
+}
+
+// withFilter adds the tag filter to the filter of the marks, in its "$and" conditions.
+func withFilter(filter bson.M, tags []string) bson.M {
+	ret := bson.M{}
+	for key, val := range filter {
+		ret[key] = val
+	}
+	var and []interface{}
+	switch conds := ret["$and"].(type) {
+	case []interface{}:
+		and = append(and, conds...)
+	case []bson.M:
+		for _, cond := range conds {
+			and = append(and, cond)
+		}
+	}
+	ret["$and"] = append(and, Filter(tags))
+	return ret
+}
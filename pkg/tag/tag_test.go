@@ -0,0 +1,74 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package tag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		tag    string
+		result string
+	}{
+		{tag: "philosophy", result: "philosophy"},
+		{tag: " philosophy / stoicism/", result: "philosophy/stoicism"},
+		{tag: "a//b", result: "a/b"},
+		{tag: " / ", result: ""},
+	}
+	for i, tt := range tests {
+		assert.Equal(t, tt.result, Normalize(tt.tag), "case #%d", i)
+	}
+}
+
+func TestHierarchy(t *testing.T) {
+	assert.Equal(t, "", Parent("a"))
+	assert.Equal(t, "a/b", Parent("a/b/c"))
+	assert.Nil(t, Ancestors("a"))
+	assert.Equal(t, []string{"a", "a/b"}, Ancestors("a/b/c"))
+	assert.True(t, IsUnder("a", "a"))
+	assert.True(t, IsUnder("a/b", "a"))
+	assert.False(t, IsUnder("ab", "a"))
+	assert.False(t, IsUnder("a", "a/b"))
+}
+
+func TestReplaceAndRemove(t *testing.T) {
+	tests := []struct {
+		tags    []string
+		from    []string
+		to      string
+		replace []string
+		remove  []string
+	}{
+		{
+			tags:    []string{"stoa", "stoa/ethics", "stoic", "novel"},
+			from:    []string{"stoa"},
+			to:      "philosophy/stoicism",
+			replace: []string{"philosophy/stoicism", "philosophy/stoicism/ethics", "stoic", "novel"},
+			remove:  []string{"stoic", "novel"},
+		},
+		{
+			tags:    []string{"a", "b", "c"},
+			from:    []string{"a", "b"},
+			to:      "c",
+			replace: []string{"c"},
+			remove:  []string{"c"},
+		},
+		{
+			tags:    []string{"x"},
+			from:    []string{"a"},
+			to:      "b",
+			replace: []string{"x"},
+			remove:  []string{"x"},
+		},
+	}
+	for i, tt := range tests {
+		assert.Equal(t, tt.replace, Replace(tt.tags, tt.from, tt.to), "case #%d", i)
+		assert.Equal(t, tt.remove, Remove(tt.tags, tt.from), "case #%d", i)
+	}
+}
@@ -0,0 +1,119 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/yifan-gu/blueNote/pkg/model"
+)
+
+// Transform modifies the books between the parser and the exporter.
+type Transform interface {
+	Name() string
+	Apply(books []*model.Book) ([]*model.Book, error)
+}
+
+// Factory creates a transform with the given arguments.
+type Factory func(args Args) (Transform, error)
+
+// Args are the arguments of a transform, e.g. "title=foo,author=bar" in "override:title=foo,author=bar".
+type Args map[string]string
+
+// Values returns the "|" separated values of the argument.
+func (a Args) Values(key string) []string {
+	val, ok := a[key]
+	if !ok || val == "" {
+		return nil
+	}
+	return strings.Split(val, "|")
+}
+
+// Chain is a list of transforms that are applied in order.
+type Chain []Transform
+
+func (c Chain) Apply(books []*model.Book) ([]*model.Book, error) {
+	var err error
+	for _, t := range c {
+		if books, err = t.Apply(books); err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to apply transform %q", t.Name()))
+		}
+	}
+	return books, nil
+}
+
+// Registry holds the transform factories by their names.
+type Registry struct {
+	factories map[string]Factory
+}
+
+func NewRegistry() *Registry {
+	return &Registry{factories: make(map[string]Factory)}
+}
+
+func (r *Registry) Register(name string, factory Factory) error {
+	name = strings.ToLower(name)
+	if _, ok := r.factories[name]; ok {
+		return errors.New(fmt.Sprintf("Name conflict for transform %q", name))
+	}
+	r.factories[name] = factory
+	return nil
+}
+
+func (r *Registry) List() []string {
+	var names []string
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates a transform from a spec in the form of "name[:key=value,key=value...]".
+func (r *Registry) New(spec string) (Transform, error) {
+	name, argStr := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		name, argStr = spec[:i], spec[i+1:]
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	factory, ok := r.factories[name]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("unrecognized transform type: %q", name))
+	}
+
+	args := make(Args)
+	for _, kv := range strings.Split(argStr, ",") {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+		tuples := strings.SplitN(kv, "=", 2)
+		if len(tuples) != 2 {
+			return nil, errors.New(fmt.Sprintf("invalid argument %q for transform %q, expecting key=value", kv, name))
+		}
+		args[strings.TrimSpace(tuples[0])] = tuples[1]
+	}
+	t, err := factory(args)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("invalid arguments for transform %q", name))
+	}
+	return t, nil
+}
+
+// NewChain creates a chain of transforms from the specs.
+func (r *Registry) NewChain(specs []string) (Chain, error) {
+	var chain Chain
+	for _, spec := range specs {
+		t, err := r.New(spec)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, t)
+	}
+	return chain, nil
+}
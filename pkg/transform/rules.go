@@ -0,0 +1,426 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package transform
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/yifan-gu/blueNote/pkg/config"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+	"github.com/yifan-gu/blueNote/pkg/tag"
+	"github.com/yifan-gu/blueNote/pkg/util"
+)
+
+// Rule tags the marks and sets their fields if they match all the conditions of the rule.
+type Rule struct {
+	Name string
+	// Title, Author and Chapter are case-insensitive regular expressions.
+	Title   *regexp.Regexp
+	Author  *regexp.Regexp
+	Chapter *regexp.Regexp
+	// Text are the lower-cased keywords, any of which is in the data or the note.
+	Text  []string
+	Types map[string]bool
+	// NotePrefix takes the leading words of the note with the prefix as the tags, e.g. ".philosophy"
+	// becomes "philosophy" with the prefix ".", the mark matches only if there is such a word.
+	NotePrefix string
+	// StripNote removes the words of the tags from the note, unless nothing would be left.
+	StripNote bool
+	Tags      []string
+	// Set are the values of the fields to set, the keys are in setFields.
+	Set map[string]string
+}
+
+// Rules are applied in order, a mark can match any number of them.
+type Rules []*Rule
+
+var (
+	ruleKeys  = []string{"name", "title", "author", "chapter", "text", "type", "note-prefix", "strip-note", "tags", "set"}
+	setFields = []string{"title", "author", "section", "chapter", "type"}
+)
+
+// LoadRules loads the rules from a TOML file.
+func LoadRules(path string) (Rules, error) {
+	path, err := util.ResolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	rules, err := ParseRules(b)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to parse the rules file %q", path))
+	}
+	return rules, nil
+}
+
+// ParseRules parses the rules in TOML, each rule is a [[rules]] table, e.g.
+//
+//	[[rules]]
+//	name = "stoicism"
+//	author = "Aurelius|Seneca"
+//	text = ["virtue", "fate"]
+//	type = ["HIGHLIGHT"]
+//	tags = ["philosophy/stoicism"]
+//	set = { author = "Marcus Aurelius" }
+//
+//	[[rules]]
+//	note-prefix = "."
+//	strip-note = true
+func ParseRules(data []byte) (Rules, error) {
+	doc, err := config.ParseTOML(data)
+	if err != nil {
+		return nil, err
+	}
+	for key := range doc {
+		if key != "rules" {
+			return nil, errors.New(fmt.Sprintf("unknown table %q, expecting [[rules]]", key))
+		}
+	}
+	tables, ok := doc["rules"].([]interface{})
+	if !ok {
+		return nil, errors.New("expect the rules in [[rules]] tables")
+	}
+	var rules Rules
+	for i, t := range tables {
+		table, ok := t.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("expect the rules in [[rules]] tables")
+		}
+		rule, err := parseRule(table)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("invalid rule #%d", i))
+		}
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("#%d", i)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func parseRule(table map[string]interface{}) (*Rule, error) {
+	rule := &Rule{}
+	for key, val := range table {
+		var err error
+		switch key {
+		case "name":
+			rule.Name, err = tomlString(key, val)
+		case "title":
+			rule.Title, err = tomlRegexp(key, val)
+		case "author":
+			rule.Author, err = tomlRegexp(key, val)
+		case "chapter":
+			rule.Chapter, err = tomlRegexp(key, val)
+		case "text":
+			var text []string
+			text, err = tomlStrings(key, val)
+			for _, keyword := range text {
+				rule.Text = append(rule.Text, strings.ToLower(keyword))
+			}
+		case "type":
+			var types []string
+			types, err = tomlStrings(key, val)
+			for _, typ := range types {
+				typ = strings.ToUpper(typ)
+				if err = model.ValidateType(typ); err != nil {
+					break
+				}
+				if rule.Types == nil {
+					rule.Types = make(map[string]bool)
+				}
+				rule.Types[typ] = true
+			}
+		case "note-prefix":
+			rule.NotePrefix, err = tomlString(key, val)
+		case "strip-note":
+			var ok bool
+			if rule.StripNote, ok = val.(bool); !ok {
+				err = errors.New(fmt.Sprintf("expect a boolean for %q, got %T", key, val))
+			}
+		case "tags":
+			var tags []string
+			tags, err = tomlStrings(key, val)
+			for _, t := range tags {
+				if t = tag.Normalize(t); t != "" {
+					rule.Tags = append(rule.Tags, t)
+				}
+			}
+		case "set":
+			rule.Set, err = parseSet(val)
+		default:
+			err = errors.New(fmt.Sprintf("unknown key %q, expecting one of %v", key, ruleKeys))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(rule.Tags) == 0 && len(rule.Set) == 0 && rule.NotePrefix == "" {
+		return nil, errors.New("expect 'tags', 'set' or 'note-prefix' to be set")
+	}
+	return rule, nil
+}
+
+func parseSet(val interface{}) (map[string]string, error) {
+	table, ok := val.(map[string]interface{})
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("expect a table for \"set\", got %T", val))
+	}
+	set := make(map[string]string)
+	for key, v := range table {
+		found := false
+		for _, f := range setFields {
+			found = found || f == key
+		}
+		if !found {
+			return nil, errors.New(fmt.Sprintf("unknown field %q to set, expecting one of %v", key, setFields))
+		}
+		s, err := tomlString(key, v)
+		if err != nil {
+			return nil, err
+		}
+		if key == "type" {
+			s = strings.ToUpper(s)
+			if err := model.ValidateType(s); err != nil {
+				return nil, err
+			}
+		}
+		set[key] = s
+	}
+	return set, nil
+}
+
+func tomlString(key string, val interface{}) (string, error) {
+	s, ok := val.(string)
+	if !ok {
+		return "", errors.New(fmt.Sprintf("expect a string for %q, got %T", key, val))
+	}
+	return s, nil
+}
+
+// tomlStrings accepts a string or an array of strings.
+func tomlStrings(key string, val interface{}) ([]string, error) {
+	if s, ok := val.(string); ok {
+		return []string{s}, nil
+	}
+	list, ok := val.([]interface{})
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("expect a string or an array of strings for %q, got %T", key, val))
+	}
+	var ret []string
+	for _, item := range list {
+		s, err := tomlString(key, item)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, s)
+	}
+	return ret, nil
+}
+
+func tomlRegexp(key string, val interface{}) (*regexp.Regexp, error) {
+	s, err := tomlString(key, val)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile("(?i)" + s)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("invalid regular expression for %q", key))
+	}
+	return re, nil
+}
+
+// noteTags splits the leading words of the note with the prefix from the rest of the note.
+func noteTags(note, prefix string) ([]string, string) {
+	var tags []string
+	rest := strings.TrimLeftFunc(note, unicode.IsSpace)
+	for strings.HasPrefix(rest, prefix) {
+		word := rest
+		if i := strings.IndexFunc(rest, unicode.IsSpace); i >= 0 {
+			word = rest[:i]
+		}
+		if t := tag.Normalize(strings.TrimPrefix(word, prefix)); t != "" {
+			tags = append(tags, t)
+		}
+		rest = strings.TrimLeftFunc(rest[len(word):], unicode.IsSpace)
+	}
+	return tags, rest
+}
+
+// apply applies the rule to the mark of the book with the title and the author,
+// it returns whether the mark matches.
+func (r *Rule) apply(mk *model.Mark, title, author string) bool {
+	var chapter string
+	if mk.Location != nil {
+		chapter = mk.Location.Chapter
+	}
+	switch {
+	case r.Types != nil && !r.Types[mk.Type]:
+		return false
+	case r.Title != nil && !r.Title.MatchString(title):
+		return false
+	case r.Author != nil && !r.Author.MatchString(author):
+		return false
+	case r.Chapter != nil && !r.Chapter.MatchString(chapter):
+		return false
+	}
+	if len(r.Text) > 0 {
+		text := strings.ToLower(mk.Data + "\n" + mk.UserNote)
+		found := false
+		for _, keyword := range r.Text {
+			found = found || strings.Contains(text, keyword)
+		}
+		if !found {
+			return false
+		}
+	}
+	tags := r.Tags
+	if r.NotePrefix != "" {
+		fromNote, rest := noteTags(mk.UserNote, r.NotePrefix)
+		if len(fromNote) == 0 {
+			return false
+		}
+		tags = append(append([]string{}, tags...), fromNote...)
+		if r.StripNote && (rest != "" || mk.Data != "") {
+			mk.UserNote = rest
+		}
+	}
+
+	if len(tags) > 0 {
+		mk.Tags = util.MergeStrings(mk.Tags, tags)
+	}
+	for field, val := range r.Set {
+		switch field {
+		case "title":
+			mk.Title = val
+		case "author":
+			mk.Author = val
+		case "section":
+			mk.Section = val
+		case "type":
+			mk.Type = val
+		case "chapter":
+			if mk.Location == nil {
+				mk.Location = &model.Location{}
+			}
+			mk.Location.Chapter = val
+		}
+	}
+	return true
+}
+
+// Apply applies the rules to the mark, and returns the names of the matched rules.
+func (rs Rules) Apply(mk *model.Mark) []string {
+	return rs.applyWith(mk, mk.Title, mk.Author)
+}
+
+func (rs Rules) applyWith(mk *model.Mark, title, author string) []string {
+	var matched []string
+	for _, r := range rs {
+		if r.apply(mk, title, author) {
+			matched = append(matched, r.Name)
+		}
+	}
+	return matched
+}
+
+type autoTagTransform struct {
+	rules Rules
+}
+
+// NewAutoTag creates a transform that tags the marks and sets their fields by the rules
+// in a TOML file, e.g. "auto-tag:file=rules.toml", see ParseRules for the format.
+func NewAutoTag(args Args) (Transform, error) {
+	if err := args.check("file"); err != nil {
+		return nil, err
+	}
+	if args["file"] == "" {
+		return nil, errors.New("expect 'file' to be set")
+	}
+	rules, err := LoadRules(args["file"])
+	if err != nil {
+		return nil, err
+	}
+	return &autoTagTransform{rules: rules}, nil
+}
+
+func (t *autoTagTransform) Name() string { return "auto-tag" }
+
+func (t *autoTagTransform) Apply(books []*model.Book) ([]*model.Book, error) {
+	for _, bk := range books {
+		for _, mk := range bk.Marks {
+			t.rules.applyWith(mk, bk.Title, bk.Author)
+		}
+	}
+	return books, nil
+}
+
+// RuleChange is a mark changed by the rules.
+type RuleChange struct {
+	Mark *model.Mark `json:"mark"`
+	// Rules are the names of the matched rules.
+	Rules []string `json:"rules"`
+	// AddedTags are the tags added to the mark.
+	AddedTags []string `json:"addedTags,omitempty"`
+}
+
+// ApplyToStorage applies the rules to the marks in the storage that match the filter, and returns
+// the changed marks as they are after the rules, which are not saved if dryRun is set.
+func (rs Rules) ApplyToStorage(ctx context.Context, store storage.Storage, filter interface{}, dryRun bool) ([]*RuleChange, error) {
+	marks, err := store.GetMarks(ctx, filter, nil)
+	if err != nil {
+		return nil, err
+	}
+	var changes []*RuleChange
+	for _, mark := range marks {
+		original := *mark
+		original.Tags = append([]string(nil), mark.Tags...)
+		if mark.Location != nil {
+			location := *mark.Location
+			original.Location = &location
+		}
+		matched := rs.Apply(mark)
+		fields := changedFields(&original, mark)
+		if len(matched) == 0 || len(fields) == 0 {
+			continue
+		}
+		if err := model.ValidateMark(mark); err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("invalid mark %q after the rules %v", mark.ID, matched))
+		}
+		if !dryRun {
+			if err := store.UpdateOneMark(ctx, mark.ID, &model.MarkPatch{Mark: mark, Fields: fields}); err != nil {
+				return nil, err
+			}
+		}
+		added := util.SubtractStrings(mark.Tags, original.Tags)
+		sort.Strings(added)
+		changes = append(changes, &RuleChange{Mark: mark, Rules: matched, AddedTags: added})
+	}
+	return changes, nil
+}
+
+// changedFields returns the fields that are different between the marks, in the order of model.MarkFields.
+func changedFields(a, b *model.Mark) []string {
+	valuesA, valuesB := model.FieldValues(a), model.FieldValues(b)
+	var fields []string
+	for _, field := range model.MarkFields {
+		if !reflect.DeepEqual(valuesA[field], valuesB[field]) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,160 @@
+package transform
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/storage"
+)
+
+const testRules = `
+[[rules]]
+name = "stoicism"
+author = "aurelius|seneca"
+text = ["Virtue", "fate"]
+tags = ["philosophy/stoicism"]
+
+[[rules]]
+name = "notes"
+note-prefix = "."
+strip-note = true
+
+[[rules]]
+name = "chapter"
+chapter = "^Book \\d+$"
+type = "highlight"
+set = { section = "Meditations", type = "NOTE" }
+`
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules([]byte(testRules))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(rules))
+	assert.Equal(t, []string{"virtue", "fate"}, rules[0].Text)
+	assert.Equal(t, map[string]bool{model.MarkTypeHighlight: true}, rules[2].Types)
+	assert.Equal(t, map[string]string{"section": "Meditations", "type": model.MarkTypeNote}, rules[2].Set)
+
+	for i, data := range []string{
+		"[other]\nname = \"x\"",
+		"[[rules]]\nname = \"no actions\"",
+		"[[rules]]\ntags = \"a\"\nunknown = 1",
+		"[[rules]]\ntags = \"a\"\ntitle = \"(\"",
+		"[[rules]]\ntags = \"a\"\ntype = \"unknown\"",
+		"[[rules]]\nset = { data = \"x\" }",
+		"rules = [\"a\"]",
+		"rules = [1, 2]",
+	} {
+		_, err := ParseRules([]byte(data))
+		assert.Error(t, err, "case #%d", i)
+	}
+}
+
+func TestApplyRules(t *testing.T) {
+	rules, err := ParseRules([]byte(testRules))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		mark    *model.Mark
+		matched []string
+		result  *model.Mark
+	}{
+		{
+			mark:    &model.Mark{Type: model.MarkTypeHighlight, Author: "Marcus Aurelius", Data: "Accept your FATE", Tags: []string{"quote"}},
+			matched: []string{"stoicism"},
+			result:  &model.Mark{Type: model.MarkTypeHighlight, Author: "Marcus Aurelius", Data: "Accept your FATE", Tags: []string{"quote", "philosophy/stoicism"}},
+		},
+		{
+			mark:   &model.Mark{Type: model.MarkTypeHighlight, Author: "Seneca", Data: "On the shortness of life"},
+			result: &model.Mark{Type: model.MarkTypeHighlight, Author: "Seneca", Data: "On the shortness of life"},
+		},
+		{
+			mark:    &model.Mark{Type: model.MarkTypeNote, Data: "data", UserNote: " .philosophy .a/b  keep this\nnote"},
+			matched: []string{"notes"},
+			result:  &model.Mark{Type: model.MarkTypeNote, Data: "data", UserNote: "keep this\nnote", Tags: []string{"philosophy", "a/b"}},
+		},
+		{
+			// The note is kept if nothing would be left.
+			mark:    &model.Mark{Type: model.MarkTypeNote, UserNote: ".todo"},
+			matched: []string{"notes"},
+			result:  &model.Mark{Type: model.MarkTypeNote, UserNote: ".todo", Tags: []string{"todo"}},
+		},
+		{
+			mark:    &model.Mark{Type: model.MarkTypeHighlight, Data: "x", Location: &model.Location{Chapter: "book 2"}},
+			matched: []string{"chapter"},
+			result:  &model.Mark{Type: model.MarkTypeNote, Section: "Meditations", Data: "x", Location: &model.Location{Chapter: "book 2"}},
+		},
+	}
+	for i, tt := range tests {
+		assert.Equal(t, tt.matched, rules.Apply(tt.mark), "case #%d", i)
+		assert.Equal(t, tt.result, tt.mark, "case #%d", i)
+	}
+}
+
+func TestAutoTag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.toml")
+	assert.NoError(t, os.WriteFile(path, []byte("[[rules]]\ntitle = \"book b\"\ntags = [\"b\"]\n"), 0644))
+
+	_, err := newTestRegistry().New("auto-tag")
+	assert.Error(t, err)
+
+	tr, err := newTestRegistry().New("auto-tag:file=" + path)
+	assert.NoError(t, err)
+	books, err := tr.Apply(newTestBooks())
+	assert.NoError(t, err)
+	assert.Nil(t, books[0].Marks[0].Tags)
+	assert.Equal(t, []string{"b"}, books[1].Marks[0].Tags)
+}
+
+// fakeStorage keeps the marks in memory, it ignores the filters.
+type fakeStorage struct {
+	storage.Storage
+	marks   []*model.Mark
+	updated []string
+	fields  [][]string
+}
+
+func (f *fakeStorage) GetMarks(ctx context.Context, filter interface{}, opts *storage.QueryOptions) ([]*model.Mark, error) {
+	var marks []*model.Mark
+	for _, mark := range f.marks {
+		copied := *mark
+		marks = append(marks, &copied)
+	}
+	return marks, nil
+}
+
+func (f *fakeStorage) UpdateOneMark(ctx context.Context, id string, patch *model.MarkPatch) error {
+	f.updated = append(f.updated, id)
+	f.fields = append(f.fields, patch.Fields)
+	return nil
+}
+
+func TestApplyToStorage(t *testing.T) {
+	rules, err := ParseRules([]byte(testRules))
+	assert.NoError(t, err)
+	store := &fakeStorage{marks: []*model.Mark{
+		{ID: "a", Type: model.MarkTypeHighlight, Title: "Meditations", Author: "Marcus Aurelius", Data: "virtue", Tags: []string{"philosophy/stoicism"}},
+		{ID: "b", Type: model.MarkTypeNote, Title: "Letters", Author: "Seneca", Data: "fate", UserNote: ".quote"},
+		{ID: "c", Type: model.MarkTypeNote, Title: "Other", Data: "data"},
+	}}
+
+	for i, dryRun := range []bool{true, false} {
+		store.updated, store.fields = nil, nil
+		changes, err := rules.ApplyToStorage(context.Background(), store, nil, dryRun)
+		assert.NoError(t, err, "case #%d", i)
+		assert.Equal(t, 1, len(changes), "case #%d", i)
+		assert.Equal(t, "b", changes[0].Mark.ID, "case #%d", i)
+		assert.Equal(t, []string{"stoicism", "notes"}, changes[0].Rules, "case #%d", i)
+		assert.Equal(t, []string{"philosophy/stoicism", "quote"}, changes[0].AddedTags, "case #%d", i)
+		assert.Equal(t, "", changes[0].Mark.UserNote, "case #%d", i)
+		if dryRun {
+			assert.Nil(t, store.updated, "case #%d", i)
+		} else {
+			assert.Equal(t, []string{"b"}, store.updated, "case #%d", i)
+			assert.Equal(t, [][]string{{"note", "tags"}}, store.fields, "case #%d", i)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/yifan-gu/blueNote/pkg/model"
+	"github.com/yifan-gu/blueNote/pkg/util"
+)
+
+const dateLayout = "2006-01-02"
+
+func (a Args) check(allowed ...string) error {
+	for key := range a {
+		found := false
+		for _, k := range allowed {
+			if key == k {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New(fmt.Sprintf("unknown argument %q, expecting one of %v", key, allowed))
+		}
+	}
+	return nil
+}
+
+// filterMarks keeps the marks that satisfy the keep function, books without marks left are dropped.
+func filterMarks(books []*model.Book, keep func(bk *model.Book, mk *model.Mark) bool) []*model.Book {
+	var result []*model.Book
+	for _, bk := range books {
+		var marks []*model.Mark
+		for _, mk := range bk.Marks {
+			if keep(bk, mk) {
+				marks = append(marks, mk)
+			}
+		}
+		if len(marks) == 0 {
+			continue
+		}
+		bk.Marks = marks
+		result = append(result, bk)
+	}
+	return result
+}
+
+// Override overrides the title and the author of the books and their marks, empty values are ignored.
+func Override(books []*model.Book, title, author string) {
+	for _, bk := range books {
+		if title != "" {
+			bk.Title = title
+		}
+		if author != "" {
+			bk.Author = author
+		}
+		for _, mk := range bk.Marks {
+			if title != "" {
+				mk.Title = title
+			}
+			if author != "" {
+				mk.Author = author
+			}
+		}
+	}
+}
+
+type overrideTransform struct {
+	title  string
+	author string
+}
+
+// NewOverride creates a transform that overrides the title and the author, e.g. "override:title=foo,author=bar".
+func NewOverride(args Args) (Transform, error) {
+	if err := args.check("title", "author"); err != nil {
+		return nil, err
+	}
+	if args["title"] == "" && args["author"] == "" {
+		return nil, errors.New("expect 'title' or 'author' to be set")
+	}
+	return &overrideTransform{title: args["title"], author: args["author"]}, nil
+}
+
+func (t *overrideTransform) Name() string { return "override" }
+
+func (t *overrideTransform) Apply(books []*model.Book) ([]*model.Book, error) {
+	Override(books, t.title, t.author)
+	return books, nil
+}
+
+// timeUnits are the units of the timestamps in milliseconds.
+var timeUnits = map[string]int64{"s": 1000, "ms": 1}
+
+type filterTransform struct {
+	types  map[string]bool
+	book   *regexp.Regexp
+	author *regexp.Regexp
+	// unit is the unit of the creation time of the marks and the timestamps of after and before, in milliseconds.
+	unit   int64
+	after  *int64
+	before *int64
+}
+
+// NewFilter creates a transform that keeps the marks matching all the given conditions,
+// e.g. "filter:type=HIGHLIGHT|NOTE,book=^The,author=Hemingway,after=2022-01-01,before=2023-01-01".
+// The dates are compared with the creation time of the marks, marks without one are dropped by date filters.
+// The creation time is in seconds like the parsers set it, unless "unit=ms" is given, e.g. for the marks
+// from a storage, which also applies to after and before if they are timestamps.
+func NewFilter(args Args) (Transform, error) {
+	if err := args.check("type", "book", "author", "after", "before", "unit"); err != nil {
+		return nil, err
+	}
+	t := &filterTransform{unit: timeUnits["s"]}
+	if args["unit"] != "" {
+		unit, ok := timeUnits[args["unit"]]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("invalid unit %q, expecting \"s\" or \"ms\"", args["unit"]))
+		}
+		t.unit = unit
+	}
+	for _, typ := range args.Values("type") {
+		if t.types == nil {
+			t.types = make(map[string]bool)
+		}
+		t.types[strings.ToUpper(typ)] = true
+	}
+	var err error
+	if args["book"] != "" {
+		if t.book, err = regexp.Compile("(?i)" + args["book"]); err != nil {
+			return nil, errors.Wrap(err, "")
+		}
+	}
+	if args["author"] != "" {
+		if t.author, err = regexp.Compile("(?i)" + args["author"]); err != nil {
+			return nil, errors.Wrap(err, "")
+		}
+	}
+	if args["after"] != "" {
+		if t.after, err = parseDate(args["after"], t.unit); err != nil {
+			return nil, err
+		}
+	}
+	if args["before"] != "" {
+		if t.before, err = parseDate(args["before"], t.unit); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (t *filterTransform) Name() string { return "filter" }
+
+func (t *filterTransform) Apply(books []*model.Book) ([]*model.Book, error) {
+	return filterMarks(books, func(bk *model.Book, mk *model.Mark) bool {
+		if t.types != nil && !t.types[mk.Type] {
+			return false
+		}
+		if t.book != nil && !t.book.MatchString(bk.Title) {
+			return false
+		}
+		if t.author != nil && !t.author.MatchString(bk.Author) {
+			return false
+		}
+		if t.after != nil || t.before != nil {
+			if mk.CreatedAt == nil {
+				return false
+			}
+			createdAt := *mk.CreatedAt * t.unit
+			if t.after != nil && createdAt < *t.after {
+				return false
+			}
+			if t.before != nil && createdAt >= *t.before {
+				return false
+			}
+		}
+		return true
+	}), nil
+}
+
+// parseDate parses a date in the form of "2006-01-02" or a unix timestamp in the unit into unix milliseconds.
+func parseDate(val string, unit int64) (*int64, error) {
+	if ts, err := strconv.ParseInt(val, 10, 64); err == nil {
+		ms := ts * unit
+		return &ms, nil
+	}
+	t, err := time.ParseInLocation(dateLayout, val, time.Local)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("invalid date %q, expecting %q or a unix timestamp", val, dateLayout))
+	}
+	ms := t.UnixMilli()
+	return &ms, nil
+}
+
+type dropBookmarksTransform struct{}
+
+// NewDropBookmarks creates a transform that drops all the bookmarks.
+func NewDropBookmarks(args Args) (Transform, error) {
+	if err := args.check(); err != nil {
+		return nil, err
+	}
+	return &dropBookmarksTransform{}, nil
+}
+
+func (t *dropBookmarksTransform) Name() string { return "drop-bookmarks" }
+
+func (t *dropBookmarksTransform) Apply(books []*model.Book) ([]*model.Book, error) {
+	return filterMarks(books, func(bk *model.Book, mk *model.Mark) bool {
+		return mk.Type != model.MarkTypeBookmark
+	}), nil
+}
+
+type stripWhitespaceTransform struct{}
+
+// NewStripWhitespace creates a transform that trims the text fields and collapses the inner whitespaces.
+func NewStripWhitespace(args Args) (Transform, error) {
+	if err := args.check(); err != nil {
+		return nil, err
+	}
+	return &stripWhitespaceTransform{}, nil
+}
+
+func (t *stripWhitespaceTransform) Name() string { return "strip-whitespace" }
+
+func stripWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func (t *stripWhitespaceTransform) Apply(books []*model.Book) ([]*model.Book, error) {
+	for _, bk := range books {
+		bk.Title = stripWhitespace(bk.Title)
+		bk.Author = stripWhitespace(bk.Author)
+		for _, mk := range bk.Marks {
+			mk.Title = stripWhitespace(mk.Title)
+			mk.Author = stripWhitespace(mk.Author)
+			mk.Section = stripWhitespace(mk.Section)
+			mk.Data = stripWhitespace(mk.Data)
+			mk.UserNote = stripWhitespace(mk.UserNote)
+			if mk.Location != nil {
+				mk.Location.Chapter = stripWhitespace(mk.Location.Chapter)
+			}
+		}
+	}
+	return books, nil
+}
+
+type renameAuthorsTransform struct {
+	mapping map[string]string
+}
+
+// NewRenameAuthors creates a transform that renames the authors with a json mapping file,
+// e.g. "rename-authors:file=authors.json" where the file contains {"old name": "new name"}.
+func NewRenameAuthors(args Args) (Transform, error) {
+	if err := args.check("file"); err != nil {
+		return nil, err
+	}
+	if args["file"] == "" {
+		return nil, errors.New("expect 'file' to be set")
+	}
+	path, err := util.ResolvePath(args["file"])
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	t := &renameAuthorsTransform{}
+	if err := json.Unmarshal(b, &t.mapping); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to parse the mapping file %q", path))
+	}
+	return t, nil
+}
+
+func (t *renameAuthorsTransform) Name() string { return "rename-authors" }
+
+func (t *renameAuthorsTransform) rename(author string) string {
+	if renamed, ok := t.mapping[author]; ok {
+		return renamed
+	}
+	return author
+}
+
+func (t *renameAuthorsTransform) Apply(books []*model.Book) ([]*model.Book, error) {
+	for _, bk := range books {
+		bk.Author = t.rename(bk.Author)
+		for _, mk := range bk.Marks {
+			mk.Author = t.rename(mk.Author)
+		}
+	}
+	return books, nil
+}
+
+// SplitSections turns a book into multiple books, one for each section.
+// It's useful when the input is a book collection.
+func SplitSections(bk *model.Book) []*model.Book {
+	var books []*model.Book
+	var sectionTitles []string
+	sectionMap := make(map[string][]*model.Mark)
+
+	for _, mk := range bk.Marks {
+		if mk.Section != "" {
+			if _, ok := sectionMap[mk.Section]; !ok {
+				sectionTitles = append(sectionTitles, mk.Section)
+			}
+			var chapter string
+			if mk.Location != nil {
+				chapter = mk.Location.Chapter
+			}
+			sectionMap[mk.Section] = append(sectionMap[mk.Section], &model.Mark{
+				Type:      mk.Type,
+				Title:     mk.Section,
+				Author:    bk.Author,
+				Section:   chapter,
+				Location:  mk.Location,
+				Data:      mk.Data,
+				UserNote:  mk.UserNote,
+				Tags:      mk.Tags,
+				CreatedAt: mk.CreatedAt,
+			})
+		}
+	}
+
+	for _, sectionTitle := range sectionTitles {
+		books = append(books, &model.Book{
+			Title:  sectionTitle,
+			Author: bk.Author,
+			Marks:  sectionMap[sectionTitle],
+		})
+	}
+	if len(books) == 0 {
+		books = []*model.Book{bk}
+	}
+
+	return books
+}
+
+type splitSectionsTransform struct{}
+
+// NewSplitSections creates a transform that splits the sections of the books into separate books.
+func NewSplitSections(args Args) (Transform, error) {
+	if err := args.check(); err != nil {
+		return nil, err
+	}
+	return &splitSectionsTransform{}, nil
+}
+
+func (t *splitSectionsTransform) Name() string { return "split-sections" }
+
+func (t *splitSectionsTransform) Apply(books []*model.Book) ([]*model.Book, error) {
+	var result []*model.Book
+	for _, bk := range books {
+		result = append(result, SplitSections(bk)...)
+	}
+	return result, nil
+}
+
+type mergeBooksTransform struct{}
+
+// NewMergeBooks creates a transform that merges the books with the same title and author.
+func NewMergeBooks(args Args) (Transform, error) {
+	if err := args.check(); err != nil {
+		return nil, err
+	}
+	return &mergeBooksTransform{}, nil
+}
+
+func (t *mergeBooksTransform) Name() string { return "merge-books" }
+
+func (t *mergeBooksTransform) Apply(books []*model.Book) ([]*model.Book, error) {
+	return model.MergeBooks(books), nil
+}
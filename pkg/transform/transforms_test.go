@@ -0,0 +1,134 @@
+package transform
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yifan-gu/blueNote/pkg/model"
+)
+
+func newTestRegistry() *Registry {
+	r := NewRegistry()
+	r.Register("override", NewOverride)
+	r.Register("filter", NewFilter)
+	r.Register("drop-bookmarks", NewDropBookmarks)
+	r.Register("strip-whitespace", NewStripWhitespace)
+	r.Register("rename-authors", NewRenameAuthors)
+	r.Register("split-sections", NewSplitSections)
+	r.Register("merge-books", NewMergeBooks)
+	r.Register("auto-tag", NewAutoTag)
+	return r
+}
+
+func newTestBooks() []*model.Book {
+	ts1, ts2 := int64(1524177254), int64(1700000000000)
+	return []*model.Book{
+		{
+			Title:  "Book A",
+			Author: "Author A",
+			Marks: []*model.Mark{
+				{Type: model.MarkTypeHighlight, Title: "Book A", Author: "Author A", Section: "Part 1", Data: "  some   data ", Location: &model.Location{Chapter: "C1"}, CreatedAt: &ts1},
+				{Type: model.MarkTypeBookmark, Title: "Book A", Author: "Author A", Section: "Part 2", Location: &model.Location{}},
+			},
+		},
+		{
+			Title:  "Book B",
+			Author: "Author B",
+			Marks: []*model.Mark{
+				{Type: model.MarkTypeNote, Title: "Book B", Author: "Author B", Data: "data", UserNote: "note", CreatedAt: &ts2},
+			},
+		},
+	}
+}
+
+func marksOf(books []*model.Book) []string {
+	var result []string
+	for _, bk := range books {
+		for _, mk := range bk.Marks {
+			result = append(result, bk.Title+"/"+bk.Author+"/"+mk.Type+"/"+mk.Title+"/"+mk.Author+"/"+mk.Data)
+		}
+	}
+	return result
+}
+
+func TestChain(t *testing.T) {
+	registry := newTestRegistry()
+
+	mapping := filepath.Join(t.TempDir(), "authors.json")
+	b, _ := json.Marshal(map[string]string{"Author B": "Renamed B"})
+	assert.NoError(t, os.WriteFile(mapping, b, 0644))
+
+	tests := []struct {
+		specs  []string
+		result []string
+	}{
+		{
+			specs:  nil,
+			result: []string{"Book A/Author A/HIGHLIGHT/Book A/Author A/  some   data ", "Book A/Author A/BOOKMARK/Book A/Author A/", "Book B/Author B/NOTE/Book B/Author B/data"},
+		},
+		{
+			specs:  []string{"override:title=T", "drop-bookmarks", "strip-whitespace"},
+			result: []string{"T/Author A/HIGHLIGHT/T/Author A/some data", "T/Author B/NOTE/T/Author B/data"},
+		},
+		{
+			specs:  []string{"filter:type=note|highlight,author=b$"},
+			result: []string{"Book B/Author B/NOTE/Book B/Author B/data"},
+		},
+		{
+			specs:  []string{"filter:after=2018-04-01,before=2018-05-01"},
+			result: []string{"Book A/Author A/HIGHLIGHT/Book A/Author A/  some   data "},
+		},
+		{
+			specs:  []string{"filter:after=1524177254,before=1524177255"},
+			result: []string{"Book A/Author A/HIGHLIGHT/Book A/Author A/  some   data "},
+		},
+		{
+			specs:  []string{"filter:after=2023-11-01,unit=ms"},
+			result: []string{"Book B/Author B/NOTE/Book B/Author B/data"},
+		},
+		{
+			specs:  []string{"filter:after=1699999999999,unit=ms"},
+			result: []string{"Book B/Author B/NOTE/Book B/Author B/data"},
+		},
+		{
+			specs:  []string{"rename-authors:file=" + mapping, "filter:book= B$"},
+			result: []string{"Book B/Renamed B/NOTE/Book B/Renamed B/data"},
+		},
+		{
+			specs:  []string{"split-sections"},
+			result: []string{"Part 1/Author A/HIGHLIGHT/Part 1/Author A/  some   data ", "Part 2/Author A/BOOKMARK/Part 2/Author A/", "Book B/Author B/NOTE/Book B/Author B/data"},
+		},
+		{
+			specs:  []string{"override:title=T,author=A", "merge-books"},
+			result: []string{"T/A/HIGHLIGHT/T/A/  some   data ", "T/A/BOOKMARK/T/A/", "T/A/NOTE/T/A/data"},
+		},
+	}
+
+	for i, tt := range tests {
+		chain, err := registry.NewChain(tt.specs)
+		assert.NoError(t, err, "case #%d", i)
+		books, err := chain.Apply(newTestBooks())
+		assert.NoError(t, err, "case #%d", i)
+		assert.Equal(t, tt.result, marksOf(books), "case #%d", i)
+	}
+}
+
+func TestNewChainErrors(t *testing.T) {
+	registry := newTestRegistry()
+
+	for i, specs := range [][]string{
+		{"unknown"},
+		{"override"},
+		{"override:title"},
+		{"filter:foo=bar"},
+		{"filter:after=yesterday"},
+		{"filter:unit=h"},
+		{"drop-bookmarks:foo=bar"},
+	} {
+		_, err := registry.NewChain(specs)
+		assert.Error(t, err, "case #%d", i)
+	}
+}
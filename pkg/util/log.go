@@ -6,42 +6,206 @@ Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
 package util
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
+// LogLevel is the verbosity of the logs.
+type LogLevel int
+
+const (
+	// LogLevelQuiet only logs the warnings and the errors.
+	LogLevelQuiet LogLevel = iota
+	// LogLevelInfo logs the progress and the summaries, it's the default.
+	LogLevelInfo
+	// LogLevelDebug logs everything.
+	LogLevelDebug
+)
+
+const (
+	// LogFormatText prints the logs as plain text.
+	LogFormatText = "text"
+	// LogFormatJSON prints the logs as json objects, one per line.
+	LogFormatJSON = "json"
+)
+
+var logLevelNames = map[string]LogLevel{
+	"quiet": LogLevelQuiet,
+	"info":  LogLevelInfo,
+	"debug": LogLevelDebug,
+}
+
+// logger writes the diagnostics to the stderr, so the stdout is left for the data.
+var logger = struct {
+	sync.Mutex
+	level  LogLevel
+	format string
+	out    io.Writer
+}{
+	level:  LogLevelInfo,
+	format: LogFormatText,
+	out:    os.Stderr,
+}
+
 type stackTracer interface {
 	StackTrace() errors.StackTrace
 }
 
+// Fields are the extra key-value pairs of a structured log entry.
+type Fields map[string]interface{}
+
+// SetLogLevel sets the log level by its name, one of "quiet", "info" and "debug".
+func SetLogLevel(name string) error {
+	level, ok := logLevelNames[strings.ToLower(name)]
+	if !ok {
+		return errors.New(fmt.Sprintf("unrecognized log level %q, expecting one of quiet, info, debug", name))
+	}
+	logger.Lock()
+	defer logger.Unlock()
+	logger.level = level
+	return nil
+}
+
+// SetLogFormat sets the log format, one of "text" and "json".
+func SetLogFormat(format string) error {
+	format = strings.ToLower(format)
+	if format != LogFormatText && format != LogFormatJSON {
+		return errors.New(fmt.Sprintf("unrecognized log format %q, expecting one of text, json", format))
+	}
+	logger.Lock()
+	defer logger.Unlock()
+	logger.format = format
+	return nil
+}
+
+// SetLogOutput sets where the logs are written to, it's the stderr by default.
+func SetLogOutput(w io.Writer) {
+	logger.Lock()
+	defer logger.Unlock()
+	logger.out = w
+}
+
+func logEnabled(level LogLevel) bool {
+	logger.Lock()
+	defer logger.Unlock()
+	return logger.level >= level
+}
+
+func isJSONLog() bool {
+	logger.Lock()
+	defer logger.Unlock()
+	return logger.format == LogFormatJSON
+}
+
+func writeLog(level, msg string, fields Fields) {
+	logger.Lock()
+	defer logger.Unlock()
+
+	msg = strings.TrimRight(msg, "\n")
+	if logger.format == LogFormatJSON {
+		entry := map[string]interface{}{}
+		for k, v := range fields {
+			entry[k] = v
+		}
+		entry["time"] = time.Now().Format(time.RFC3339Nano)
+		entry["level"] = level
+		entry["msg"] = msg
+		b, err := json.Marshal(entry)
+		if err != nil {
+			b = []byte(fmt.Sprintf(`{"level":"error","msg":%q}`, err.Error()))
+		}
+		fmt.Fprintln(logger.out, string(b))
+		return
+	}
+
+	var sb strings.Builder
+	switch level {
+	case "warning":
+		sb.WriteString("Warning: ")
+	case "error":
+		sb.WriteString("Error: ")
+	}
+	sb.WriteString(msg)
+	var keys []string
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		sb.WriteString(fmt.Sprintf(" %s=%v", k, fields[k]))
+	}
+	fmt.Fprintln(logger.out, sb.String())
+}
+
 func Fatal(v ...interface{}) {
-	fmt.Println(v...)
+	writeLog("error", fmt.Sprint(v...), nil)
 	os.Exit(1)
 }
 
+// Log logs the message at the info level.
 func Log(v ...interface{}) {
-	fmt.Println(v...)
+	if logEnabled(LogLevelInfo) {
+		writeLog("info", fmt.Sprintln(v...), nil)
+	}
 }
 
+// Logf logs the formatted message at the info level.
 func Logf(format string, v ...interface{}) {
-	fmt.Printf(format, v...)
+	if logEnabled(LogLevelInfo) {
+		writeLog("info", fmt.Sprintf(format, v...), nil)
+	}
+}
+
+// LogFields logs the message with the structured fields at the info level.
+func LogFields(msg string, fields Fields) {
+	if logEnabled(LogLevelInfo) {
+		writeLog("info", msg, fields)
+	}
+}
+
+func Debug(v ...interface{}) {
+	if logEnabled(LogLevelDebug) {
+		writeLog("debug", fmt.Sprintln(v...), nil)
+	}
+}
+
+func Debugf(format string, v ...interface{}) {
+	if logEnabled(LogLevelDebug) {
+		writeLog("debug", fmt.Sprintf(format, v...), nil)
+	}
 }
 
 func Error(v ...interface{}) {
-	fmt.Println("Error:", fmt.Sprint(v...))
+	writeLog("error", fmt.Sprint(v...), nil)
 }
 
 func Warn(v ...interface{}) {
-	fmt.Println("Warning:", fmt.Sprint(v...))
+	writeLog("warning", fmt.Sprint(v...), nil)
+}
+
+// Output prints the data to the stdout, it's not affected by the log level or format.
+func Output(v ...interface{}) {
+	fmt.Println(v...)
 }
 
 func StackTraceErrorAndExit(err error) {
 	stackTraceableErr, ok := err.(stackTracer)
-	Log(errors.Cause(err))
-	if ok {
-		Logf("%+v\n", stackTraceableErr.StackTrace())
+	cause := errors.Cause(err)
+	switch {
+	case !ok:
+		writeLog("error", cause.Error(), nil)
+	case isJSONLog():
+		writeLog("error", cause.Error(), Fields{"stack": fmt.Sprintf("%+v", stackTraceableErr.StackTrace())})
+	default:
+		writeLog("error", fmt.Sprintf("%v\n%+v", cause, stackTraceableErr.StackTrace()), nil)
 	}
 	os.Exit(1)
 }
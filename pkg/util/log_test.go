@@ -0,0 +1,63 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogLevelsAndFormats(t *testing.T) {
+	buf := new(bytes.Buffer)
+	SetLogOutput(buf)
+	defer func() {
+		SetLogOutput(os.Stderr)
+		SetLogLevel("info")
+		SetLogFormat(LogFormatText)
+	}()
+
+	assert.NoError(t, SetLogLevel("quiet"))
+	Log("info message")
+	Debug("debug message")
+	Warn("warning message")
+	assert.Equal(t, "Warning: warning message\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, SetLogLevel("debug"))
+	Logf("info %d\n", 1)
+	Debugf("debug %d", 2)
+	LogFields("fields", Fields{"b": 2, "a": 1})
+	assert.Equal(t, "info 1\ndebug 2\nfields a=1 b=2\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, SetLogFormat(LogFormatJSON))
+	LogFields("json message", Fields{"count": 3})
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(strings.TrimSpace(buf.String())), &entry))
+	assert.Equal(t, "info", entry["level"])
+	assert.Equal(t, "json message", entry["msg"])
+	assert.Equal(t, float64(3), entry["count"])
+
+	assert.Error(t, SetLogLevel("verbose"))
+	assert.Error(t, SetLogFormat("xml"))
+}
+
+func TestJSONProgress(t *testing.T) {
+	buf := new(bytes.Buffer)
+	SetLogOutput(buf)
+	assert.NoError(t, SetLogFormat(LogFormatJSON))
+	defer func() {
+		SetLogOutput(os.Stderr)
+		SetLogFormat(LogFormatText)
+	}()
+
+	p := NewProgress("task", 200)
+	for i := 1; i <= 200; i++ {
+		p.Update(i)
+	}
+	p.Done()
+	assert.Equal(t, 101, strings.Count(buf.String(), "\n"), "one event per percent from 0 to 100")
+}
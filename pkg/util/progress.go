@@ -0,0 +1,87 @@
+/*
+Copyright © 2022 Yifan Gu <guyifan1121@gmail.com>
+
+*/
+
+package util
+
+import (
+	"fmt"
+	"os"
+)
+
+// Progress reports the progress of a long running task.
+type Progress interface {
+	// Update sets the number of the processed items.
+	Update(current int)
+	// Done finishes the progress.
+	Done()
+}
+
+// NewProgress creates a progress for the task with the total number of items.
+// It draws a progress bar if the stderr is a terminal, emits progress events if the
+// logs are in json, and does nothing otherwise or when the logs are quiet.
+func NewProgress(task string, total int) Progress {
+	switch {
+	case !logEnabled(LogLevelInfo):
+		return noopProgress{}
+	case isJSONLog():
+		return &jsonProgress{task: task, total: total, lastPercent: -1}
+	case IsTerminal(os.Stderr):
+		return &terminalProgress{task: task, total: total}
+	default:
+		return noopProgress{}
+	}
+}
+
+type noopProgress struct{}
+
+func (noopProgress) Update(current int) {}
+func (noopProgress) Done()              {}
+
+func percentage(current, total int) float64 {
+	if total <= 0 {
+		return 100
+	}
+	return float64(current) / float64(total) * 100
+}
+
+type terminalProgress struct {
+	task    string
+	total   int
+	current int
+}
+
+func (p *terminalProgress) Update(current int) {
+	p.current = current
+	logger.Lock()
+	defer logger.Unlock()
+	fmt.Fprintf(logger.out, "\r%s: %.2f%% (%d/%d)", p.task, percentage(current, p.total), current, p.total)
+}
+
+func (p *terminalProgress) Done() {
+	p.Update(p.total)
+	logger.Lock()
+	defer logger.Unlock()
+	fmt.Fprintln(logger.out)
+}
+
+type jsonProgress struct {
+	task        string
+	total       int
+	lastPercent int
+}
+
+// Update emits an event whenever the progress moves forward by at least one percent.
+func (p *jsonProgress) Update(current int) {
+	percent := int(percentage(current, p.total))
+	if percent == p.lastPercent {
+		return
+	}
+	p.lastPercent = percent
+	writeLog("info", "progress", Fields{"task": p.task, "current": current, "total": p.total, "percent": percent})
+}
+
+func (p *jsonProgress) Done() {
+	p.Update(p.total)
+}
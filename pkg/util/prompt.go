@@ -7,6 +7,7 @@ package util
 
 import (
 	"bufio"
+	"fmt"
 	"os"
 	"strings"
 
@@ -24,7 +25,7 @@ func PromptExportOverrideConfirmation(prompt string) (bool, error) {
 
 	reader := bufio.NewReader(os.Stdin)
 	for {
-		Logf("%s [y/n/yes-to-(a)ll/n(o)ne]: ", prompt)
+		fmt.Fprintf(os.Stderr, "%s [y/n/yes-to-(a)ll/n(o)ne]: ", prompt)
 		response, err := reader.ReadString('\n')
 		if err != nil {
 			return false, errors.Wrap(err, "")
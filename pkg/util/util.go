@@ -16,3 +16,31 @@ func StringSlicesEqual(a, b []string) bool {
 	}
 	return true
 }
+
+// MergeStrings appends the strings of b that are not in a, the result has no duplicates.
+func MergeStrings(a, b []string) []string {
+	ret := []string{}
+	seen := make(map[string]bool)
+	for _, s := range append(append([]string{}, a...), b...) {
+		if !seen[s] {
+			seen[s] = true
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+// SubtractStrings returns the strings of a that are not in b.
+func SubtractStrings(a, b []string) []string {
+	ret := []string{}
+	exclude := make(map[string]bool)
+	for _, s := range b {
+		exclude[s] = true
+	}
+	for _, s := range a {
+		if !exclude[s] {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
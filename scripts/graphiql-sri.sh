@@ -0,0 +1,18 @@
+#!/usr/bin/env bash
+
+# Sets the subresource integrity hashes of the assets of the GraphiQL page, so the browsers refuse
+# the assets if the CDN serves anything else. Run it after changing the versions of the assets.
+
+set -euo pipefail
+
+page="${1:-$(dirname "$0")/../pkg/server/graphiql.html}"
+
+for url in $(grep -o 'https://unpkg.com/[^"]*' "$page"); do
+    if ! echo "$url" | grep -qE '@[0-9]+\.[0-9]+\.[0-9]+/'; then
+        echo "Expect an exact version in $url" >&2
+        exit 1
+    fi
+    hash="sha384-$(curl -fsSL "$url" | openssl dgst -sha384 -binary | openssl base64 -A)"
+    sed -i.bak -E "s#\"$url\"( integrity=\"[^\"]*\")?#\"$url\" integrity=\"$hash\"#" "$page"
+done
+rm -f "$page.bak"
@@ -39,4 +39,8 @@ output="$(go run ./... convert -i kindle-my-clippings --json.pretty -ojson \
     "${ROOT_DIR}/examples/My Clippings.txt")"
 echo "${output}" | diff "${ROOT_DIR}/tests/my_clippings_output.json" -
 
+echo "Test parsing 'My Clippings.txt' (stdin)"
+output="$(cat "${ROOT_DIR}/examples/My Clippings.txt" | go run ./... convert -i kindle-my-clippings --json.pretty -ojson -)"
+echo "${output}" | diff "${ROOT_DIR}/tests/my_clippings_output.json" -
+
 echo "PASSED!"